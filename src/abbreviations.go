@@ -0,0 +1,87 @@
+package main
+
+import "strings"
+
+// abbreviations maps the short forms people type in URLs to upstream book
+// IDs. Keys are normalized with NormalizeSlug.
+var abbreviations = map[string]string{
+	"gen": "GEN", "ge": "GEN", "gn": "GEN",
+	"ex": "EXO", "exo": "EXO", "exod": "EXO",
+	"lev": "LEV", "le": "LEV", "lv": "LEV",
+	"num": "NUM", "nu": "NUM", "nm": "NUM", "nb": "NUM",
+	"deut": "DEU", "deu": "DEU", "dt": "DEU",
+	"josh": "JOS", "jos": "JOS", "jsh": "JOS",
+	"judg": "JDG", "jdg": "JDG", "jg": "JDG", "jdgs": "JDG",
+	"ruth": "RUT", "rut": "RUT", "rth": "RUT", "ru": "RUT",
+	"1sam": "1SA", "1sa": "1SA", "1sm": "1SA", "1s": "1SA",
+	"2sam": "2SA", "2sa": "2SA", "2sm": "2SA", "2s": "2SA",
+	"1kgs": "1KI", "1ki": "1KI", "1kin": "1KI", "1k": "1KI",
+	"2kgs": "2KI", "2ki": "2KI", "2kin": "2KI", "2k": "2KI",
+	"1chr": "1CH", "1ch": "1CH", "1chron": "1CH",
+	"2chr": "2CH", "2ch": "2CH", "2chron": "2CH",
+	"ezra": "EZR", "ezr": "EZR",
+	"neh": "NEH", "ne": "NEH",
+	"esth": "EST", "est": "EST", "es": "EST",
+	"job": "JOB", "jb": "JOB",
+	"ps": "PSA", "psa": "PSA", "psalm": "PSA", "pss": "PSA", "psm": "PSA",
+	"prov": "PRO", "pro": "PRO", "prv": "PRO", "pr": "PRO",
+	"eccl": "ECC", "ecc": "ECC", "eccles": "ECC", "qoh": "ECC",
+	"song": "SNG", "sng": "SNG", "sos": "SNG", "songofsongs": "SNG", "canticles": "SNG",
+	"isa": "ISA", "is": "ISA",
+	"jer": "JER", "je": "JER", "jr": "JER",
+	"lam": "LAM", "la": "LAM",
+	"ezek": "EZK", "ezk": "EZK", "eze": "EZK",
+	"dan": "DAN", "da": "DAN", "dn": "DAN",
+	"hos": "HOS", "ho": "HOS",
+	"joel": "JOL", "jol": "JOL", "jl": "JOL",
+	"amos": "AMO", "amo": "AMO", "am": "AMO",
+	"obad": "OBA", "oba": "OBA", "ob": "OBA",
+	"jonah": "JON", "jon": "JON", "jnh": "JON",
+	"mic": "MIC", "mi": "MIC",
+	"nah": "NAM", "nam": "NAM", "na": "NAM",
+	"hab": "HAB", "hb": "HAB",
+	"zeph": "ZEP", "zep": "ZEP", "zp": "ZEP",
+	"hag": "HAG", "hg": "HAG",
+	"zech": "ZEC", "zec": "ZEC", "zc": "ZEC",
+	"mal": "MAL", "ml": "MAL",
+	"matt": "MAT", "mat": "MAT", "mt": "MAT",
+	"mark": "MRK", "mrk": "MRK", "mk": "MRK", "mr": "MRK",
+	"luke": "LUK", "luk": "LUK", "lk": "LUK",
+	"john": "JHN", "jhn": "JHN", "jn": "JHN",
+	"acts": "ACT", "act": "ACT", "ac": "ACT",
+	"rom": "ROM", "ro": "ROM", "rm": "ROM",
+	"1cor": "1CO", "1co": "1CO",
+	"2cor": "2CO", "2co": "2CO",
+	"gal": "GAL", "ga": "GAL",
+	"eph": "EPH", "ephes": "EPH",
+	"phil": "PHP", "php": "PHP", "pp": "PHP",
+	"col": "COL", "co": "COL",
+	"1thess": "1TH", "1th": "1TH", "1thes": "1TH",
+	"2thess": "2TH", "2th": "2TH", "2thes": "2TH",
+	"1tim": "1TI", "1ti": "1TI", "1tm": "1TI",
+	"2tim": "2TI", "2ti": "2TI", "2tm": "2TI",
+	"titus": "TIT", "tit": "TIT", "ti": "TIT",
+	"philem": "PHM", "phm": "PHM", "pm": "PHM",
+	"heb": "HEB", "he": "HEB",
+	"jas": "JAS", "jm": "JAS", "jms": "JAS",
+	"1pet": "1PE", "1pe": "1PE", "1pt": "1PE", "1p": "1PE",
+	"2pet": "2PE", "2pe": "2PE", "2pt": "2PE", "2p": "2PE",
+	"1john": "1JN", "1jn": "1JN", "1jhn": "1JN", "1j": "1JN",
+	"2john": "2JN", "2jn": "2JN", "2jhn": "2JN", "2j": "2JN",
+	"3john": "3JN", "3jn": "3JN", "3jhn": "3JN", "3j": "3JN",
+	"jude": "JUD", "jud": "JUD", "jd": "JUD",
+	"rev": "REV", "re": "REV", "rv": "REV", "revelations": "REV",
+}
+
+// NormalizeSlug lowercases a book slug and drops the spaces and dots people
+// type in abbreviations like "1 Cor.", and the hyphens in canonical slugs, so
+// "song-of-solomon" and "songofsolomon" compare equal.
+func NormalizeSlug(slug string) string {
+	return strings.NewReplacer(" ", "", ".", "", "-", "").Replace(strings.ToLower(slug))
+}
+
+// LookupAbbreviation returns the book ID for a known abbreviation.
+func LookupAbbreviation(abbreviation string) (string, bool) {
+	id, ok := abbreviations[NormalizeSlug(abbreviation)]
+	return id, ok
+}
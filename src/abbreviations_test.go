@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// testBooks are books whose abbreviations and prefixes are easy to get
+// wrong: Judges and Jude share a prefix, and the numbered books differ
+// only by their number.
+var testBooks = []Book{
+	{ID: "GEN", Name: "Genesis"},
+	{ID: "JDG", Name: "Judges"},
+	{ID: "1KI", Name: "1 Kings"},
+	{ID: "2KI", Name: "2 Kings"},
+	{ID: "PSA", Name: "Psalms"},
+	{ID: "SNG", Name: "Song of Solomon"},
+	{ID: "JHN", Name: "John"},
+	{ID: "1CO", Name: "1 Corinthians"},
+	{ID: "2CO", Name: "2 Corinthians"},
+	{ID: "1JN", Name: "1 John"},
+	{ID: "JUD", Name: "Jude"},
+	{ID: "REV", Name: "Revelation"},
+}
+
+// newTestBookCache is a BookCache whose web translation has books.
+func newTestBookCache(t *testing.T, books []Book) *BookCache {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/data/web" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(BookInfo{Translation: Translation{Identifier: "web"}, Books: books})
+	}))
+	t.Cleanup(upstream.Close)
+	return NewBookCache(NewBibleClient(upstream.URL))
+}
+
+func TestNormalizeSlug(t *testing.T) {
+	tests := []struct {
+		slug string
+		want string
+	}{
+		{"song-of-solomon", "songofsolomon"},
+		{"SongOfSolomon", "songofsolomon"},
+		{"1 Cor.", "1cor"},
+		{"1-corinthians", "1corinthians"},
+		{"Ps", "ps"},
+	}
+	for _, test := range tests {
+		t.Run(test.slug, func(t *testing.T) {
+			if got := NormalizeSlug(test.slug); got != test.want {
+				t.Errorf("NormalizeSlug(%q) = %q, want %q", test.slug, got, test.want)
+			}
+		})
+	}
+}
+
+func TestLookupAbbreviation(t *testing.T) {
+	tests := []struct {
+		abbreviation string
+		id           string
+		ok           bool
+	}{
+		{"gen", "GEN", true},
+		{"Gen.", "GEN", true},
+		{"ps", "PSA", true},
+		{"psalm", "PSA", true},
+		{"prov", "PRO", true},
+		{"matt", "MAT", true},
+		{"mt", "MAT", true},
+		{"jn", "JHN", true},
+		{"rom", "ROM", true},
+		{"1cor", "1CO", true},
+		{"1 Cor", "1CO", true},
+		{"1 cor.", "1CO", true},
+		{"rev", "REV", true},
+		{"jude", "JUD", true},
+		{"ju", "", false},
+		{"xyz", "", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.abbreviation, func(t *testing.T) {
+			id, ok := LookupAbbreviation(test.abbreviation)
+			if id != test.id || ok != test.ok {
+				t.Errorf("LookupAbbreviation(%q) = %q, %v, want %q, %v", test.abbreviation, id, ok, test.id, test.ok)
+			}
+		})
+	}
+}
+
+func TestAbbreviationsAreNormalized(t *testing.T) {
+	for abbreviation := range abbreviations {
+		if NormalizeSlug(abbreviation) != abbreviation {
+			t.Errorf("%q can never be looked up, it normalizes to %q", abbreviation, NormalizeSlug(abbreviation))
+		}
+	}
+}
+
+func TestFindBook(t *testing.T) {
+	cache := newTestBookCache(t, testBooks)
+	tests := []struct {
+		slug string
+		id   string
+		// candidates is set when the slug is ambiguous
+		candidates []string
+	}{
+		{"song-of-solomon", "SNG", nil},
+		{"songofsolomon", "SNG", nil},
+		{"1cor", "1CO", nil},
+		{"ps", "PSA", nil},
+		{"jn", "JHN", nil},
+		{"reve", "REV", nil},
+		{"jude", "JUD", nil},
+		{"1-john", "1JN", nil},
+		{"ju", "", []string{"JDG", "JUD"}},
+		{"2", "", []string{"2KI", "2CO"}},
+	}
+	for _, test := range tests {
+		t.Run(test.slug, func(t *testing.T) {
+			var book Book
+			err := cache.FindBook(context.Background(), "web", test.slug, &book)
+			if test.candidates != nil {
+				var ambiguous *AmbiguousBookError
+				if !errors.As(err, &ambiguous) {
+					t.Fatalf("FindBook(%q) = %s, %v, want it to be ambiguous", test.slug, book.ID, err)
+				}
+				var ids []string
+				for _, candidate := range ambiguous.Candidates {
+					ids = append(ids, candidate.ID)
+				}
+				if !slices.Equal(ids, test.candidates) {
+					t.Errorf("FindBook(%q) candidates %v, want %v", test.slug, ids, test.candidates)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindBook(%q): %v", test.slug, err)
+			}
+			if book.ID != test.id {
+				t.Errorf("FindBook(%q) = %s, want %s", test.slug, book.ID, test.id)
+			}
+		})
+	}
+}
+
+func TestFindBookNotFound(t *testing.T) {
+	cache := newTestBookCache(t, testBooks)
+	var book Book
+	err := cache.FindBook(context.Background(), "web", "nope", &book)
+	if !errors.Is(err, ErrBookNotFound) {
+		t.Errorf("FindBook(%q) = %s, %v, want ErrBookNotFound", "nope", book.ID, err)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// The credentials /admin takes, from -admin-token, -admin-user and
+// -admin-password. /admin isn't served without either a token or a
+// password.
+var (
+	admin_token    = ""
+	admin_user     = "admin"
+	admin_password = ""
+)
+
+// caches are the caches /admin/cache can see, under the names
+// cache_lookups counts them by.
+func (s *Server) caches() map[string]InspectableCache {
+	return map[string]InspectableCache{
+		"books":        s.Books,
+		"chapters":     s.Chapters,
+		"translations": s.Translations,
+		"stats":        s.Stats,
+		"plans":        s.Plans,
+		"feed":         s.Feeds,
+		"og_image":     s.Images,
+		"sitemap":      s.Sitemaps,
+	}
+}
+
+// adminAuthorized checks for the admin token as a bearer token, or the
+// admin user and password by basic auth.
+func adminAuthorized(r *http.Request) bool {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && admin_token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(admin_token)) == 1
+	}
+	user, password, ok := r.BasicAuth()
+	if !ok || admin_password == "" {
+		return false
+	}
+	user_ok := subtle.ConstantTimeCompare([]byte(user), []byte(admin_user)) == 1
+	password_ok := subtle.ConstantTimeCompare([]byte(password), []byte(admin_password)) == 1
+	return user_ok && password_ok
+}
+
+// RequireAdmin turns away requests without the admin credentials. They
+// only ever come in headers, which the access log leaves out.
+func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		if !adminAuthorized(r) {
+			Logger(r.Context()).Warn("rejected admin request")
+			if admin_password != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="admin", charset="UTF-8"`)
+			} else {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			}
+			WriteJSON(w, http.StatusUnauthorized, ErrorResponse{Status: http.StatusUnauthorized, Error: "This needs the admin credentials."})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// CacheStats describes one cache for GET /admin/cache. Entries are only
+// listed for a cache asked for by name.
+type CacheStats struct {
+	Name     string       `json:"name"`
+	Count    int          `json:"count"`
+	Size     int          `json:"size"`
+	Hits     int64        `json:"hits"`
+	Misses   int64        `json:"misses"`
+	Stale    int64        `json:"stale"`
+	HitRatio float64      `json:"hit_ratio"`
+	Oldest   *CacheEntry  `json:"oldest,omitempty"`
+	Newest   *CacheEntry  `json:"newest,omitempty"`
+	Entries  []CacheEntry `json:"entries,omitempty"`
+}
+
+type AdminCacheResponse struct {
+	Caches []CacheStats `json:"caches"`
+	Count  int          `json:"count"`
+	Size   int          `json:"size"`
+}
+
+// cacheLookups reads how often a cache has had a result from
+// cache_lookups since startup.
+func cacheLookups(name string, result string) int64 {
+	var metric dto.Metric
+	if cache_lookups.WithLabelValues(name, result).Write(&metric) != nil {
+		return 0
+	}
+	return int64(metric.GetCounter().GetValue())
+}
+
+func NewCacheStats(name string, cache InspectableCache, list bool) CacheStats {
+	entries := cache.Entries()
+	stats := CacheStats{
+		Name:   name,
+		Count:  len(entries),
+		Hits:   cacheLookups(name, "hit"),
+		Misses: cacheLookups(name, "miss"),
+		Stale:  cacheLookups(name, "stale"),
+	}
+	if lookups := stats.Hits + stats.Misses + stats.Stale; lookups > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(lookups)
+	}
+	for i := range entries {
+		stats.Size += entries[i].Size
+		if stats.Oldest == nil || entries[i].Added.Before(stats.Oldest.Added) {
+			stats.Oldest = &entries[i]
+		}
+		if stats.Newest == nil || entries[i].Added.After(stats.Newest.Added) {
+			stats.Newest = &entries[i]
+		}
+	}
+	if list {
+		slices.SortFunc(entries, func(a, b CacheEntry) int { return a.Added.Compare(b.Added) })
+		stats.Entries = entries
+	}
+	return stats
+}
+
+// adminCaches is the cache named by ?cache=, or every cache without one.
+func (s *Server) adminCaches(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	caches := s.caches()
+	name := r.URL.Query().Get("cache")
+	if name == "" {
+		names := make([]string, 0, len(caches))
+		for name := range caches {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return names, true
+	}
+	if _, ok := caches[name]; !ok {
+		WriteJSON(w, http.StatusNotFound, ErrorResponse{Status: http.StatusNotFound, Error: fmt.Sprintf("There's no cache called %q.", name)})
+		return nil, false
+	}
+	return []string{name}, true
+}
+
+// getAdminCache serves GET /admin/cache, the size and hit ratio of each
+// cache with its oldest and newest entries. ?cache= shows one cache with
+// every entry in it.
+func (s *Server) getAdminCache(w http.ResponseWriter, r *http.Request) {
+	names, ok := s.adminCaches(w, r)
+	if !ok {
+		return
+	}
+	caches := s.caches()
+	list := r.URL.Query().Has("cache")
+	var response AdminCacheResponse
+	for _, name := range names {
+		stats := NewCacheStats(name, caches[name], list)
+		response.Caches = append(response.Caches, stats)
+		response.Count += stats.Count
+		response.Size += stats.Size
+	}
+	WriteJSON(w, http.StatusOK, response)
+}
+
+// deleteAdminCache serves DELETE /admin/cache, flushing every cache, or
+// the one named by ?cache=. With ?key= only the entry under that key is
+// dropped.
+func (s *Server) deleteAdminCache(w http.ResponseWriter, r *http.Request) {
+	names, ok := s.adminCaches(w, r)
+	if !ok {
+		return
+	}
+	caches := s.caches()
+	key := r.URL.Query().Get("key")
+	flushed := 0
+	for _, name := range names {
+		flushed += caches[name].Flush(key)
+	}
+	Logger(r.Context()).Info("flushed caches", "caches", names, "key", key, "entries", flushed)
+	WriteJSON(w, http.StatusOK, map[string]int{"flushed": flushed})
+}
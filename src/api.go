@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type SingleVerseInfo struct {
+	Translation Translation `json:"translation"`
+	Verse       Verse       `json:"verse"`
+}
+
+type ErrorResponse struct {
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+// WriteJSON encodes v before sending anything, so an encoding failure can
+// still become a 500.
+func WriteJSON(w http.ResponseWriter, status int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("encoding JSON response", "err", err)
+		status = http.StatusInternalServerError
+		body = []byte(`{"status":500,"error":"internal server error"}`)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
+}
+
+func apiError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	Logger(r.Context()).Error("request failed", "err", err)
+	status, message := ErrorStatus(err)
+	WriteJSON(w, status, ErrorResponse{Status: status, Error: message})
+}
+
+func (s *Server) apiBooks(w http.ResponseWriter, r *http.Request) {
+	var book_info BookInfo
+	err := s.Books.Get(r.Context(), RequestTranslation(r), &book_info)
+	if err != nil {
+		apiError(w, r, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, book_info)
+}
+
+func (s *Server) apiChapters(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var book Book
+	var chapter_info ChapterInfo
+	err := s.LoadChapters(r.Context(), RequestTranslation(r), vars["book"], &book, &chapter_info)
+	if err != nil {
+		apiError(w, r, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, chapter_info)
+}
+
+func (s *Server) apiVerses(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var book Book
+	var verse_info VerseInfo
+	err := s.LoadVerses(r.Context(), RequestTranslation(r), vars["book"], vars["chapter"], &book, &verse_info)
+	if err != nil {
+		apiError(w, r, err)
+		return
+	}
+	normalizeVerses(verse_info.Verses)
+	WriteJSON(w, http.StatusOK, verse_info)
+}
+
+func (s *Server) apiVerse(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	number, err := ParseNumber("verse", vars["verse"])
+	if err != nil {
+		apiError(w, r, err)
+		return
+	}
+
+	var book Book
+	var verse_info VerseInfo
+	var verse Verse
+	err = s.LoadVerse(r.Context(), RequestTranslation(r), vars["book"], vars["chapter"], number, &book, &verse_info, &verse)
+	if err != nil {
+		apiError(w, r, err)
+		return
+	}
+	verse.Text = verseText(verse.Text)
+	WriteJSON(w, http.StatusOK, SingleVerseInfo{Translation: verse_info.Translation, Verse: verse})
+}
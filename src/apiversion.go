@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// current_api_version is where unversioned /api/ requests are sent.
+const current_api_version = "v1"
+
+// APIVersion is one version of the JSON API, mounted under /api/{Name}.
+// Once Deprecated is set its responses say so, and when it will go away if
+// Sunset is set too, pointing clients at current_api_version.
+type APIVersion struct {
+	Name       string
+	Deprecated time.Time
+	Sunset     time.Time
+	Register   func(s *Server, api *mux.Router)
+}
+
+var api_versions = []APIVersion{
+	{Name: "v1", Register: (*Server).registerAPI},
+}
+
+// api_version_pattern is what a version looks like in a path, so /api/v9/
+// isn't taken for an unversioned path and redirected to /api/v1/v9/.
+var api_version_pattern = regexp.MustCompile(`^v[0-9]+$`)
+
+// MountAPI registers version's handlers under /api/{Name} on parent and
+// returns the subrouter they are on.
+func (s *Server) MountAPI(parent *mux.Router, version APIVersion) *mux.Router {
+	api := parent.PathPrefix("/api/" + version.Name).Subrouter()
+	api.Use(api_cors.Handler, version.Headers)
+	version.Register(s, api)
+	// paths under the version stay with it when nothing matches, rather
+	// than falling through to the pages. mux can report a wrong method as
+	// not found inside a subrouter, so that is checked here too. Neither
+	// goes through the subrouter's middleware, so they set the version
+	// headers themselves.
+	method_not_allowed := s.MethodNotAllowed(api)
+	api.MethodNotAllowedHandler = version.Headers(method_not_allowed)
+	api.NotFoundHandler = version.Headers(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if TrailingSlashRedirect(parent, w, r) {
+			return
+		}
+		if len(AllowedMethods(api, r)) > 0 {
+			method_not_allowed.ServeHTTP(w, r)
+			return
+		}
+		WriteJSON(w, http.StatusNotFound, ErrorResponse{Status: http.StatusNotFound, Error: "There's nothing at this address."})
+	}))
+	return api
+}
+
+// Headers sets X-API-Version on every response of the version, and the
+// Deprecation, Sunset and successor Link headers once it is deprecated.
+func (v APIVersion) Headers(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Set("X-API-Version", v.Name)
+		if !v.Deprecated.IsZero() {
+			header.Set("Deprecation", fmt.Sprintf("@%d", v.Deprecated.Unix()))
+			if !v.Sunset.IsZero() {
+				header.Set("Sunset", v.Sunset.UTC().Format(http.TimeFormat))
+			}
+			header.Add("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", SitePath("api", current_api_version+"/")))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redirectAPIVersion sends an unversioned /api/... request to the same path
+// under current_api_version with a 307, so the method and body are kept.
+// Paths that name a version that doesn't exist are a 404.
+func redirectAPIVersion(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/")
+	first, _, _ := strings.Cut(rest, "/")
+	if api_version_pattern.MatchString(first) {
+		message := fmt.Sprintf("There's no version %s of the API; the current one is %s.", first, current_api_version)
+		WriteJSON(w, http.StatusNotFound, ErrorResponse{Status: http.StatusNotFound, Error: message})
+		return
+	}
+	target := url.URL{Path: SitePath("api", current_api_version, rest), RawQuery: r.URL.RawQuery}
+	http.Redirect(w, r, target.String(), http.StatusTemporaryRedirect)
+}
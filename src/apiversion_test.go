@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRedirectAPIVersion(t *testing.T) {
+	handler := newTestServer(t)
+	tests := []struct {
+		method string
+		target string
+		status int
+		// location is empty when there's no redirect
+		location string
+	}{
+		{http.MethodGet, "/api/john/3", http.StatusTemporaryRedirect, "/api/v1/john/3"},
+		{http.MethodGet, "/api/john/3/16?translation=kjv", http.StatusTemporaryRedirect, "/api/v1/john/3/16?translation=kjv"},
+		{http.MethodGet, "/api/books", http.StatusTemporaryRedirect, "/api/v1/books"},
+		{http.MethodPost, "/api/passages", http.StatusTemporaryRedirect, "/api/v1/passages"},
+		{http.MethodDelete, "/api/webhooks/1", http.StatusTemporaryRedirect, "/api/v1/webhooks/1"},
+		// versions, even ones that don't exist, aren't paths of the current one
+		{http.MethodGet, "/api/v9/john/3", http.StatusNotFound, ""},
+		{http.MethodGet, "/api/v10/books", http.StatusNotFound, ""},
+		{http.MethodGet, "/api/v1/john/3", http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(test.method, test.target, nil))
+			if w.Code != test.status {
+				t.Fatalf("status %d, want %d", w.Code, test.status)
+			}
+			if location := w.Header().Get("Location"); location != test.location {
+				t.Errorf("Location %q, want %q", location, test.location)
+			}
+		})
+	}
+}
+
+// Following the redirect gets what the versioned path would, body and all.
+func TestUnversionedAPI(t *testing.T) {
+	server := httptest.NewServer(newTestServer(t))
+	t.Cleanup(server.Close)
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodGet, "/john/3/16", ""},
+		{http.MethodGet, "/books", ""},
+		{http.MethodPost, "/passages", `{"refs":["John 3:16","Genesis 1:1"]}`},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			var bodies []string
+			for _, prefix := range []string{"/api", "/api/v1"} {
+				r, _ := http.NewRequest(test.method, server.URL+prefix+test.path, strings.NewReader(test.body))
+				r.Header.Set("Content-Type", "application/json")
+				response, err := server.Client().Do(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ := io.ReadAll(response.Body)
+				response.Body.Close()
+				if response.StatusCode != http.StatusOK {
+					t.Fatalf("%s %s%s: status %d: %s", test.method, prefix, test.path, response.StatusCode, body)
+				}
+				if version := response.Header.Get("X-API-Version"); version != current_api_version {
+					t.Errorf("%s%s: X-API-Version %q", prefix, test.path, version)
+				}
+				bodies = append(bodies, string(body))
+			}
+			if bodies[0] != bodies[1] {
+				t.Errorf("the prefixes answer differently:\n%s\n%s", bodies[0], bodies[1])
+			}
+		})
+	}
+}
+
+func TestAPINotFound(t *testing.T) {
+	handler := newTestServer(t)
+	for _, target := range []string{"/api/v1/nowhere/at/all/here", "/api/v1/john/3/16/17"} {
+		w := get(t, handler, target)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("GET %s: status %d, want %d", target, w.Code, http.StatusNotFound)
+		}
+		var response ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Errorf("GET %s: body %s isn't JSON", target, w.Body)
+		}
+		if version := w.Header().Get("X-API-Version"); version != "v1" {
+			t.Errorf("GET %s: X-API-Version %q", target, version)
+		}
+	}
+}
+
+func TestAPIVersionHeaders(t *testing.T) {
+	deprecated := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)
+	register := func(s *Server, api *mux.Router) {
+		api.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
+			WriteJSON(w, http.StatusOK, map[string]bool{"ok": true})
+		})
+	}
+	tests := []struct {
+		version     APIVersion
+		deprecation string
+		sunset      string
+		link        string
+	}{
+		{APIVersion{Name: "v1", Register: register}, "", "", ""},
+		{APIVersion{Name: "v0", Deprecated: deprecated, Register: register}, "@1767225600", "", `</api/v1/>; rel="successor-version"`},
+		{APIVersion{Name: "v0", Deprecated: deprecated, Sunset: sunset, Register: register}, "@1767225600", "Thu, 31 Dec 2026 00:00:00 GMT", `</api/v1/>; rel="successor-version"`},
+	}
+	for _, test := range tests {
+		t.Run(test.version.Name+" "+test.sunset, func(t *testing.T) {
+			router := mux.NewRouter()
+			NewServer(NewBibleClient(fakeUpstream(t).URL), nil).MountAPI(router, test.version)
+			for _, path := range []string{"/ping", "/nowhere"} {
+				w := get(t, router, "/api/"+test.version.Name+path)
+				header := w.Header()
+				for name, want := range map[string]string{
+					"X-API-Version": test.version.Name,
+					"Deprecation":   test.deprecation,
+					"Sunset":        test.sunset,
+					"Link":          test.link,
+				} {
+					if got := header.Get(name); got != want {
+						t.Errorf("%s: %s %q, want %q", path, name, got, want)
+					}
+				}
+				if links := header.Values("Link"); len(links) > 1 {
+					t.Errorf("%s: Link %q", path, links)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// BasePath strips -base-path from incoming requests so the router only sees
+// paths relative to the site root. Requests outside the base path get a 404,
+// and the bare base path is redirected to have a trailing slash.
+func BasePath(next http.Handler) http.Handler {
+	if base_path == "" {
+		return next
+	}
+	stripped := http.StripPrefix(base_path, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == base_path {
+			http.Redirect(w, r, base_path+"/", http.StatusMovedPermanently)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, base_path+"/") {
+			http.NotFound(w, r)
+			return
+		}
+		stripped.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBasePath(t *testing.T) {
+	setBasePath(t, "/bible")
+	handler := BasePath(newTestServer(t))
+	tests := []struct {
+		target   string
+		status   int
+		location string
+		want     string
+	}{
+		{"/bible/", http.StatusOK, "", `href="/bible/john"`},
+		{"/bible/john", http.StatusOK, "", `href="/bible/john/3"`},
+		{"/bible/john/3", http.StatusOK, "", "For God so loved the world"},
+		{"/bible", http.StatusMovedPermanently, "/bible/", ""},
+		{"/john/3", http.StatusNotFound, "", ""},
+		{"/biblical/john", http.StatusNotFound, "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			w := get(t, handler, test.target)
+			if w.Code != test.status {
+				t.Fatalf("GET %s: status %d, want %d", test.target, w.Code, test.status)
+			}
+			if location := w.Header().Get("Location"); location != test.location {
+				t.Errorf("GET %s: redirected to %q, want %q", test.target, location, test.location)
+			}
+			if !strings.Contains(w.Body.String(), test.want) {
+				t.Errorf("GET %s: body doesn't contain %q", test.target, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// max_batch_refs caps how many references one /api/v1/passages request
+	// can ask for.
+	max_batch_refs = 20
+	// batch_body_size is far more than max_batch_refs references need.
+	batch_body_size = 64 << 10
+)
+
+// PassagesRequest is the body of POST /api/v1/passages. Translation falls
+// back to ?translation= and then the default.
+type PassagesRequest struct {
+	Translation string   `json:"translation,omitempty"`
+	Refs        []string `json:"refs"`
+}
+
+// PassageResult is one reference of a batch, in the order it was asked
+// for. A reference that can't be read or found has a Status and Error
+// instead of verses, without failing the rest.
+type PassageResult struct {
+	Ref         string      `json:"ref"`
+	Reference   string      `json:"reference,omitempty"`
+	Translation Translation `json:"translation"`
+	Verses      []Verse     `json:"verses,omitempty"`
+	Status      int         `json:"status"`
+	Error       string      `json:"error,omitempty"`
+}
+
+// batchChapter is a chapter one or more references of a batch need.
+type batchChapter struct {
+	Book    string
+	Chapter int
+}
+
+// batchPassage is a reference that resolved to a book, waiting on its
+// chapters.
+type batchPassage struct {
+	Reference Reference
+	Book      Book
+}
+
+// resolvePassage parses text and finds its book, checking that the
+// reference is one chapters can be loaded for.
+func (s *Server) resolvePassage(ctx context.Context, translation string, text string) (batchPassage, error) {
+	ref, err := ParseReference(text)
+	if err != nil {
+		return batchPassage{}, fmt.Errorf("%w: %q isn't a reference like \"John 3:16\"", ErrInvalidReference, text)
+	}
+	var book Book
+	err = s.Books.FindBook(ctx, translation, ref.Book, &book)
+	if err != nil {
+		return batchPassage{}, err
+	}
+	if ref.ChapterStart == 0 {
+		return batchPassage{}, fmt.Errorf("%w: %q names a whole book, not chapters", ErrInvalidReference, text)
+	}
+	if ref.ChapterEnd-ref.ChapterStart >= max_reference_chapters {
+		return batchPassage{}, fmt.Errorf("%w: %q is more than %d chapters", ErrInvalidReference, text, max_reference_chapters)
+	}
+	ref.Book = book.Name
+	return batchPassage{Reference: ref, Book: book}, nil
+}
+
+// Passage is the verses of one reference, for the endpoints that take
+// free text rather than a path.
+type Passage struct {
+	Reference   Reference
+	Book        Book
+	Translation Translation
+	Verses      []Verse
+}
+
+// LoadPassage resolves text and reads its verses a chapter at a time.
+func (s *Server) LoadPassage(ctx context.Context, translation string, text string) (Passage, error) {
+	resolved, err := s.resolvePassage(ctx, translation, text)
+	if err != nil {
+		return Passage{}, err
+	}
+	ref := resolved.Reference
+	passage := Passage{Reference: ref, Book: resolved.Book}
+	var verse_info VerseInfo
+	for chapter := ref.ChapterStart; chapter <= ref.ChapterEnd; chapter++ {
+		err = s.CheckChapter(ctx, translation, resolved.Book, chapter)
+		if err != nil {
+			return Passage{}, err
+		}
+		err = s.Bible.GetVerseInfo(ctx, translation, resolved.Book.ID, strconv.Itoa(chapter), &verse_info)
+		if err != nil {
+			return Passage{}, err
+		}
+		normalizeVerses(verse_info.Verses)
+		passage.Translation = verse_info.Translation
+		for _, verse := range verse_info.Verses {
+			if ref.Includes(chapter, verse.Verse) {
+				passage.Verses = append(passage.Verses, verse)
+			}
+		}
+	}
+	if len(passage.Verses) == 0 {
+		return Passage{}, &VerseNotFoundError{Reference: fmt.Sprintf("%s %d", ref.Book, ref.ChapterStart), Verse: ref.VerseStart, Last: LastVerse(verse_info.Verses)}
+	}
+	return passage, nil
+}
+
+// PassageText joins the verses of a passage into one paragraph for chat
+// messages. Each verse is led by its number, passed through number for the
+// message's markup, with the chapter too where one starts. A single verse
+// is left bare.
+func PassageText(passage Passage, number func(string) string) string {
+	if len(passage.Verses) == 1 {
+		return passage.Verses[0].Text
+	}
+	parts := make([]string, len(passage.Verses))
+	for i, verse := range passage.Verses {
+		label := strconv.Itoa(verse.Verse)
+		if i > 0 && verse.Chapter != passage.Verses[i-1].Chapter {
+			label = fmt.Sprintf("%d:%d", verse.Chapter, verse.Verse)
+		}
+		parts[i] = number(label) + " " + verse.Text
+	}
+	return strings.Join(parts, " ")
+}
+
+// passageError fills in a result for a reference that failed.
+func passageError(result *PassageResult, err error) {
+	status, message := ErrorStatus(err)
+	if errors.Is(err, ErrInvalidReference) {
+		status, message = http.StatusBadRequest, strings.TrimPrefix(err.Error(), ErrInvalidReference.Error()+": ")+"."
+	}
+	result.Status = status
+	result.Error = message
+}
+
+// apiPassages serves POST /api/v1/passages, resolving several references at
+// once. Each chapter is fetched once however many references share it, and
+// the chapters are fetched concurrently.
+func (s *Server) apiPassages(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, batch_body_size)
+	var request PassagesRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Status: http.StatusBadRequest, Error: `The body should be JSON like {"refs": ["John 3:16-18", "Ps 23"]}.`})
+		return
+	}
+	if len(request.Refs) == 0 || len(request.Refs) > max_batch_refs {
+		message := fmt.Sprintf("Ask for between 1 and %d references at a time.", max_batch_refs)
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Status: http.StatusBadRequest, Error: message})
+		return
+	}
+	translation := strings.ToLower(request.Translation)
+	if translation == "" {
+		translation = RequestTranslation(r)
+	}
+	// an unknown translation fails the whole batch, not each reference
+	var book_info BookInfo
+	err = s.Books.Get(r.Context(), translation, &book_info)
+	if err != nil {
+		apiError(w, r, err)
+		return
+	}
+
+	results := make([]PassageResult, len(request.Refs))
+	passages := make([]batchPassage, len(request.Refs))
+	var chapters []batchChapter
+	books := map[string]Book{}
+	for i, text := range request.Refs {
+		results[i] = PassageResult{Ref: text, Translation: book_info.Translation}
+		passages[i], err = s.resolvePassage(r.Context(), translation, text)
+		if err != nil {
+			passageError(&results[i], err)
+			continue
+		}
+		book, ref := passages[i].Book, passages[i].Reference
+		books[book.ID] = book
+		for chapter := ref.ChapterStart; chapter <= ref.ChapterEnd; chapter++ {
+			key := batchChapter{Book: book.ID, Chapter: chapter}
+			if !slices.Contains(chapters, key) {
+				chapters = append(chapters, key)
+			}
+		}
+	}
+
+	// a chapter that fails only fails the references that need it, so
+	// errors are kept rather than returned to the group
+	verse_infos := make([]VerseInfo, len(chapters))
+	chapter_errors := make([]error, len(chapters))
+	g, ctx := errgroup.WithContext(r.Context())
+	g.SetLimit(markdown_workers)
+	for i, chapter := range chapters {
+		g.Go(func() error {
+			book := books[chapter.Book]
+			chapter_errors[i] = s.CheckChapter(ctx, translation, book, chapter.Chapter)
+			if chapter_errors[i] == nil {
+				chapter_errors[i] = s.Bible.GetVerseInfo(ctx, translation, book.ID, strconv.Itoa(chapter.Chapter), &verse_infos[i])
+				normalizeVerses(verse_infos[i].Verses)
+			}
+			return nil
+		})
+	}
+	g.Wait()
+
+	for i := range results {
+		if results[i].Error != "" {
+			continue
+		}
+		book, ref := passages[i].Book, passages[i].Reference
+		results[i].Reference = ref.String()
+		results[i].Status = http.StatusOK
+		last := 0
+		for chapter := ref.ChapterStart; chapter <= ref.ChapterEnd; chapter++ {
+			j := slices.Index(chapters, batchChapter{Book: book.ID, Chapter: chapter})
+			if chapter_errors[j] != nil {
+				results[i].Verses = nil
+				passageError(&results[i], chapter_errors[j])
+				break
+			}
+			results[i].Translation = verse_infos[j].Translation
+			if chapter == ref.ChapterStart {
+				last = LastVerse(verse_infos[j].Verses)
+			}
+			for _, verse := range verse_infos[j].Verses {
+				if ref.Includes(chapter, verse.Verse) {
+					results[i].Verses = append(results[i].Verses, verse)
+				}
+			}
+		}
+		if results[i].Error == "" && len(results[i].Verses) == 0 {
+			passageError(&results[i], &VerseNotFoundError{Reference: fmt.Sprintf("%s %d", ref.Book, ref.ChapterStart), Verse: ref.VerseStart, Last: last})
+		}
+	}
+	WriteJSON(w, http.StatusOK, results)
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// bookmark_import_size is the largest JSON file /bookmarks/import reads
+	bookmark_import_size = 1 << 20
+	snippet_length       = 120
+)
+
+// Bookmark is a saved verse, or a whole chapter when Verse is 0. Books are
+// kept by ID rather than slug so bookmarks carry over between translations.
+type Bookmark struct {
+	Book    string `json:"book"`
+	Chapter int    `json:"chapter"`
+	Verse   int    `json:"verse,omitempty"`
+}
+
+func (b Bookmark) String() string {
+	return fmt.Sprintf("%s.%d.%d", b.Book, b.Chapter, b.Verse)
+}
+
+// ParseBookmark reads a bookmark written by String, like "JHN.3.16".
+func ParseBookmark(value string) (Bookmark, error) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 || parts[0] == "" {
+		return Bookmark{}, fmt.Errorf("%q isn't a bookmark", value)
+	}
+	chapter, err := strconv.Atoi(parts[1])
+	if err != nil || chapter < 1 {
+		return Bookmark{}, fmt.Errorf("%q isn't a bookmark", value)
+	}
+	verse, err := strconv.Atoi(parts[2])
+	if err != nil || verse < 0 {
+		return Bookmark{}, fmt.Errorf("%q isn't a bookmark", value)
+	}
+	return Bookmark{Book: parts[0], Chapter: chapter, Verse: verse}, nil
+}
+
+// encodeBookmarks joins bookmarks, oldest first, for the bookmarks cookie.
+// When they don't fit in cookie_value_size the oldest are dropped.
+func encodeBookmarks(bookmarks []Bookmark) string {
+	parts := make([]string, len(bookmarks))
+	size := 0
+	for i, bookmark := range bookmarks {
+		parts[i] = bookmark.String()
+		size += len(parts[i]) + 1
+	}
+	for len(parts) > 0 && size-1 > cookie_value_size {
+		size -= len(parts[0]) + 1
+		parts = parts[1:]
+	}
+	return strings.Join(parts, "-")
+}
+
+// decodeBookmarks reads the bookmarks cookie, skipping anything it doesn't
+// recognise.
+func decodeBookmarks(value string) []Bookmark {
+	var bookmarks []Bookmark
+	for _, part := range strings.Split(value, "-") {
+		bookmark, err := ParseBookmark(part)
+		if err == nil {
+			bookmarks = append(bookmarks, bookmark)
+		}
+	}
+	return bookmarks
+}
+
+// LoadBookmarks returns the visitor's bookmarks, oldest first, from the store
+// when there is one and otherwise from their cookie.
+func (s *Server) LoadBookmarks(r *http.Request) []Bookmark {
+	if s.Store == nil {
+		value, _ := SignedCookie(r, "bookmarks")
+		return decodeBookmarks(value)
+	}
+	user, ok := SignedCookie(r, "user")
+	if !ok {
+		return nil
+	}
+	bookmarks, err := s.Store.LoadBookmarks(r.Context(), user)
+	if err != nil {
+		storeError(err)
+		return nil
+	}
+	return bookmarks
+}
+
+// AddBookmarks saves bookmarks the visitor doesn't have yet, as the newest.
+func (s *Server) AddBookmarks(w http.ResponseWriter, r *http.Request, added []Bookmark) error {
+	if s.Store == nil {
+		bookmarks := s.LoadBookmarks(r)
+		for _, bookmark := range added {
+			if !slices.Contains(bookmarks, bookmark) {
+				bookmarks = append(bookmarks, bookmark)
+			}
+		}
+		SetSignedCookie(w, r, "bookmarks", encodeBookmarks(bookmarks))
+		return nil
+	}
+	user := UserToken(w, r)
+	for _, bookmark := range added {
+		err := s.Store.AddBookmark(r.Context(), user, bookmark)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveBookmark deletes one of the visitor's bookmarks.
+func (s *Server) RemoveBookmark(w http.ResponseWriter, r *http.Request, bookmark Bookmark) error {
+	if s.Store == nil {
+		bookmarks := slices.DeleteFunc(s.LoadBookmarks(r), func(b Bookmark) bool { return b == bookmark })
+		SetSignedCookie(w, r, "bookmarks", encodeBookmarks(bookmarks))
+		return nil
+	}
+	user, ok := SignedCookie(r, "user")
+	if !ok {
+		return nil
+	}
+	return s.Store.RemoveBookmark(r.Context(), user, bookmark)
+}
+
+// checkBookmark makes sure a bookmark is of a book the translation has, so
+// forms and imports can't fill the cookie with junk.
+func (s *Server) checkBookmark(ctx context.Context, translation string, bookmark Bookmark) error {
+	if bookmark.Chapter < 1 || bookmark.Verse < 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidBookmark, bookmark)
+	}
+	var book Book
+	err := s.Books.BookByID(ctx, translation, bookmark.Book, &book)
+	if errors.Is(err, ErrBookNotFound) {
+		return fmt.Errorf("%w: %s", ErrInvalidBookmark, bookmark)
+	}
+	return err
+}
+
+// BookmarkForm is the bookmark button on a verse or chapter page.
+type BookmarkForm struct {
+	Action   string
+	Bookmark Bookmark
+	Saved    bool
+}
+
+// NewBookmarkForm makes the button for bookmarking a verse, or a chapter
+// when verse is 0. Whether it shows as saved depends on the visitor's
+// bookmarks, so the page becomes Private for visitors with a bookmarks
+// cookie. Everyone else sees the same unsaved button.
+func (s *Server) NewBookmarkForm(w http.ResponseWriter, r *http.Request, book Book, chapter int, verse int) BookmarkForm {
+	cookie := "bookmarks"
+	if s.Store != nil {
+		cookie = "user"
+	}
+	if _, ok := SignedCookie(r, cookie); ok {
+		Private(w)
+	}
+	bookmark := Bookmark{Book: book.ID, Chapter: chapter, Verse: verse}
+	return BookmarkForm{
+		Action:   s.Path("bookmarks"),
+		Bookmark: bookmark,
+		Saved:    slices.Contains(s.LoadBookmarks(r), bookmark),
+	}
+}
+
+type BookmarkItem struct {
+	Bookmark Bookmark
+	Link     Link
+	Snippet  string
+}
+
+// bookmarkItem looks up the reference and opening words of a bookmark. A
+// book the translation doesn't have is listed by its ID without a link.
+func (s *Server) bookmarkItem(ctx context.Context, translation string, bookmark Bookmark) BookmarkItem {
+	item := BookmarkItem{Bookmark: bookmark, Link: Link{Text: fmt.Sprintf("%s %d", bookmark.Book, bookmark.Chapter)}}
+	if bookmark.Verse > 0 {
+		item.Link.Text += ":" + strconv.Itoa(bookmark.Verse)
+	}
+	var book Book
+	err := s.Books.BookByID(ctx, translation, bookmark.Book, &book)
+	if err != nil {
+		return item
+	}
+	item.Link = s.ChapterLink(translation, book, bookmark.Chapter)
+	if bookmark.Verse > 0 {
+		item.Link = s.VerseLink(translation, book, bookmark.Chapter, bookmark.Verse)
+	}
+
+	var verse_info VerseInfo
+	err = s.LoadVerses(ctx, translation, BookSlug(book.Name), strconv.Itoa(bookmark.Chapter), &book, &verse_info)
+	if err != nil {
+		return item
+	}
+	for _, verse := range verse_info.Verses {
+		if verse.Verse == max(bookmark.Verse, 1) {
+			item.Snippet = Truncate(verseText(verse.Text), snippet_length)
+			break
+		}
+	}
+	return item
+}
+
+func (s *Server) getBookmarks(w http.ResponseWriter, r *http.Request) {
+	translation := RequestTranslation(r)
+	bookmarks := s.LoadBookmarks(r)
+	page := BookmarksPage{
+		Action: s.Path("bookmarks"),
+		Export: s.Path("bookmarks-json"),
+		Import: s.Path("import-bookmarks"),
+		Items:  make([]BookmarkItem, len(bookmarks)),
+	}
+
+	g, ctx := errgroup.WithContext(r.Context())
+	g.SetLimit(markdown_workers)
+	// newest first
+	for i, bookmark := range bookmarks {
+		g.Go(func() error {
+			page.Items[len(bookmarks)-1-i] = s.bookmarkItem(ctx, translation, bookmark)
+			return nil
+		})
+	}
+	g.Wait()
+	s.RenderPage(w, r, http.StatusOK, "bookmarks.html", "Bookmarks", page)
+}
+
+// postBookmark adds the bookmark in the form, or removes it with remove=1,
+// and goes back to the page the form was on.
+func (s *Server) postBookmark(w http.ResponseWriter, r *http.Request) {
+	bookmark, err := ParseBookmark(r.PostFormValue("bookmark"))
+	if err != nil {
+		s.fetchError(w, r, RequestTranslation(r), "", fmt.Errorf("%w: %s", ErrInvalidBookmark, err))
+		return
+	}
+	if r.PostFormValue("remove") == "1" {
+		err = s.RemoveBookmark(w, r, bookmark)
+	} else {
+		err = s.checkBookmark(r.Context(), RequestTranslation(r), bookmark)
+		if err != nil {
+			s.fetchError(w, r, RequestTranslation(r), "", err)
+			return
+		}
+		err = s.AddBookmarks(w, r, []Bookmark{bookmark})
+	}
+	if err != nil {
+		Logger(r.Context()).Error("saving bookmarks", "err", err)
+		s.renderError(w, r, http.StatusInternalServerError, "Your bookmarks couldn't be saved. Please try again.")
+		return
+	}
+	redirectBack(w, r, s.Path("bookmarks"))
+}
+
+// getBookmarksJSON downloads the visitor's bookmarks, oldest first, in the
+// form /bookmarks/import reads back.
+func (s *Server) getBookmarksJSON(w http.ResponseWriter, r *http.Request) {
+	bookmarks := s.LoadBookmarks(r)
+	if bookmarks == nil {
+		bookmarks = []Bookmark{}
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="bookmarks.json"`)
+	w.Header().Set("Cache-Control", "private, no-store")
+	WriteJSON(w, http.StatusOK, bookmarks)
+}
+
+// postBookmarksImport adds the bookmarks of an uploaded export to the ones
+// the visitor already has.
+func (s *Server) postBookmarksImport(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, bookmark_import_size)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "Choose a bookmarks.json file to import.")
+		return
+	}
+	defer file.Close()
+
+	var imported []Bookmark
+	err = json.NewDecoder(file).Decode(&imported)
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "That file isn't a bookmarks export.")
+		return
+	}
+	translation := RequestTranslation(r)
+	for _, bookmark := range imported {
+		err = s.checkBookmark(r.Context(), translation, bookmark)
+		if err != nil {
+			s.fetchError(w, r, translation, "", err)
+			return
+		}
+	}
+	err = s.AddBookmarks(w, r, imported)
+	if err != nil {
+		Logger(r.Context()).Error("importing bookmarks", "err", err)
+		s.renderError(w, r, http.StatusInternalServerError, "Your bookmarks couldn't be saved. Please try again.")
+		return
+	}
+	http.Redirect(w, r, s.Path("bookmarks"), http.StatusSeeOther)
+}
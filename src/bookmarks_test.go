@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewBookmarkForm(t *testing.T) {
+	s := testServer(t, fakeUpstream(t).URL)
+	john := Book{ID: "JHN", Name: "John"}
+	saved := httptest.NewRecorder()
+	SetSignedCookie(saved, httptest.NewRequest(http.MethodGet, "/", nil), "bookmarks", encodeBookmarks([]Bookmark{{Book: "JHN", Chapter: 3, Verse: 16}}))
+	tests := []struct {
+		name    string
+		cookie  *http.Cookie
+		verse   int
+		saved   bool
+		private bool
+	}{
+		{"no bookmarks", nil, 16, false, false},
+		{"bookmarked", saved.Result().Cookies()[0], 16, true, true},
+		{"other bookmarks", saved.Result().Cookies()[0], 17, false, true},
+		{"forged", &http.Cookie{Name: "bookmarks", Value: "JHN.3.16.forged"}, 16, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/john/3/16", nil)
+			if test.cookie != nil {
+				r.AddCookie(test.cookie)
+			}
+			w := httptest.NewRecorder()
+			form := s.NewBookmarkForm(w, r, john, 3, test.verse)
+			if form.Saved != test.saved {
+				t.Errorf("Saved = %v, want %v", form.Saved, test.saved)
+			}
+			cache_control := w.Header().Get("Cache-Control")
+			if private := strings.HasPrefix(cache_control, "private"); private != test.private {
+				t.Errorf("Cache-Control %q, want private %v", cache_control, test.private)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ErrCircuitOpen is returned without trying the upstream while its
+// circuit is open. It counts as the upstream being unavailable, so caches
+// fall back to stale copies.
+var ErrCircuitOpen = fmt.Errorf("%w: circuit open", ErrUpstreamUnavailable)
+
+type circuitState int
+
+const (
+	circuit_closed circuitState = iota
+	circuit_half_open
+	circuit_open
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuit_half_open:
+		return "half_open"
+	case circuit_open:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+var (
+	circuit_state = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "bible_upstream_circuit_state",
+		Help: "State of each upstream host's circuit breaker: 0 closed, 1 half open, 2 open.",
+	}, []string{"host"})
+	circuit_transitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bible_upstream_circuit_transitions_total",
+		Help: "Circuit breaker state changes, by upstream host and the state changed to.",
+	}, []string{"host", "state"})
+)
+
+// Breaker is the circuit breaker of one upstream host. After Failures
+// failed requests in a row it opens, and requests fail straight away with
+// ErrCircuitOpen for Cooldown. Then it half opens and lets one probe
+// request through: if that works the circuit closes again, and if not it
+// opens for another Cooldown.
+type Breaker struct {
+	Host     string
+	Failures int
+	Cooldown time.Duration
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	opened   time.Time
+	probing  bool
+}
+
+// Allow reports whether a request may go ahead. A true while half open
+// makes the caller the probe, which must report back with Record. With
+// Failures at 0 the breaker never opens.
+func (b *Breaker) Allow() bool {
+	if b.Failures <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case circuit_open:
+		if time.Since(b.opened) < b.Cooldown {
+			return false
+		}
+		b.transition(circuit_half_open)
+		fallthrough
+	case circuit_half_open:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+	}
+	return true
+}
+
+// Record counts the outcome of a request Allow let through. Only errors
+// that say the upstream is in trouble count as failures: a 404 is an
+// answer, and a request cancelled by its client says nothing either way.
+func (b *Breaker) Record(err error) {
+	if b.Failures <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == circuit_half_open {
+		b.probing = false
+	}
+	switch {
+	case err != nil && errors.Is(err, context.Canceled):
+	case err != nil && (errors.Is(err, ErrUpstreamUnavailable) || IsTimeout(err)):
+		b.failures++
+		if b.state == circuit_half_open || b.failures >= b.Failures {
+			b.opened = time.Now()
+			b.transition(circuit_open)
+		}
+	default:
+		b.failures = 0
+		if b.state != circuit_closed {
+			b.transition(circuit_closed)
+		}
+	}
+}
+
+func (b *Breaker) transition(state circuitState) {
+	if b.state == state {
+		return
+	}
+	switch state {
+	case circuit_open:
+		slog.Warn("upstream circuit opened", "host", b.Host, "failures", b.failures, "cooldown", b.Cooldown)
+	case circuit_half_open:
+		slog.Info("upstream circuit half open, probing", "host", b.Host)
+	case circuit_closed:
+		slog.Info("upstream circuit closed", "host", b.Host)
+	}
+	b.state = state
+	circuit_state.WithLabelValues(b.Host).Set(float64(state))
+	circuit_transitions.WithLabelValues(b.Host, state.String()).Inc()
+}
+
+// State is the circuit's state, "closed", "half_open" or "open".
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state.String()
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+	unavailable := fmt.Errorf("%w: 503 Service Unavailable", ErrUpstreamUnavailable)
+	// a step is one of "allow", "deny", "wait" for the cooldown, or an
+	// outcome to record, followed by the state it leaves
+	type step struct {
+		do    string
+		state string
+	}
+	outcomes := map[string]error{
+		"ok":        nil,
+		"fail":      unavailable,
+		"timeout":   context.DeadlineExceeded,
+		"not found": ErrNotFound,
+		"bad":       ErrBadUpstreamResponse,
+		"cancelled": context.Canceled,
+	}
+	tests := []struct {
+		name     string
+		failures int
+		steps    []step
+	}{
+		{"opens after failures in a row", 3, []step{
+			{"fail", "closed"}, {"fail", "closed"}, {"allow", "closed"}, {"fail", "open"}, {"deny", "open"},
+		}},
+		{"a success starts counting again", 3, []step{
+			{"fail", "closed"}, {"fail", "closed"}, {"ok", "closed"}, {"fail", "closed"}, {"fail", "closed"}, {"fail", "open"},
+		}},
+		{"timeouts count", 2, []step{
+			{"timeout", "closed"}, {"timeout", "open"},
+		}},
+		{"answers aren't failures", 2, []step{
+			{"fail", "closed"}, {"not found", "closed"}, {"fail", "closed"}, {"bad", "closed"}, {"fail", "closed"},
+		}},
+		{"cancelled requests don't count", 2, []step{
+			{"fail", "closed"}, {"cancelled", "closed"}, {"fail", "open"},
+		}},
+		{"a probe that works closes it", 1, []step{
+			{"fail", "open"}, {"deny", "open"}, {"wait", "open"},
+			{"allow", "half_open"}, {"deny", "half_open"}, {"deny", "half_open"},
+			{"ok", "closed"}, {"allow", "closed"}, {"allow", "closed"},
+		}},
+		{"a probe that fails opens it again", 2, []step{
+			{"fail", "closed"}, {"fail", "open"}, {"wait", "open"},
+			{"allow", "half_open"}, {"fail", "open"}, {"deny", "open"},
+			{"wait", "open"}, {"allow", "half_open"}, {"ok", "closed"},
+		}},
+		{"a probe that's cancelled lets another through", 1, []step{
+			{"fail", "open"}, {"wait", "open"},
+			{"allow", "half_open"}, {"deny", "half_open"}, {"cancelled", "half_open"},
+			{"allow", "half_open"}, {"deny", "half_open"}, {"not found", "closed"},
+		}},
+		{"off", 0, []step{
+			{"fail", "closed"}, {"fail", "closed"}, {"fail", "closed"}, {"allow", "closed"},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := &Breaker{Host: "breaker.test", Failures: test.failures, Cooldown: cooldown}
+			for i, step := range test.steps {
+				switch step.do {
+				case "allow", "deny":
+					if allowed := b.Allow(); allowed != (step.do == "allow") {
+						t.Fatalf("step %d: Allow = %t", i+1, allowed)
+					}
+				case "wait":
+					time.Sleep(cooldown)
+				default:
+					err, ok := outcomes[step.do]
+					if !ok {
+						t.Fatalf("step %d: no outcome %q", i+1, step.do)
+					}
+					b.Record(err)
+				}
+				if state := b.State(); state != step.state {
+					t.Fatalf("step %d, %s: state %s, want %s", i+1, step.do, state, step.state)
+				}
+			}
+		})
+	}
+}
+
+// Only one of many requests at once gets to probe a half open circuit.
+func TestBreakerOneProbe(t *testing.T) {
+	b := &Breaker{Host: "breaker.test", Failures: 1, Cooldown: time.Millisecond}
+	b.Record(ErrUpstreamUnavailable)
+	time.Sleep(2 * time.Millisecond)
+	var allowed atomic.Int32
+	done := make(chan bool)
+	for range 50 {
+		go func() {
+			if b.Allow() {
+				allowed.Add(1)
+			}
+			done <- true
+		}()
+	}
+	for range 50 {
+		<-done
+	}
+	if n := allowed.Load(); n != 1 {
+		t.Errorf("%d probes let through, want 1", n)
+	}
+}
+
+// breakerTestClient is a client whose primary is a server answering with
+// the status status holds, and a mirror that works. It counts the requests
+// each gets.
+func breakerTestClient(t *testing.T, status *atomic.Int32) (*BibleClient, *atomic.Int32, *atomic.Int32) {
+	t.Helper()
+	var primary_hits, mirror_hits atomic.Int32
+	upstream := fakeUpstream(t)
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primary_hits.Add(1)
+		if code := int(status.Load()); code != http.StatusOK {
+			w.WriteHeader(code)
+			return
+		}
+		upstream.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(primary.Close)
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirror_hits.Add(1)
+		upstream.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(mirror.Close)
+	bible := NewBibleClient(primary.URL)
+	bible.Retries = 0
+	bible.BreakerFailures = 3
+	bible.BreakerCooldown = 50 * time.Millisecond
+	bible.Mirrors = []string{mirror.URL}
+	return bible, &primary_hits, &mirror_hits
+}
+
+func TestBreakerClient(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	bible, primary_hits, mirror_hits := breakerTestClient(t, &status)
+	primary := upstreamHost(bible.BaseURL)
+	mirror := upstreamHost(bible.Mirrors[0])
+	ctx := context.Background()
+
+	lookup := func() {
+		t.Helper()
+		var verse_info VerseInfo
+		err := bible.GetVerseInfo(ctx, "web", "JHN", "3", &verse_info)
+		if err != nil || len(verse_info.Verses) == 0 {
+			t.Fatalf("GetVerseInfo: %v", err)
+		}
+	}
+
+	// the mirror answers while the primary fails, until its circuit opens
+	for range 3 {
+		lookup()
+	}
+	if n := primary_hits.Load(); n != 3 {
+		t.Errorf("primary got %d requests, want 3", n)
+	}
+	circuits := bible.Circuits()
+	if circuits[primary] != "open" || circuits[mirror] != "closed" {
+		t.Fatalf("circuits %v", circuits)
+	}
+
+	// then it isn't asked at all
+	for range 5 {
+		lookup()
+	}
+	if n := primary_hits.Load(); n != 3 {
+		t.Errorf("primary got %d requests with its circuit open, want 3", n)
+	}
+	if n := mirror_hits.Load(); n != 8 {
+		t.Errorf("mirror got %d requests, want 8", n)
+	}
+	_, err := bible.responseFrom(ctx, bible.BaseURL, "/data/web/JHN/3")
+	if !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Errorf("responseFrom an open circuit: %v", err)
+	}
+
+	// after the cooldown one request checks on it, and closes it
+	status.Store(http.StatusOK)
+	time.Sleep(bible.BreakerCooldown)
+	lookup()
+	if n := primary_hits.Load(); n != 4 {
+		t.Errorf("primary got %d requests after the cooldown, want 4", n)
+	}
+	if state := bible.Circuits()[primary]; state != "closed" {
+		t.Errorf("primary's circuit is %s after it answered", state)
+	}
+}
+
+// A book list that's cached is still served while the circuit is open.
+func TestBreakerStaleCache(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	bible, primary_hits, _ := breakerTestClient(t, &status)
+	bible.Mirrors = nil
+	books := NewBookCache(bible)
+	books.TTL, books.MaxStale = time.Millisecond, 0
+	ctx := context.Background()
+
+	var book_info BookInfo
+	err := books.Get(ctx, "web", &book_info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status.Store(http.StatusBadGateway)
+	for range bible.BreakerFailures {
+		bible.Response(ctx, "/data/web/JHN/3")
+	}
+	if state := bible.Breaker(upstreamHost(bible.BaseURL)).State(); state != "open" {
+		t.Fatalf("circuit is %s", state)
+	}
+	hits := primary_hits.Load()
+	time.Sleep(2 * time.Millisecond)
+	book_info = BookInfo{}
+	err = books.Get(ctx, "web", &book_info)
+	if err != nil || len(book_info.Books) == 0 {
+		t.Errorf("Get with the circuit open: %d books, %v", len(book_info.Books), err)
+	}
+	if n := primary_hits.Load(); n != hits {
+		t.Errorf("the upstream got %d requests with its circuit open", n-hits)
+	}
+}
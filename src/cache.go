@@ -0,0 +1,489 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheEntry is one entry of a cache, as /admin/cache lists it. Size is a
+// rough estimate of the memory it takes, in bytes.
+type CacheEntry struct {
+	Key   string    `json:"key"`
+	Size  int       `json:"size"`
+	Added time.Time `json:"added"`
+}
+
+// InspectableCache is a cache /admin/cache can list and flush.
+type InspectableCache interface {
+	Entries() []CacheEntry
+	// Flush drops the entry under key, or every entry if key is "", and
+	// returns how many were dropped.
+	Flush(key string) int
+}
+
+// flushMap is Flush for caches kept in a map.
+func flushMap[V any](entries map[string]V, key string) int {
+	if key == "" {
+		flushed := len(entries)
+		clear(entries)
+		return flushed
+	}
+	if _, ok := entries[key]; !ok {
+		return 0
+	}
+	delete(entries, key)
+	return 1
+}
+
+// estimateSize guesses the memory a cached value takes from the size of
+// its JSON, which is close enough for text-heavy values.
+func estimateSize(value any) int {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+type bookCacheEntry struct {
+	info    BookInfo
+	slugs   map[string]Book
+	ids     map[string]Book
+	fetched time.Time
+}
+
+func newBookCacheEntry(info BookInfo) bookCacheEntry {
+	slugs := make(map[string]Book, len(info.Books))
+	ids := make(map[string]Book, len(info.Books))
+	books := make([]Book, len(info.Books))
+	for i, book := range info.Books {
+		book.Testament = Testament(book.ID)
+		book.Slug = BookSlug(book.Name)
+		books[i] = book
+		slugs[NormalizeSlug(book.Name)] = book
+		ids[book.ID] = book
+	}
+	info.Books = books
+	return bookCacheEntry{info: info, slugs: slugs, ids: ids, fetched: time.Now()}
+}
+
+// BookCache keeps the book list of each translation in memory so handlers
+// don't refetch it on every page view. Up to MaxStale past its TTL, a book
+// list is served as it is while a fresh one is fetched in the background.
+// Older than that it's fetched before answering, and a failed refresh
+// keeps serving the stale copy. A translation bible-api.com doesn't have
+// is remembered for book_missing_ttl, so asking for it again doesn't.
+type BookCache struct {
+	Client   *BibleClient
+	mu       sync.RWMutex
+	entries  map[string]bookCacheEntry
+	missing  map[string]bookCacheMiss
+	TTL      time.Duration
+	MaxStale time.Duration
+}
+
+// bookCacheMiss is the 404 a translation's book list got.
+type bookCacheMiss struct {
+	err     error
+	fetched time.Time
+}
+
+const (
+	book_missing_ttl = time.Minute
+	// book_missing_limit caps how many unknown translations are remembered,
+	// since anyone can make up more.
+	book_missing_limit = 1000
+)
+
+func NewBookCache(client *BibleClient) *BookCache {
+	return &BookCache{Client: client, entries: map[string]bookCacheEntry{}, TTL: 24 * time.Hour, MaxStale: 24 * time.Hour}
+}
+
+func (c *BookCache) fresh(translation string) (bookCacheEntry, bool) {
+	entry, ok := c.entries[translation]
+	return entry, ok && time.Since(entry.fetched) < c.TTL
+}
+
+// Age reports how long ago a translation's book list was fetched, or false
+// if it has never been.
+func (c *BookCache) Age(translation string) (time.Duration, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[translation]
+	if !ok {
+		return 0, false
+	}
+	return time.Since(entry.fetched), true
+}
+
+// Fetched is when a translation's book list was last fetched, or false if
+// it has never been.
+func (c *BookCache) Fetched(translation string) (time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[translation]
+	return entry.fetched, ok
+}
+
+// Peek returns whatever book list is cached for a translation, however old,
+// without fetching.
+func (c *BookCache) Peek(translation string, book_info *BookInfo) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[translation]
+	if ok {
+		*book_info = entry.info
+	}
+	return ok
+}
+
+func (c *BookCache) Get(ctx context.Context, translation string, book_info *BookInfo) error {
+	entry, err := c.entry(ctx, translation)
+	if err != nil {
+		return err
+	}
+	*book_info = entry.info
+	return nil
+}
+
+// FindBook resolves a URL slug such as "song-of-solomon" or "songofsolomon",
+// an abbreviation like "1cor", or an unambiguous prefix of a book name to
+// its book.
+func (c *BookCache) FindBook(ctx context.Context, translation string, slug string, book *Book) error {
+	entry, err := c.entry(ctx, translation)
+	if err != nil {
+		return err
+	}
+
+	slug = NormalizeSlug(slug)
+	found, ok := entry.slugs[slug]
+	if id, is_abbreviation := LookupAbbreviation(slug); !ok && is_abbreviation {
+		found, ok = entry.ids[id]
+	}
+	if ok {
+		*book = found
+		return nil
+	}
+
+	var candidates []Book
+	for _, b := range entry.info.Books {
+		if strings.HasPrefix(NormalizeSlug(b.Name), slug) {
+			candidates = append(candidates, b)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return fmt.Errorf("%w: %q", ErrBookNotFound, slug)
+	case 1:
+		*book = candidates[0]
+		return nil
+	default:
+		return &AmbiguousBookError{Slug: slug, Candidates: candidates}
+	}
+}
+
+// BookByID looks a book up by its upstream ID, like "JHN".
+func (c *BookCache) BookByID(ctx context.Context, translation string, id string, book *Book) error {
+	entry, err := c.entry(ctx, translation)
+	if err != nil {
+		return err
+	}
+	found, ok := entry.ids[id]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrBookNotFound, id)
+	}
+	*book = found
+	return nil
+}
+
+func (c *BookCache) Entries() []CacheEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entries := make([]CacheEntry, 0, len(c.entries))
+	for translation, entry := range c.entries {
+		size := estimateSize(entry.info) + estimateSize(entry.slugs) + estimateSize(entry.ids)
+		entries = append(entries, CacheEntry{Key: translation, Size: size, Added: entry.fetched})
+	}
+	return entries
+}
+
+func (c *BookCache) Flush(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	flushMap(c.missing, key)
+	return flushMap(c.entries, key)
+}
+
+// entry fetches outside the lock, so a slow or failing fetch of one
+// translation doesn't hold up lookups in the others. sharedFetch makes
+// sure it's only fetched once at a time.
+func (c *BookCache) entry(ctx context.Context, translation string) (bookCacheEntry, error) {
+	c.mu.RLock()
+	entry, ok := c.fresh(translation)
+	stale, have_stale := c.entries[translation]
+	miss, is_missing := c.missing[translation]
+	c.mu.RUnlock()
+	if ok {
+		recordLookup(ctx, "books", "hit")
+		return entry, nil
+	}
+	if have_stale && time.Since(stale.fetched) < c.TTL+c.MaxStale {
+		recordLookup(ctx, "books", "stale")
+		cache_refresher.Go("books/"+translation, func(ctx context.Context) error {
+			return c.refresh(ctx, translation)
+		})
+		return stale, nil
+	}
+	if is_missing && time.Since(miss.fetched) < book_missing_ttl {
+		recordLookup(ctx, "books", "hit")
+		return bookCacheEntry{}, miss.err
+	}
+
+	var info BookInfo
+	err := c.Client.GetBookInfo(ctx, translation, &info)
+	if errors.Is(err, ErrNotFound) {
+		c.mu.Lock()
+		if len(c.missing) >= book_missing_limit {
+			clear(c.missing)
+		}
+		if c.missing == nil {
+			c.missing = map[string]bookCacheMiss{}
+		}
+		c.missing[translation] = bookCacheMiss{err: err, fetched: time.Now()}
+		c.mu.Unlock()
+	}
+	if err != nil {
+		if !have_stale {
+			recordLookup(ctx, "books", "miss")
+			return bookCacheEntry{}, err
+		}
+		recordLookup(ctx, "books", "stale")
+		if !errors.Is(err, context.Canceled) {
+			slog.Warn("book cache refresh failed, serving stale copy", "translation", translation, "err", err)
+		}
+		return stale, nil
+	}
+
+	recordLookup(ctx, "books", "miss")
+	entry = newBookCacheEntry(info)
+	c.mu.Lock()
+	c.entries[translation] = entry
+	delete(c.missing, translation)
+	c.mu.Unlock()
+	return entry, nil
+}
+
+// refresh fetches a translation's book list in place of the stale one.
+func (c *BookCache) refresh(ctx context.Context, translation string) error {
+	var info BookInfo
+	err := c.Client.GetBookInfo(ctx, translation, &info)
+	if err != nil {
+		return err
+	}
+	entry := newBookCacheEntry(info)
+	c.mu.Lock()
+	c.entries[translation] = entry
+	c.mu.Unlock()
+	return nil
+}
+
+type chapterCacheEntry struct {
+	info    ChapterInfo
+	fetched time.Time
+}
+
+// ChapterCache keeps the chapter list of each book, keyed by translation and
+// book ID. Like BookCache it serves stale copies up to MaxStale while
+// refreshing them, and falls back to one when a refresh fails.
+type ChapterCache struct {
+	Client   *BibleClient
+	mu       sync.RWMutex
+	entries  map[string]chapterCacheEntry
+	TTL      time.Duration
+	MaxStale time.Duration
+}
+
+func NewChapterCache(client *BibleClient) *ChapterCache {
+	return &ChapterCache{Client: client, entries: map[string]chapterCacheEntry{}, TTL: 24 * time.Hour, MaxStale: 24 * time.Hour}
+}
+
+// Peek is BookCache.Peek for chapter lists.
+func (c *ChapterCache) Peek(translation string, book string, chapter_info *ChapterInfo) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[translation+"/"+book]
+	if ok {
+		*chapter_info = entry.info
+	}
+	return ok
+}
+
+func (c *ChapterCache) Get(ctx context.Context, translation string, book string, chapter_info *ChapterInfo) error {
+	key := translation + "/" + book
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+	if ok && time.Since(entry.fetched) < c.TTL {
+		recordLookup(ctx, "chapters", "hit")
+		*chapter_info = entry.info
+		return nil
+	}
+	if ok && time.Since(entry.fetched) < c.TTL+c.MaxStale {
+		recordLookup(ctx, "chapters", "stale")
+		cache_refresher.Go("chapters/"+key, func(ctx context.Context) error {
+			var info ChapterInfo
+			return c.refresh(ctx, translation, book, &info)
+		})
+		*chapter_info = entry.info
+		return nil
+	}
+
+	var info ChapterInfo
+	err := c.refresh(ctx, translation, book, &info)
+	if err != nil {
+		if !ok {
+			recordLookup(ctx, "chapters", "miss")
+			return err
+		}
+		recordLookup(ctx, "chapters", "stale")
+		if !errors.Is(err, context.Canceled) {
+			slog.Warn("chapter cache refresh failed, serving stale copy", "err", err)
+		}
+		*chapter_info = entry.info
+		return nil
+	}
+
+	recordLookup(ctx, "chapters", "miss")
+	*chapter_info = info
+	return nil
+}
+
+// refresh fetches a book's chapter list and caches it.
+func (c *ChapterCache) refresh(ctx context.Context, translation string, book string, chapter_info *ChapterInfo) error {
+	err := c.Client.GetChapterInfo(ctx, translation, book, chapter_info)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.entries[translation+"/"+book] = chapterCacheEntry{info: *chapter_info, fetched: time.Now()}
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *ChapterCache) Entries() []CacheEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entries := make([]CacheEntry, 0, len(c.entries))
+	for key, entry := range c.entries {
+		entries = append(entries, CacheEntry{Key: key, Size: estimateSize(entry.info), Added: entry.fetched})
+	}
+	return entries
+}
+
+func (c *ChapterCache) Flush(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return flushMap(c.entries, key)
+}
+
+// TranslationCache keeps the catalogue of translations bible-api.com
+// offers, refreshing it like ChapterCache.
+type TranslationCache struct {
+	Client   *BibleClient
+	mu       sync.RWMutex
+	list     TranslationList
+	fetched  time.Time
+	TTL      time.Duration
+	MaxStale time.Duration
+}
+
+func NewTranslationCache(client *BibleClient) *TranslationCache {
+	return &TranslationCache{Client: client, TTL: 24 * time.Hour, MaxStale: 24 * time.Hour}
+}
+
+func (c *TranslationCache) Get(ctx context.Context, translation_list *TranslationList) error {
+	c.mu.RLock()
+	list, fetched := c.list, c.fetched
+	c.mu.RUnlock()
+	if !fetched.IsZero() && time.Since(fetched) < c.TTL {
+		recordLookup(ctx, "translations", "hit")
+		*translation_list = list
+		return nil
+	}
+	if !fetched.IsZero() && time.Since(fetched) < c.TTL+c.MaxStale {
+		recordLookup(ctx, "translations", "stale")
+		cache_refresher.Go("translations", func(ctx context.Context) error {
+			var fresh TranslationList
+			return c.refresh(ctx, &fresh)
+		})
+		*translation_list = list
+		return nil
+	}
+
+	var fresh TranslationList
+	err := c.refresh(ctx, &fresh)
+	if err != nil {
+		if fetched.IsZero() {
+			recordLookup(ctx, "translations", "miss")
+			return err
+		}
+		recordLookup(ctx, "translations", "stale")
+		if !errors.Is(err, context.Canceled) {
+			slog.Warn("translation cache refresh failed, serving stale copy", "err", err)
+		}
+		*translation_list = list
+		return nil
+	}
+
+	recordLookup(ctx, "translations", "miss")
+	*translation_list = fresh
+	return nil
+}
+
+// refresh fetches the catalogue and caches it.
+func (c *TranslationCache) refresh(ctx context.Context, translation_list *TranslationList) error {
+	err := c.Client.GetTranslations(ctx, translation_list)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.list, c.fetched = *translation_list, time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+// Has reports whether identifier is a known translation. It is used to tell
+// /kjv/john apart from /john/3, so a failed fetch just answers no.
+func (c *TranslationCache) Has(ctx context.Context, identifier string) bool {
+	var translation_list TranslationList
+	if c.Get(ctx, &translation_list) != nil {
+		return false
+	}
+	return translation_list.Has(identifier)
+}
+
+// Entries has one entry, "translations", once the catalogue is fetched.
+func (c *TranslationCache) Entries() []CacheEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.fetched.IsZero() {
+		return nil
+	}
+	return []CacheEntry{{Key: "translations", Size: estimateSize(c.list), Added: c.fetched}}
+}
+
+func (c *TranslationCache) Flush(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fetched.IsZero() || (key != "" && key != "translations") {
+		return 0
+	}
+	c.list, c.fetched = TranslationList{}, time.Time{}
+	return 1
+}
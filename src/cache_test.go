@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// A translation bible-api.com doesn't have is only asked for once in
+// book_missing_ttl.
+func TestBookCacheMissing(t *testing.T) {
+	upstream, hits := countingUpstream(t, "", nil)
+	books := NewBookCache(NewBibleClient(upstream.URL))
+	ctx := context.Background()
+
+	for range 3 {
+		var book_info BookInfo
+		err := books.Get(ctx, "xyz", &book_info)
+		if !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get of an unknown translation: %v", err)
+		}
+	}
+	if n := hitCount(hits, "/data/xyz"); n != 1 {
+		t.Errorf("upstream asked for xyz %d times, want once", n)
+	}
+
+	// a flush forgets it
+	books.Flush("xyz")
+	books.Get(ctx, "xyz", &BookInfo{})
+	if n := hitCount(hits, "/data/xyz"); n != 2 {
+		t.Errorf("upstream asked for xyz %d times after a flush, want twice", n)
+	}
+}
+
+// A slow book list for one translation doesn't hold up the others.
+func TestBookCacheFetchOutsideLock(t *testing.T) {
+	release := make(chan struct{})
+	upstream, hits := countingUpstream(t, "/data/xyz", release)
+	t.Cleanup(func() { close(release) })
+	books := NewBookCache(NewBibleClient(upstream.URL))
+	ctx := context.Background()
+
+	var book_info BookInfo
+	err := books.Get(ctx, "web", &book_info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go books.Get(slow, "xyz", &BookInfo{})
+	for hitCount(hits, "/data/xyz") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- books.Get(ctx, "web", &BookInfo{})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Get of a cached translation: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Get of a cached translation waited on another's fetch")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	index_max_age = time.Hour
+	text_max_age  = 7 * 24 * time.Hour
+)
+
+// bufferedWriter holds a handler's output so a hash of the body can go in
+// the headers before anything is sent.
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedWriter) WriteHeader(status int) {
+	b.status = status
+}
+
+func (b *bufferedWriter) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+// Private marks a response as depending on the visitor's cookies, so
+// shared caches don't keep it and browsers check the ETag every time.
+func Private(w http.ResponseWriter) {
+	if strings.HasPrefix(w.Header().Get("Cache-Control"), "private") {
+		return
+	}
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Add("Vary", "Cookie")
+}
+
+// Cached sets Cache-Control and a strong ETag on successful responses and
+// answers a matching If-None-Match with 304. Bible text never changes, so
+// chapter pages can be cached for a long time, unless the handler made the
+// response Private.
+func Cached(max_age time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		buf := &bufferedWriter{ResponseWriter: w, status: http.StatusOK}
+		next(buf, r)
+
+		if buf.status != http.StatusOK {
+			w.WriteHeader(buf.status)
+			buf.body.WriteTo(w)
+			return
+		}
+
+		sum := sha256.Sum256(buf.body.Bytes())
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		w.Header().Set("ETag", etag)
+		if !strings.HasPrefix(w.Header().Get("Cache-Control"), "private") {
+			w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(max_age.Seconds())))
+		}
+
+		if ETagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(buf.body.Len()))
+		w.WriteHeader(http.StatusOK)
+		buf.body.WriteTo(w)
+	}
+}
+
+// ETagMatches reports whether an If-None-Match header names etag, using the
+// weak comparison If-None-Match calls for.
+func ETagMatches(if_none_match string, etag string) bool {
+	if if_none_match == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(if_none_match, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
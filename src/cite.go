@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Citation is a quotation of some verses with what is needed to attribute
+// it. Verses is the "16-18" or "1,3" part of the reference. A passage that
+// runs on past Chapter, like John 3:16-4:2, has EndChapter set instead, and
+// runs from the start of Verses to EndVerse.
+type Citation struct {
+	Quote       string
+	Book        Book
+	Chapter     int
+	Verses      []VerseRange
+	EndChapter  int
+	EndVerse    int
+	Translation Translation
+}
+
+// CitationStyle formats a citation as plain text.
+type CitationStyle func(c Citation) string
+
+// citation_styles are the values of /cite?style=.
+var citation_styles = map[string]CitationStyle{
+	"default": defaultCitation,
+	"sbl":     sblCitation,
+	"mla":     mlaCitation,
+}
+
+// sbl_books are the SBL Handbook abbreviations of book names, by upstream
+// ID. Books without one, like the deuterocanon, are written out in full.
+var sbl_books = map[string]string{
+	"GEN": "Gen", "EXO": "Exod", "LEV": "Lev", "NUM": "Num", "DEU": "Deut",
+	"JOS": "Josh", "JDG": "Judg", "RUT": "Ruth", "1SA": "1 Sam", "2SA": "2 Sam",
+	"1KI": "1 Kgs", "2KI": "2 Kgs", "1CH": "1 Chr", "2CH": "2 Chr", "EZR": "Ezra",
+	"NEH": "Neh", "EST": "Esth", "JOB": "Job", "PSA": "Ps", "PRO": "Prov",
+	"ECC": "Eccl", "SNG": "Song", "ISA": "Isa", "JER": "Jer", "LAM": "Lam",
+	"EZK": "Ezek", "DAN": "Dan", "HOS": "Hos", "JOL": "Joel", "AMO": "Amos",
+	"OBA": "Obad", "JON": "Jonah", "MIC": "Mic", "NAM": "Nah", "HAB": "Hab",
+	"ZEP": "Zeph", "HAG": "Hag", "ZEC": "Zech", "MAL": "Mal",
+	"MAT": "Matt", "MRK": "Mark", "LUK": "Luke", "JHN": "John", "ACT": "Acts",
+	"ROM": "Rom", "1CO": "1 Cor", "2CO": "2 Cor", "GAL": "Gal", "EPH": "Eph",
+	"PHP": "Phil", "COL": "Col", "1TH": "1 Thess", "2TH": "2 Thess", "1TI": "1 Tim",
+	"2TI": "2 Tim", "TIT": "Titus", "PHM": "Phlm", "HEB": "Heb", "JAS": "Jas",
+	"1PE": "1 Pet", "2PE": "2 Pet", "1JN": "1 John", "2JN": "2 John", "3JN": "3 John",
+	"JUD": "Jude", "REV": "Rev",
+}
+
+// mla_books are the MLA Handbook abbreviations of book names, by upstream
+// ID.
+var mla_books = map[string]string{
+	"GEN": "Gen.", "EXO": "Exod.", "LEV": "Lev.", "NUM": "Num.", "DEU": "Deut.",
+	"JOS": "Josh.", "JDG": "Judg.", "RUT": "Ruth", "1SA": "1 Sam.", "2SA": "2 Sam.",
+	"1KI": "1 Kings", "2KI": "2 Kings", "1CH": "1 Chron.", "2CH": "2 Chron.", "EZR": "Ezra",
+	"NEH": "Neh.", "EST": "Esth.", "JOB": "Job", "PSA": "Ps.", "PRO": "Prov.",
+	"ECC": "Eccles.", "SNG": "Song of Sol.", "ISA": "Isa.", "JER": "Jer.", "LAM": "Lam.",
+	"EZK": "Ezek.", "DAN": "Dan.", "HOS": "Hos.", "JOL": "Joel", "AMO": "Amos",
+	"OBA": "Obad.", "JON": "Jon.", "MIC": "Mic.", "NAM": "Nah.", "HAB": "Hab.",
+	"ZEP": "Zeph.", "HAG": "Hag.", "ZEC": "Zech.", "MAL": "Mal.",
+	"MAT": "Matt.", "MRK": "Mark", "LUK": "Luke", "JHN": "John", "ACT": "Acts",
+	"ROM": "Rom.", "1CO": "1 Cor.", "2CO": "2 Cor.", "GAL": "Gal.", "EPH": "Eph.",
+	"PHP": "Phil.", "COL": "Col.", "1TH": "1 Thess.", "2TH": "2 Thess.", "1TI": "1 Tim.",
+	"2TI": "2 Tim.", "TIT": "Tit.", "PHM": "Philem.", "HEB": "Heb.", "JAS": "Jas.",
+	"1PE": "1 Pet.", "2PE": "2 Pet.", "1JN": "1 John", "2JN": "2 John", "3JN": "3 John",
+	"JUD": "Jude", "REV": "Rev.",
+}
+
+func abbreviatedBook(abbreviations map[string]string, book Book) string {
+	if name, ok := abbreviations[book.ID]; ok {
+		return name
+	}
+	return book.Name
+}
+
+// location writes the chapter and verses of c, with separator between a
+// chapter and its verse and dash between the ends of a range.
+func (c Citation) location(separator string, dash string) string {
+	if c.EndChapter > c.Chapter {
+		return fmt.Sprintf("%d%s%d%s%d%s%d", c.Chapter, separator, c.Verses[0].Start, dash, c.EndChapter, separator, c.EndVerse)
+	}
+	return fmt.Sprintf("%d%s%s", c.Chapter, separator, strings.ReplaceAll(FormatVerseRanges(c.Verses), "-", dash))
+}
+
+// defaultCitation is `"…" — John 3:16 (World English Bible, Public Domain)`.
+func defaultCitation(c Citation) string {
+	attribution := c.Translation.Name
+	if c.Translation.License != "" {
+		attribution += ", " + c.Translation.License
+	}
+	return fmt.Sprintf("\"%s\" — %s %s (%s)", c.Quote, c.Book.Name, c.location(":", "-"), attribution)
+}
+
+// sblCitation is `"…" (John 3:16 WEB)`, with the book abbreviated and an en
+// dash in ranges.
+func sblCitation(c Citation) string {
+	return fmt.Sprintf("\"%s\" (%s %s %s)", c.Quote, abbreviatedBook(sbl_books, c.Book), c.location(":", "–"), strings.ToUpper(c.Translation.Identifier))
+}
+
+// mlaCitation is `"…" (World English Bible, John 3.16)`, naming the
+// translation first and separating chapter and verse with a period.
+func mlaCitation(c Citation) string {
+	return fmt.Sprintf("\"%s\" (%s, %s %s)", c.Quote, c.Translation.Name, abbreviatedBook(mla_books, c.Book), c.location(".", "-"))
+}
+
+// CitationQuote joins the text of verses into one quotation. Gaps between
+// ranges become an ellipsis, and double quotes inside the text become
+// single ones so they don't close the quotation. A chapter's first verse
+// follows on from the one before it.
+func CitationQuote(verses []Verse) string {
+	var b strings.Builder
+	for i, verse := range verses {
+		if i > 0 {
+			previous := verses[i-1]
+			if verse.Chapter == previous.Chapter && verse.Verse == previous.Verse+1 || verse.Chapter == previous.Chapter+1 && verse.Verse == 1 {
+				b.WriteString(" ")
+			} else {
+				b.WriteString(" … ")
+			}
+		}
+		b.WriteString(verseText(verse.Text))
+	}
+	return strings.NewReplacer("\"", "'", "“", "‘", "”", "’").Replace(b.String())
+}
+
+func citationStyle(r *http.Request) (CitationStyle, error) {
+	name := r.URL.Query().Get("style")
+	if name == "" {
+		name = "default"
+	}
+	style, ok := citation_styles[name]
+	if !ok {
+		var names []string
+		for name := range citation_styles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, &InvalidOptionError{Name: "style", Value: name, Options: names}
+	}
+	return style, nil
+}
+
+// CiteLink points at the plain text citation of one verse.
+func (s *Server) CiteLink(translation string, book Book, chapter int, verse int) Link {
+	link := s.Path("cite", "book", BookSlug(book.Name), "chapter", strconv.Itoa(chapter), "verses", strconv.Itoa(verse))
+	if translation != default_translation {
+		link += "?translation=" + url.QueryEscape(translation)
+	}
+	return Link{Text: "Copy citation", URL: link}
+}
+
+// getCite serves /cite/{book}/{chapter}/{verses} as text/plain, ready to
+// paste.
+func (s *Server) getCite(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	style, err := citationStyle(r)
+	if err != nil {
+		textError(w, r, err)
+		return
+	}
+	ranges, err := ParseVerseRanges(vars["verses"])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("\"%s\" isn't a verse or range of verses.", vars["verses"]), http.StatusBadRequest)
+		return
+	}
+
+	var book Book
+	var verse_info VerseInfo
+	err = s.LoadVerses(r.Context(), RequestTranslation(r), vars["book"], vars["chapter"], &book, &verse_info)
+	if err != nil {
+		textError(w, r, err)
+		return
+	}
+	chapter, _ := strconv.Atoi(vars["chapter"])
+	verses := PassageVerses(verse_info.Verses, ranges)
+	if len(verses) == 0 {
+		textError(w, r, &VerseNotFoundError{Reference: fmt.Sprintf("%s %d", book.Name, chapter), Verse: ranges[0].Start, Last: LastVerse(verse_info.Verses)})
+		return
+	}
+
+	citation := Citation{Quote: CitationQuote(verses), Book: book, Chapter: chapter, Verses: ranges, Translation: verse_info.Translation}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, style(citation))
+}
+
+// getCiteReference serves /cite?ref=John+3:16-4:2 like getCite, for
+// passages that run across chapters.
+func (s *Server) getCiteReference(w http.ResponseWriter, r *http.Request) {
+	style, err := citationStyle(r)
+	if err != nil {
+		textError(w, r, err)
+		return
+	}
+	text := r.URL.Query().Get("ref")
+	ref, err := ParseReference(text)
+	if err != nil || ref.ChapterStart == 0 {
+		http.Error(w, fmt.Sprintf("\"%s\" isn't a reference like \"John 3:16\".", text), http.StatusBadRequest)
+		return
+	}
+	if ref.ChapterEnd-ref.ChapterStart >= max_reference_chapters {
+		http.Error(w, fmt.Sprintf("That's more than %d chapters.", max_reference_chapters), http.StatusBadRequest)
+		return
+	}
+
+	translation := RequestTranslation(r)
+	var book Book
+	err = s.Books.FindBook(r.Context(), translation, ref.Book, &book)
+	if err != nil {
+		textError(w, r, err)
+		return
+	}
+	var verses []Verse
+	var first VerseInfo
+	var attribution Translation
+	for chapter := ref.ChapterStart; chapter <= ref.ChapterEnd; chapter++ {
+		var verse_info VerseInfo
+		err = s.LoadVerses(r.Context(), translation, BookSlug(book.Name), strconv.Itoa(chapter), &book, &verse_info)
+		if err != nil {
+			textError(w, r, err)
+			return
+		}
+		if chapter == ref.ChapterStart {
+			first = verse_info
+		}
+		attribution = verse_info.Translation
+		for _, verse := range verse_info.Verses {
+			if ref.Includes(chapter, verse.Verse) {
+				verses = append(verses, verse)
+			}
+		}
+	}
+	if len(verses) == 0 {
+		textError(w, r, &VerseNotFoundError{Reference: fmt.Sprintf("%s %d", book.Name, ref.ChapterStart), Verse: ref.VerseStart, Last: LastVerse(first.Verses)})
+		return
+	}
+
+	start, end := verses[0], verses[len(verses)-1]
+	citation := Citation{Quote: CitationQuote(verses), Book: book, Chapter: start.Chapter, Verses: []VerseRange{{start.Verse, end.Verse}}, Translation: attribution}
+	if end.Chapter > start.Chapter {
+		citation.Verses = []VerseRange{{start.Verse, start.Verse}}
+		citation.EndChapter, citation.EndVerse = end.Chapter, end.Verse
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, style(citation))
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var (
+	web_translation = Translation{Identifier: "web", Name: "World English Bible", License: "Public Domain"}
+	john            = Book{ID: "JHN", Name: "John"}
+	song            = Book{ID: "SNG", Name: "Song of Solomon"}
+)
+
+// citationTest is a citation and what a style should write for it.
+type citationTest struct {
+	name     string
+	citation Citation
+	want     string
+}
+
+func testCitationStyle(t *testing.T, style string, tests []citationTest) {
+	t.Helper()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := citation_styles[style](test.citation); got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+var (
+	jesus_wept   = Citation{Quote: "Jesus wept.", Book: john, Chapter: 11, Verses: []VerseRange{{35, 35}}, Translation: web_translation}
+	rose         = Citation{Quote: "I am a rose of Sharon, a lily of the valleys. As a lily among thorns", Book: song, Chapter: 2, Verses: []VerseRange{{1, 2}}, Translation: web_translation}
+	two_chapters = Citation{Quote: "Verse 36 of John 3. Now when the Lord knew…", Book: john, Chapter: 3, Verses: []VerseRange{{36, 36}}, EndChapter: 4, EndVerse: 2, Translation: web_translation}
+	separate     = Citation{Quote: "For God so loved the world … Verse 18.", Book: john, Chapter: 3, Verses: []VerseRange{{16, 16}, {18, 18}}, Translation: web_translation}
+	tobit        = Citation{Quote: "…", Book: Book{ID: "TOB", Name: "Tobit"}, Chapter: 1, Verses: []VerseRange{{1, 1}}, Translation: web_translation}
+	kjv          = Translation{Identifier: "kjv", Name: "King James Version"}
+)
+
+func TestDefaultCitation(t *testing.T) {
+	unlicensed := jesus_wept
+	unlicensed.Translation = kjv
+	testCitationStyle(t, "default", []citationTest{
+		{"single verse", jesus_wept, `"Jesus wept." — John 11:35 (World English Bible, Public Domain)`},
+		{"range", rose, `"I am a rose of Sharon, a lily of the valleys. As a lily among thorns" — Song of Solomon 2:1-2 (World English Bible, Public Domain)`},
+		{"multi-chapter", two_chapters, `"Verse 36 of John 3. Now when the Lord knew…" — John 3:36-4:2 (World English Bible, Public Domain)`},
+		{"separate ranges", separate, `"For God so loved the world … Verse 18." — John 3:16,18 (World English Bible, Public Domain)`},
+		{"no license", unlicensed, `"Jesus wept." — John 11:35 (King James Version)`},
+	})
+}
+
+func TestSBLCitation(t *testing.T) {
+	unlicensed := jesus_wept
+	unlicensed.Translation = kjv
+	testCitationStyle(t, "sbl", []citationTest{
+		{"single verse", jesus_wept, `"Jesus wept." (John 11:35 WEB)`},
+		{"range", rose, `"I am a rose of Sharon, a lily of the valleys. As a lily among thorns" (Song 2:1–2 WEB)`},
+		{"multi-chapter", two_chapters, `"Verse 36 of John 3. Now when the Lord knew…" (John 3:36–4:2 WEB)`},
+		{"separate ranges", separate, `"For God so loved the world … Verse 18." (John 3:16,18 WEB)`},
+		{"no license", unlicensed, `"Jesus wept." (John 11:35 KJV)`},
+		{"book without an abbreviation", tobit, `"…" (Tobit 1:1 WEB)`},
+	})
+}
+
+func TestMLACitation(t *testing.T) {
+	testCitationStyle(t, "mla", []citationTest{
+		{"single verse", jesus_wept, `"Jesus wept." (World English Bible, John 11.35)`},
+		{"range", rose, `"I am a rose of Sharon, a lily of the valleys. As a lily among thorns" (World English Bible, Song of Sol. 2.1-2)`},
+		{"multi-chapter", two_chapters, `"Verse 36 of John 3. Now when the Lord knew…" (World English Bible, John 3.36-4.2)`},
+		{"separate ranges", separate, `"For God so loved the world … Verse 18." (World English Bible, John 3.16,18)`},
+		{"book without an abbreviation", tobit, `"…" (World English Bible, Tobit 1.1)`},
+	})
+}
+
+func TestCitationQuote(t *testing.T) {
+	tests := []struct {
+		name   string
+		verses []Verse
+		want   string
+	}{
+		{"one verse", []Verse{{Verse: 35, Text: "Jesus wept.\n"}}, "Jesus wept."},
+		{"consecutive verses", []Verse{{Verse: 1, Text: "I am a rose of Sharon,\na lily of the valleys.\n"}, {Verse: 2, Text: "As a lily among thorns\n"}}, "I am a rose of Sharon, a lily of the valleys. As a lily among thorns"},
+		{"into the next chapter", []Verse{{Chapter: 3, Verse: 36, Text: "Verse 36 of John 3.\n"}, {Chapter: 4, Verse: 1, Text: "Now when the Lord knew\n"}}, "Verse 36 of John 3. Now when the Lord knew"},
+		{"a gap", []Verse{{Verse: 16, Text: "For God so loved the world\n"}, {Verse: 18, Text: "Verse 18.\n"}}, "For God so loved the world … Verse 18."},
+		{"quotes inside", []Verse{{Verse: 3, Text: "God said, “Let there be light,” and \"there was\" light.\n"}}, "God said, ‘Let there be light,’ and 'there was' light."},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := CitationQuote(test.verses); got != test.want {
+				t.Errorf("CitationQuote = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCitePage(t *testing.T) {
+	handler := newTestServer(t)
+	tests := []struct {
+		target string
+		status int
+		want   string
+	}{
+		{"/cite/john/3/16", http.StatusOK, "\"For God so loved the world, that he gave his one and only Son, that whoever believes in him should not perish, but have eternal life.\" — John 3:16 (World English Bible, Public Domain)\n"},
+		{"/cite/john/3/16?style=sbl", http.StatusOK, "\"For God so loved the world, that he gave his one and only Son, that whoever believes in him should not perish, but have eternal life.\" (John 3:16 WEB)\n"},
+		{"/cite/john/3/17-18?style=mla", http.StatusOK, "\"For God didn’t send his Son into the world to judge the world, but that the world should be saved through him. Verse 18 of John 3.\" (World English Bible, John 3.17-18)\n"},
+		{"/cite/john/3/16?style=chicago", http.StatusBadRequest, "style"},
+		{"/cite/john/3/x", http.StatusBadRequest, `"x" isn't a verse or range of verses.`},
+		{"/cite/john/3/40", http.StatusNotFound, "36"},
+	}
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			w := get(t, handler, test.target)
+			if w.Code != test.status {
+				t.Fatalf("GET %s: status %d, want %d", test.target, w.Code, test.status)
+			}
+			if content_type := w.Header().Get("Content-Type"); content_type != "text/plain; charset=utf-8" {
+				t.Errorf("GET %s: Content-Type %q", test.target, content_type)
+			}
+			body := w.Body.String()
+			if test.status == http.StatusOK && body != test.want || !strings.Contains(body, test.want) {
+				t.Errorf("GET %s: body\n%s\nwant\n%s", test.target, body, test.want)
+			}
+		})
+	}
+}
+
+func TestCiteLink(t *testing.T) {
+	body := get(t, newTestServer(t), "/john/3/16").Body.String()
+	if want := `href="/cite/john/3/16"`; !strings.Contains(body, want) {
+		t.Errorf("verse page doesn't link to its citation with %s", want)
+	}
+}
+
+// john4 is the first verses of John 4, which the fixtures don't have, so
+// that a passage can run on from John 3.
+const john4 = `{"translation": {"identifier": "web", "name": "World English Bible", "license": "Public Domain"}, "verses": [
+	{"book_id": "JHN", "book": "John", "chapter": 4, "verse": 1, "text": "Now when the Lord knew\n"},
+	{"book_id": "JHN", "book": "John", "chapter": 4, "verse": 2, "text": "Verse 2 of John 4.\n"},
+	{"book_id": "JHN", "book": "John", "chapter": 4, "verse": 3, "text": "Verse 3 of John 4.\n"}
+]}`
+
+func TestCiteReference(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/data/web/JHN/4" {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, john4)
+			return
+		}
+		serveFixture(w, r)
+	}))
+	t.Cleanup(upstream.Close)
+	handler := testServer(t, upstream.URL).Routes(false, false)
+	tests := []struct {
+		target string
+		status int
+		want   string
+	}{
+		{"/cite?ref=John+3:16", http.StatusOK, "\"For God so loved the world, that he gave his one and only Son, that whoever believes in him should not perish, but have eternal life.\" — John 3:16 (World English Bible, Public Domain)\n"},
+		{"/cite?ref=John+3:35-36&style=mla", http.StatusOK, "\"Verse 35 of John 3. Verse 36 of John 3.\" (World English Bible, John 3.35-36)\n"},
+		{"/cite?ref=John+3:36-4:2", http.StatusOK, "\"Verse 36 of John 3. Now when the Lord knew Verse 2 of John 4.\" — John 3:36-4:2 (World English Bible, Public Domain)\n"},
+		{"/cite?ref=John+3:36-4:2&style=sbl", http.StatusOK, "\"Verse 36 of John 3. Now when the Lord knew Verse 2 of John 4.\" (John 3:36–4:2 WEB)\n"},
+		{"/cite?ref=John+3:36-4:2&style=mla", http.StatusOK, "\"Verse 36 of John 3. Now when the Lord knew Verse 2 of John 4.\" (World English Bible, John 3.36-4.2)\n"},
+		{"/cite?ref=John+3:16&style=chicago", http.StatusBadRequest, "style"},
+		{"/cite?ref=John", http.StatusBadRequest, `"John" isn't a reference like "John 3:16".`},
+		{"/cite?ref=nonsense+3:16", http.StatusNotFound, "doesn't exist"},
+		{"/cite?ref=John+3:40", http.StatusNotFound, "36"},
+		{"/cite?ref=John+3-30", http.StatusBadRequest, "chapters"},
+	}
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			w := get(t, handler, test.target)
+			if w.Code != test.status {
+				t.Fatalf("GET %s: status %d, want %d: %s", test.target, w.Code, test.status, w.Body)
+			}
+			body := w.Body.String()
+			if test.status == http.StatusOK && body != test.want || !strings.Contains(body, test.want) {
+				t.Errorf("GET %s: body\n%s\nwant\n%s", test.target, body, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BibleClient talks to bible-api.com, or a mirror of it at BaseURL, falling
+// back to the Mirrors in order when it can't be reached. HTTP has a timeout
+// so a hung connection can't hold a handler forever.
+type BibleClient struct {
+	BaseURL string
+	Mirrors []string
+	HTTP    *http.Client
+	// Store, when there is one, keeps what's fetched so it survives
+	// restarts, and is read before asking upstream.
+	Store *Store
+	// Retries is how many times a failed GET is retried, and RetryBudget
+	// caps the time spent on one request across all attempts.
+	Retries     int
+	RetryBudget time.Duration
+	// BreakerFailures and BreakerCooldown configure the circuit breaker
+	// each upstream host gets.
+	BreakerFailures int
+	BreakerCooldown time.Duration
+	group           FetchGroup
+	breakers_mu     sync.Mutex
+	breakers        map[string]*Breaker
+}
+
+func NewBibleClient(base_url string) *BibleClient {
+	return &BibleClient{
+		BaseURL: strings.TrimSuffix(base_url, "/"),
+		HTTP: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				MaxIdleConns:          20,
+				MaxIdleConnsPerHost:   10,
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   5 * time.Second,
+				ResponseHeaderTimeout: 10 * time.Second,
+			},
+		},
+		Retries:         2,
+		RetryBudget:     15 * time.Second,
+		BreakerFailures: 5,
+		BreakerCooldown: 30 * time.Second,
+		breakers:        map[string]*Breaker{},
+	}
+}
+
+// Breaker is the circuit breaker of an upstream host, made the first time
+// it's asked for.
+func (c *BibleClient) Breaker(host string) *Breaker {
+	c.breakers_mu.Lock()
+	defer c.breakers_mu.Unlock()
+	breaker, ok := c.breakers[host]
+	if !ok {
+		breaker = &Breaker{Host: host, Failures: c.BreakerFailures, Cooldown: c.BreakerCooldown}
+		c.breakers[host] = breaker
+	}
+	return breaker
+}
+
+// Circuits is the circuit state of the primary and each mirror, by host.
+func (c *BibleClient) Circuits() map[string]string {
+	circuits := map[string]string{}
+	for _, base_url := range append([]string{c.BaseURL}, c.Mirrors...) {
+		host := upstreamHost(base_url)
+		circuits[host] = c.Breaker(host).State()
+	}
+	return circuits
+}
+
+// Response GETs path from BaseURL, or from the first of the Mirrors that
+// answers when it can't be reached. A mirror's answer has its own base URL
+// swapped for BaseURL, so it can't be told apart from the primary's.
+//
+// A host whose circuit is open is skipped straight away, so while the
+// primary is down requests go to a mirror without waiting on it, and once
+// its cooldown is over the next request checks on it again.
+func (c *BibleClient) Response(ctx context.Context, path string) (*http.Response, error) {
+	resp, err := c.responseFrom(ctx, c.BaseURL, path)
+	for _, mirror := range c.Mirrors {
+		if err == nil || !retryable(err) || ctx.Err() != nil {
+			break
+		}
+		level := slog.LevelWarn
+		if errors.Is(err, ErrCircuitOpen) {
+			// the circuit opening was logged already
+			level = slog.LevelDebug
+		}
+		Logger(ctx).Log(ctx, level, "upstream unavailable, trying mirror", "mirror", mirror, "err", err)
+		resp, err = c.responseFrom(ctx, mirror, path)
+		if err == nil {
+			err = rebaseResponse(resp, mirror, c.BaseURL)
+		}
+	}
+	return resp, err
+}
+
+// responseFrom GETs path from one upstream, retrying network errors, 429s
+// and 5xxs with backoff until Retries, RetryBudget or ctx's deadline runs
+// out. While the host's circuit is open it fails straight away with
+// ErrCircuitOpen.
+func (c *BibleClient) responseFrom(ctx context.Context, base_url string, path string) (*http.Response, error) {
+	request_url := base_url + path
+	host := upstreamHost(base_url)
+	breaker := c.Breaker(host)
+	deadline := time.Now().Add(c.RetryBudget)
+	if ctx_deadline, ok := ctx.Deadline(); ok && ctx_deadline.Before(deadline) {
+		deadline = ctx_deadline
+	}
+	var last_err error
+	for attempt := 1; ; attempt++ {
+		if !breaker.Allow() {
+			observeUpstream(path, 0, ErrCircuitOpen)
+			if last_err != nil {
+				// the circuit opened while retrying
+				return nil, last_err
+			}
+			return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, host)
+		}
+		start := time.Now()
+		resp, wait, err := c.attempt(ctx, request_url)
+		last_err = err
+		breaker.Record(err)
+		observeUpstream(path, time.Since(start), err)
+		if err == nil {
+			upstream_served.WithLabelValues(host).Inc()
+			Logger(ctx).Debug("upstream answered", "host", host, "url", request_url, "attempts", attempt)
+			if attempt > 1 {
+				Logger(ctx).Info("upstream request succeeded after retrying", "url", request_url, "attempts", attempt)
+			}
+			return resp, nil
+		}
+
+		if wait == 0 {
+			wait = backoff(attempt)
+		}
+		if attempt > c.Retries || !retryable(err) || ctx.Err() != nil || time.Now().Add(wait).After(deadline) {
+			if attempt > 1 {
+				Logger(ctx).Warn("upstream request failed", "url", request_url, "attempts", attempt, "err", err)
+			}
+			return nil, err
+		}
+
+		Logger(ctx).Warn("retrying upstream request", "url", request_url, "attempt", attempt, "wait", wait, "err", err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// rebaseResponse swaps a mirror's base URL for the primary's in the body
+// of resp, where bible-api.com links books and chapters, so what's cached
+// and shown is the same whichever host answered.
+func rebaseResponse(resp *http.Response, mirror string, primary string) error {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUpstreamUnavailable, err)
+	}
+	body = bytes.ReplaceAll(body, []byte(mirror), []byte(primary))
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	return nil
+}
+
+// upstreamHost is the host of base_url, which its circuit breaker goes by.
+func upstreamHost(base_url string) string {
+	u, err := url.Parse(base_url)
+	if err != nil || u.Host == "" {
+		return base_url
+	}
+	return u.Host
+}
+
+// attempt makes a single request, also returning how long a 429 or 503
+// asked to be left alone for.
+func (c *BibleClient) attempt(ctx context.Context, request_url string) (_ *http.Response, _ time.Duration, err error) {
+	var status int
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, request_url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if tracer != nil {
+		span := startUpstreamSpan(ctx, req)
+		defer func() {
+			endUpstreamSpan(span, status, err)
+		}()
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", ErrUpstreamUnavailable, err)
+	}
+	status = resp.StatusCode
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			err = ErrNotFound
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+			err = ErrUpstreamUnavailable
+		default:
+			err = ErrBadUpstreamResponse
+		}
+		return nil, retryAfter(resp.Header), fmt.Errorf("%w: GET %s returned %s", err, request_url, resp.Status)
+	}
+	return resp, 0, nil
+}
+
+func (c *BibleClient) GetTranslations(ctx context.Context, translation_list *TranslationList) error {
+	return sharedFetch(ctx, &c.group, "translations", translation_list, c.fetchTranslations)
+}
+
+func (c *BibleClient) GetBookInfo(ctx context.Context, translation string, book_info *BookInfo) error {
+	return sharedFetch(ctx, &c.group, "books/"+translation, book_info, func(ctx context.Context, book_info *BookInfo) error {
+		return c.fetchBookInfo(ctx, translation, book_info)
+	})
+}
+
+func (c *BibleClient) GetChapterInfo(ctx context.Context, translation string, book string, chapter_info *ChapterInfo) error {
+	return sharedFetch(ctx, &c.group, "chapters/"+translation+"/"+book, chapter_info, func(ctx context.Context, chapter_info *ChapterInfo) error {
+		return c.fetchChapterInfo(ctx, translation, book, chapter_info)
+	})
+}
+
+func (c *BibleClient) GetVerseInfo(ctx context.Context, translation string, book string, chapter string, verse_info *VerseInfo) error {
+	err := sharedFetch(ctx, &c.group, "verses/"+translation+"/"+book+"/"+chapter, verse_info, func(ctx context.Context, verse_info *VerseInfo) error {
+		return c.fetchVerseInfo(ctx, translation, book, chapter, verse_info)
+	})
+	if err == nil {
+		word_counts.Record(translation, book, chapter, verse_info.Verses)
+	}
+	return err
+}
+
+func (c *BibleClient) fetchTranslations(ctx context.Context, translation_list *TranslationList) error {
+	if local_data != nil {
+		translation_list.Translations = []Translation{local_data.BookInfo.Translation}
+		return nil
+	}
+	resp, err := c.Response(ctx, "/data")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(&translation_list)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrBadUpstreamResponse, err)
+	}
+	return nil
+}
+
+func (c *BibleClient) fetchBookInfo(ctx context.Context, translation string, book_info *BookInfo) error {
+	if local_data != nil {
+		return local_data.GetBookInfo(translation, book_info)
+	}
+	if c.Store != nil {
+		err := c.Store.LoadBookInfo(ctx, c.BaseURL, translation, book_info)
+		if err == nil {
+			return nil
+		}
+		storeError(err)
+	}
+
+	resp, err := c.Response(ctx, "/data/"+url.PathEscape(translation))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(&book_info)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrBadUpstreamResponse, err)
+	}
+
+	if c.Store != nil {
+		storeError(c.Store.SaveBookInfo(ctx, *book_info))
+	}
+	return nil
+}
+
+func (c *BibleClient) fetchChapterInfo(ctx context.Context, translation string, book string, chapter_info *ChapterInfo) error {
+	if local_data != nil {
+		return local_data.GetChapterInfo(translation, book, chapter_info)
+	}
+	if c.Store != nil {
+		err := c.Store.LoadChapterInfo(ctx, c.BaseURL, translation, book, chapter_info)
+		if err == nil {
+			return nil
+		}
+		storeError(err)
+	}
+
+	resp, err := c.Response(ctx, fmt.Sprintf("/data/%s/%s", url.PathEscape(translation), url.PathEscape(book)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(&chapter_info)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrBadUpstreamResponse, err)
+	}
+
+	if c.Store != nil {
+		storeError(c.Store.SaveChapterInfo(ctx, translation, book, *chapter_info))
+	}
+	return nil
+}
+
+func (c *BibleClient) fetchVerseInfo(ctx context.Context, translation string, book string, chapter string, verse_info *VerseInfo) error {
+	if local_data != nil {
+		return local_data.GetVerseInfo(translation, book, chapter, verse_info)
+	}
+	if c.Store != nil {
+		err := c.Store.LoadVerseInfo(ctx, translation, book, chapter, verse_info)
+		if err == nil {
+			return nil
+		}
+		storeError(err)
+	}
+
+	resp, err := c.Response(ctx, fmt.Sprintf("/data/%s/%s/%s", url.PathEscape(translation), url.PathEscape(book), url.PathEscape(chapter)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(&verse_info)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrBadUpstreamResponse, err)
+	}
+
+	if c.Store != nil {
+		storeError(c.Store.SaveVerseInfo(ctx, translation, book, *verse_info))
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpstreamPathsEscaped(t *testing.T) {
+	var paths []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(upstream.Close)
+	bible := NewBibleClient(upstream.URL)
+
+	ctx := context.Background()
+	bible.GetBookInfo(ctx, "a/b", &BookInfo{})
+	bible.GetChapterInfo(ctx, "web", "../JHN", &ChapterInfo{})
+	bible.GetVerseInfo(ctx, "web", "JHN", "3?x=1", &VerseInfo{})
+	want := []string{"/data/a%2Fb", "/data/web/..%2FJHN", "/data/web/JHN/3%3Fx=1"}
+	if !slices.Equal(paths, want) {
+		t.Errorf("requested %q, want %q", paths, want)
+	}
+}
+
+func TestUpstreamTimeout(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/data/web/JHN/3" {
+			// hangs until the client gives up
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		serveFixture(w, r)
+	}))
+	t.Cleanup(upstream.Close)
+	bible := NewBibleClient(upstream.URL)
+	bible.Retries = 0
+	bible.HTTP.Timeout = 50 * time.Millisecond
+	handler := NewServer(bible, nil).Routes(false, false)
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		// json is whether the error comes back as an ErrorResponse
+		json bool
+	}{
+		{"page", "/john/3", http.StatusGatewayTimeout, false},
+		{"api", "/api/v1/john/3", http.StatusGatewayTimeout, true},
+		{"text", "/john/3.txt", http.StatusGatewayTimeout, false},
+		{"other chapter", "/psalms/119", http.StatusOK, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start := time.Now()
+			w := get(t, handler, test.target)
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("GET %s took %v", test.target, elapsed)
+			}
+			if w.Code != test.status {
+				t.Fatalf("GET %s: status %d, want %d", test.target, w.Code, test.status)
+			}
+			if test.status == http.StatusOK {
+				return
+			}
+			message := w.Body.String()
+			if test.json {
+				var response ErrorResponse
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				if err != nil {
+					t.Fatalf("GET %s: %v", test.target, err)
+				}
+				message = response.Error
+			}
+			if !strings.Contains(message, "took too long") {
+				t.Errorf("GET %s: error doesn't say it took too long: %q", test.target, message)
+			}
+		})
+	}
+}
+
+// Only responses bible-api.com sent that couldn't be decoded are blamed on
+// it.
+func TestBadUpstreamResponse(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"verses": [`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	var response ErrorResponse
+	w := get(t, testServer(t, upstream.URL).Routes(false, false), "/api/v1/books")
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if w.Code != http.StatusInternalServerError || response.Error != "bible-api.com sent something we couldn't understand." {
+		t.Errorf("status %d %q", w.Code, response.Error)
+	}
+
+	if status, message := ErrorStatus(errors.New("template failed")); status != http.StatusInternalServerError || strings.Contains(message, "bible-api.com") {
+		t.Errorf("our own failure is %d %q", status, message)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/sync/errgroup"
+)
+
+const max_compare_translations = 6
+
+type CompareColumn struct {
+	Identifier string
+	Name       string
+	Error      string
+}
+
+type CompareRow struct {
+	Verse int
+	Cells []string
+}
+
+type TranslationChoice struct {
+	Identifier string
+	Name       string
+	Selected   bool
+}
+
+// compareTranslations reads ?translations=web,kjv, or the repeated
+// ?translations= the checkbox form sends, dropping blanks and duplicates.
+func compareTranslations(r *http.Request) []string {
+	seen := map[string]bool{}
+	var translations []string
+	for _, value := range r.URL.Query()["translations"] {
+		for _, t := range strings.Split(value, ",") {
+			t = strings.ToLower(strings.TrimSpace(t))
+			if t != "" && !seen[t] {
+				seen[t] = true
+				translations = append(translations, t)
+			}
+		}
+	}
+	if len(translations) == 0 {
+		return []string{default_translation}
+	}
+	return translations
+}
+
+func (s *Server) getCompare(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	book_name := vars["book"]
+	chapter := vars["chapter"]
+	translations := compareTranslations(r)
+	if len(translations) > max_compare_translations {
+		s.renderError(w, r, http.StatusBadRequest, fmt.Sprintf("At most %d translations can be compared at once.", max_compare_translations))
+		return
+	}
+
+	// book IDs are the same in every translation, so the slug only needs
+	// resolving once
+	var book Book
+	number, err := ParseNumber("chapter", chapter)
+	if err == nil {
+		err = s.Books.FindBook(r.Context(), default_translation, book_name, &book)
+	}
+	if err == nil {
+		err = s.CheckChapter(r.Context(), default_translation, book, number)
+	}
+	if err != nil {
+		s.fetchError(w, r, default_translation, book_name, err)
+		return
+	}
+	chapter = strconv.Itoa(number)
+
+	results := make([]VerseInfo, len(translations))
+	errs := make([]error, len(translations))
+	var g errgroup.Group
+	for i, translation := range translations {
+		g.Go(func() error {
+			// a failure only blanks its own column, so it isn't returned
+			errs[i] = s.Bible.GetVerseInfo(r.Context(), translation, book.ID, chapter, &results[i])
+			return nil
+		})
+	}
+	g.Wait()
+
+	page := ComparePage{Reference: fmt.Sprintf("%s %s", book.Name, chapter), Book: BookSlug(book.Name), Chapter: chapter}
+	cells := map[int][]string{}
+	for i, translation := range translations {
+		column := CompareColumn{Identifier: translation, Name: results[i].Translation.Name}
+		if errs[i] != nil {
+			Logger(r.Context()).Error("compare column failed", "translation", translation, "err", errs[i])
+			_, column.Error = ErrorStatus(errs[i])
+		}
+		page.Columns = append(page.Columns, column)
+		for _, verse := range results[i].Verses {
+			if cells[verse.Verse] == nil {
+				cells[verse.Verse] = make([]string, len(translations))
+			}
+			cells[verse.Verse][i] = verse.Text
+		}
+	}
+	for number, row := range cells {
+		page.Rows = append(page.Rows, CompareRow{Verse: number, Cells: row})
+	}
+	sort.Slice(page.Rows, func(i, j int) bool { return page.Rows[i].Verse < page.Rows[j].Verse })
+
+	var translation_list TranslationList
+	if s.Translations.Get(r.Context(), &translation_list) == nil {
+		selected := map[string]bool{}
+		for _, t := range translations {
+			selected[t] = true
+		}
+		for _, t := range translation_list.Translations {
+			page.Choices = append(page.Choices, TranslationChoice{Identifier: t.Identifier, Name: t.Name, Selected: selected[t.Identifier]})
+		}
+	}
+
+	page.Breadcrumbs = s.Breadcrumbs(default_translation, &book, number)
+	s.RenderPage(w, r, http.StatusOK, "compare.html", "Compare "+page.Reference, page)
+}
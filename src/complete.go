@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// max_completions caps the suggestions /api/v1/complete returns.
+const max_completions = 10
+
+// Completion is one suggestion for what is being typed into the jump box.
+type Completion struct {
+	Text    string `json:"text"`
+	Slug    string `json:"slug"`
+	Chapter int    `json:"chapter,omitempty"`
+	URL     string `json:"url"`
+}
+
+// complete_pattern splits "1 john 3" into the book and a chapter number
+// being typed after it.
+var complete_pattern = regexp.MustCompile(`^(.*?[^\d\s].*?)\s*(\d+)$`)
+
+// bookRank scores how well typed matches a book, lower being better, or -1
+// for no match: the full name or an abbreviation of it, then the start of
+// the name, the start of a later word in it ("cor" for 1 Corinthians), the
+// start of an abbreviation, and last a misspelling of the name.
+func bookRank(typed string, book Book) int {
+	slug := NormalizeSlug(typed)
+	name := NormalizeSlug(book.Name)
+	if slug == "" {
+		return -1
+	}
+	if id, ok := LookupAbbreviation(slug); slug == name || (ok && id == book.ID) {
+		return 0
+	}
+	if strings.HasPrefix(name, slug) {
+		return 1
+	}
+	words := strings.Fields(strings.ToLower(book.Name))
+	for _, word := range words[1:] {
+		if strings.HasPrefix(word, slug) {
+			return 2
+		}
+	}
+	for abbreviation, id := range abbreviations {
+		if id == book.ID && strings.HasPrefix(abbreviation, slug) {
+			return 3
+		}
+	}
+	if len([]rune(slug)) >= 3 {
+		// compare against as much of the name as has been typed, so
+		// "revle" finds Revelation before the rest is typed
+		prefix := []rune(name)
+		if len(prefix) > len([]rune(slug)) {
+			prefix = prefix[:len([]rune(slug))]
+		}
+		if EditDistance(slug, string(prefix)) <= suggestionThreshold(slug)-1 || EditDistance(slug, name) <= suggestionThreshold(slug) {
+			return 4
+		}
+	}
+	return -1
+}
+
+// CompleteBooks returns the books that typed could be the start of, best
+// first and in Bible order within a rank.
+func CompleteBooks(typed string, books []Book) []Book {
+	type match struct {
+		book Book
+		rank int
+	}
+	var matches []match
+	for _, book := range books {
+		rank := bookRank(typed, book)
+		if rank >= 0 {
+			matches = append(matches, match{book, rank})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].rank < matches[j].rank
+	})
+	found := make([]Book, 0, min(len(matches), max_completions))
+	for _, m := range matches[:min(len(matches), max_completions)] {
+		found = append(found, m.book)
+	}
+	return found
+}
+
+// Complete suggests books for typed text, or chapters of the best book when
+// a chapter number follows it. Chapters are checked against the cached
+// chapter list; before that is cached the typed number is offered as is.
+func (s *Server) Complete(translation string, typed string, books []Book) []Completion {
+	typed = strings.TrimSpace(typed)
+	completions := []Completion{}
+	if typed == "" {
+		return completions
+	}
+
+	match := complete_pattern.FindStringSubmatch(typed)
+	if match == nil {
+		for _, book := range CompleteBooks(typed, books) {
+			completions = append(completions, Completion{Text: book.Name, Slug: book.Slug, URL: s.BookLink(translation, book).URL})
+		}
+		return completions
+	}
+
+	found := CompleteBooks(match[1], books)
+	if len(found) == 0 {
+		return completions
+	}
+	book := found[0]
+	chapters := []int{}
+	var chapter_info ChapterInfo
+	if s.Chapters.Peek(translation, book.ID, &chapter_info) {
+		for _, chapter := range chapter_info.Chapters {
+			if strings.HasPrefix(strconv.Itoa(chapter.Chapter), match[2]) {
+				chapters = append(chapters, chapter.Chapter)
+			}
+		}
+	} else if n, err := ParseNumber("chapter", match[2]); err == nil {
+		chapters = append(chapters, n)
+	}
+	for _, chapter := range chapters[:min(len(chapters), max_completions)] {
+		completions = append(completions, Completion{
+			Text:    book.Name + " " + strconv.Itoa(chapter),
+			Slug:    book.Slug,
+			Chapter: chapter,
+			URL:     s.ChapterLink(translation, book, chapter).URL,
+		})
+	}
+	return completions
+}
+
+// apiComplete serves /api/v1/complete?q=1+c for the jump box to suggest as
+// people type. Everything comes from memory once the book list is cached.
+func (s *Server) apiComplete(w http.ResponseWriter, r *http.Request) {
+	translation := RequestTranslation(r)
+	var book_info BookInfo
+	err := s.Books.Get(r.Context(), translation, &book_info)
+	if err != nil {
+		apiError(w, r, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, s.Complete(translation, r.URL.Query().Get("q"), book_info.Books))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+// canon is every book of the Protestant canon, in order.
+var canon = []Book{
+	{ID: "GEN", Name: "Genesis"}, {ID: "EXO", Name: "Exodus"}, {ID: "LEV", Name: "Leviticus"},
+	{ID: "NUM", Name: "Numbers"}, {ID: "DEU", Name: "Deuteronomy"}, {ID: "JOS", Name: "Joshua"},
+	{ID: "JDG", Name: "Judges"}, {ID: "RUT", Name: "Ruth"}, {ID: "1SA", Name: "1 Samuel"},
+	{ID: "2SA", Name: "2 Samuel"}, {ID: "1KI", Name: "1 Kings"}, {ID: "2KI", Name: "2 Kings"},
+	{ID: "1CH", Name: "1 Chronicles"}, {ID: "2CH", Name: "2 Chronicles"}, {ID: "EZR", Name: "Ezra"},
+	{ID: "NEH", Name: "Nehemiah"}, {ID: "EST", Name: "Esther"}, {ID: "JOB", Name: "Job"},
+	{ID: "PSA", Name: "Psalms"}, {ID: "PRO", Name: "Proverbs"}, {ID: "ECC", Name: "Ecclesiastes"},
+	{ID: "SNG", Name: "Song of Solomon"}, {ID: "ISA", Name: "Isaiah"}, {ID: "JER", Name: "Jeremiah"},
+	{ID: "LAM", Name: "Lamentations"}, {ID: "EZK", Name: "Ezekiel"}, {ID: "DAN", Name: "Daniel"},
+	{ID: "HOS", Name: "Hosea"}, {ID: "JOL", Name: "Joel"}, {ID: "AMO", Name: "Amos"},
+	{ID: "OBA", Name: "Obadiah"}, {ID: "JON", Name: "Jonah"}, {ID: "MIC", Name: "Micah"},
+	{ID: "NAM", Name: "Nahum"}, {ID: "HAB", Name: "Habakkuk"}, {ID: "ZEP", Name: "Zephaniah"},
+	{ID: "HAG", Name: "Haggai"}, {ID: "ZEC", Name: "Zechariah"}, {ID: "MAL", Name: "Malachi"},
+	{ID: "MAT", Name: "Matthew"}, {ID: "MRK", Name: "Mark"}, {ID: "LUK", Name: "Luke"},
+	{ID: "JHN", Name: "John"}, {ID: "ACT", Name: "Acts"}, {ID: "ROM", Name: "Romans"},
+	{ID: "1CO", Name: "1 Corinthians"}, {ID: "2CO", Name: "2 Corinthians"}, {ID: "GAL", Name: "Galatians"},
+	{ID: "EPH", Name: "Ephesians"}, {ID: "PHP", Name: "Philippians"}, {ID: "COL", Name: "Colossians"},
+	{ID: "1TH", Name: "1 Thessalonians"}, {ID: "2TH", Name: "2 Thessalonians"}, {ID: "1TI", Name: "1 Timothy"},
+	{ID: "2TI", Name: "2 Timothy"}, {ID: "TIT", Name: "Titus"}, {ID: "PHM", Name: "Philemon"},
+	{ID: "HEB", Name: "Hebrews"}, {ID: "JAS", Name: "James"}, {ID: "1PE", Name: "1 Peter"},
+	{ID: "2PE", Name: "2 Peter"}, {ID: "1JN", Name: "1 John"}, {ID: "2JN", Name: "2 John"},
+	{ID: "3JN", Name: "3 John"}, {ID: "JUD", Name: "Jude"}, {ID: "REV", Name: "Revelation"},
+}
+
+func TestCompleteBooks(t *testing.T) {
+	tests := []struct {
+		typed string
+		want  []string
+	}{
+		{"john", []string{"JHN", "1JN", "2JN", "3JN"}},
+		// starts of names in Bible order, then the numbered books with a
+		// word that starts with it
+		{"jo", []string{"JOS", "JOB", "JOL", "JON", "JHN", "1JN", "2JN", "3JN"}},
+		{"1 jo", []string{"1JN"}},
+		{"1 c", []string{"1CH", "1CO"}},
+		{"1c", []string{"1CH", "1CO"}},
+		{"cor", []string{"1CO", "2CO"}},
+		// an abbreviation first, then the start of one
+		{"jn", []string{"JHN", "JON"}},
+		{"ps", []string{"PSA"}},
+		{"revle", []string{"REV"}},
+		{"xyz", nil},
+		{"", nil},
+		// capped at max_completions, so 2 John and 3 John miss out
+		{"j", []string{"JOS", "JDG", "JOB", "JER", "JOL", "JON", "JHN", "JAS", "JUD", "1JN"}},
+	}
+	for _, test := range tests {
+		t.Run(test.typed, func(t *testing.T) {
+			var got []string
+			for _, book := range CompleteBooks(test.typed, canon) {
+				got = append(got, book.ID)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("CompleteBooks(%q) = %v, want %v", test.typed, got, test.want)
+			}
+		})
+	}
+}
+
+func TestComplete(t *testing.T) {
+	handler := newTestServer(t)
+	complete := func(t *testing.T, typed string) []string {
+		t.Helper()
+		w := get(t, handler, "/api/v1/complete?q="+url.QueryEscape(typed))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET /api/complete?q=%s: status %d", typed, w.Code)
+		}
+		var completions []Completion
+		if err := json.Unmarshal(w.Body.Bytes(), &completions); err != nil {
+			t.Fatal(err)
+		}
+		texts := []string{}
+		for _, completion := range completions {
+			texts = append(texts, completion.Text)
+		}
+		return texts
+	}
+
+	// before John's chapter list is cached the number is taken as typed
+	if got := complete(t, "john 3"); !slices.Equal(got, []string{"John 3"}) {
+		t.Errorf("john 3 = %q, want just John 3", got)
+	}
+	if w := get(t, handler, "/john"); w.Code != http.StatusOK {
+		t.Fatalf("GET /john: status %d", w.Code)
+	}
+
+	tests := []struct {
+		typed string
+		want  []string
+	}{
+		{"jo", []string{"John"}},
+		{"  john  ", []string{"John"}},
+		{"john 3", []string{"John 3"}},
+		{"john 2", []string{"John 2", "John 20", "John 21"}},
+		// John 1 and 10 to 18, leaving 19 out
+		{"john 1", []string{"John 1", "John 10", "John 11", "John 12", "John 13", "John 14", "John 15", "John 16", "John 17", "John 18"}},
+		{"john 30", []string{}},
+		{"nope 3", []string{}},
+		{"", []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.typed, func(t *testing.T) {
+			if got := complete(t, test.typed); !slices.Equal(got, test.want) {
+				t.Errorf("%q = %q, want %q", test.typed, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/gorilla/mux"
+)
+
+// concordance_per_page is how many verses one page of a concordance lists.
+// Common words like "the" run to thousands, so they are paged rather than
+// refused.
+const concordance_per_page = 200
+
+// Words splits text into words the way the concordance counts them: folded
+// like search, with apostrophes dropped so "LORD's" is "lords", and any
+// other punctuation separating words.
+func Words(text string) []string {
+	return foldedWords(Fold(text))
+}
+
+func foldedWords(text string) []string {
+	text = strings.NewReplacer("'", "", "’", "").Replace(text)
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// ConcordanceBook is every verse of one book containing a word, and how
+// many times the word appears in them.
+type ConcordanceBook struct {
+	Book   Book
+	Count  int
+	Verses []Verse
+}
+
+// Concordance finds every indexed verse containing word as a whole word,
+// grouped by book in the order the books were indexed.
+func (idx *SearchIndex) Concordance(word string) []ConcordanceBook {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	var books []ConcordanceBook
+	positions := map[string]int{}
+	for _, v := range idx.verses {
+		count := 0
+		for _, w := range foldedWords(v.text) {
+			if w == word {
+				count++
+			}
+		}
+		if count == 0 {
+			continue
+		}
+		i, ok := positions[v.Book.ID]
+		if !ok {
+			i = len(books)
+			positions[v.Book.ID] = i
+			books = append(books, ConcordanceBook{Book: v.Book})
+		}
+		books[i].Count += count
+		books[i].Verses = append(books[i].Verses, v.Verse)
+	}
+	return books
+}
+
+type ConcordanceBookResponse struct {
+	Book  string   `json:"book"`
+	Count int      `json:"count"`
+	Refs  []string `json:"refs"`
+}
+
+// ConcordanceResponse is the JSON form of one page of a concordance. Total
+// counts occurrences, pages are of verses.
+type ConcordanceResponse struct {
+	Word     string                    `json:"word"`
+	Total    int                       `json:"total"`
+	Page     int                       `json:"page"`
+	Pages    int                       `json:"pages"`
+	Complete bool                      `json:"complete"`
+	Books    []ConcordanceBookResponse `json:"books"`
+}
+
+// concordancePage cuts one page of verses out of books, keeping the per
+// book counts of the whole concordance.
+func concordancePage(books []ConcordanceBook, page int) ([]ConcordanceBook, int) {
+	verses := 0
+	for _, book := range books {
+		verses += len(book.Verses)
+	}
+	start := (page - 1) * concordance_per_page
+	end := start + concordance_per_page
+
+	var paged []ConcordanceBook
+	seen := 0
+	for _, book := range books {
+		first, last := max(start-seen, 0), min(end-seen, len(book.Verses))
+		seen += len(book.Verses)
+		if first >= last {
+			continue
+		}
+		book.Verses = book.Verses[first:last]
+		paged = append(paged, book)
+	}
+	return paged, pageCount(verses, concordance_per_page)
+}
+
+// readConcordance reads the word and page of a concordance request and
+// looks the word up.
+func (s *Server) readConcordance(r *http.Request) (string, []ConcordanceBook, int, error) {
+	raw := mux.Vars(r)["word"]
+	words := Words(raw)
+	if len(words) != 1 {
+		return raw, nil, 0, fmt.Errorf("%w: %q", ErrNotAWord, raw)
+	}
+	page := 1
+	if value := r.URL.Query().Get("page"); value != "" {
+		var err error
+		page, err = ParseNumber("page", value)
+		if err != nil {
+			return words[0], nil, 0, err
+		}
+	}
+	s.Search.StartCrawl(default_translation)
+	return words[0], s.Search.Concordance(words[0]), page, nil
+}
+
+func (s *Server) apiConcordance(w http.ResponseWriter, r *http.Request) {
+	word, books, page, err := s.readConcordance(r)
+	if err != nil {
+		apiError(w, r, err)
+		return
+	}
+	paged, pages := concordancePage(books, page)
+	_, _, complete := s.Search.Progress()
+	response := ConcordanceResponse{Word: word, Page: page, Pages: pages, Complete: complete, Books: []ConcordanceBookResponse{}}
+	for _, book := range books {
+		response.Total += book.Count
+	}
+	for _, book := range paged {
+		entry := ConcordanceBookResponse{Book: book.Book.Name, Count: book.Count}
+		for _, verse := range book.Verses {
+			entry.Refs = append(entry.Refs, fmt.Sprintf("%s %d:%d", book.Book.Name, verse.Chapter, verse.Verse))
+		}
+		response.Books = append(response.Books, entry)
+	}
+	WriteJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) getConcordance(w http.ResponseWriter, r *http.Request) {
+	word, books, page_number, err := s.readConcordance(r)
+	if err != nil {
+		s.fetchError(w, r, default_translation, "", err)
+		return
+	}
+	paged, pages := concordancePage(books, page_number)
+	page := ConcordancePage{Word: word, Page: page_number, Pages: pages}
+	page.Indexed, page.Chapters, page.Complete = s.Search.Progress()
+	for _, book := range books {
+		page.Total += book.Count
+		page.Counts = append(page.Counts, ConcordanceCount{Book: book.Book.Name, Count: book.Count})
+	}
+	for _, book := range paged {
+		section := ConcordanceSection{Book: book.Book.Name, Count: book.Count}
+		for _, verse := range book.Verses {
+			section.Verses = append(section.Verses, s.VerseLink(default_translation, book.Book, verse.Chapter, verse.Verse))
+		}
+		page.Sections = append(page.Sections, section)
+	}
+	link := s.Path("concordance", "word", word)
+	if page_number > 1 {
+		page.Previous = &Link{Text: "← Previous", URL: fmt.Sprintf("%s?page=%d", link, page_number-1)}
+	}
+	if page_number < pages {
+		page.Next = &Link{Text: "Next →", URL: fmt.Sprintf("%s?page=%d", link, page_number+1)}
+	}
+	s.RenderPage(w, r, http.StatusOK, "concordance.html", fmt.Sprintf("Concordance: %s", word), page)
+}
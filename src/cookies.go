@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// cookie_max_age keeps visitor state like reading plan progress for a year
+// after it last changed.
+const cookie_max_age = 365 * 24 * time.Hour
+
+// cookie_value_size leaves room under the 4096 bytes browsers keep of a
+// cookie for its name, signature and attributes.
+const cookie_value_size = 3500
+
+// cookie_secret signs cookies so visitors can't forge them. It comes from
+// -cookie-secret, or is made up at startup, which logs everyone out of
+// their progress on every restart.
+var cookie_secret []byte
+
+// RandomToken returns n random bytes as hex.
+func RandomToken(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func cookieSignature(name string, value string) string {
+	mac := hmac.New(sha256.New, cookie_secret)
+	mac.Write([]byte(name + "=" + value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SetSignedCookie stores value with a signature over it and the cookie's
+// name, so it can't be edited or moved to another cookie. The cookie is
+// SameSite=Lax, which keeps other sites from POSTing forms with it.
+func SetSignedCookie(w http.ResponseWriter, r *http.Request, name string, value string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value + "." + cookieSignature(name, value),
+		Path:     SitePath("/"),
+		MaxAge:   int(cookie_max_age.Seconds()),
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// SignedCookie returns the value of a cookie set by SetSignedCookie, or
+// false if it's missing or its signature doesn't match.
+func SignedCookie(r *http.Request, name string) (string, bool) {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return "", false
+	}
+	i := strings.LastIndexByte(cookie.Value, '.')
+	if i < 0 {
+		return "", false
+	}
+	value, signature := cookie.Value[:i], cookie.Value[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(cookieSignature(name, value))) {
+		return "", false
+	}
+	return value, true
+}
+
+// ClearCookie removes a cookie set by SetSignedCookie.
+func ClearCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{Name: name, Path: SitePath("/"), MaxAge: -1})
+}
+
+// UserToken identifies a visitor to the store without them having an
+// account: a random token kept in a signed cookie, made on first use.
+func UserToken(w http.ResponseWriter, r *http.Request) string {
+	token, ok := SignedCookie(r, "user")
+	if !ok {
+		token = RandomToken(16)
+		SetSignedCookie(w, r, "user", token)
+	}
+	return token
+}
+
+// backURL is the page a form was posted from, or fallback when the Referer
+// is missing or from another site.
+func backURL(r *http.Request, fallback string) string {
+	if referer, err := url.Parse(r.Referer()); err == nil && referer.Host == r.Host && referer.Path != "" {
+		return referer.RequestURI()
+	}
+	return fallback
+}
+
+// redirectBack sends a form POST back to the page it came from.
+func redirectBack(w http.ResponseWriter, r *http.Request, fallback string) {
+	http.Redirect(w, r, backURL(r, fallback), http.StatusSeeOther)
+}
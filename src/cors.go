@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+)
+
+// CORS lets pages on other origins call the JSON API. Origins lists the
+// ones that may, "*" for any, which is safe because the API is read-only
+// and never looks at cookies.
+type CORS struct {
+	Origins []string
+}
+
+var api_cors = &CORS{Origins: []string{"*"}}
+
+// allowOrigin is the Access-Control-Allow-Origin value for origin, or ""
+// if it isn't allowed.
+func (c *CORS) allowOrigin(origin string) string {
+	if slices.Contains(c.Origins, "*") {
+		return "*"
+	}
+	if slices.Contains(c.Origins, origin) {
+		return origin
+	}
+	return ""
+}
+
+// Handler adds CORS headers to API responses and answers preflight
+// requests itself. Requests from origins that aren't allowed are served
+// without the headers, so the browser keeps the response from the page.
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		allow := ""
+		if origin != "" {
+			allow = c.allowOrigin(origin)
+		}
+		if allow != "" {
+			header.Set("Access-Control-Allow-Origin", allow)
+			header.Set("Access-Control-Expose-Headers", "ETag, Retry-After, X-API-Version, Deprecation, Sunset, Link")
+		}
+		if !preflight {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if allow != "" {
+			header.Set("Access-Control-Allow-Methods", "GET, HEAD, POST, DELETE, OPTIONS")
+			header.Set("Access-Control-Allow-Headers", "Accept, Content-Type, If-None-Match")
+			header.Set("Access-Control-Max-Age", "86400")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
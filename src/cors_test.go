@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name          string
+		origins       []string
+		method        string
+		origin        string
+		preflight     bool
+		status        int
+		allow_origin  string
+		allow_methods bool
+	}{
+		{"wildcard", []string{"*"}, http.MethodGet, "https://example.com", false, http.StatusOK, "*", false},
+		{"wildcard preflight", []string{"*"}, http.MethodOptions, "https://example.com", true, http.StatusNoContent, "*", true},
+		{"listed origin", []string{"https://a.example", "https://example.com"}, http.MethodGet, "https://example.com", false, http.StatusOK, "https://example.com", false},
+		{"listed origin preflight", []string{"https://example.com"}, http.MethodOptions, "https://example.com", true, http.StatusNoContent, "https://example.com", true},
+		{"disallowed origin", []string{"https://example.com"}, http.MethodGet, "https://evil.example", false, http.StatusOK, "", false},
+		{"disallowed preflight", []string{"https://example.com"}, http.MethodOptions, "https://evil.example", true, http.StatusNoContent, "", false},
+		{"no origin", []string{"*"}, http.MethodGet, "", false, http.StatusOK, "", false},
+		{"plain OPTIONS", []string{"*"}, http.MethodOptions, "https://example.com", false, http.StatusOK, "*", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			served := false
+			cors := &CORS{Origins: test.origins}
+			handler := cors.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				served = true
+			}))
+			r := httptest.NewRequest(test.method, "/api/v1/john/3", nil)
+			if test.origin != "" {
+				r.Header.Set("Origin", test.origin)
+			}
+			if test.preflight {
+				r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != test.status {
+				t.Errorf("status %d, want %d", w.Code, test.status)
+			}
+			if served == test.preflight {
+				t.Errorf("served %v, want %v", served, !test.preflight)
+			}
+			if allow := w.Header().Get("Access-Control-Allow-Origin"); allow != test.allow_origin {
+				t.Errorf("Access-Control-Allow-Origin %q, want %q", allow, test.allow_origin)
+			}
+			if methods := w.Header().Get("Access-Control-Allow-Methods"); (methods != "") != test.allow_methods {
+				t.Errorf("Access-Control-Allow-Methods %q", methods)
+			}
+			if test.allow_methods && w.Header().Get("Access-Control-Allow-Headers") == "" {
+				t.Errorf("preflight without Access-Control-Allow-Headers")
+			}
+			if vary := w.Header().Values("Vary"); len(vary) == 0 || vary[0] != "Origin" {
+				t.Errorf("Vary %q, want Origin", vary)
+			}
+		})
+	}
+}
+
+func TestCORSRoutes(t *testing.T) {
+	handler := newTestServer(t)
+	tests := []struct {
+		method string
+		target string
+		cors   bool
+	}{
+		{http.MethodGet, "/api/v1/john/3", true},
+		{http.MethodOptions, "/api/v1/john/3", true},
+		{http.MethodGet, "/api/v1/books", true},
+		{http.MethodGet, "/api/john/3", true},
+		{http.MethodGet, "/john/3", false},
+		{http.MethodGet, "/john/3?format=json", false},
+		{http.MethodGet, "/", false},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.target, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, test.target, nil)
+			r.Header.Set("Origin", "https://example.com")
+			if test.method == http.MethodOptions {
+				r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if allow := w.Header().Get("Access-Control-Allow-Origin"); (allow == "*") != test.cors {
+				t.Errorf("%s %s: Access-Control-Allow-Origin %q, want CORS %v", test.method, test.target, allow, test.cors)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+//go:generate go run crossrefs_gen.go cross_references.txt crossrefs.bin
+
+import (
+	"context"
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// crossref_limit is the most references shown under a verse.
+const crossref_limit = 10
+
+// crossrefs_enabled turns the "See also" list off with -no-crossrefs.
+var crossrefs_enabled = true
+
+// crossrefs_bin is written by crossrefs_gen.go. After "XREF" it has a byte
+// counting the books, their IDs of 3 bytes each, the number of verses with
+// references N and the number of references M. Then come N pairs of a
+// verse and the index of its first reference, sorted by verse, and M pairs
+// of the first and last verse of each reference. Verses are written as the
+// book's position, counting from 1, shifted 16 bits, the chapter shifted 8
+// bits and the verse, and all numbers are little endian uint32s.
+//
+//go:embed crossrefs.bin
+var crossrefs_bin []byte
+
+// CrossRefs reads references straight out of the embedded data, so a few
+// hundred thousand of them cost no memory beyond the binary itself.
+type CrossRefs struct {
+	books   []string
+	numbers map[string]uint32
+	index   []byte
+	pairs   []byte
+}
+
+// CrossRef is a verse or range of verses another verse refers to.
+type CrossRef struct {
+	Book       string
+	Chapter    int
+	Verse      int
+	EndChapter int
+	EndVerse   int
+}
+
+var crossrefs = sync.OnceValues(func() (*CrossRefs, error) {
+	return ParseCrossRefs(crossrefs_bin)
+})
+
+var errCrossRefsFormat = errors.New("cross references aren't in the expected format")
+
+// ParseCrossRefs checks the header of data written by crossrefs_gen.go.
+func ParseCrossRefs(data []byte) (*CrossRefs, error) {
+	if len(data) < 5 || string(data[:4]) != "XREF" {
+		return nil, errCrossRefsFormat
+	}
+	book_count := int(data[4])
+	rest := data[5:]
+	if len(rest) < 3*book_count+8 {
+		return nil, errCrossRefsFormat
+	}
+	c := &CrossRefs{numbers: map[string]uint32{}}
+	for i := range book_count {
+		id := string(rest[3*i : 3*i+3])
+		c.books = append(c.books, id)
+		c.numbers[id] = uint32(i + 1)
+	}
+	rest = rest[3*book_count:]
+	sources := int(binary.LittleEndian.Uint32(rest))
+	targets := int(binary.LittleEndian.Uint32(rest[4:]))
+	rest = rest[8:]
+	if len(rest) != 8*sources+8*targets {
+		return nil, fmt.Errorf("%w: expected %d bytes of references, found %d", errCrossRefsFormat, 8*sources+8*targets, len(rest))
+	}
+	c.index = rest[:8*sources]
+	c.pairs = rest[8*sources:]
+	return c, nil
+}
+
+func (c *CrossRefs) uint(data []byte, i int) uint32 {
+	return binary.LittleEndian.Uint32(data[4*i:])
+}
+
+func (c *CrossRefs) ref(key uint32) (string, int, int) {
+	book := int(key>>16) - 1
+	if book < 0 || book >= len(c.books) {
+		return "", 0, 0
+	}
+	return c.books[book], int(key >> 8 & 0xff), int(key & 0xff)
+}
+
+// Lookup returns the references of a verse, most relevant first.
+func (c *CrossRefs) Lookup(book string, chapter int, verse int) []CrossRef {
+	number, ok := c.numbers[book]
+	if !ok || chapter > 0xff || verse > 0xff {
+		return nil
+	}
+	key := number<<16 | uint32(chapter)<<8 | uint32(verse)
+	count := len(c.index) / 8
+	i := sort.Search(count, func(i int) bool { return c.uint(c.index, 2*i) >= key })
+	if i == count || c.uint(c.index, 2*i) != key {
+		return nil
+	}
+	first := int(c.uint(c.index, 2*i+1))
+	last := len(c.pairs) / 8
+	if i+1 < count {
+		last = int(c.uint(c.index, 2*i+3))
+	}
+
+	refs := make([]CrossRef, 0, last-first)
+	for j := first; j < last; j++ {
+		var ref CrossRef
+		ref.Book, ref.Chapter, ref.Verse = c.ref(c.uint(c.pairs, 2*j))
+		_, ref.EndChapter, ref.EndVerse = c.ref(c.uint(c.pairs, 2*j+1))
+		if ref.Book != "" {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// CrossRefText writes a reference short, like "Rom 5:8" or "1 John 4:9-10",
+// with the SBL abbreviation of its book.
+func CrossRefText(book Book, ref CrossRef) string {
+	name, ok := sbl_books[book.ID]
+	if !ok {
+		name = book.Name
+	}
+	text := fmt.Sprintf("%s %d:%d", name, ref.Chapter, ref.Verse)
+	switch {
+	case ref.EndChapter != ref.Chapter:
+		text += fmt.Sprintf("–%d:%d", ref.EndChapter, ref.EndVerse)
+	case ref.EndVerse != ref.Verse:
+		text += "-" + strconv.Itoa(ref.EndVerse)
+	}
+	return text
+}
+
+// CrossRefLinks links the references of a verse that the translation has,
+// up to crossref_limit of them.
+func (s *Server) CrossRefLinks(ctx context.Context, translation string, book Book, chapter int, verse int) []Link {
+	if !crossrefs_enabled {
+		return nil
+	}
+	c, err := crossrefs()
+	if err != nil {
+		Logger(ctx).Error("loading cross references", "err", err)
+		return nil
+	}
+	var links []Link
+	for _, ref := range c.Lookup(book.ID, chapter, verse) {
+		if len(links) == crossref_limit {
+			break
+		}
+		var target Book
+		if s.Books.BookByID(ctx, translation, ref.Book, &target) != nil {
+			continue
+		}
+		link := s.VerseLink(translation, target, ref.Chapter, ref.Verse)
+		if ref.EndChapter == ref.Chapter && ref.EndVerse > ref.Verse {
+			link.URL = s.TranslationPath(translation, "passage", "book", BookSlug(target.Name), "chapter", strconv.Itoa(ref.Chapter), "verses", fmt.Sprintf("%d-%d", ref.Verse, ref.EndVerse))
+		}
+		link.Text = CrossRefText(target, ref)
+		links = append(links, link)
+	}
+	return links
+}
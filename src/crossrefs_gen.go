@@ -0,0 +1,151 @@
+//go:build ignore
+
+// crossrefs_gen converts the cross references published at
+// https://www.openbible.info/labs/cross-references/, which are derived from
+// the Treasury of Scripture Knowledge, into crossrefs.bin:
+//
+//	go run crossrefs_gen.go cross_references.txt crossrefs.bin
+//
+// Each verse keeps its references in order of votes, leaving out those
+// voted down. See crossrefs.go for the format.
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// osis_books lists the books in order by their OSIS names, as the input
+// uses, and their bible-api.com IDs.
+var osis_books = [][2]string{
+	{"Gen", "GEN"}, {"Exod", "EXO"}, {"Lev", "LEV"}, {"Num", "NUM"}, {"Deut", "DEU"},
+	{"Josh", "JOS"}, {"Judg", "JDG"}, {"Ruth", "RUT"}, {"1Sam", "1SA"}, {"2Sam", "2SA"},
+	{"1Kgs", "1KI"}, {"2Kgs", "2KI"}, {"1Chr", "1CH"}, {"2Chr", "2CH"}, {"Ezra", "EZR"},
+	{"Neh", "NEH"}, {"Esth", "EST"}, {"Job", "JOB"}, {"Ps", "PSA"}, {"Prov", "PRO"},
+	{"Eccl", "ECC"}, {"Song", "SNG"}, {"Isa", "ISA"}, {"Jer", "JER"}, {"Lam", "LAM"},
+	{"Ezek", "EZK"}, {"Dan", "DAN"}, {"Hos", "HOS"}, {"Joel", "JOL"}, {"Amos", "AMO"},
+	{"Obad", "OBA"}, {"Jonah", "JON"}, {"Mic", "MIC"}, {"Nah", "NAM"}, {"Hab", "HAB"},
+	{"Zeph", "ZEP"}, {"Hag", "HAG"}, {"Zech", "ZEC"}, {"Mal", "MAL"},
+	{"Matt", "MAT"}, {"Mark", "MRK"}, {"Luke", "LUK"}, {"John", "JHN"}, {"Acts", "ACT"},
+	{"Rom", "ROM"}, {"1Cor", "1CO"}, {"2Cor", "2CO"}, {"Gal", "GAL"}, {"Eph", "EPH"},
+	{"Phil", "PHP"}, {"Col", "COL"}, {"1Thess", "1TH"}, {"2Thess", "2TH"}, {"1Tim", "1TI"},
+	{"2Tim", "2TI"}, {"Titus", "TIT"}, {"Phlm", "PHM"}, {"Heb", "HEB"}, {"Jas", "JAS"},
+	{"1Pet", "1PE"}, {"2Pet", "2PE"}, {"1John", "1JN"}, {"2John", "2JN"}, {"3John", "3JN"},
+	{"Jude", "JUD"}, {"Rev", "REV"},
+}
+
+var osis_index = map[string]uint32{}
+
+func init() {
+	for i, book := range osis_books {
+		osis_index[book[0]] = uint32(i + 1)
+	}
+}
+
+// key reads an OSIS reference like "Gen.1.1".
+func key(ref string) (uint32, error) {
+	parts := strings.Split(ref, ".")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("%q isn't a verse", ref)
+	}
+	book, ok := osis_index[parts[0]]
+	chapter, err1 := strconv.Atoi(parts[1])
+	verse, err2 := strconv.Atoi(parts[2])
+	if !ok || err1 != nil || err2 != nil || chapter > 255 || verse > 255 {
+		return 0, fmt.Errorf("%q isn't a verse", ref)
+	}
+	return book<<16 | uint32(chapter)<<8 | uint32(verse), nil
+}
+
+type target struct {
+	start, end uint32
+	votes      int
+}
+
+func main() {
+	if len(os.Args) != 3 {
+		log.Fatal("usage: go run crossrefs_gen.go cross_references.txt crossrefs.bin")
+	}
+	in, err := os.Open(os.Args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer in.Close()
+
+	targets := map[uint32][]target{}
+	scanner := bufio.NewScanner(in)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 3 || fields[0] == "From Verse" || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		votes, err := strconv.Atoi(fields[2])
+		if err != nil {
+			log.Fatalf("line %d: %v", line, err)
+		}
+		if votes < 0 {
+			continue
+		}
+		from, err := key(fields[0])
+		if err != nil {
+			log.Fatalf("line %d: %v", line, err)
+		}
+		start_ref, end_ref, _ := strings.Cut(fields[1], "-")
+		start, err := key(start_ref)
+		if err != nil {
+			log.Fatalf("line %d: %v", line, err)
+		}
+		end := start
+		if end_ref != "" {
+			end, err = key(end_ref)
+			if err != nil {
+				log.Fatalf("line %d: %v", line, err)
+			}
+		}
+		targets[from] = append(targets[from], target{start: start, end: end, votes: votes})
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	sources := make([]uint32, 0, len(targets))
+	for source := range targets {
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i] < sources[j] })
+
+	var index, pairs []uint32
+	for _, source := range sources {
+		list := targets[source]
+		sort.SliceStable(list, func(i, j int) bool { return list[i].votes > list[j].votes })
+		index = append(index, source, uint32(len(pairs)/2))
+		for _, t := range list {
+			pairs = append(pairs, t.start, t.end)
+		}
+	}
+
+	out := []byte("XREF")
+	out = append(out, byte(len(osis_books)))
+	for _, book := range osis_books {
+		out = append(out, book[1]...)
+	}
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(sources)))
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(pairs)/2))
+	for _, n := range index {
+		out = binary.LittleEndian.AppendUint32(out, n)
+	}
+	for _, n := range pairs {
+		out = binary.LittleEndian.AppendUint32(out, n)
+	}
+	err = os.WriteFile(os.Args[2], out, 0o644)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %d verses with %d references", len(sources), len(pairs)/2)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCrossRefsLookup(t *testing.T) {
+	c, err := crossrefs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		book    string
+		chapter int
+		verse   int
+		want    []CrossRef
+	}{
+		{"JHN", 3, 16, []CrossRef{
+			{"ROM", 5, 8, 5, 8}, {"1JN", 4, 9, 4, 10}, {"JHN", 3, 36, 3, 36}, {"ROM", 8, 32, 8, 32}, {"JHN", 1, 18, 1, 18},
+		}},
+		{"GEN", 1, 1, []CrossRef{
+			{"JHN", 1, 1, 1, 3}, {"HEB", 11, 3, 11, 3}, {"PSA", 33, 6, 33, 6}, {"COL", 1, 16, 1, 16}, {"ISA", 45, 18, 45, 18}, {"REV", 4, 11, 4, 11},
+		}},
+		{"PSA", 23, 1, []CrossRef{
+			{"JHN", 10, 11, 10, 11}, {"ISA", 40, 11, 40, 11}, {"EZK", 34, 11, 34, 12}, {"PHP", 4, 19, 4, 19}, {"1PE", 2, 25, 2, 25},
+		}},
+		{"PSA", 119, 105, []CrossRef{{"PRO", 6, 23, 6, 23}, {"2PE", 1, 19, 1, 19}}},
+		{"ROM", 8, 28, []CrossRef{{"GEN", 50, 20, 50, 20}, {"EPH", 1, 11, 1, 11}, {"2TI", 1, 9, 1, 9}, {"ROM", 8, 30, 8, 30}}},
+		// the last verse with references
+		{"REV", 21, 4, []CrossRef{{"ISA", 25, 8, 25, 8}, {"REV", 7, 17, 7, 17}, {"1CO", 15, 26, 15, 26}}},
+		{"JHN", 3, 17, nil},
+		{"GEN", 1, 2, nil},
+		{"XYZ", 1, 1, nil},
+		{"PSA", 119, 300, nil},
+		{"JHN", 259, 16, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.book, func(t *testing.T) {
+			got := c.Lookup(test.book, test.chapter, test.verse)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("Lookup(%s %d:%d) = %v, want %v", test.book, test.chapter, test.verse, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseCrossRefsInvalid(t *testing.T) {
+	header := func(books string, sources uint32, targets uint32) []byte {
+		data := append([]byte("XREF"), byte(len(books)/3))
+		data = append(data, books...)
+		data = binary.LittleEndian.AppendUint32(data, sources)
+		return binary.LittleEndian.AppendUint32(data, targets)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"wrong magic", []byte("XRFE\x00\x00\x00\x00\x00\x00\x00\x00\x00")},
+		{"short book list", append([]byte("XREF\x02"), "GENEX"...)},
+		{"missing counts", append([]byte("XREF\x01"), "GEN"...)},
+		{"missing references", header("GENJHN", 1, 1)},
+		{"extra bytes", append(header("GEN", 0, 0), 0)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseCrossRefs(test.data)
+			if !errors.Is(err, errCrossRefsFormat) {
+				t.Errorf("ParseCrossRefs = %v, want errCrossRefsFormat", err)
+			}
+		})
+	}
+	if _, err := ParseCrossRefs(header("GEN", 0, 0)); err != nil {
+		t.Errorf("ParseCrossRefs without references: %v", err)
+	}
+}
+
+func TestCrossRefText(t *testing.T) {
+	tests := []struct {
+		book Book
+		ref  CrossRef
+		want string
+	}{
+		{Book{ID: "ROM", Name: "Romans"}, CrossRef{"ROM", 5, 8, 5, 8}, "Rom 5:8"},
+		{Book{ID: "1JN", Name: "1 John"}, CrossRef{"1JN", 4, 9, 4, 10}, "1 John 4:9-10"},
+		{Book{ID: "EZK", Name: "Ezekiel"}, CrossRef{"EZK", 34, 11, 35, 2}, "Ezek 34:11–35:2"},
+		{Book{ID: "TOB", Name: "Tobit"}, CrossRef{"TOB", 1, 1, 1, 1}, "Tobit 1:1"},
+	}
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			if got := CrossRefText(test.book, test.ref); got != test.want {
+				t.Errorf("CrossRefText = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCrossRefsPage(t *testing.T) {
+	upstream, _ := bibleUpstream(t)
+	bible := NewBibleClient(upstream.URL)
+	bible.Retries = 0
+	handler := NewServer(bible, nil).Routes(false, false)
+	tests := []struct {
+		name    string
+		target  string
+		enabled bool
+		want    string
+	}{
+		{"John 3:16", "/jhn/3/16", true, `See also: <a href="/rom/5/8">Rom 5:8</a>; <a href="/1jn/4/9-10">1 John 4:9-10</a>; <a href="/jhn/3/36">John 3:36</a>; <a href="/rom/8/32">Rom 8:32</a>; <a href="/jhn/1/18">John 1:18</a>`},
+		{"no references", "/jhn/3/17", true, ""},
+		{"turned off", "/jhn/3/16", false, ""},
+	}
+	defer func() { crossrefs_enabled = true }()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			crossrefs_enabled = test.enabled
+			body := get(t, handler, test.target).Body.String()
+			if test.want == "" {
+				if strings.Contains(body, "See also") {
+					t.Errorf("GET %s shows cross references", test.target)
+				}
+				return
+			}
+			if !strings.Contains(body, test.want) {
+				t.Errorf("GET %s: body doesn't contain %s", test.target, test.want)
+			}
+		})
+	}
+}
+
+// References to books a translation doesn't have are left out.
+func TestCrossRefsMissingBooks(t *testing.T) {
+	body := get(t, newTestServer(t), "/john/3/16").Body.String()
+	want := `See also: <a href="/john/3/36">John 3:36</a>; <a href="/john/1/18">John 1:18</a>`
+	if !strings.Contains(body, want) {
+		t.Errorf("body doesn't contain %s", want)
+	}
+}
+
+// TestCrossRefsGenerate runs crossrefs_gen.go over a few lines in
+// OpenBible.info's format and reads the result back.
+func TestCrossRefsGenerate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds crossrefs_gen.go")
+	}
+	input := filepath.Join(t.TempDir(), "cross_references.txt")
+	output := filepath.Join(t.TempDir(), "crossrefs.bin")
+	err := os.WriteFile(input, []byte(strings.Join([]string{
+		"From Verse\tTo Verse\tVotes\t#www.openbible.info CC-BY 2024-01-01",
+		"Gen.1.1\tHeb.11.3\t302",
+		"Gen.1.1\tJohn.1.1-John.1.3\t571",
+		"Gen.1.1\tIsa.45.18\t-3",
+		"John.3.16\tRom.5.8\t734",
+		"John.3.16\tEzek.34.11-Ezek.35.2\t12",
+		"Rev.22.21\tRom.16.20\t0",
+	}, "\n")+"\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("go", "run", "crossrefs_gen.go", input, output).CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run crossrefs_gen.go: %v\n%s", err, out)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := ParseCrossRefs(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		book    string
+		chapter int
+		verse   int
+		want    []CrossRef
+	}{
+		// most votes first, and none voted down
+		{"GEN", 1, 1, []CrossRef{{"JHN", 1, 1, 1, 3}, {"HEB", 11, 3, 11, 3}}},
+		{"JHN", 3, 16, []CrossRef{{"ROM", 5, 8, 5, 8}, {"EZK", 34, 11, 35, 2}}},
+		{"REV", 22, 21, []CrossRef{{"ROM", 16, 20, 16, 20}}},
+		{"ISA", 45, 18, nil},
+	}
+	for _, test := range tests {
+		if got := c.Lookup(test.book, test.chapter, test.verse); !slices.Equal(got, test.want) {
+			t.Errorf("Lookup(%s %d:%d) = %v, want %v", test.book, test.chapter, test.verse, got, test.want)
+		}
+	}
+}
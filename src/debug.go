@@ -0,0 +1,75 @@
+package main
+
+import (
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"net/netip"
+	"runtime"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// upstream_calls counts requests to bible-api.com for /debug/vars, by
+// endpoint and outcome like "chapters ok".
+var upstream_calls = expvar.NewMap("upstream_calls")
+
+// publishDebugVars adds the cache sizes and goroutine count to
+// /debug/vars, next to expvar's own cmdline and memstats.
+func (s *Server) publishDebugVars() {
+	expvar.Publish("goroutines", expvar.Func(func() any {
+		return runtime.NumGoroutine()
+	}))
+	expvar.Publish("caches", expvar.Func(func() any {
+		sizes := map[string]CacheStats{}
+		for name, cache := range s.caches() {
+			sizes[name] = NewCacheStats(name, cache, false)
+		}
+		return sizes
+	}))
+}
+
+// registerDebug serves pprof under /debug/pprof/ and expvar at
+// /debug/vars. pprof.Index serves the named profiles, like
+// /debug/pprof/heap, as well as the index, but the profiles that aren't
+// runtime/pprof ones need their own handlers.
+func registerDebug(r *mux.Router) {
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	// go tool pprof looks symbols up with POST
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol).Methods(http.MethodGet, http.MethodHead, http.MethodPost)
+	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	r.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+	r.Handle("/debug/vars", expvar.Handler())
+}
+
+// DebugHandler is the handler of the -debug-addr listener, which serves
+// nothing but /debug.
+func (s *Server) DebugHandler() http.Handler {
+	r := mux.NewRouter()
+	r.Use(recordRoute, s.Recover)
+	registerDebug(r)
+	RestrictMethods(r, http.MethodGet, http.MethodHead)
+	r.MethodNotAllowedHandler = s.MethodNotAllowed(r)
+	return Logging(r)
+}
+
+// IsLocalAddr reports whether addr only listens on the local machine: a
+// loopback address like localhost:6060 or 127.0.0.1:6060, or a Unix
+// socket. ":6060" listens on every interface, so it isn't.
+func IsLocalAddr(addr string) bool {
+	if strings.HasPrefix(addr, "unix:") {
+		return true
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && ip.IsLoopback()
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	discord_api = "https://discord.com/api/v10"
+	// discord_embed_limit is the most an embed's description can hold, and
+	// discord_title_limit its title.
+	discord_embed_limit = 4096
+	discord_title_limit = 256
+	discord_body_size   = 64 << 10
+	discord_command     = "verse"
+)
+
+// Discord's interaction types, the response types answering them, the
+// flag that shows a message only to whoever ran the command, and the
+// command and option types /verse is registered with.
+const (
+	discord_ping                = 1
+	discord_application_command = 2
+	discord_pong                = 1
+	discord_channel_message     = 4
+	discord_deferred_message    = 5
+	discord_ephemeral           = 1 << 6
+	discord_chat_input          = 1
+	discord_string_option       = 3
+)
+
+// discord_public_key checks interactions came from Discord, from
+// -discord-public-key. /integrations/discord is only served with one.
+var discord_public_key ed25519.PublicKey
+
+// ParseDiscordPublicKey reads the hex public key from an application's
+// settings page.
+func ParseDiscordPublicKey(value string) (ed25519.PublicKey, error) {
+	key, err := hex.DecodeString(value)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("should be 64 hex digits")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// VerifyDiscordSignature checks the Ed25519 signature Discord sends over
+// the timestamp followed by the body.
+func VerifyDiscordSignature(key ed25519.PublicKey, header http.Header, body []byte) error {
+	signature, err := hex.DecodeString(header.Get("X-Signature-Ed25519"))
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return fmt.Errorf("%w: no signature", ErrBadSignature)
+	}
+	timestamp := header.Get("X-Signature-Timestamp")
+	if timestamp == "" {
+		return fmt.Errorf("%w: no timestamp", ErrBadSignature)
+	}
+	message := append([]byte(timestamp), body...)
+	if !ed25519.Verify(key, message, signature) {
+		return fmt.Errorf("%w: signature doesn't match", ErrBadSignature)
+	}
+	return nil
+}
+
+type DiscordInteraction struct {
+	Type          int                    `json:"type"`
+	ApplicationID string                 `json:"application_id"`
+	Token         string                 `json:"token"`
+	Data          DiscordInteractionData `json:"data"`
+}
+
+type DiscordInteractionData struct {
+	Name    string          `json:"name"`
+	Options []DiscordOption `json:"options"`
+}
+
+// DiscordOption is an argument to a command. Value is whatever JSON the
+// option's type calls for.
+type DiscordOption struct {
+	Name  string          `json:"name"`
+	Type  int             `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Option is the string value of the named option, or "" without one.
+func (d DiscordInteractionData) Option(name string) string {
+	for _, option := range d.Options {
+		var value string
+		if option.Name == name && json.Unmarshal(option.Value, &value) == nil {
+			return value
+		}
+	}
+	return ""
+}
+
+// ParseDiscordInteraction reads an interaction, checking it has what its
+// type needs.
+func ParseDiscordInteraction(body []byte) (DiscordInteraction, error) {
+	var interaction DiscordInteraction
+	err := json.Unmarshal(body, &interaction)
+	if err != nil {
+		return DiscordInteraction{}, err
+	}
+	switch interaction.Type {
+	case discord_ping:
+	case discord_application_command:
+		if interaction.Data.Name == "" || interaction.Token == "" || interaction.ApplicationID == "" {
+			return DiscordInteraction{}, errors.New("command without a name, token or application")
+		}
+	default:
+		return DiscordInteraction{}, fmt.Errorf("unknown interaction type %d", interaction.Type)
+	}
+	return interaction, nil
+}
+
+type DiscordResponse struct {
+	Type int                 `json:"type"`
+	Data *DiscordMessageData `json:"data,omitempty"`
+}
+
+type DiscordMessageData struct {
+	Content string         `json:"content,omitempty"`
+	Embeds  []DiscordEmbed `json:"embeds,omitempty"`
+	Flags   int            `json:"flags,omitempty"`
+}
+
+type DiscordEmbed struct {
+	Title       string              `json:"title"`
+	URL         string              `json:"url,omitempty"`
+	Description string              `json:"description"`
+	Footer      *DiscordEmbedFooter `json:"footer,omitempty"`
+}
+
+type DiscordEmbedFooter struct {
+	Text string `json:"text"`
+}
+
+// DiscordPassageEmbed shows a passage as an embed titled with its
+// reference, cut to fit Discord's limits.
+func DiscordPassageEmbed(passage Passage, link string) DiscordEmbed {
+	text := PassageText(passage, func(label string) string { return "**" + label + "**" })
+	return DiscordEmbed{
+		Title:       Truncate(passage.Reference.String(), discord_title_limit-1),
+		URL:         link,
+		Description: Truncate(text, discord_embed_limit-1),
+		Footer:      &DiscordEmbedFooter{Text: passage.Translation.Name},
+	}
+}
+
+// DiscordError is a message only the person who ran the command sees.
+func DiscordError(message string) DiscordMessageData {
+	return DiscordMessageData{Content: message, Flags: discord_ephemeral}
+}
+
+// editDiscordResponse fills in a deferred response once its lookup is done.
+func (s *Server) editDiscordResponse(ctx context.Context, interaction DiscordInteraction, data DiscordMessageData) error {
+	request_url := fmt.Sprintf("%s/webhooks/%s/%s/messages/@original", discord_api, url.PathEscape(interaction.ApplicationID), url.PathEscape(interaction.Token))
+	return s.sendIntegration(ctx, http.MethodPatch, request_url, nil, data)
+}
+
+// postDiscord serves POST /integrations/discord, the interactions endpoint
+// for the /verse command.
+func (s *Server) postDiscord(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, discord_body_size))
+	if err != nil {
+		http.Error(w, "Request body too large.", http.StatusRequestEntityTooLarge)
+		return
+	}
+	// Discord sends requests with bad signatures on purpose, and stops
+	// using an endpoint that accepts them
+	err = VerifyDiscordSignature(discord_public_key, r.Header, body)
+	if err != nil {
+		Logger(r.Context()).Warn("rejected discord request", "err", err)
+		http.Error(w, "Bad signature.", http.StatusUnauthorized)
+		return
+	}
+	interaction, err := ParseDiscordInteraction(body)
+	if err != nil {
+		http.Error(w, "Bad interaction.", http.StatusBadRequest)
+		return
+	}
+	if interaction.Type == discord_ping {
+		WriteJSON(w, http.StatusOK, DiscordResponse{Type: discord_pong})
+		return
+	}
+	if interaction.Data.Name != discord_command {
+		data := DiscordError(fmt.Sprintf("Unknown command /%s.", interaction.Data.Name))
+		WriteJSON(w, http.StatusOK, DiscordResponse{Type: discord_channel_message, Data: &data})
+		return
+	}
+
+	text := strings.TrimSpace(interaction.Data.Option("ref"))
+	translation := default_translation
+	lookup := func(ctx context.Context) DiscordMessageData {
+		passage, err := s.LoadPassage(ctx, translation, text)
+		if err != nil {
+			return DiscordError(integrationErrorText(text, err))
+		}
+		return DiscordMessageData{Embeds: []DiscordEmbed{DiscordPassageEmbed(passage, s.PassageURL(r, translation, passage.Reference))}}
+	}
+	late := func(ctx context.Context, data DiscordMessageData) {
+		err := s.editDiscordResponse(ctx, interaction, data)
+		if err != nil {
+			Logger(ctx).Error("answering discord command", "err", err)
+		}
+	}
+	data, ok := answerInTime(r, lookup, late)
+	if !ok {
+		// shows "thinking…" until the answer is edited in
+		WriteJSON(w, http.StatusOK, DiscordResponse{Type: discord_deferred_message})
+		return
+	}
+	WriteJSON(w, http.StatusOK, DiscordResponse{Type: discord_channel_message, Data: &data})
+}
+
+type discordCommand struct {
+	Name        string                 `json:"name"`
+	Type        int                    `json:"type"`
+	Description string                 `json:"description"`
+	Options     []discordCommandOption `json:"options"`
+}
+
+type discordCommandOption struct {
+	Name        string `json:"name"`
+	Type        int    `json:"type"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+}
+
+// RegisterDiscordCommands sets the application's global commands to
+// /verse, replacing any it had.
+func (s *Server) RegisterDiscordCommands(ctx context.Context, application_id string, token string) error {
+	commands := []discordCommand{{
+		Name:        discord_command,
+		Type:        discord_chat_input,
+		Description: "Look up a Bible passage",
+		Options: []discordCommandOption{{
+			Name:        "ref",
+			Type:        discord_string_option,
+			Description: `A reference, like "John 3:16" or "Ps 23"`,
+			Required:    true,
+		}},
+	}}
+	request_url := fmt.Sprintf("%s/applications/%s/commands", discord_api, url.PathEscape(application_id))
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	return s.sendIntegration(ctx, http.MethodPut, request_url, http.Header{"Authorization": {"Bot " + token}}, commands)
+}
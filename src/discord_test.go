@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// discordKey is a fixed key pair, so test failures are repeatable.
+func discordKey() (ed25519.PublicKey, ed25519.PrivateKey) {
+	private := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{7}, ed25519.SeedSize))
+	return private.Public().(ed25519.PublicKey), private
+}
+
+func signDiscord(key ed25519.PrivateKey, timestamp string, body string) string {
+	return hex.EncodeToString(ed25519.Sign(key, []byte(timestamp+body)))
+}
+
+func TestParseDiscordPublicKey(t *testing.T) {
+	public, _ := discordKey()
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{hex.EncodeToString(public), true},
+		{strings.ToUpper(hex.EncodeToString(public)), true},
+		{hex.EncodeToString(public)[:62], false},
+		{hex.EncodeToString(public) + "00", false},
+		{strings.Repeat("z", 64), false},
+		{"", false},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			key, err := ParseDiscordPublicKey(test.value)
+			if (err == nil) != test.ok {
+				t.Fatalf("ParseDiscordPublicKey: %v", err)
+			}
+			if test.ok && !key.Equal(public) {
+				t.Errorf("key %x, want %x", key, public)
+			}
+		})
+	}
+}
+
+func TestVerifyDiscordSignature(t *testing.T) {
+	public, private := discordKey()
+	_, other, _ := ed25519.GenerateKey(nil)
+	body := `{"type":1}`
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		body      string
+		ok        bool
+	}{
+		{"valid", "1760529600", signDiscord(private, "1760529600", body), body, true},
+		{"other key", "1760529600", signDiscord(other, "1760529600", body), body, false},
+		{"other body", "1760529600", signDiscord(private, "1760529600", body), `{"type":2}`, false},
+		{"other timestamp", "1760529601", signDiscord(private, "1760529600", body), body, false},
+		{"no timestamp", "", signDiscord(private, "", body), body, false},
+		{"no signature", "1760529600", "", body, false},
+		{"short signature", "1760529600", signDiscord(private, "1760529600", body)[:126], body, false},
+		{"not hex", "1760529600", strings.Repeat("z", 128), body, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("X-Signature-Timestamp", test.timestamp)
+			header.Set("X-Signature-Ed25519", test.signature)
+			err := VerifyDiscordSignature(public, header, []byte(test.body))
+			if test.ok && err != nil {
+				t.Errorf("VerifyDiscordSignature: %v", err)
+			}
+			if !test.ok && !errors.Is(err, ErrBadSignature) {
+				t.Errorf("VerifyDiscordSignature = %v, want ErrBadSignature", err)
+			}
+		})
+	}
+}
+
+func TestParseDiscordInteraction(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		ok   bool
+		ref  string
+	}{
+		{"ping", `{"type":1}`, true, ""},
+		{"command", `{"type":2,"application_id":"1","token":"t","data":{"name":"verse","options":[{"name":"ref","type":3,"value":"John 3:16"}]}}`, true, "John 3:16"},
+		{"other options", `{"type":2,"application_id":"1","token":"t","data":{"name":"verse","options":[{"name":"count","type":4,"value":3},{"name":"ref","type":3,"value":"Ps 23"}]}}`, true, "Ps 23"},
+		{"option that isn't a string", `{"type":2,"application_id":"1","token":"t","data":{"name":"verse","options":[{"name":"ref","type":4,"value":3}]}}`, true, ""},
+		{"no options", `{"type":2,"application_id":"1","token":"t","data":{"name":"verse"}}`, true, ""},
+		{"command without a name", `{"type":2,"application_id":"1","token":"t","data":{}}`, false, ""},
+		{"command without a token", `{"type":2,"application_id":"1","data":{"name":"verse"}}`, false, ""},
+		{"command without an application", `{"type":2,"token":"t","data":{"name":"verse"}}`, false, ""},
+		{"autocomplete", `{"type":4}`, false, ""},
+		{"not JSON", `type=1`, false, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			interaction, err := ParseDiscordInteraction([]byte(test.body))
+			if (err == nil) != test.ok {
+				t.Fatalf("ParseDiscordInteraction: %v", err)
+			}
+			if ref := interaction.Data.Option("ref"); ref != test.ref {
+				t.Errorf("ref %q, want %q", ref, test.ref)
+			}
+		})
+	}
+}
+
+func TestDiscordPassageEmbed(t *testing.T) {
+	translation := Translation{Identifier: "web", Name: "World English Bible"}
+	verses := func(n int, text string) []Verse {
+		var verses []Verse
+		for i := 1; i <= n; i++ {
+			verses = append(verses, Verse{Chapter: 119, Verse: i, Text: text})
+		}
+		return verses
+	}
+	tests := []struct {
+		name        string
+		verses      []Verse
+		description string
+		truncated   bool
+	}{
+		{"one verse", verses(1, "Blessed are those."), "Blessed are those.", false},
+		{"numbered", verses(2, "Blessed are those."), "**1** Blessed are those. **2** Blessed are those.", false},
+		{"long", verses(176, "Blessed are those whose ways are blameless."), "", true},
+		// four bytes a character, so a byte limit would cut far too early
+		// or split one
+		{"multi-byte", verses(176, strings.Repeat("𝔅", 40)), "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			passage := Passage{Reference: Reference{Book: "Psalms", ChapterStart: 119, VerseStart: 1, ChapterEnd: 119, VerseEnd: len(test.verses)}, Translation: translation, Verses: test.verses}
+			embed := DiscordPassageEmbed(passage, "https://example.com/passage")
+			if embed.Title != passage.Reference.String() || embed.URL != "https://example.com/passage" || embed.Footer == nil || embed.Footer.Text != "World English Bible" {
+				t.Errorf("embed %+v", embed)
+			}
+			n := utf8.RuneCountInString(embed.Description)
+			if n > discord_embed_limit || !utf8.ValidString(embed.Description) {
+				t.Errorf("description is %d characters", n)
+			}
+			if test.truncated {
+				if !strings.HasSuffix(embed.Description, "…") || n < discord_embed_limit-200 {
+					t.Errorf("description is %d characters, ending %q", n, embed.Description[len(embed.Description)-12:])
+				}
+			} else if embed.Description != test.description {
+				t.Errorf("description %q, want %q", embed.Description, test.description)
+			}
+		})
+	}
+}
+
+// discordRequest is an interaction signed with key.
+func discordRequest(key ed25519.PrivateKey, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/integrations/discord", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	timestamp := "1760529600"
+	r.Header.Set("X-Signature-Timestamp", timestamp)
+	r.Header.Set("X-Signature-Ed25519", signDiscord(key, timestamp, body))
+	return r
+}
+
+func TestPostDiscord(t *testing.T) {
+	public, private := discordKey()
+	_, other, _ := ed25519.GenerateKey(nil)
+	discord_public_key = public
+	t.Cleanup(func() { discord_public_key = nil })
+	handler := newTestServer(t)
+	command := func(name string, ref string) string {
+		return `{"type":2,"application_id":"1","token":"t","data":{"name":"` + name + `","options":[{"name":"ref","type":3,"value":"` + ref + `"}]}}`
+	}
+	tests := []struct {
+		name    string
+		request *http.Request
+		status  int
+		// kind is the response type, if the status is 200
+		kind    int
+		title   string
+		content string
+	}{
+		{"ping", discordRequest(private, `{"type":1}`), http.StatusOK, discord_pong, "", ""},
+		{"verse", discordRequest(private, command("verse", "Jn 3:16")), http.StatusOK, discord_channel_message, "John 3:16", ""},
+		{"passage", discordRequest(private, command("verse", "Psalm 119:1-2")), http.StatusOK, discord_channel_message, "Psalms 119:1-2", ""},
+		{"not a reference", discordRequest(private, command("verse", "John 3:x")), http.StatusOK, discord_channel_message, "", `"John 3:x" isn't a reference like "John 3:16".`},
+		{"unknown command", discordRequest(private, command("psalm", "23")), http.StatusOK, discord_channel_message, "", "Unknown command /psalm."},
+		{"bad interaction", discordRequest(private, `{"type":9}`), http.StatusBadRequest, 0, "", ""},
+		{"bad signature", discordRequest(other, `{"type":1}`), http.StatusUnauthorized, 0, "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, test.request)
+			if w.Code != test.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+			var response DiscordResponse
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.Type != test.kind {
+				t.Fatalf("response type %d, want %d", response.Type, test.kind)
+			}
+			switch {
+			case test.title != "":
+				if len(response.Data.Embeds) != 1 || response.Data.Embeds[0].Title != test.title || response.Data.Flags != 0 {
+					t.Errorf("data %+v, want an embed titled %s", response.Data, test.title)
+				}
+			case test.content != "":
+				if response.Data.Content != test.content || response.Data.Flags != discord_ephemeral {
+					t.Errorf("data %+v, want ephemeral %q", response.Data, test.content)
+				}
+			}
+		})
+	}
+}
+
+func TestRegisterDiscordCommands(t *testing.T) {
+	var request *http.Request
+	var body []byte
+	bible := NewBibleClient("http://upstream.invalid")
+	bible.HTTP = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		request = r
+		body, _ = io.ReadAll(r.Body)
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("[]")), Header: http.Header{}}, nil
+	})}
+	err := NewServer(bible, nil).RegisterDiscordCommands(t.Context(), "123", "bot-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Method != http.MethodPut || request.URL.String() != "https://discord.com/api/v10/applications/123/commands" {
+		t.Errorf("%s %s", request.Method, request.URL)
+	}
+	if authorization := request.Header.Get("Authorization"); authorization != "Bot bot-token" {
+		t.Errorf("Authorization %q", authorization)
+	}
+	var commands []discordCommand
+	err = json.Unmarshal(body, &commands)
+	if err != nil || len(commands) != 1 || commands[0].Name != "verse" || len(commands[0].Options) != 1 || commands[0].Options[0].Name != "ref" || !commands[0].Options[0].Required {
+		t.Errorf("commands %s", body)
+	}
+}
+
+func TestSendIntegrationRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		// requests is how many are made, and ok whether the last succeeds
+		requests int
+		ok       bool
+	}{
+		{"ok", []int{http.StatusNoContent}, 1, true},
+		{"rate limited", []int{http.StatusTooManyRequests, http.StatusOK}, 2, true},
+		{"unavailable", []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK}, 3, true},
+		{"gives up", []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK}, integration_retries + 1, false},
+		{"not retried", []int{http.StatusUnauthorized, http.StatusOK}, 1, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests atomic.Int32
+			service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := requests.Add(1)
+				// no wait, so it falls back to the backoff
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(test.statuses[n-1])
+			}))
+			t.Cleanup(service.Close)
+			s := NewServer(NewBibleClient(service.URL), nil)
+			start := time.Now()
+			err := s.sendIntegration(t.Context(), http.MethodPost, service.URL+"/hook/secret-token", nil, map[string]string{"text": "hi"})
+			if (err == nil) != test.ok {
+				t.Errorf("sendIntegration: %v", err)
+			}
+			if err != nil && strings.Contains(err.Error(), "secret-token") {
+				t.Errorf("error %q has the path in it", err)
+			}
+			if n := int(requests.Load()); n != test.requests {
+				t.Errorf("%d requests, want %d", n, test.requests)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("took %s", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// email_width is where the plain text part of an email wraps.
+	email_width = 72
+	// max_email_length is the longest address SMTP allows.
+	max_email_length = 254
+	// confirm_expiry is how long the link to confirm a subscription works.
+	confirm_expiry = 48 * time.Hour
+)
+
+// Subscriber is an address signed up for the daily verse.
+type Subscriber struct {
+	Email       string
+	Translation string
+}
+
+// Mailer sends the verse of the day to every subscriber once a day, at a
+// local time of day, over SMTP.
+type Mailer struct {
+	// Server is where the verses and subscribers come from.
+	Server *Server
+	// Addr is the SMTP server's host:port, and Auth nil for a server that
+	// takes mail without logging in.
+	Addr string
+	Auth smtp.Auth
+	From string
+	// Hour and Minute are when in Location emails go out.
+	Hour     int
+	Minute   int
+	Location *time.Location
+	// Interval is the pause between emails, so a big list doesn't trip the
+	// server's rate limits.
+	Interval time.Duration
+	// Origin is the scheme and host links in emails are made absolute
+	// with.
+	Origin string
+}
+
+// mailer is nil unless -smtp-host is given, which leaves /subscribe
+// unserved.
+var mailer *Mailer
+
+// ParseEmail checks an address someone typed in, returning it lowercased.
+func ParseEmail(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	address, err := mail.ParseAddress(value)
+	if err != nil || address.Address != value || len(value) > max_email_length {
+		return "", errors.New("that doesn't look like an email address")
+	}
+	return strings.ToLower(value), nil
+}
+
+// UnsubscribeToken lets whoever has it unsubscribe email, without logging
+// in. It's signed with the cookie secret.
+func UnsubscribeToken(email string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(email)) + "." + cookieSignature("unsubscribe", email)
+}
+
+// ParseUnsubscribeToken returns the address a token was made for, or false
+// if it's malformed or its signature doesn't match.
+func ParseUnsubscribeToken(token string) (string, bool) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", false
+	}
+	email, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || !hmac.Equal([]byte(signature), []byte(cookieSignature("unsubscribe", string(email)))) {
+		return "", false
+	}
+	return string(email), true
+}
+
+// ConfirmToken lets whoever has it confirm the subscription of email until
+// expires, which is part of what's signed.
+func ConfirmToken(email string, expires time.Time) string {
+	value := base64.RawURLEncoding.EncodeToString([]byte(email)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	return value + "." + cookieSignature("confirm", value)
+}
+
+// ParseConfirmToken returns the address a token was made for, or false if
+// it's malformed, its signature doesn't match or it expired before now.
+func ParseConfirmToken(token string, now time.Time) (string, bool) {
+	i := strings.LastIndex(token, ".")
+	if i < 0 || !hmac.Equal([]byte(token[i+1:]), []byte(cookieSignature("confirm", token[:i]))) {
+		return "", false
+	}
+	encoded, expires, _ := strings.Cut(token[:i], ".")
+	email, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	seconds, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || !now.Before(time.Unix(seconds, 0)) {
+		return "", false
+	}
+	return string(email), true
+}
+
+// nextSend is the first time emails go out after now.
+func (m *Mailer) nextSend(now time.Time) time.Time {
+	now = now.In(m.Location)
+	at := time.Date(now.Year(), now.Month(), now.Day(), m.Hour, m.Minute, 0, 0, m.Location)
+	if !at.After(now) {
+		at = time.Date(now.Year(), now.Month(), now.Day()+1, m.Hour, m.Minute, 0, 0, m.Location)
+	}
+	return at
+}
+
+// Run sends each day's emails until ctx is done. If the server starts after
+// today's send time, whoever hasn't had today's email yet gets it straight
+// away.
+func (m *Mailer) Run(ctx context.Context) {
+	now := time.Now().In(m.Location)
+	if !now.Before(time.Date(now.Year(), now.Month(), now.Day(), m.Hour, m.Minute, 0, 0, m.Location)) {
+		m.SendDay(ctx, now)
+	}
+	for {
+		timer := time.NewTimer(time.Until(m.nextSend(time.Now())))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case now := <-timer.C:
+			m.SendDay(ctx, now)
+		}
+	}
+}
+
+// SendDay emails the verse of the day to every subscriber who hasn't had
+// it yet. The day is the calendar date in the mailer's time zone. One
+// address failing doesn't stop the rest, and it's tried again on the next
+// run.
+func (m *Mailer) SendDay(ctx context.Context, now time.Time) {
+	now = now.In(m.Location)
+	date := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	day := date.Format(time.DateOnly)
+	subscribers, err := m.Server.Store.LoadSubscribersDue(ctx, day)
+	if err != nil {
+		Logger(ctx).Error("loading subscribers", "err", err)
+		return
+	}
+	if len(subscribers) == 0 {
+		return
+	}
+
+	verses := map[string]VerseOfTheDayInfo{}
+	sent, failed := 0, 0
+	for i, subscriber := range subscribers {
+		if i > 0 {
+			timer := time.NewTimer(m.Interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				Logger(ctx).Info("stopped sending verse of the day", "date", day, "sent", sent, "failed", failed)
+				return
+			case <-timer.C:
+			}
+		}
+		info, ok := verses[subscriber.Translation]
+		if !ok {
+			info, err = m.Server.NewVerseOfTheDayInfo(ctx, subscriber.Translation, date)
+			if err != nil {
+				Logger(ctx).Error("loading verse of the day for email", "translation", subscriber.Translation, "err", err)
+				failed++
+				continue
+			}
+			verses[subscriber.Translation] = info
+		}
+		err = m.Send(subscriber, date, info)
+		if err == nil {
+			err = m.Server.Store.MarkSent(ctx, subscriber.Email, day)
+		}
+		if err != nil {
+			Logger(ctx).Error("sending verse of the day", "to", subscriber.Email, "err", err)
+			failed++
+			continue
+		}
+		sent++
+	}
+	Logger(ctx).Info("sent verse of the day", "date", day, "sent", sent, "failed", failed)
+}
+
+// Send emails one subscriber.
+func (m *Mailer) Send(subscriber Subscriber, date time.Time, info VerseOfTheDayInfo) error {
+	message, err := m.Compose(subscriber, date, info)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.Addr, m.Auth, m.From, []string{subscriber.Email}, message)
+}
+
+// SendConfirmation emails the link that confirms a subscription to email.
+func (m *Mailer) SendConfirmation(email string, link string) error {
+	var body bytes.Buffer
+	qp := quotedprintable.NewWriter(&body)
+	fmt.Fprintf(qp, "Someone, hopefully you, asked for the verse of the day to be emailed to %s every day at %s.\n\nTo start getting it, confirm here within %d hours:\n%s\n\nIf it wasn't you, ignore this email and you won't hear from us again.\n",
+		email, m.sendAt(), int(confirm_expiry.Hours()), link)
+	qp.Close()
+
+	headers, err := m.headers(email, "Confirm your daily verse emails")
+	if err != nil {
+		return err
+	}
+	var message bytes.Buffer
+	headers = append(headers, "Content-Type: text/plain; charset=utf-8", "Content-Transfer-Encoding: quoted-printable")
+	for _, header := range headers {
+		message.WriteString(header + "\r\n")
+	}
+	message.WriteString("\r\n")
+	body.WriteTo(&message)
+	return smtp.SendMail(m.Addr, m.Auth, m.From, []string{email}, message.Bytes())
+}
+
+// headers are the ones every email has, ahead of its Content-Type.
+func (m *Mailer) headers(to string, subject string) ([]string, error) {
+	origin, err := url.Parse(m.Origin)
+	if err != nil {
+		return nil, err
+	}
+	return []string{
+		"From: " + m.From,
+		"To: " + to,
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: <" + RandomToken(16) + "@" + origin.Hostname() + ">",
+		"MIME-Version: 1.0",
+	}, nil
+}
+
+// EmailPage is what the HTML part of an email is rendered from.
+type EmailPage struct {
+	Date        string
+	Reference   string
+	Text        string
+	Translation string
+	Link        string
+	Site        string
+	Unsubscribe string
+}
+
+// Compose builds the email for one subscriber: a plain text part laid out
+// like the site's .txt pages, and an HTML part, with headers that let mail
+// clients offer one-click unsubscribing.
+func (m *Mailer) Compose(subscriber Subscriber, date time.Time, info VerseOfTheDayInfo) ([]byte, error) {
+	query := url.Values{"date": {info.Date}}
+	if subscriber.Translation != default_translation {
+		query.Set("translation", subscriber.Translation)
+	}
+	page := EmailPage{
+		Date:        date.Format("Monday, 2 January 2006"),
+		Reference:   info.Reference,
+		Text:        info.Verse.Text,
+		Translation: info.Translation.Name,
+		Link:        m.Origin + m.Server.Path("votd") + "?" + query.Encode(),
+		Site:        m.Origin + m.Server.Path("books"),
+		Unsubscribe: m.Origin + m.Server.Path("unsubscribe") + "?" + url.Values{"token": {UnsubscribeToken(subscriber.Email)}}.Encode(),
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "Verse of the day, %s\n\n", page.Date)
+	for _, line := range WrapVerse(fmt.Sprintf("%d:%d", info.Verse.Chapter, info.Verse.Verse), verseText(info.Verse.Text), email_width) {
+		text.WriteString(line + "\n")
+	}
+	fmt.Fprintf(&text, "\n%s\n%s\n%s\n\nUnsubscribe: %s\n", page.Reference, page.Link, Attribution(info.Translation), page.Unsubscribe)
+
+	var html bytes.Buffer
+	err := m.Server.templates["email.html"].ExecuteTemplate(&html, "email", page)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		content_type string
+		body         string
+	}{{"text/plain; charset=utf-8", text.String()}, {"text/html; charset=utf-8", html.String()}} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.content_type},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		qp.Write([]byte(part.body))
+		qp.Close()
+	}
+	parts.Close()
+
+	headers, err := m.headers(subscriber.Email, "Verse of the day: "+info.Reference)
+	if err != nil {
+		return nil, err
+	}
+	headers = append(headers,
+		"Content-Type: multipart/alternative; boundary="+parts.Boundary(),
+		"List-Unsubscribe: <"+page.Unsubscribe+">",
+		"List-Unsubscribe-Post: List-Unsubscribe=One-Click",
+	)
+	var message bytes.Buffer
+	for _, header := range headers {
+		message.WriteString(header + "\r\n")
+	}
+	message.WriteString("\r\n")
+	body.WriteTo(&message)
+	return message.Bytes(), nil
+}
+
+type SubscribePage struct {
+	Email       string
+	Translation string
+	SendAt      string
+	Error       string
+	// Sent is set once the confirmation email has gone out, and Token when
+	// the page is asking to confirm, with Done once that's happened.
+	Sent  bool
+	Token string
+	Done  bool
+}
+
+func (m *Mailer) sendAt() string {
+	return fmt.Sprintf("%02d:%02d %s", m.Hour, m.Minute, m.Location)
+}
+
+// getSubscribe serves the form to sign up for the daily verse.
+func (s *Server) getSubscribe(w http.ResponseWriter, r *http.Request) {
+	page := SubscribePage{Translation: RequestTranslation(r), SendAt: mailer.sendAt()}
+	s.RenderPage(w, r, http.StatusOK, "subscribe.html", "Daily verse by email", page)
+}
+
+// postSubscribe keeps a pending sign up and emails the address a link to
+// confirm it, so nobody can sign up an address that isn't theirs. The
+// answer is the same whether or not it was already signed up, so the form
+// can't be used to find out who is.
+func (s *Server) postSubscribe(w http.ResponseWriter, r *http.Request) {
+	translation := strings.ToLower(r.PostFormValue("translation"))
+	if translation == "" || !s.Translations.Has(r.Context(), translation) {
+		translation = default_translation
+	}
+	page := SubscribePage{Email: r.PostFormValue("email"), Translation: translation, SendAt: mailer.sendAt()}
+	email, err := ParseEmail(page.Email)
+	if err != nil {
+		page.Error = "That doesn't look like an email address."
+		s.RenderPage(w, r, http.StatusBadRequest, "subscribe.html", "Daily verse by email", page)
+		return
+	}
+	now := time.Now()
+	err = s.Store.AddPendingSubscriber(r.Context(), email, translation, now.Add(-confirm_expiry))
+	if err != nil {
+		Logger(r.Context()).Error("adding pending subscriber", "err", err)
+		s.renderError(w, r, http.StatusInternalServerError, "You couldn't be subscribed. Please try again.")
+		return
+	}
+	link := mailer.Origin + s.Path("confirm-subscribe") + "?" + url.Values{"token": {ConfirmToken(email, now.Add(confirm_expiry))}}.Encode()
+	err = mailer.SendConfirmation(email, link)
+	if err != nil {
+		Logger(r.Context()).Error("sending subscription confirmation", "to", email, "err", err)
+		s.renderError(w, r, http.StatusInternalServerError, "The email to confirm your subscription couldn't be sent. Please try again.")
+		return
+	}
+	page.Email = email
+	page.Sent = true
+	s.RenderPage(w, r, http.StatusOK, "subscribe.html", "Daily verse by email", page)
+}
+
+// confirmRequest reads the token of a confirmation link, rendering an error
+// for a bad or expired one.
+func (s *Server) confirmRequest(w http.ResponseWriter, r *http.Request) (SubscribePage, bool) {
+	token := r.URL.Query().Get("token")
+	email, ok := ParseConfirmToken(token, time.Now())
+	if !ok {
+		s.renderError(w, r, http.StatusBadRequest, "That confirmation link isn't valid or has expired. Try subscribing again.")
+		return SubscribePage{}, false
+	}
+	return SubscribePage{Email: email, SendAt: mailer.sendAt(), Token: token}, true
+}
+
+// getConfirmSubscribe asks for a click rather than confirming straight
+// away, since mail scanners open every link in an email.
+func (s *Server) getConfirmSubscribe(w http.ResponseWriter, r *http.Request) {
+	page, ok := s.confirmRequest(w, r)
+	if !ok {
+		return
+	}
+	s.RenderPage(w, r, http.StatusOK, "subscribe.html", "Daily verse by email", page)
+}
+
+// postConfirmSubscribe turns a pending sign up into a subscription.
+// Confirming twice is fine, but a sign up that's gone, because it expired
+// or was replaced, can't be confirmed.
+func (s *Server) postConfirmSubscribe(w http.ResponseWriter, r *http.Request) {
+	page, ok := s.confirmRequest(w, r)
+	if !ok {
+		return
+	}
+	pending, err := s.Store.ConfirmSubscriber(r.Context(), page.Email)
+	if err != nil {
+		Logger(r.Context()).Error("confirming subscriber", "err", err)
+		s.renderError(w, r, http.StatusInternalServerError, "You couldn't be subscribed. Please try again.")
+		return
+	}
+	if !pending {
+		s.renderError(w, r, http.StatusBadRequest, "That confirmation link isn't valid or has expired. Try subscribing again.")
+		return
+	}
+	page.Done = true
+	s.RenderPage(w, r, http.StatusOK, "subscribe.html", "Daily verse by email", page)
+}
+
+type UnsubscribePage struct {
+	Token string
+	Email string
+	Done  bool
+}
+
+// unsubscribeRequest reads the token of an unsubscribe link, rendering an
+// error for a bad one.
+func (s *Server) unsubscribeRequest(w http.ResponseWriter, r *http.Request) (UnsubscribePage, bool) {
+	token := r.URL.Query().Get("token")
+	email, ok := ParseUnsubscribeToken(token)
+	if !ok {
+		s.renderError(w, r, http.StatusBadRequest, "That unsubscribe link isn't valid. Try copying the whole link from the email.")
+		return UnsubscribePage{}, false
+	}
+	return UnsubscribePage{Token: token, Email: email}, true
+}
+
+// getUnsubscribe asks for confirmation rather than unsubscribing straight
+// away, since mail scanners open every link in an email.
+func (s *Server) getUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	page, ok := s.unsubscribeRequest(w, r)
+	if !ok {
+		return
+	}
+	s.RenderPage(w, r, http.StatusOK, "unsubscribe.html", "Unsubscribe", page)
+}
+
+// postUnsubscribe unsubscribes from the confirmation page, and from mail
+// clients' one-click unsubscribe buttons.
+func (s *Server) postUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	page, ok := s.unsubscribeRequest(w, r)
+	if !ok {
+		return
+	}
+	err := s.Store.RemoveSubscriber(r.Context(), page.Email)
+	if err != nil {
+		Logger(r.Context()).Error("removing subscriber", "err", err)
+		s.renderError(w, r, http.StatusInternalServerError, "You couldn't be unsubscribed. Please try again.")
+		return
+	}
+	page.Done = true
+	s.RenderPage(w, r, http.StatusOK, "unsubscribe.html", "Unsubscribe", page)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfirmToken(t *testing.T) {
+	now := time.Now()
+	token := ConfirmToken("someone@example.com", now.Add(time.Hour))
+	encoded, rest, _ := strings.Cut(token, ".")
+	_, signature, _ := strings.Cut(rest, ".")
+	tests := []struct {
+		name  string
+		token string
+		now   time.Time
+		ok    bool
+	}{
+		{"valid", token, now, true},
+		{"expired", token, now.Add(time.Hour), false},
+		{"later expiry", encoded + "." + strconv.FormatInt(now.Add(24*time.Hour).Unix(), 10) + "." + signature, now, false},
+		{"other address", base64.RawURLEncoding.EncodeToString([]byte("other@example.com")) + "." + rest, now, false},
+		{"unsubscribe token", UnsubscribeToken("someone@example.com"), now, false},
+		{"malformed", "nonsense", now, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			email, ok := ParseConfirmToken(test.token, test.now)
+			if ok != test.ok || ok && email != "someone@example.com" {
+				t.Errorf("ParseConfirmToken = %q, %v, want ok %v", email, ok, test.ok)
+			}
+		})
+	}
+}
+
+// fakeSMTP is an SMTP server that accepts every email, passing on the
+// message of each, with its lines ending in \n.
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	messages := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				c := textproto.NewConn(conn)
+				defer c.Close()
+				c.PrintfLine("220 localhost")
+				for {
+					line, err := c.ReadLine()
+					if err != nil {
+						return
+					}
+					switch strings.ToUpper(strings.SplitN(line, " ", 2)[0]) {
+					case "DATA":
+						c.PrintfLine("354 go ahead")
+						body, _ := c.ReadDotBytes()
+						messages <- string(body)
+						c.PrintfLine("250 ok")
+					case "QUIT":
+						c.PrintfLine("221 bye")
+						return
+					default:
+						c.PrintfLine("250 ok")
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String(), messages
+}
+
+// subscribeTestServer is the site with a store and a mailer sending through
+// fakeSMTP.
+func subscribeTestServer(t *testing.T) (*Server, http.Handler, <-chan string) {
+	t.Helper()
+	s := webhookTestServer(t)
+	addr, messages := fakeSMTP(t)
+	saved := mailer
+	mailer = &Mailer{Server: s, Addr: addr, From: "verses@example.com", Hour: 7, Location: time.UTC, Origin: "https://example.com"}
+	t.Cleanup(func() { mailer = saved })
+	return s, s.Routes(false, false), messages
+}
+
+func postForm(handler http.Handler, target string, form url.Values) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func subscribers(t *testing.T, s *Server) []Subscriber {
+	t.Helper()
+	due, err := s.Store.LoadSubscribersDue(context.Background(), "2024-01-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return due
+}
+
+var confirm_link = regexp.MustCompile(`https://example\.com(/subscribe/confirm\?token=\S+)`)
+
+// Signing up only emails a link, and the address gets the daily verse once
+// the link has been followed and confirmed.
+func TestSubscribeConfirmation(t *testing.T) {
+	s, handler, messages := subscribeTestServer(t)
+
+	w := postForm(handler, "/subscribe", url.Values{"email": {"Someone@Example.com"}, "translation": {"web"}})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "a link to confirm") {
+		t.Fatalf("POST /subscribe: %d\n%s", w.Code, w.Body)
+	}
+	if due := subscribers(t, s); len(due) != 0 {
+		t.Fatalf("subscribed %v before confirming", due)
+	}
+	var message string
+	select {
+	case message = <-messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no confirmation email")
+	}
+	if !strings.Contains(message, "To: someone@example.com\n") {
+		t.Errorf("confirmation email isn't to someone@example.com:\n%s", message)
+	}
+	_, body, _ := strings.Cut(message, "\n\n")
+	text, _ := io.ReadAll(quotedprintable.NewReader(strings.NewReader(body)))
+	match := confirm_link.FindStringSubmatch(string(text))
+	if match == nil {
+		t.Fatalf("no confirmation link in\n%s", text)
+	}
+	link := match[1]
+
+	w = get(t, handler, link)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `<button type="submit">Confirm</button>`) {
+		t.Fatalf("GET %s: %d\n%s", link, w.Code, w.Body)
+	}
+	if due := subscribers(t, s); len(due) != 0 {
+		t.Fatalf("subscribed %v by opening the link", due)
+	}
+
+	w = postForm(handler, link, nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "will get the verse of the day") {
+		t.Fatalf("POST %s: %d\n%s", link, w.Code, w.Body)
+	}
+	if due := subscribers(t, s); len(due) != 1 || due[0] != (Subscriber{Email: "someone@example.com", Translation: "web"}) {
+		t.Errorf("subscribers %v", due)
+	}
+
+	w = postForm(handler, link, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("confirming again: %d", w.Code)
+	}
+}
+
+func TestConfirmSubscribeRejected(t *testing.T) {
+	s, handler, _ := subscribeTestServer(t)
+	err := s.Store.AddPendingSubscriber(context.Background(), "someone@example.com", "web", time.Now().Add(-confirm_expiry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"expired", ConfirmToken("someone@example.com", time.Now().Add(-time.Minute))},
+		{"forged", ConfirmToken("someone@example.com", time.Now().Add(time.Hour)) + "x"},
+		{"not pending", ConfirmToken("other@example.com", time.Now().Add(time.Hour))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := "/subscribe/confirm?" + url.Values{"token": {test.token}}.Encode()
+			if w := postForm(handler, target, nil); w.Code != http.StatusBadRequest {
+				t.Errorf("POST %s: %d", target, w.Code)
+			}
+			if due := subscribers(t, s); len(due) != 0 {
+				t.Errorf("subscribed %v", due)
+			}
+		})
+	}
+}
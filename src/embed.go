@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	embed_font_size     = 16
+	embed_min_font_size = 10
+	embed_max_font_size = 48
+	// the iframe oEmbed hands out, which fits most verses at the default
+	// font size
+	embed_width  = 500
+	embed_height = 200
+)
+
+type EmbedPage struct {
+	Reference   string
+	Text        string
+	Translation string
+	Link        string
+	Theme       string
+	FontSize    int
+}
+
+// embedOptions reads ?theme=light|dark|auto and ?fontsize= for the widget.
+// The widget lives on other sites, so it never uses the theme cookie, and
+// without ?theme= it follows the browser.
+func embedOptions(r *http.Request, page *EmbedPage) error {
+	query := r.URL.Query()
+	switch theme := query.Get("theme"); theme {
+	case "", ThemeAuto:
+	case ThemeLight, ThemeDark:
+		page.Theme = theme
+	default:
+		return &InvalidOptionError{Name: "theme", Value: theme, Options: []string{ThemeLight, ThemeDark, ThemeAuto}}
+	}
+	page.FontSize = embed_font_size
+	if value := query.Get("fontsize"); value != "" {
+		size, err := ParseNumber("font size", value)
+		if err != nil {
+			return err
+		}
+		page.FontSize = min(max(size, embed_min_font_size), embed_max_font_size)
+	}
+	return nil
+}
+
+// getEmbed serves /embed/{book}/{chapter}/{verse}, one verse with none of
+// the site around it, for other sites to put in an iframe.
+func (s *Server) getEmbed(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	translation := RequestTranslation(r)
+	var page EmbedPage
+	err := embedOptions(r, &page)
+	if err != nil {
+		textError(w, r, err)
+		return
+	}
+	number, err := ParseNumber("verse", vars["verse"])
+	if err != nil {
+		textError(w, r, err)
+		return
+	}
+
+	var book Book
+	var verse_info VerseInfo
+	var verse Verse
+	err = s.LoadVerse(r.Context(), translation, vars["book"], vars["chapter"], number, &book, &verse_info, &verse)
+	if err != nil {
+		textError(w, r, err)
+		return
+	}
+
+	link := s.VerseLink(translation, book, verse.Chapter, verse.Verse)
+	page.Reference = link.Text
+	page.Text = verse.Text
+	page.Translation = verse_info.Translation.Name
+	page.Link = absoluteURL(r, link.URL)
+
+	var buf bytes.Buffer
+	err = s.templates["embed.html"].ExecuteTemplate(&buf, "embed", page)
+	if err != nil {
+		slog.Error("rendering embed", "err", err)
+		http.Error(w, "500 internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+// EmbedPath is the widget for one verse.
+func (s *Server) EmbedPath(translation string, book Book, chapter int, verse int) string {
+	link := s.Path("embed", "book", BookSlug(book.Name), "chapter", strconv.Itoa(chapter), "verse", strconv.Itoa(verse))
+	if translation != default_translation {
+		link += "?translation=" + url.QueryEscape(translation)
+	}
+	return link
+}
+
+// OEmbedResponse is the "rich" type of https://oembed.com.
+type OEmbedResponse struct {
+	Version      string `json:"version"`
+	Type         string `json:"type"`
+	Title        string `json:"title"`
+	ProviderName string `json:"provider_name"`
+	ProviderURL  string `json:"provider_url"`
+	HTML         string `json:"html"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+// parseVersePath splits the path of a verse page URL, like /john/3/16 or
+// /kjv/john/3/16, into its translation, book, chapter and verse.
+func parseVersePath(p string) (string, string, string, string, bool) {
+	p = strings.TrimPrefix(p, base_path)
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	translation := default_translation
+	if len(parts) == 4 {
+		translation, parts = strings.ToLower(parts[0]), parts[1:]
+	}
+	if len(parts) != 3 {
+		return "", "", "", "", false
+	}
+	return translation, parts[0], parts[1], parts[2], true
+}
+
+// getOEmbed serves /oembed?url=, which turns a link to a verse page into
+// the iframe of its widget for sites that support oEmbed.
+func (s *Server) getOEmbed(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if format := query.Get("format"); format != "" && format != "json" {
+		WriteJSON(w, http.StatusNotImplemented, ErrorResponse{Status: http.StatusNotImplemented, Error: "Only JSON oEmbed responses are supported."})
+		return
+	}
+	page_url, err := url.Parse(query.Get("url"))
+	if err != nil || page_url.Path == "" {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Status: http.StatusBadRequest, Error: "?url= needs to be a link to a verse."})
+		return
+	}
+	translation, slug, chapter, verse_number, ok := parseVersePath(page_url.Path)
+	if !ok {
+		WriteJSON(w, http.StatusNotFound, ErrorResponse{Status: http.StatusNotFound, Error: "Only links to single verses can be embedded."})
+		return
+	}
+	if page_translation := page_url.Query().Get("translation"); page_translation != "" {
+		translation = strings.ToLower(page_translation)
+	}
+	number, err := ParseNumber("verse", verse_number)
+	if err != nil {
+		apiError(w, r, err)
+		return
+	}
+
+	var book Book
+	var verse_info VerseInfo
+	var verse Verse
+	err = s.LoadVerse(r.Context(), translation, slug, chapter, number, &book, &verse_info, &verse)
+	if err != nil {
+		apiError(w, r, err)
+		return
+	}
+
+	width, height := embed_width, embed_height
+	if n, err := strconv.Atoi(query.Get("maxwidth")); err == nil && n > 0 {
+		width = min(width, n)
+	}
+	if n, err := strconv.Atoi(query.Get("maxheight")); err == nil && n > 0 {
+		height = min(height, n)
+	}
+	title := fmt.Sprintf("%s %d:%d", book.Name, verse.Chapter, verse.Verse)
+	src := absoluteURL(r, s.EmbedPath(translation, book, verse.Chapter, verse.Verse))
+	WriteJSON(w, http.StatusOK, OEmbedResponse{
+		Version:      "1.0",
+		Type:         "rich",
+		Title:        title,
+		ProviderName: site_name,
+		ProviderURL:  absoluteURL(r, s.Path("books")),
+		HTML:         fmt.Sprintf(`<iframe src="%s" width="%d" height="%d" title="%s" style="border: 0"></iframe>`, html.EscapeString(src), width, height, html.EscapeString(title)),
+		Width:        width,
+		Height:       height,
+	})
+}
+
+// OEmbedPath is the oEmbed discovery link for a page.
+func (s *Server) OEmbedPath(r *http.Request) string {
+	page := SitePath(r.URL.Path)
+	if r.URL.RawQuery != "" {
+		page += "?" + r.URL.RawQuery
+	}
+	return s.Path("oembed") + "?url=" + url.QueryEscape(absoluteURL(r, page))
+}
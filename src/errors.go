@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrBookNotFound        = errors.New("book not found")
+	ErrNotFound            = errors.New("not found upstream")
+	ErrUpstreamUnavailable = errors.New("upstream unavailable")
+	ErrBadUpstreamResponse = errors.New("bad upstream response")
+	ErrNotAWord            = errors.New("not a single word")
+	ErrPlanNotFound        = errors.New("reading plan not found")
+	ErrInvalidBookmark     = errors.New("not a chapter or verse")
+	ErrInvalidHighlight    = errors.New("not a verse and color")
+)
+
+// AmbiguousBookError is returned when a slug is the start of several book
+// names, like "ju" for Judges and Jude.
+type AmbiguousBookError struct {
+	Slug       string
+	Candidates []Book
+}
+
+func (e *AmbiguousBookError) Error() string {
+	names := make([]string, len(e.Candidates))
+	for i, book := range e.Candidates {
+		names[i] = book.Name
+	}
+	return fmt.Sprintf("%q could be any of %s", e.Slug, strings.Join(names, ", "))
+}
+
+// VerseNotFoundError is returned for a verse number past the end of a
+// chapter.
+type VerseNotFoundError struct {
+	Reference string
+	Verse     int
+	Last      int
+}
+
+func (e *VerseNotFoundError) Error() string {
+	return fmt.Sprintf("%s has no verse %d, it has verses 1-%d", e.Reference, e.Verse, e.Last)
+}
+
+// ChapterNotFoundError is returned for a chapter past the end of a book.
+type ChapterNotFoundError struct {
+	Book    string
+	Chapter int
+	Last    int
+}
+
+func (e *ChapterNotFoundError) Error() string {
+	return fmt.Sprintf("%s has no chapter %d, it has chapters 1-%d", e.Book, e.Chapter, e.Last)
+}
+
+// PlanDayNotFoundError is returned for a day past the end of a reading
+// plan.
+type PlanDayNotFoundError struct {
+	Plan string
+	Day  int
+	Last int
+}
+
+func (e *PlanDayNotFoundError) Error() string {
+	return fmt.Sprintf("%s has no day %d, it has days 1-%d", e.Plan, e.Day, e.Last)
+}
+
+// InvalidNumberError is returned for a chapter or verse in the URL that
+// isn't a positive whole number, like /john/banana.
+type InvalidNumberError struct {
+	Kind  string
+	Value string
+}
+
+func (e *InvalidNumberError) Error() string {
+	return fmt.Sprintf("%q isn't a %s number", e.Value, e.Kind)
+}
+
+// InvalidOptionError is returned for a query parameter that isn't one of
+// the values it takes, like ?testament=xx.
+type InvalidOptionError struct {
+	Name    string
+	Value   string
+	Options []string
+}
+
+func (e *InvalidOptionError) Error() string {
+	return fmt.Sprintf("?%s=%s isn't one of %s", e.Name, e.Value, strings.Join(e.Options, ", "))
+}
+
+// IsTimeout reports whether err came from the upstream taking too long.
+func IsTimeout(err error) bool {
+	var net_err net.Error
+	return errors.As(err, &net_err) && net_err.Timeout()
+}
+
+// ErrorStatus maps an error from the Get* functions to the status code and
+// message shown to the user.
+func ErrorStatus(err error) (int, string) {
+	var ambiguous *AmbiguousBookError
+	var missing_verse *VerseNotFoundError
+	var missing_chapter *ChapterNotFoundError
+	var invalid_number *InvalidNumberError
+	var invalid_option *InvalidOptionError
+	var search_syntax *SearchSyntaxError
+	var missing_day *PlanDayNotFoundError
+	switch {
+	case errors.As(err, &search_syntax):
+		return http.StatusBadRequest, fmt.Sprintf("Couldn't read the search at character %d: %s.", search_syntax.Position, search_syntax.Message)
+	case errors.As(err, &invalid_option):
+		return http.StatusBadRequest, invalid_option.Error() + "."
+	case errors.As(err, &invalid_number):
+		return http.StatusBadRequest, invalid_number.Error() + "."
+	case errors.As(err, &missing_chapter):
+		return http.StatusNotFound, missing_chapter.Error() + "."
+	case errors.As(err, &ambiguous):
+		return http.StatusMultipleChoices, ambiguous.Error()
+	case errors.As(err, &missing_verse):
+		return http.StatusNotFound, missing_verse.Error() + "."
+	case errors.As(err, &missing_day):
+		return http.StatusNotFound, missing_day.Error() + "."
+	case errors.Is(err, ErrInvalidHighlight):
+		return http.StatusBadRequest, "That isn't a verse and color that can be highlighted."
+	case errors.Is(err, ErrInvalidBookmark):
+		return http.StatusBadRequest, "That isn't a chapter or verse that can be bookmarked."
+	case errors.Is(err, ErrPlanNotFound):
+		return http.StatusNotFound, "That reading plan doesn't exist."
+	case errors.Is(err, ErrNotAWord):
+		return http.StatusBadRequest, "The concordance only looks up single words."
+	case errors.Is(err, ErrBookNotFound):
+		return http.StatusNotFound, "That book doesn't exist."
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound, "That page doesn't exist."
+	case IsTimeout(err):
+		return http.StatusGatewayTimeout, "bible-api.com took too long to answer. Please try again in a moment."
+	case errors.Is(err, ErrUpstreamUnavailable):
+		return http.StatusBadGateway, "bible-api.com can't be reached right now. Please try again later."
+	case errors.Is(err, ErrBadUpstreamResponse):
+		return http.StatusInternalServerError, "bible-api.com sent something we couldn't understand."
+	default:
+		return http.StatusInternalServerError, "Something went wrong on our end. Please try again later."
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// votd_heartbeat is how often an idle event stream sends a comment, so
+	// proxies don't take it for dead and close it.
+	votd_heartbeat = 30 * time.Second
+	// votd_check is how often the hub looks for the date rolling over.
+	votd_check = time.Minute
+	// votd_retry is how long a browser waits before reconnecting a dropped
+	// stream.
+	votd_retry = 10 * time.Second
+)
+
+// votd_events tells /events/votd streams when the verse of the day changes.
+var votd_events = NewVotdHub()
+
+// VotdHub hands the date of each new verse of the day to its subscribers.
+// It only sends the date, since every stream loads the verse in its own
+// translation.
+type VotdHub struct {
+	mu          sync.Mutex
+	subscribers map[chan time.Time]struct{}
+	date        time.Time
+	closed      bool
+}
+
+func NewVotdHub() *VotdHub {
+	return &VotdHub{
+		subscribers: map[chan time.Time]struct{}{},
+		date:        votdToday(),
+	}
+}
+
+// votdToday is the start of the current UTC day.
+func votdToday() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
+
+// Subscribe returns a channel that receives each new date, or nil once the
+// hub is closed. The channel is closed when the hub is.
+func (h *VotdHub) Subscribe() chan time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+	events := make(chan time.Time, 1)
+	h.subscribers[events] = struct{}{}
+	return events
+}
+
+func (h *VotdHub) Unsubscribe(events chan time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[events]; ok {
+		delete(h.subscribers, events)
+		close(events)
+	}
+}
+
+// Publish sends date to every subscriber without waiting on any of them. A
+// subscriber that hasn't taken the last date yet gets the new one instead.
+func (h *VotdHub) Publish(date time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.date = date
+	for events := range h.subscribers {
+		select {
+		case <-events:
+		default:
+		}
+		events <- date
+	}
+}
+
+// Date is the date last published.
+func (h *VotdHub) Date() time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.date
+}
+
+// Run publishes the new date whenever the day rolls over, until ctx is done.
+func (h *VotdHub) Run(ctx context.Context) {
+	ticker := time.NewTicker(votd_check)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			today := votdToday()
+			if today.After(h.Date()) {
+				h.Publish(today)
+			}
+		}
+	}
+}
+
+// Close ends every stream, so a graceful shutdown doesn't wait on them.
+func (h *VotdHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for events := range h.subscribers {
+		delete(h.subscribers, events)
+		close(events)
+	}
+}
+
+// writeVotdEvent sends the verse for date as a "votd" event, or an "error"
+// event if it can't be loaded. The stream stays open either way.
+func (s *Server) writeVotdEvent(w http.ResponseWriter, r *http.Request, translation string, date time.Time) {
+	info, err := s.NewVerseOfTheDayInfo(r.Context(), translation, date)
+	if err != nil {
+		status, message := ErrorStatus(err)
+		Logger(r.Context()).Warn("loading verse of the day", "date", date.Format(time.DateOnly), "err", err)
+		data, _ := json.Marshal(ErrorResponse{Status: status, Error: message})
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+		return
+	}
+	data, _ := json.Marshal(info)
+	fmt.Fprintf(w, "id: %s\nevent: votd\ndata: %s\n\n", info.Date, data)
+}
+
+// getVotdEvents serves /events/votd, a server-sent event stream with the
+// verse of the day now and again each time the date changes.
+func (s *Server) getVotdEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Status: http.StatusInternalServerError, Error: "Streaming isn't supported here."})
+		return
+	}
+	events := votd_events.Subscribe()
+	if events == nil {
+		WriteJSON(w, http.StatusServiceUnavailable, ErrorResponse{Status: http.StatusServiceUnavailable, Error: "The server is shutting down."})
+		return
+	}
+	defer votd_events.Unsubscribe(events)
+
+	translation := RequestTranslation(r)
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	// nginx buffers responses unless told not to
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", votd_retry.Milliseconds())
+	s.writeVotdEvent(w, r, translation, votd_events.Date())
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(votd_heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case date, ok := <-events:
+			if !ok {
+				return
+			}
+			s.writeVotdEvent(w, r, translation, date)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		flusher.Flush()
+	}
+}
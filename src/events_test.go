@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVotdHub(t *testing.T) {
+	day := time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		publish []time.Time
+		// want is what a subscriber that hasn't read yet gets
+		want time.Time
+	}{
+		{"one", []time.Time{day}, day},
+		{"the latest", []time.Time{day, day.AddDate(0, 0, 1), day.AddDate(0, 0, 2)}, day.AddDate(0, 0, 2)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hub := NewVotdHub()
+			a, b := hub.Subscribe(), hub.Subscribe()
+			for _, date := range test.publish {
+				hub.Publish(date)
+			}
+			for _, events := range []chan time.Time{a, b} {
+				select {
+				case date := <-events:
+					if !date.Equal(test.want) {
+						t.Errorf("got %s, want %s", date, test.want)
+					}
+				default:
+					t.Errorf("nothing published")
+				}
+			}
+			if date := hub.Date(); !date.Equal(test.want) {
+				t.Errorf("Date = %s, want %s", date, test.want)
+			}
+		})
+	}
+}
+
+func TestVotdHubUnsubscribe(t *testing.T) {
+	hub := NewVotdHub()
+	a, b := hub.Subscribe(), hub.Subscribe()
+	hub.Unsubscribe(a)
+	// twice is fine
+	hub.Unsubscribe(a)
+	if _, ok := <-a; ok {
+		t.Errorf("unsubscribed channel isn't closed")
+	}
+	hub.Publish(time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC))
+	if len(b) != 1 {
+		t.Errorf("remaining subscriber has %d dates", len(b))
+	}
+
+	hub.Close()
+	if _, ok := <-b; !ok {
+		t.Errorf("the date published before Close was lost")
+	}
+	if _, ok := <-b; ok {
+		t.Errorf("Close left a channel open")
+	}
+	if events := hub.Subscribe(); events != nil {
+		t.Errorf("subscribed to a closed hub")
+	}
+	hub.Unsubscribe(b)
+}
+
+// sseEvent is one event of a text/event-stream, or a comment.
+type sseEvent struct {
+	ID      string
+	Event   string
+	Data    string
+	Retry   string
+	Comment string
+}
+
+// readEvent reads the next event from an event stream.
+func readEvent(t *testing.T, stream *bufio.Reader) sseEvent {
+	t.Helper()
+	var event sseEvent
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading the stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return event
+		}
+		name, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch name {
+		case "":
+			event.Comment = value
+		case "id":
+			event.ID = value
+		case "event":
+			event.Event = value
+		case "data":
+			event.Data += value
+		case "retry":
+			event.Retry = value
+		default:
+			t.Fatalf("unknown field in %q", line)
+		}
+	}
+}
+
+func TestVotdEvents(t *testing.T) {
+	s, _ := newFeedTestServer(t)
+	server := httptest.NewServer(s.Routes(false, false))
+	t.Cleanup(server.Close)
+	hub := NewVotdHub()
+	saved := votd_events
+	votd_events = hub
+	t.Cleanup(func() { votd_events = saved })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/events/votd", nil)
+	response, err := server.Client().Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	for name, want := range map[string]string{
+		"Content-Type":      "text/event-stream",
+		"Cache-Control":     "no-cache",
+		"X-Accel-Buffering": "no",
+	} {
+		if got := response.Header.Get(name); got != want {
+			t.Errorf("%s %q, want %q", name, got, want)
+		}
+	}
+	stream := bufio.NewReader(response.Body)
+	if event := readEvent(t, stream); event.Retry != "10000" {
+		t.Errorf("first event %+v, want the retry delay", event)
+	}
+
+	tomorrow := hub.Date().AddDate(0, 0, 1)
+	tests := []struct {
+		name string
+		// publish is the date to publish before reading, if any
+		publish time.Time
+		want    time.Time
+	}{
+		{"on connect", time.Time{}, hub.Date()},
+		{"the next day", tomorrow, tomorrow},
+		{"the day after", tomorrow.AddDate(0, 0, 1), tomorrow.AddDate(0, 0, 1)},
+	}
+	for _, test := range tests {
+		if !test.publish.IsZero() {
+			hub.Publish(test.publish)
+		}
+		event := readEvent(t, stream)
+		date := test.want.Format(time.DateOnly)
+		if event.Event != "votd" || event.ID != date {
+			t.Fatalf("%s: event %+v, want votd %s", test.name, event, date)
+		}
+		var info VerseOfTheDayInfo
+		err := json.Unmarshal([]byte(event.Data), &info)
+		if err != nil {
+			t.Fatalf("%s: data %q: %v", test.name, event.Data, err)
+		}
+		ref := VerseOfTheDayRef(test.want)
+		if info.Date != date || info.Verse.Verse != ref.Verse || info.Verse.Chapter != ref.Chapter {
+			t.Errorf("%s: %+v, want %s %d:%d", test.name, info, ref.Book, ref.Chapter, ref.Verse)
+		}
+	}
+
+	// hanging up unsubscribes the stream
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		hub.mu.Lock()
+		subscribers := len(hub.subscribers)
+		hub.mu.Unlock()
+		if subscribers == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d subscribers after the client left", subscribers)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Closing the hub, as a shutdown does, ends the streams.
+func TestVotdEventsClose(t *testing.T) {
+	s, _ := newFeedTestServer(t)
+	server := httptest.NewServer(s.Routes(false, false))
+	t.Cleanup(server.Close)
+	hub := NewVotdHub()
+	saved := votd_events
+	votd_events = hub
+	t.Cleanup(func() { votd_events = saved })
+
+	response, err := server.Client().Get(server.URL + "/events/votd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	stream := bufio.NewReader(response.Body)
+	readEvent(t, stream)
+	readEvent(t, stream)
+	hub.Close()
+	if rest, err := stream.ReadString('\n'); err == nil {
+		t.Errorf("stream went on after Close: %q", rest)
+	}
+
+	w := get(t, s.Routes(false, false), "/events/votd")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status %d after Close, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// feed_days is how many days of verses /feed.xml holds, today included.
+const feed_days = 30
+
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type AtomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type AtomContent struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+type AtomEntry struct {
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Link    AtomLink    `xml:"link"`
+	Content AtomContent `xml:"content"`
+}
+
+type AtomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  AtomAuthor  `xml:"author"`
+	Links   []AtomLink  `xml:"link"`
+	Entries []AtomEntry `xml:"entry"`
+}
+
+// feedID is a stable urn:uuid for name, so an entry keeps its ID however
+// the feed is reached and however often it is rebuilt.
+func feedID(name string) string {
+	sum := sha1.Sum([]byte(name))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// VerseOfTheDayFeed builds the Atom feed of the verses of the feed_days days
+// up to today. origin is the scheme and host links are made absolute with.
+func (s *Server) VerseOfTheDayFeed(ctx context.Context, translation string, today time.Time, origin string) (AtomFeed, error) {
+	today = today.UTC().Truncate(24 * time.Hour)
+	query := ""
+	if translation != default_translation {
+		query = "?translation=" + url.QueryEscape(translation)
+	}
+	feed := AtomFeed{
+		Title:   "Verse of the day",
+		ID:      feedID("votd/" + translation),
+		Updated: today.Format(time.RFC3339),
+		Author:  AtomAuthor{Name: site_name},
+		Links: []AtomLink{
+			{Href: origin + s.Path("feed") + query, Rel: "self", Type: "application/atom+xml"},
+			{Href: origin + s.Path("votd") + query, Rel: "alternate", Type: "text/html"},
+		},
+		Entries: make([]AtomEntry, feed_days),
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(markdown_workers)
+	for i := range feed.Entries {
+		date := today.AddDate(0, 0, -i)
+		g.Go(func() error {
+			var book Book
+			var verse_info VerseInfo
+			var verse Verse
+			err := s.VerseOfTheDay(ctx, translation, date, &book, &verse_info, &verse)
+			if err != nil {
+				return err
+			}
+			link := s.VerseLink(translation, book, verse.Chapter, verse.Verse)
+			feed.Entries[i] = AtomEntry{
+				Title:   date.Format("2 January 2006") + ": " + link.Text,
+				ID:      feedID("votd/" + translation + "/" + date.Format(time.DateOnly)),
+				Updated: date.Format(time.RFC3339),
+				Link:    AtomLink{Href: origin + link.URL, Rel: "alternate", Type: "text/html"},
+				Content: AtomContent{Type: "text", Text: fmt.Sprintf("%s (%s, %s)", verseText(verse.Text), link.Text, verse_info.Translation.Name)},
+			}
+			return nil
+		})
+	}
+	return feed, g.Wait()
+}
+
+type feedCacheEntry struct {
+	body  []byte
+	day   time.Time
+	added time.Time
+}
+
+// FeedCache keeps the feed built for each translation and host until the
+// day changes, so feed readers polling it cost no upstream requests.
+type FeedCache struct {
+	// Server is what the feeds are built from.
+	Server *Server
+
+	mu      sync.Mutex
+	entries map[string]feedCacheEntry
+	group   FetchGroup
+}
+
+func (c *FeedCache) Get(ctx context.Context, translation string, today time.Time, origin string, body *[]byte) error {
+	key := translation + " " + origin
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && entry.day.Equal(today) {
+		recordLookup(ctx, "feed", "hit")
+		*body = entry.body
+		return nil
+	}
+	recordLookup(ctx, "feed", "miss")
+
+	err := sharedFetch(ctx, &c.group, key+" "+today.Format(time.DateOnly), body, func(ctx context.Context, body *[]byte) error {
+		feed, err := c.Server.VerseOfTheDayFeed(ctx, translation, today, origin)
+		if err != nil {
+			return err
+		}
+		encoded, err := xml.MarshalIndent(feed, "", "\t")
+		if err != nil {
+			return err
+		}
+		*body = append([]byte(xml.Header), encoded...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.entries[key] = feedCacheEntry{body: *body, day: today, added: time.Now()}
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *FeedCache) Entries() []CacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := make([]CacheEntry, 0, len(c.entries))
+	for key, entry := range c.entries {
+		entries = append(entries, CacheEntry{Key: key, Size: len(entry.body), Added: entry.added})
+	}
+	return entries
+}
+
+func (c *FeedCache) Flush(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return flushMap(c.entries, key)
+}
+
+// getFeed serves /feed.xml. Its Last-Modified is the start of the current
+// day, when the newest entry was added, which ServeContent compares with
+// If-Modified-Since.
+func (s *Server) getFeed(w http.ResponseWriter, r *http.Request) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	var body []byte
+	err := s.Feeds.Get(r.Context(), RequestTranslation(r), today, absoluteURL(r, ""), &body)
+	if err != nil {
+		textError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	votdCacheControl(w, time.Now().UTC(), false)
+	http.ServeContent(w, r, "feed.xml", today, bytes.NewReader(body))
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// bibleUpstream is a bible-api.com with every book of verse_counts, named by
+// their IDs, where each verse is "Verse N of BOOK C.". It counts the
+// requests it gets.
+func bibleUpstream(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	translation := Translation{Identifier: "web", Name: "World English Bible", License: "Public Domain"}
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/data/web"), "/")
+		switch {
+		case len(parts) == 1 && parts[0] == "":
+			info := BookInfo{Translation: translation}
+			for _, id := range slices.Sorted(maps.Keys(verse_counts)) {
+				info.Books = append(info.Books, Book{ID: id, Name: id})
+			}
+			json.NewEncoder(w).Encode(info)
+			return
+		case len(parts) == 2 && verse_counts[parts[1]] != nil:
+			info := ChapterInfo{Translation: translation}
+			for i := range verse_counts[parts[1]] {
+				info.Chapters = append(info.Chapters, Chapter{BookID: parts[1], Book: parts[1], Chapter: i + 1})
+			}
+			json.NewEncoder(w).Encode(info)
+			return
+		case len(parts) == 3 && verse_counts[parts[1]] != nil:
+			chapter, err := strconv.Atoi(parts[2])
+			if err != nil || chapter < 1 || chapter > len(verse_counts[parts[1]]) {
+				break
+			}
+			info := VerseInfo{Translation: translation}
+			for i := range verse_counts[parts[1]][chapter-1] {
+				info.Verses = append(info.Verses, Verse{BookID: parts[1], BookName: parts[1], Chapter: chapter, Verse: i + 1, Text: fmt.Sprintf("Verse %d of %s %d.\n", i+1, parts[1], chapter)})
+			}
+			json.NewEncoder(w).Encode(info)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":"not found"}`)
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream, &hits
+}
+
+func newFeedTestServer(t *testing.T) (*Server, *atomic.Int32) {
+	t.Helper()
+	upstream, hits := bibleUpstream(t)
+	bible := NewBibleClient(upstream.URL)
+	bible.Retries = 0
+	return NewServer(bible, nil), hits
+}
+
+var uuid_urn = regexp.MustCompile(`^urn:uuid:[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// atomFeed is the parts of an Atom document RFC 4287 requires, decoded
+// without the types the feed is built from, so a field the encoder leaves
+// out shows up empty.
+type atomFeed struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string   `xml:"http://www.w3.org/2005/Atom id"`
+	Title   string   `xml:"http://www.w3.org/2005/Atom title"`
+	Updated string   `xml:"http://www.w3.org/2005/Atom updated"`
+	Authors []struct {
+		Name string `xml:"http://www.w3.org/2005/Atom name"`
+	} `xml:"http://www.w3.org/2005/Atom author"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"http://www.w3.org/2005/Atom link"`
+	Entries []struct {
+		ID      string `xml:"http://www.w3.org/2005/Atom id"`
+		Title   string `xml:"http://www.w3.org/2005/Atom title"`
+		Updated string `xml:"http://www.w3.org/2005/Atom updated"`
+		Links   []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"http://www.w3.org/2005/Atom link"`
+		Content struct {
+			Type string `xml:"type,attr"`
+			Text string `xml:",chardata"`
+		} `xml:"http://www.w3.org/2005/Atom content"`
+	} `xml:"http://www.w3.org/2005/Atom entry"`
+}
+
+// validateAtom checks body against the rules of RFC 4287 the feed can
+// break, and returns it decoded.
+func validateAtom(t *testing.T, body []byte) atomFeed {
+	t.Helper()
+	if !strings.HasPrefix(string(body), xml.Header) {
+		t.Errorf("feed doesn't start with the XML declaration")
+	}
+	var feed atomFeed
+	err := xml.Unmarshal(body, &feed)
+	if err != nil {
+		t.Fatalf("feed isn't Atom: %v", err)
+	}
+	if feed.XMLName.Space != "http://www.w3.org/2005/Atom" {
+		t.Errorf("feed is in namespace %q, want Atom's", feed.XMLName.Space)
+	}
+	if !uuid_urn.MatchString(feed.ID) {
+		t.Errorf("feed id %q isn't a urn:uuid", feed.ID)
+	}
+	if feed.Title == "" {
+		t.Errorf("feed has no title")
+	}
+	if _, err := time.Parse(time.RFC3339, feed.Updated); err != nil {
+		t.Errorf("feed updated %q isn't a date-time: %v", feed.Updated, err)
+	}
+	if len(feed.Authors) != 1 || feed.Authors[0].Name == "" {
+		t.Errorf("feed authors %+v, want one with a name", feed.Authors)
+	}
+	self := false
+	for _, link := range feed.Links {
+		self = self || link.Rel == "self"
+		if !strings.HasPrefix(link.Href, "http://") {
+			t.Errorf("feed link %q isn't absolute", link.Href)
+		}
+	}
+	if !self {
+		t.Errorf("feed has no self link")
+	}
+	ids := map[string]bool{}
+	for i, entry := range feed.Entries {
+		if !uuid_urn.MatchString(entry.ID) {
+			t.Errorf("entry %d: id %q isn't a urn:uuid", i, entry.ID)
+		}
+		if ids[entry.ID] || entry.ID == feed.ID {
+			t.Errorf("entry %d: id %q is used twice", i, entry.ID)
+		}
+		ids[entry.ID] = true
+		if entry.Title == "" {
+			t.Errorf("entry %d has no title", i)
+		}
+		if _, err := time.Parse(time.RFC3339, entry.Updated); err != nil {
+			t.Errorf("entry %d: updated %q isn't a date-time: %v", i, entry.Updated, err)
+		}
+		if len(entry.Links) != 1 || entry.Links[0].Rel != "alternate" || !strings.HasPrefix(entry.Links[0].Href, "http://") {
+			t.Errorf("entry %d: links %+v, want one absolute alternate", i, entry.Links)
+		}
+		if entry.Content.Type != "text" || entry.Content.Text == "" {
+			t.Errorf("entry %d: content %+v", i, entry.Content)
+		}
+	}
+	return feed
+}
+
+func TestVerseOfTheDayFeed(t *testing.T) {
+	s, _ := newFeedTestServer(t)
+	today := time.Date(2026, 10, 15, 13, 45, 0, 0, time.UTC)
+	feed, err := s.VerseOfTheDayFeed(context.Background(), "web", today, "http://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Entries) != feed_days {
+		t.Fatalf("%d entries, want %d", len(feed.Entries), feed_days)
+	}
+	if feed.Updated != "2026-10-15T00:00:00Z" {
+		t.Errorf("feed updated %s, want the start of the day", feed.Updated)
+	}
+	for i, entry := range feed.Entries {
+		date := time.Date(2026, 10, 15-i, 0, 0, 0, 0, time.UTC)
+		if entry.Updated != date.Format(time.RFC3339) {
+			t.Errorf("entry %d updated %s, want %s", i, entry.Updated, date.Format(time.RFC3339))
+		}
+		ref := VerseOfTheDayRef(date)
+		want := fmt.Sprintf("Verse %d of %s %d. (", ref.Verse, ref.Book, ref.Chapter)
+		if !strings.HasPrefix(entry.Content.Text, want) || !strings.HasSuffix(entry.Content.Text, ", World English Bible)") {
+			t.Errorf("entry %d content %q, want the verse for %s", i, entry.Content.Text, date.Format(time.DateOnly))
+		}
+		if !strings.HasPrefix(entry.Title, date.Format("2 January 2006")+": ") {
+			t.Errorf("entry %d title %q", i, entry.Title)
+		}
+	}
+}
+
+// An entry's ID depends only on its date, so the day a feed is built on
+// doesn't change the IDs of the days it shares with yesterday's.
+func TestVerseOfTheDayFeedIDs(t *testing.T) {
+	s, _ := newFeedTestServer(t)
+	today := time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		today  time.Time
+		origin string
+		// shift is how many days later the entries are
+		shift int
+	}{
+		{"rebuilt", today, "http://example.com", 0},
+		{"later in the day", today.Add(20 * time.Hour), "http://example.com", 0},
+		{"the next day", today.AddDate(0, 0, 1), "http://example.com", 1},
+		{"a week later", today.AddDate(0, 0, 7), "http://example.com", 7},
+		{"another host", today, "https://bible.example", 0},
+	}
+	base, err := s.VerseOfTheDayFeed(context.Background(), "web", today, "http://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feedID("votd/kjv/2026-10-15") == base.Entries[0].ID {
+		t.Errorf("translations share entry IDs")
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			feed, err := s.VerseOfTheDayFeed(context.Background(), "web", test.today, test.origin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if feed.ID != base.ID {
+				t.Errorf("feed id %s, want %s", feed.ID, base.ID)
+			}
+			for i := range feed_days - test.shift {
+				if got, want := feed.Entries[i+test.shift].ID, base.Entries[i].ID; got != want {
+					t.Errorf("entry %d: id %s, want %s", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFeed(t *testing.T) {
+	s, hits := newFeedTestServer(t)
+	handler := s.Routes(false, false)
+
+	w := get(t, handler, "/feed.xml")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /feed.xml: status %d", w.Code)
+	}
+	if content_type := w.Header().Get("Content-Type"); content_type != "application/atom+xml; charset=utf-8" {
+		t.Errorf("Content-Type %q", content_type)
+	}
+	feed := validateAtom(t, w.Body.Bytes())
+	if len(feed.Entries) != feed_days {
+		t.Errorf("%d entries, want %d", len(feed.Entries), feed_days)
+	}
+	last_modified := w.Header().Get("Last-Modified")
+	if modified, err := http.ParseTime(last_modified); err != nil || !modified.Equal(time.Now().UTC().Truncate(24*time.Hour)) {
+		t.Errorf("Last-Modified %q, want the start of today", last_modified)
+	}
+
+	// readers polling it cost nothing upstream
+	fetched := hits.Load()
+	tests := []struct {
+		name              string
+		if_modified_since string
+		status            int
+	}{
+		{"again", "", http.StatusOK},
+		{"not modified", last_modified, http.StatusNotModified},
+		{"later", time.Now().UTC().Add(time.Hour).Format(http.TimeFormat), http.StatusNotModified},
+		{"yesterday", time.Now().UTC().AddDate(0, 0, -1).Format(http.TimeFormat), http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/feed.xml", nil)
+			if test.if_modified_since != "" {
+				r.Header.Set("If-Modified-Since", test.if_modified_since)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != test.status {
+				t.Errorf("status %d, want %d", w.Code, test.status)
+			}
+			if test.status == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("304 with a body")
+			}
+		})
+	}
+	if n := hits.Load(); n != fetched {
+		t.Errorf("%d upstream requests for the cached feed", n-fetched)
+	}
+}
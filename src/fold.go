@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// strip_marks decomposes a character and drops its accents, so "ñ" becomes
+// "n" whether it was written as one character or as n and a combining tilde.
+var strip_marks = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// foldRune is one character of Fold. Combining marks fold to nothing.
+func foldRune(r rune) string {
+	if r < utf8.RuneSelf {
+		return string(unicode.ToLower(r))
+	}
+	stripped, _, err := transform.String(strip_marks, string(r))
+	if err != nil {
+		stripped = string(r)
+	}
+	return strings.ToLower(stripped)
+}
+
+// Fold makes text comparable ignoring case and accents, so a search for
+// "senor" finds "Señor".
+func Fold(text string) string {
+	folded, _ := foldOffsets(text)
+	return folded
+}
+
+// foldOffsets folds text a character at a time and also returns, for each
+// byte of the folded text, the offset in text of the character it came
+// from, plus one final entry for the end of text. That lets a match in the
+// folded text be mapped back to the original.
+func foldOffsets(text string) (string, []int) {
+	var b strings.Builder
+	offsets := make([]int, 0, len(text)+1)
+	for i, r := range text {
+		folded := foldRune(r)
+		b.WriteString(folded)
+		for range len(folded) {
+			offsets = append(offsets, i)
+		}
+	}
+	return b.String(), append(offsets, len(text))
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Señor", "senor"},
+		{"SEÑOR", "senor"},
+		{"Sen\u0303or", "senor"},
+		{"Jésus", "jesus"},
+		{"Je\u0301sus", "jesus"},
+		{"Éternel", "eternel"},
+		{"E\u0301ternel", "eternel"},
+		{"Noël", "noel"},
+		{"Dios", "dios"},
+		{"Yahweh’s law", "yahweh’s law"},
+		{"For God so loved", "for god so loved"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			if got := Fold(test.text); got != test.want {
+				t.Errorf("Fold(%q) = %q, want %q", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+// Every offset of foldOffsets points at the start of the character the
+// folded byte came from, so slicing text with them never splits one.
+func TestFoldOffsets(t *testing.T) {
+	tests := []struct {
+		text    string
+		folded  string
+		offsets []int
+	}{
+		{"Ab", "ab", []int{0, 1, 2}},
+		{"ñu", "nu", []int{0, 2, 3}},
+		{"n\u0303u", "nu", []int{0, 3, 4}},
+		{"é’", "e’", []int{0, 2, 2, 2, 5}},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			folded, offsets := foldOffsets(test.text)
+			if folded != test.folded {
+				t.Errorf("folded %q, want %q", folded, test.folded)
+			}
+			if len(offsets) != len(test.offsets) {
+				t.Fatalf("offsets %v, want %v", offsets, test.offsets)
+			}
+			for i := range offsets {
+				if offsets[i] != test.offsets[i] {
+					t.Errorf("offsets %v, want %v", offsets, test.offsets)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestFoldSearch(t *testing.T) {
+	tests := []struct {
+		query string
+		text  string
+		match bool
+	}{
+		{"senor", "Jehová es mi pastor; el Señor", true},
+		{"señor", "el SENOR es mi pastor", true},
+		{"senor", "el Sen\u0303or es mi pastor", true},
+		{"sen\u0303or", "el Señor es mi pastor", true},
+		{"jehova", "Jehová es mi pastor", true},
+		{"eternel", "L’Éternel est mon berger", true},
+		{"éternel", "L’Eternel est mon berger", true},
+		{`"l’eternel est"`, "L’Éternel  est mon berger", true},
+		{"pastora", "Jehová es mi pastor", false},
+	}
+	for _, test := range tests {
+		t.Run(test.query+" "+test.text, func(t *testing.T) {
+			expr, _, err := ParseSearch(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := expr.Match(searchText(test.text)); got != test.match {
+				t.Errorf("%q matches %q = %v, want %v", test.query, test.text, got, test.match)
+			}
+		})
+	}
+}
+
+func TestHighlightFolded(t *testing.T) {
+	tests := []struct {
+		text  string
+		query string
+		want  string
+	}{
+		{"el Señor es mi pastor", "senor", "el <mark>Señor</mark> es mi pastor"},
+		{"el SEÑOR es mi pastor", "señor", "el <mark>SEÑOR</mark> es mi pastor"},
+		{"el Sen\u0303or es", "senor", "el <mark>Sen\u0303or</mark> es"},
+		{"Jehová es mi pastor", "jehova", "<mark>Jehová</mark> es mi pastor"},
+		{"Jehová es", `"jehova es"`, "<mark>Jehová es</mark>"},
+		{"L’Éternel est mon berger", "eternel", "L’<mark>Éternel</mark> est mon berger"},
+		{"E\u0301ternel", "ete", "<mark>E\u0301te</mark>rnel"},
+		{"niño y niña", "nin", "<mark>niñ</mark>o y <mark>niñ</mark>a"},
+		{"a señal & b", `"senal &"`, "a <mark>señal &amp;</mark> b"},
+	}
+	for _, test := range tests {
+		t.Run(test.text+" "+test.query, func(t *testing.T) {
+			_, terms, err := ParseSearch(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := Highlight(test.text, terms); string(got) != test.want {
+				t.Errorf("Highlight(%q, %q) = %q, want %q", test.text, terms, got, test.want)
+			}
+		})
+	}
+}
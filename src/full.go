@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// full_book_workers caps how many chapters /{book}/full fetches at once.
+const full_book_workers = 4
+
+// loadFullBook fetches every chapter concurrently and returns one channel
+// per chapter, so the caller can wait on them in order while later chapters
+// are still loading.
+func (s *Server) loadFullBook(ctx context.Context, translation string, slug string, chapters []Chapter) []chan FullBookChapter {
+	results := make([]chan FullBookChapter, len(chapters))
+	for i := range results {
+		results[i] = make(chan FullBookChapter, 1)
+	}
+
+	go func() {
+		workers := make(chan struct{}, full_book_workers)
+		for i, chapter := range chapters {
+			workers <- struct{}{}
+			go func() {
+				defer func() { <-workers }()
+				section := FullBookChapter{Anchor: fmt.Sprintf("chapter-%d", chapter.Chapter), Number: chapter.Chapter}
+				var book Book
+				var verse_info VerseInfo
+				err := s.LoadVerses(ctx, translation, slug, strconv.Itoa(chapter.Chapter), &book, &verse_info)
+				if err != nil {
+					if !errors.Is(err, context.Canceled) {
+						Logger(ctx).Error("chapter failed", "chapter", chapter.Chapter, "err", err)
+					}
+					_, section.Error = ErrorStatus(err)
+				} else {
+					section.Verses = verse_info.Verses
+				}
+				results[i] <- section
+			}()
+		}
+	}()
+	return results
+}
+
+// getFullBook serves /{book}/full, streaming each chapter to the client as
+// soon as it and every chapter before it have loaded. A chapter that fails
+// gets an error notice in its place instead of failing the page.
+func (s *Server) getFullBook(w http.ResponseWriter, r *http.Request) {
+	slug := mux.Vars(r)["book"]
+	translation := RequestTranslation(r)
+
+	var book Book
+	var chapter_info ChapterInfo
+	err := s.LoadChapters(r.Context(), translation, slug, &book, &chapter_info)
+	if err != nil {
+		s.fetchError(w, r, translation, slug, err)
+		return
+	}
+
+	page := FullBookPage{Breadcrumbs: s.Breadcrumbs(translation, &book, 0), Title: book.Name}
+	for _, chapter := range chapter_info.Chapters {
+		page.Contents = append(page.Contents, Link{Text: fmt.Sprintf("Chapter %d", chapter.Chapter), URL: fmt.Sprintf("#chapter-%d", chapter.Chapter)})
+	}
+
+	// the head is rendered up front so a template error can still become
+	// an error page
+	tmpl := s.templates["full.html"]
+	var buf bytes.Buffer
+	err = tmpl.ExecuteTemplate(&buf, "layout_head", s.NewPage(w, r, book.Name, nil))
+	if err == nil {
+		err = tmpl.ExecuteTemplate(&buf, "content", page)
+	}
+	if err != nil {
+		Logger(r.Context()).Error("rendering page", "err", err)
+		s.renderError(w, r, http.StatusInternalServerError, "Something went wrong while building this page.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(text_max_age.Seconds())))
+	w.WriteHeader(http.StatusOK)
+	buf.WriteTo(w)
+	flusher, _ := w.(http.Flusher)
+
+	for _, result := range s.loadFullBook(r.Context(), translation, slug, chapter_info.Chapters) {
+		if flusher != nil {
+			flusher.Flush()
+		}
+		var section FullBookChapter
+		select {
+		case section = <-result:
+		case <-r.Context().Done():
+			return
+		}
+		err = tmpl.ExecuteTemplate(w, "chapter", section)
+		if err != nil {
+			Logger(r.Context()).Error("rendering page", "err", err)
+			return
+		}
+	}
+	tmpl.ExecuteTemplate(w, "layout_foot", nil)
+}
@@ -0,0 +1,70 @@
+package main
+
+import "sort"
+
+// EditDistance is the optimal string alignment distance between a and b:
+// insertions, deletions, substitutions and swaps of two neighbouring letters
+// each cost one, so "pslams" is a single edit from "psalms".
+func EditDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+// suggestionThreshold is how many edits a slug may be from a book name and
+// still be suggested. Short slugs get less slack so "job" doesn't suggest
+// half the Bible.
+func suggestionThreshold(slug string) int {
+	switch n := len([]rune(slug)); {
+	case n <= 4:
+		return 1
+	case n <= 8:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// SuggestBooks returns the books whose slug is close to slug, closest first.
+func SuggestBooks(slug string, books []Book) []Book {
+	type match struct {
+		book     Book
+		distance int
+	}
+	threshold := suggestionThreshold(slug)
+	var matches []match
+	for _, book := range books {
+		d := EditDistance(NormalizeSlug(slug), NormalizeSlug(book.Name))
+		if d <= threshold {
+			matches = append(matches, match{book, d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].distance < matches[j].distance
+	})
+
+	suggestions := make([]Book, len(matches))
+	for i, m := range matches {
+		suggestions[i] = m.book
+	}
+	return suggestions
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{"psalms", "psalms", 0},
+		{"pslams", "psalms", 1},
+		{"jhon", "john", 1},
+		{"genisis", "genesis", 1},
+		{"psams", "psalms", 1},
+		{"psalmss", "psalms", 1},
+		{"2kngs", "2kings", 1},
+		{"2kings", "1kings", 1},
+		{"", "john", 4},
+		{"john", "", 4},
+		{"ab", "ba", 1},
+		{"abc", "ca", 3},
+		{"ésaïe", "esaie", 2},
+	}
+	for _, test := range tests {
+		t.Run(test.a+"/"+test.b, func(t *testing.T) {
+			if got := EditDistance(test.a, test.b); got != test.want {
+				t.Errorf("EditDistance(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSuggestBooks(t *testing.T) {
+	tests := []struct {
+		slug string
+		want []string
+	}{
+		{"pslams", []string{"PSA"}},
+		{"psams", []string{"PSA"}},
+		{"genisis", []string{"GEN"}},
+		{"jhon", []string{"JHN"}},
+		{"revelations", []string{"REV"}},
+		{"2kings", []string{"2KI", "1KI"}},
+		{"2-kngs", []string{"2KI", "1KI"}},
+		{"1corinthains", []string{"1CO", "2CO"}},
+		{"song-of-salomon", []string{"SNG"}},
+		{"xyz", nil},
+		{"exodus", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.slug, func(t *testing.T) {
+			var ids []string
+			for _, book := range SuggestBooks(test.slug, testBooks) {
+				ids = append(ids, book.ID)
+			}
+			if !slices.Equal(ids, test.want) {
+				t.Errorf("SuggestBooks(%q) = %v, want %v", test.slug, ids, test.want)
+			}
+		})
+	}
+}
+
+func TestSuggestionPage(t *testing.T) {
+	handler := newTestServer(t)
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/pslams/23", `href="/psalms"`},
+		{"/jhon/3", `href="/john"`},
+		{"/song-of-salomon", `href="/song-of-solomon"`},
+	}
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			w := get(t, handler, test.target)
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("GET %s: status %d, want %d", test.target, w.Code, http.StatusNotFound)
+			}
+			body := w.Body.String()
+			if !strings.Contains(body, "Did you mean") || !strings.Contains(body, test.want) {
+				t.Errorf("GET %s: no suggestion linking to %s", test.target, test.want)
+			}
+		})
+	}
+}
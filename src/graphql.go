@@ -0,0 +1,945 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// This is the part of GraphQL /graphql needs: queries with fields, aliases,
+// arguments and variables. Fragments, directives, mutations and
+// introspection aren't supported; the playground shows the schema as SDL
+// instead.
+
+// GraphQLLocation is where in a query an error is, counting from 1.
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// GraphQLError is an error in the shape GraphQL responses list them.
+type GraphQLError struct {
+	Message   string            `json:"message"`
+	Locations []GraphQLLocation `json:"locations,omitempty"`
+	Path      []any             `json:"path,omitempty"`
+}
+
+func (e *GraphQLError) Error() string {
+	return e.Message
+}
+
+// graphQLErrorAt builds an error pointing at byte position of query.
+func graphQLErrorAt(query string, position int, format string, args ...any) *GraphQLError {
+	line, column := 1, 1
+	for _, c := range query[:min(position, len(query))] {
+		if c == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return &GraphQLError{Message: fmt.Sprintf(format, args...), Locations: []GraphQLLocation{{Line: line, Column: column}}}
+}
+
+type graphQLToken struct {
+	kind     rune // 'n' for a name, 'i' an int, 'f' a float, 's' a string, 0 the end, or the punctuator itself
+	text     string
+	position int
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// lexGraphQL splits a query into tokens, dropping whitespace, commas and
+// comments, which GraphQL ignores.
+func lexGraphQL(query string) ([]graphQLToken, error) {
+	var tokens []graphQLToken
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(query[i:], "\ufeff"):
+			i += len("\ufeff")
+		case strings.HasPrefix(query[i:], "..."):
+			return nil, graphQLErrorAt(query, i, "fragments aren't supported")
+		case strings.ContainsRune("!$():=@[]{}|", rune(c)):
+			tokens = append(tokens, graphQLToken{kind: rune(c), text: string(c), position: i})
+			i++
+		case isNameStart(c):
+			start := i
+			for i < len(query) && (isNameStart(query[i]) || isDigit(query[i])) {
+				i++
+			}
+			tokens = append(tokens, graphQLToken{kind: 'n', text: query[start:i], position: start})
+		case c == '-' || isDigit(c):
+			start := i
+			kind := 'i'
+			i++
+			for i < len(query) && isDigit(query[i]) {
+				i++
+			}
+			if i < len(query) && query[i] == '.' {
+				kind = 'f'
+				i++
+				for i < len(query) && isDigit(query[i]) {
+					i++
+				}
+			}
+			if i < len(query) && (query[i] == 'e' || query[i] == 'E') {
+				kind = 'f'
+				i++
+				if i < len(query) && (query[i] == '+' || query[i] == '-') {
+					i++
+				}
+				for i < len(query) && isDigit(query[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, graphQLToken{kind: kind, text: query[start:i], position: start})
+		case strings.HasPrefix(query[i:], `"""`):
+			end := strings.Index(query[i+3:], `"""`)
+			if end < 0 {
+				return nil, graphQLErrorAt(query, i, "unterminated string")
+			}
+			text := strings.ReplaceAll(query[i+3:i+3+end], `\"""`, `"""`)
+			tokens = append(tokens, graphQLToken{kind: 's', text: strings.TrimSpace(text), position: i})
+			i += end + 6
+		case c == '"':
+			text, length, err := lexGraphQLString(query[i:])
+			if err != "" {
+				return nil, graphQLErrorAt(query, i, "%s", err)
+			}
+			tokens = append(tokens, graphQLToken{kind: 's', text: text, position: i})
+			i += length
+		default:
+			r, _ := utf8.DecodeRuneInString(query[i:])
+			return nil, graphQLErrorAt(query, i, "unexpected character %q", r)
+		}
+	}
+	return append(tokens, graphQLToken{position: len(query)}), nil
+}
+
+// lexGraphQLString reads the quoted string s starts with, returning it
+// unescaped and how many bytes it took up.
+func lexGraphQLString(s string) (string, int, string) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), i + 1, ""
+		case '\n':
+			return "", 0, "unterminated string"
+		case '\\':
+			i++
+			if i >= len(s) {
+				return "", 0, "unterminated string"
+			}
+			switch s[i] {
+			case '"', '\\', '/':
+				b.WriteByte(s[i])
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if i+5 > len(s) {
+					return "", 0, "bad \\u escape"
+				}
+				code, err := strconv.ParseUint(s[i+1:i+5], 16, 32)
+				if err != nil {
+					return "", 0, "bad \\u escape"
+				}
+				b.WriteRune(rune(code))
+				i += 4
+			default:
+				return "", 0, fmt.Sprintf("bad escape \\%c", s[i])
+			}
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, "unterminated string"
+}
+
+// graphQLVariable is a $name in a query, replaced by its value before the
+// query runs.
+type graphQLVariable string
+
+// GraphQLSelection is a field asked for, with the fields asked for on what
+// it returns. Args holds the arguments once variables are filled in.
+type GraphQLSelection struct {
+	Alias      string
+	Name       string
+	RawArgs    map[string]any
+	Args       map[string]any
+	Selections []*GraphQLSelection
+	position   int
+}
+
+// Key is the name the field's value goes under in the response.
+func (s *GraphQLSelection) Key() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+	return s.Name
+}
+
+type graphQLVariableDefinition struct {
+	Name       string
+	Type       string
+	Default    any
+	HasDefault bool
+	position   int
+}
+
+type graphQLOperation struct {
+	Name       string
+	Variables  []graphQLVariableDefinition
+	Selections []*GraphQLSelection
+	position   int
+}
+
+type graphQLParser struct {
+	query  string
+	tokens []graphQLToken
+	i      int
+}
+
+func (p *graphQLParser) peek() graphQLToken {
+	return p.tokens[p.i]
+}
+
+func (p *graphQLParser) next() graphQLToken {
+	token := p.tokens[p.i]
+	if token.kind != 0 {
+		p.i++
+	}
+	return token
+}
+
+func (p *graphQLParser) errorf(token graphQLToken, format string, args ...any) *GraphQLError {
+	return graphQLErrorAt(p.query, token.position, format, args...)
+}
+
+func (p *graphQLParser) expect(kind rune) (graphQLToken, error) {
+	token := p.next()
+	if token.kind == kind {
+		return token, nil
+	}
+	want := string(kind)
+	if kind == 'n' {
+		want = "a name"
+	}
+	if token.kind == 0 {
+		return token, p.errorf(token, "expected %s, found the end of the query", want)
+	}
+	return token, p.errorf(token, "expected %s, found %q", want, token.text)
+}
+
+// ParseGraphQL parses a query document into its operations.
+func ParseGraphQL(query string) ([]graphQLOperation, error) {
+	tokens, err := lexGraphQL(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &graphQLParser{query: query, tokens: tokens}
+	var operations []graphQLOperation
+	for p.peek().kind != 0 {
+		operation, err := p.operation()
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, operation)
+	}
+	if len(operations) == 0 {
+		return nil, &GraphQLError{Message: "the query is empty"}
+	}
+	return operations, nil
+}
+
+func (p *graphQLParser) operation() (graphQLOperation, error) {
+	start := p.peek()
+	operation := graphQLOperation{position: start.position}
+	if start.kind == 'n' {
+		if start.text != "query" {
+			return operation, p.errorf(start, "only queries are supported, not %q", start.text)
+		}
+		p.next()
+		if p.peek().kind == 'n' {
+			operation.Name = p.next().text
+		}
+		if p.peek().kind == '(' {
+			p.next()
+			for p.peek().kind != ')' {
+				definition, err := p.variableDefinition()
+				if err != nil {
+					return operation, err
+				}
+				operation.Variables = append(operation.Variables, definition)
+			}
+			p.next()
+		}
+	}
+	if p.peek().kind == '@' {
+		return operation, p.errorf(p.peek(), "directives aren't supported")
+	}
+	var err error
+	operation.Selections, err = p.selectionSet()
+	return operation, err
+}
+
+func (p *graphQLParser) variableDefinition() (graphQLVariableDefinition, error) {
+	start, err := p.expect('$')
+	if err != nil {
+		return graphQLVariableDefinition{}, err
+	}
+	name, err := p.expect('n')
+	if err != nil {
+		return graphQLVariableDefinition{}, err
+	}
+	definition := graphQLVariableDefinition{Name: name.text, position: start.position}
+	_, err = p.expect(':')
+	if err != nil {
+		return definition, err
+	}
+	definition.Type, err = p.typeReference()
+	if err != nil {
+		return definition, err
+	}
+	if p.peek().kind == '=' {
+		p.next()
+		definition.Default, err = p.value(true)
+		definition.HasDefault = true
+	}
+	return definition, err
+}
+
+// typeReference reads a type like "String!" or "[Int]".
+func (p *graphQLParser) typeReference() (string, error) {
+	var t string
+	if p.peek().kind == '[' {
+		p.next()
+		inner, err := p.typeReference()
+		if err != nil {
+			return "", err
+		}
+		_, err = p.expect(']')
+		if err != nil {
+			return "", err
+		}
+		t = "[" + inner + "]"
+	} else {
+		name, err := p.expect('n')
+		if err != nil {
+			return "", err
+		}
+		t = name.text
+	}
+	if p.peek().kind == '!' {
+		p.next()
+		t += "!"
+	}
+	return t, nil
+}
+
+func (p *graphQLParser) selectionSet() ([]*GraphQLSelection, error) {
+	_, err := p.expect('{')
+	if err != nil {
+		return nil, err
+	}
+	var selections []*GraphQLSelection
+	for p.peek().kind != '}' {
+		selection, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+	p.next()
+	if len(selections) == 0 {
+		return nil, p.errorf(p.tokens[p.i-1], "a selection needs at least one field")
+	}
+	return selections, nil
+}
+
+func (p *graphQLParser) field() (*GraphQLSelection, error) {
+	name, err := p.expect('n')
+	if err != nil {
+		return nil, err
+	}
+	selection := &GraphQLSelection{Name: name.text, position: name.position}
+	if p.peek().kind == ':' {
+		p.next()
+		name, err = p.expect('n')
+		if err != nil {
+			return nil, err
+		}
+		selection.Alias, selection.Name = selection.Name, name.text
+	}
+	if p.peek().kind == '(' {
+		p.next()
+		selection.RawArgs = map[string]any{}
+		for p.peek().kind != ')' {
+			arg, err := p.expect('n')
+			if err != nil {
+				return nil, err
+			}
+			_, err = p.expect(':')
+			if err != nil {
+				return nil, err
+			}
+			selection.RawArgs[arg.text], err = p.value(false)
+			if err != nil {
+				return nil, err
+			}
+		}
+		p.next()
+	}
+	if p.peek().kind == '@' {
+		return nil, p.errorf(p.peek(), "directives aren't supported")
+	}
+	if p.peek().kind == '{' {
+		selection.Selections, err = p.selectionSet()
+	}
+	return selection, err
+}
+
+// value reads an argument or default value. Defaults can't refer to
+// variables.
+func (p *graphQLParser) value(constant bool) (any, error) {
+	token := p.next()
+	switch token.kind {
+	case '$':
+		if constant {
+			return nil, p.errorf(token, "a default value can't be a variable")
+		}
+		name, err := p.expect('n')
+		return graphQLVariable(name.text), err
+	case 'i':
+		n, err := strconv.Atoi(token.text)
+		if err != nil {
+			return nil, p.errorf(token, "%s isn't a number", token.text)
+		}
+		if n > math.MaxInt32 || n < math.MinInt32 {
+			return nil, p.errorf(token, "%s is too big for an Int", token.text)
+		}
+		return n, nil
+	case 'f':
+		f, err := strconv.ParseFloat(token.text, 64)
+		if err != nil {
+			return nil, p.errorf(token, "%s isn't a number", token.text)
+		}
+		return f, nil
+	case 's':
+		return token.text, nil
+	case 'n':
+		switch token.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		// an enum value, which arguments read as a string
+		return token.text, nil
+	case '[':
+		list := []any{}
+		for p.peek().kind != ']' {
+			item, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		p.next()
+		return list, nil
+	case '{':
+		object := map[string]any{}
+		for p.peek().kind != '}' {
+			name, err := p.expect('n')
+			if err != nil {
+				return nil, err
+			}
+			_, err = p.expect(':')
+			if err != nil {
+				return nil, err
+			}
+			object[name.text], err = p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+		}
+		p.next()
+		return object, nil
+	case 0:
+		return nil, p.errorf(token, "expected a value, found the end of the query")
+	}
+	return nil, p.errorf(token, "expected a value, found %q", token.text)
+}
+
+// GraphQLArg is an argument a field takes.
+type GraphQLArg struct {
+	Name string
+	Type string
+}
+
+// GraphQLParams is what a resolver gets: the object the field is on, its
+// arguments, and the fields asked for on its result.
+type GraphQLParams struct {
+	Context    context.Context
+	Source     any
+	Args       map[string]any
+	Selections []*GraphQLSelection
+}
+
+// Selects reports whether any of the fields are asked for on the result,
+// so a resolver can load what they need up front.
+func (p GraphQLParams) Selects(names ...string) bool {
+	for _, selection := range p.Selections {
+		for _, name := range names {
+			if selection.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GraphQLField is a field of an object type. Cost is what resolving it
+// counts against graphql_max_complexity, and Size how many items a list
+// of objects is counted as, each costing what is asked for on it.
+type GraphQLField struct {
+	Name        string
+	Type        string
+	Description string
+	Args        []GraphQLArg
+	Cost        int
+	Size        func(args map[string]any) int
+	Resolve     func(p GraphQLParams) (any, error)
+}
+
+// GraphQLObject is an object type with its fields in the order the SDL
+// lists them.
+type GraphQLObject struct {
+	Name   string
+	Fields []*GraphQLField
+}
+
+func (o *GraphQLObject) Field(name string) *GraphQLField {
+	for _, field := range o.Fields {
+		if field.Name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// GraphQLSchema is the object types, starting from Query.
+type GraphQLSchema struct {
+	Query    *GraphQLObject
+	Types    map[string]*GraphQLObject
+	MaxDepth int
+	MaxCost  int
+	// ErrorText is the message a response gives for an error from a
+	// resolver.
+	ErrorText func(ctx context.Context, err error) string
+}
+
+// namedType strips the list and non-null markers from a type, leaving
+// "Book" for "[Book!]!".
+func namedType(t string) string {
+	return strings.Trim(t, "[]!")
+}
+
+// SDL is the schema in GraphQL's schema definition language.
+func (s *GraphQLSchema) SDL() string {
+	var b strings.Builder
+	objects := []*GraphQLObject{s.Query}
+	for _, field := range s.Query.Fields {
+		objects = s.collect(objects, field)
+	}
+	for i, object := range objects {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "type %s {\n", object.Name)
+		for _, field := range object.Fields {
+			if field.Description != "" {
+				fmt.Fprintf(&b, "  %q\n", field.Description)
+			}
+			b.WriteString("  " + field.Name)
+			if len(field.Args) > 0 {
+				var args []string
+				for _, arg := range field.Args {
+					args = append(args, arg.Name+": "+arg.Type)
+				}
+				b.WriteString("(" + strings.Join(args, ", ") + ")")
+			}
+			b.WriteString(": " + field.Type + "\n")
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+// collect lists the object types reachable from field, once each, in the
+// order they are found.
+func (s *GraphQLSchema) collect(objects []*GraphQLObject, field *GraphQLField) []*GraphQLObject {
+	object, ok := s.Types[namedType(field.Type)]
+	if !ok {
+		return objects
+	}
+	if slices.Contains(objects, object) {
+		return objects
+	}
+	objects = append(objects, object)
+	for _, field := range object.Fields {
+		objects = s.collect(objects, field)
+	}
+	return objects
+}
+
+// GraphQLRequest is a query as sent to /graphql.
+type GraphQLRequest struct {
+	Query         string         `json:"query"`
+	Variables     map[string]any `json:"variables"`
+	OperationName string         `json:"operationName"`
+}
+
+// GraphQLResponse is the result of a query. Data is missing when the query
+// couldn't be run at all.
+type GraphQLResponse struct {
+	Data   *graphQLObject  `json:"data,omitempty"`
+	Errors []*GraphQLError `json:"errors,omitempty"`
+}
+
+// graphQLObject keeps the fields of a result in the order they were asked
+// for, which a map wouldn't.
+type graphQLObject struct {
+	keys   []string
+	values []any
+}
+
+func (o *graphQLObject) set(key string, value any) {
+	for i, existing := range o.keys {
+		if existing == key {
+			o.values[i] = value
+			return
+		}
+	}
+	o.keys = append(o.keys, key)
+	o.values = append(o.values, value)
+}
+
+func (o *graphQLObject) MarshalJSON() ([]byte, error) {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		value, err := json.Marshal(o.values[i])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return []byte(b.String()), nil
+}
+
+// Prepare parses request, picks the operation to run, fills in its
+// variables and checks it against the schema and its limits, before any
+// resolver runs.
+func (s *GraphQLSchema) Prepare(request GraphQLRequest) ([]*GraphQLSelection, error) {
+	operations, err := ParseGraphQL(request.Query)
+	if err != nil {
+		return nil, err
+	}
+	var operation *graphQLOperation
+	for i := range operations {
+		if request.OperationName == "" && len(operations) > 1 {
+			return nil, &GraphQLError{Message: "operationName is needed to pick one of several operations"}
+		}
+		if request.OperationName == "" || operations[i].Name == request.OperationName {
+			operation = &operations[i]
+			break
+		}
+	}
+	if operation == nil {
+		return nil, &GraphQLError{Message: fmt.Sprintf("there's no operation named %q", request.OperationName)}
+	}
+
+	variables := map[string]any{}
+	for _, definition := range operation.Variables {
+		value, given := request.Variables[definition.Name]
+		if !given && definition.HasDefault {
+			value, given = definition.Default, true
+		}
+		if !given && !strings.HasSuffix(definition.Type, "!") {
+			variables[definition.Name] = nil
+			continue
+		}
+		value, err := coerceGraphQL(definition.Type, value)
+		if err != nil {
+			return nil, graphQLErrorAt(request.Query, definition.position, "variable $%s: %s", definition.Name, err)
+		}
+		variables[definition.Name] = value
+	}
+	cost, err := s.check(request.Query, s.Query, operation.Selections, variables, 1)
+	if err != nil {
+		return nil, err
+	}
+	if cost > s.MaxCost {
+		return nil, graphQLErrorAt(request.Query, operation.position, "this query would cost %d, more than the limit of %d; ask for fewer lists of objects", cost, s.MaxCost)
+	}
+	return operation.Selections, nil
+}
+
+// check fills in the arguments of selections on object, reporting unknown
+// fields, bad arguments and queries nested too deep, and returns what the
+// selections cost.
+func (s *GraphQLSchema) check(query string, object *GraphQLObject, selections []*GraphQLSelection, variables map[string]any, depth int) (int, error) {
+	if depth > s.MaxDepth {
+		return 0, graphQLErrorAt(query, selections[0].position, "the query nests deeper than %d levels", s.MaxDepth)
+	}
+	total := 0
+	for _, selection := range selections {
+		if selection.Name == "__typename" {
+			if selection.Selections != nil {
+				return 0, graphQLErrorAt(query, selection.position, "__typename is a String, it has no fields")
+			}
+			continue
+		}
+		field := object.Field(selection.Name)
+		if field == nil {
+			return 0, graphQLErrorAt(query, selection.position, "%s has no field %q", object.Name, selection.Name)
+		}
+		selection.Args = map[string]any{}
+		for name := range selection.RawArgs {
+			if !slices.ContainsFunc(field.Args, func(arg GraphQLArg) bool { return arg.Name == name }) {
+				return 0, graphQLErrorAt(query, selection.position, "%s.%s has no argument %q", object.Name, field.Name, name)
+			}
+		}
+		for _, arg := range field.Args {
+			raw, given := selection.RawArgs[arg.Name]
+			value, err := substituteGraphQL(raw, variables)
+			if err != nil {
+				return 0, graphQLErrorAt(query, selection.position, "%s", err)
+			}
+			if variable, ok := raw.(graphQLVariable); ok {
+				_, given = variables[string(variable)]
+			}
+			if !given && !strings.HasSuffix(arg.Type, "!") {
+				continue
+			}
+			value, err = coerceGraphQL(arg.Type, value)
+			if err != nil {
+				return 0, graphQLErrorAt(query, selection.position, "argument %s of %s: %s", arg.Name, field.Name, err)
+			}
+			selection.Args[arg.Name] = value
+		}
+
+		cost := field.Cost
+		child, is_object := s.Types[namedType(field.Type)]
+		switch {
+		case is_object && selection.Selections == nil:
+			return 0, graphQLErrorAt(query, selection.position, "%s is a %s, so it needs fields asked for", field.Name, child.Name)
+		case !is_object && selection.Selections != nil:
+			return 0, graphQLErrorAt(query, selection.position, "%s is a %s, it has no fields", field.Name, field.Type)
+		case is_object:
+			child_cost, err := s.check(query, child, selection.Selections, variables, depth+1)
+			if err != nil {
+				return 0, err
+			}
+			size := 1
+			if field.Size != nil {
+				size = field.Size(selection.Args)
+			}
+			cost += size * child_cost
+		}
+		total += cost
+	}
+	return total, nil
+}
+
+// substituteGraphQL replaces the variables in an argument's value.
+func substituteGraphQL(value any, variables map[string]any) (any, error) {
+	switch value := value.(type) {
+	case graphQLVariable:
+		variable, ok := variables[string(value)]
+		if !ok {
+			return nil, fmt.Errorf("$%s isn't declared by the query", value)
+		}
+		return variable, nil
+	case []any:
+		list := make([]any, len(value))
+		for i, item := range value {
+			var err error
+			list[i], err = substituteGraphQL(item, variables)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case map[string]any:
+		object := map[string]any{}
+		for name, item := range value {
+			var err error
+			object[name], err = substituteGraphQL(item, variables)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return object, nil
+	}
+	return value, nil
+}
+
+// coerceGraphQL checks value against a scalar type like "Int!" or
+// "[String]", turning JSON numbers from variables into ints.
+func coerceGraphQL(t string, value any) (any, error) {
+	if value == nil {
+		if strings.HasSuffix(t, "!") {
+			return nil, fmt.Errorf("a %s is required", t)
+		}
+		return nil, nil
+	}
+	t = strings.TrimSuffix(t, "!")
+	if strings.HasPrefix(t, "[") {
+		inner := t[1 : len(t)-1]
+		items, ok := value.([]any)
+		if !ok {
+			// a single value stands for a list of one
+			items = []any{value}
+		}
+		list := make([]any, len(items))
+		for i, item := range items {
+			var err error
+			list[i], err = coerceGraphQL(inner, item)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+	switch t {
+	case "String", "ID":
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case "Int":
+		switch n := value.(type) {
+		case int:
+			return n, nil
+		case float64:
+			if n == math.Trunc(n) && n <= math.MaxInt32 && n >= math.MinInt32 {
+				return int(n), nil
+			}
+		}
+	case "Float":
+		switch n := value.(type) {
+		case int:
+			return float64(n), nil
+		case float64:
+			return n, nil
+		}
+	case "Boolean":
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	default:
+		return nil, fmt.Errorf("%s isn't an input type", t)
+	}
+	return nil, fmt.Errorf("%v isn't a %s", value, t)
+}
+
+// Execute runs prepared selections from Query. A resolver that fails
+// leaves null where its value would be and adds an error with the path to
+// it, without failing the rest.
+func (s *GraphQLSchema) Execute(ctx context.Context, selections []*GraphQLSelection) GraphQLResponse {
+	e := graphQLExecution{schema: s, ctx: ctx}
+	data := e.object(s.Query, nil, selections, nil)
+	return GraphQLResponse{Data: data, Errors: e.errors}
+}
+
+type graphQLExecution struct {
+	schema *GraphQLSchema
+	ctx    context.Context
+	errors []*GraphQLError
+}
+
+func (e *graphQLExecution) object(object *GraphQLObject, source any, selections []*GraphQLSelection, path []any) *graphQLObject {
+	result := &graphQLObject{}
+	for _, selection := range selections {
+		if selection.Name == "__typename" {
+			result.set(selection.Key(), object.Name)
+			continue
+		}
+		field := object.Field(selection.Name)
+		field_path := append(append([]any{}, path...), selection.Key())
+		value, err := field.Resolve(GraphQLParams{Context: e.ctx, Source: source, Args: selection.Args, Selections: selection.Selections})
+		if err != nil {
+			e.errors = append(e.errors, &GraphQLError{Message: e.schema.ErrorText(e.ctx, err), Path: field_path})
+			result.set(selection.Key(), nil)
+			continue
+		}
+		result.set(selection.Key(), e.complete(field.Type, value, selection, field_path))
+	}
+	return result
+}
+
+// complete turns a resolved value into its JSON form: lists item by item
+// and objects by resolving the fields asked for on them.
+func (e *graphQLExecution) complete(t string, value any, selection *GraphQLSelection, path []any) any {
+	t = strings.TrimSuffix(t, "!")
+	if value == nil {
+		return nil
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		return nil
+	}
+	if strings.HasPrefix(t, "[") {
+		if v.Kind() != reflect.Slice {
+			return nil
+		}
+		list := make([]any, v.Len())
+		for i := range list {
+			list[i] = e.complete(t[1:len(t)-1], v.Index(i).Interface(), selection, append(append([]any{}, path...), i))
+		}
+		return list
+	}
+	if object, ok := e.schema.Types[t]; ok {
+		return e.object(object, value, selection.Selections, path)
+	}
+	return value
+}
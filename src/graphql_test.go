@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseGraphQL(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		// err is the message, empty if the query parses, and line and column
+		// where it points
+		err          string
+		line, column int
+	}{
+		{"shorthand", `{ books { name } }`, "", 0, 0},
+		{"named with variables", "query Verse($ref: String!, $t: String = \"kjv\") {\n  verse(ref: $ref, translation: $t) { text }\n}", "", 0, 0},
+		{"aliases and comments", "# the first chapter\n{ first: chapter(book: \"john\", number: 1) { number } }", "", 0, 0},
+		{"values", `{ f(a: -1, b: 1.5e3, c: "é\n", d: [1 2], e: {x: true}, f: null, g: ENUM, h: """ block """) { x } }`, "", 0, 0},
+		{"empty", "  # nothing\n", "the query is empty", 0, 0},
+		{"mutation", `mutation { x }`, `only queries are supported, not "mutation"`, 1, 1},
+		{"fragment", "{\n  books { ...BookFields }\n}", "fragments aren't supported", 2, 11},
+		{"directive", `{ books @include(if: true) { name } }`, "directives aren't supported", 1, 9},
+		{"unclosed", "{ books { name }", "expected a name, found the end of the query", 1, 17},
+		{"no fields", `{ books { } }`, "a selection needs at least one field", 1, 11},
+		{"unexpected character", "{\n  books { name% }\n}", `unexpected character '%'`, 2, 15},
+		{"unterminated string", "{ verse(ref: \"John 3:16\n) { text } }", "unterminated string", 1, 14},
+		{"bad escape", `{ verse(ref: "\q") { text } }`, `bad escape \q`, 1, 14},
+		{"bad unicode escape", `{ verse(ref: "\u12") { text } }`, `bad \u escape`, 1, 14},
+		{"too big", `{ search(q: "love", limit: 3000000000) { text } }`, "3000000000 is too big for an Int", 1, 28},
+		{"variable as default", `query ($a: Int = $b) { x }`, "a default value can't be a variable", 1, 18},
+		{"missing value", `{ verse(ref: ) { text } }`, `expected a value, found ")"`, 1, 14},
+		{"missing colon", `{ verse(ref "John 3:16") { text } }`, `expected :, found "John 3:16"`, 1, 13},
+		{"unicode before the error", "{ verse(ref: \"Ésaïe 1:1\") { text ) }", `expected a name, found ")"`, 1, 34},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseGraphQL(test.query)
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("ParseGraphQL: %v", err)
+				}
+				return
+			}
+			graphql_err, ok := err.(*GraphQLError)
+			if !ok {
+				t.Fatalf("ParseGraphQL = %v, want %q", err, test.err)
+			}
+			if graphql_err.Message != test.err {
+				t.Errorf("error %q, want %q", graphql_err.Message, test.err)
+			}
+			if test.line == 0 {
+				if len(graphql_err.Locations) != 0 {
+					t.Errorf("locations %v, want none", graphql_err.Locations)
+				}
+				return
+			}
+			want := GraphQLLocation{Line: test.line, Column: test.column}
+			if len(graphql_err.Locations) != 1 || graphql_err.Locations[0] != want {
+				t.Errorf("locations %v, want %v", graphql_err.Locations, want)
+			}
+		})
+	}
+}
+
+func TestParseGraphQLSelections(t *testing.T) {
+	operations, err := ParseGraphQL(`query A { one: verse(ref: "John 3:16") { text } } query B { books(translation: $t) { name id } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(operations) != 2 || operations[0].Name != "A" || operations[1].Name != "B" {
+		t.Fatalf("operations %+v", operations)
+	}
+	verse := operations[0].Selections[0]
+	if verse.Name != "verse" || verse.Key() != "one" || verse.RawArgs["ref"] != "John 3:16" {
+		t.Errorf("verse %+v", verse)
+	}
+	books := operations[1].Selections[0]
+	if books.RawArgs["translation"] != graphQLVariable("t") || len(books.Selections) != 2 || books.Selections[1].Name != "id" {
+		t.Errorf("books %+v", books)
+	}
+}
+
+func TestGraphQLPrepare(t *testing.T) {
+	schema := NewServer(NewBibleClient(fakeUpstream(t).URL), nil).graphql
+	tests := []struct {
+		name      string
+		request   GraphQLRequest
+		err       string
+		line, col int
+	}{
+		{"books", GraphQLRequest{Query: `{ books { name chapterCount } }`}, "", 0, 0},
+		{"one chapter's verses", GraphQLRequest{Query: `{ chapter(book: "john", number: 3) { verses { number text } } }`}, "", 0, 0},
+		{"variables", GraphQLRequest{Query: `query ($ref: String!) { verse(ref: $ref) { text } }`, Variables: map[string]any{"ref": "John 3:16"}}, "", 0, 0},
+		{"default variable", GraphQLRequest{Query: `query ($n: Int = 3) { chapter(book: "john", number: $n) { number } }`}, "", 0, 0},
+		{"float that's an int", GraphQLRequest{Query: `query ($n: Int!) { chapter(book: "john", number: $n) { number } }`, Variables: map[string]any{"n": 3.0}}, "", 0, 0},
+		{"picked operation", GraphQLRequest{Query: `query A { books { name } } query B { books { id } }`, OperationName: "B"}, "", 0, 0},
+		{"six levels", GraphQLRequest{Query: `{ verse(ref: "John 3:16") { book { chapter(number: 1) { book { chapter(number: 1) { number } } } } } }`}, "", 0, 0},
+
+		{"seven levels", GraphQLRequest{Query: `{ verse(ref: "John 3:16") { book { chapter(number: 1) { book { chapter(number: 1) { book { name } } } } } } }`}, "the query nests deeper than 6 levels", 1, 92},
+		{"every book's verses", GraphQLRequest{Query: `{ books { chapter(number: 1) { verses { text } } } }`}, "this query would cost 2707, more than the limit of 1000; ask for fewer lists of objects", 1, 1},
+		{"aliased many times", GraphQLRequest{Query: "query Many {\n" + strings.Repeat(`  c: chapter(book: "john", number: 1) { verses { text } }`+"\n", 25) + "}"}, "this query would cost 1025, more than the limit of 1000; ask for fewer lists of objects", 1, 1},
+		{"big search", GraphQLRequest{Query: `{ search(q: "love", limit: 1000) { book { chapters } } }`}, "", 0, 0},
+		{"unknown field", GraphQLRequest{Query: `{ books { nam } }`}, `Book has no field "nam"`, 1, 11},
+		{"unknown argument", GraphQLRequest{Query: `{ book(slug: "john", lang: "en") { name } }`}, `Query.book has no argument "lang"`, 1, 3},
+		{"missing argument", GraphQLRequest{Query: `{ book { name } }`}, "argument slug of book: a String! is required", 1, 3},
+		{"wrong argument type", GraphQLRequest{Query: `{ chapter(book: "john", number: "three") { number } }`}, "argument number of chapter: three isn't a Int", 1, 3},
+		{"object without fields", GraphQLRequest{Query: `{ books }`}, "books is a Book, so it needs fields asked for", 1, 3},
+		{"fields of a scalar", GraphQLRequest{Query: `{ books { name { x } } }`}, "name is a String!, it has no fields", 1, 11},
+		{"fields of __typename", GraphQLRequest{Query: `{ __typename { x } }`}, "__typename is a String, it has no fields", 1, 3},
+		{"undeclared variable", GraphQLRequest{Query: `{ verse(ref: $ref) { text } }`}, "$ref isn't declared by the query", 1, 3},
+		{"missing variable", GraphQLRequest{Query: "query ($ref: String!) {\n  verse(ref: $ref) { text }\n}"}, "variable $ref: a String! is required", 1, 8},
+		{"wrong variable type", GraphQLRequest{Query: `query ($n: Int!) { chapter(book: "john", number: $n) { number } }`, Variables: map[string]any{"n": 3.5}}, "variable $n: 3.5 isn't a Int", 1, 8},
+		{"several operations", GraphQLRequest{Query: `query A { books { name } } query B { books { id } }`}, "operationName is needed to pick one of several operations", 0, 0},
+		{"no such operation", GraphQLRequest{Query: `query A { books { name } }`, OperationName: "B"}, `there's no operation named "B"`, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := schema.Prepare(test.request)
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("Prepare: %v", err)
+				}
+				return
+			}
+			graphql_err, ok := err.(*GraphQLError)
+			if !ok {
+				t.Fatalf("Prepare = %v, want %q", err, test.err)
+			}
+			if graphql_err.Message != test.err {
+				t.Errorf("error %q, want %q", graphql_err.Message, test.err)
+			}
+			var locations []GraphQLLocation
+			if test.line > 0 {
+				locations = []GraphQLLocation{{Line: test.line, Column: test.col}}
+			}
+			if len(graphql_err.Locations) != len(locations) || (len(locations) > 0 && graphql_err.Locations[0] != locations[0]) {
+				t.Errorf("locations %v, want %v", graphql_err.Locations, locations)
+			}
+		})
+	}
+}
+
+func TestGraphQLEndpoint(t *testing.T) {
+	handler := newTestServer(t)
+	post := func(body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		return r
+	}
+	tests := []struct {
+		name    string
+		request *http.Request
+		status  int
+		// body is what the response starts with, so the order of fields
+		// is checked too
+		body string
+	}{
+		{
+			"verse",
+			post(`{"query": "{ verse(ref: \"John 3:16\") { reference number text } }"}`),
+			http.StatusOK,
+			`{"data":{"verse":{"reference":"John 3:16","number":16,"text":"For God so loved the world`,
+		},
+		{
+			"aliases",
+			post(`{"query": "{ b: book(slug: \"genesis\") { id name } a: book(slug: \"john\") { name id } }"}`),
+			http.StatusOK,
+			`{"data":{"b":{"id":"GEN","name":"Genesis"},"a":{"name":"John","id":"JHN"}}}`,
+		},
+		{
+			"variables in a GET",
+			httptest.NewRequest(http.MethodGet, "/graphql?"+url.Values{"query": {"query ($n: Int!) { chapter(book: \"psalms\", number: $n) { reference } }"}, "variables": {`{"n": 119}`}}.Encode(), nil),
+			http.StatusOK,
+			`{"data":{"chapter":{"reference":"Psalms 119"}}}`,
+		},
+		{
+			"a field that fails",
+			post(`{"query": "{ verse(ref: \"John 3:99\") { text } book(slug: \"john\") { name } }"}`),
+			http.StatusOK,
+			`{"data":{"verse":null,"book":{"name":"John"}},"errors":[{"message":`,
+		},
+		{
+			"too costly",
+			post(`{"query": "{ books { chapter(number: 1) { verses { text } } } }"}`),
+			http.StatusBadRequest,
+			`{"errors":[{"message":"this query would cost 2707, more than the limit of 1000; ask for fewer lists of objects","locations":[{"line":1,"column":1}]}]}`,
+		},
+		{
+			"not JSON",
+			post(`query { books { name } }`),
+			http.StatusBadRequest,
+			`{"errors":[{"message":"the body should be JSON like {\"query\": \"{ books { name } }\"}"}]}`,
+		},
+		{
+			"bad variables",
+			httptest.NewRequest(http.MethodGet, "/graphql?query=%7Bbooks%7Bname%7D%7D&variables=3", nil),
+			http.StatusBadRequest,
+			`{"errors":[{"message":"?variables= should be a JSON object"}]}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, test.request)
+			if w.Code != test.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+			if body := strings.TrimSpace(w.Body.String()); !strings.HasPrefix(body, test.body) {
+				t.Errorf("body %s\nwant %s", body, test.body)
+			}
+		})
+	}
+}
+
+// A resolver's error says which field it came from.
+func TestGraphQLFieldError(t *testing.T) {
+	w := httptest.NewRecorder()
+	newTestServer(t).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/graphql?query="+url.QueryEscape(`{ x: chapter(book: "john", number: 40) { number } }`), nil))
+	var response struct {
+		Data   map[string]any
+		Errors []GraphQLError
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Data["x"] != nil || len(response.Errors) != 1 {
+		t.Fatalf("response %s", w.Body)
+	}
+	if path := response.Errors[0].Path; len(path) != 1 || path[0] != "x" {
+		t.Errorf("path %v, want [x]", path)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// graphql_max_depth is how deeply fields can nest, counting the ones
+	// on Query as 1.
+	graphql_max_depth = 6
+	// graphql_max_cost is what a query can add up to, see GraphQLField.
+	// Every chapter of every book is far past it, one chapter with its
+	// verses or every book's chapter list is well under.
+	graphql_max_cost = 1000
+	// graphql_body_size is the largest POST body /graphql reads.
+	graphql_body_size = 64 << 10
+	// graphql_search_limit is how many results search returns unless
+	// limit asks for fewer or more, up to search_max_per_page.
+	graphql_search_limit = 10
+)
+
+// graphql_playground is set by -graphql-playground, for GET /graphql in a
+// browser to show a page to try queries on.
+var graphql_playground = false
+
+// graphQLBook, graphQLChapter and graphQLVerse are what the Book, Chapter
+// and Verse types resolve from. Each knows its translation so the fields
+// under it can load more from the same one.
+type graphQLBook struct {
+	Book
+	Translation string
+}
+
+type graphQLChapter struct {
+	Book   graphQLBook
+	Number int
+}
+
+type graphQLVerse struct {
+	Verse
+	Book graphQLBook
+}
+
+// graphQLTranslation is the translation argument, or the default.
+func graphQLTranslation(args map[string]any) string {
+	if translation, ok := args["translation"].(string); ok && translation != "" {
+		return translation
+	}
+	return default_translation
+}
+
+// listSize counts a list field as n items against graphql_max_cost.
+func listSize(n int) func(map[string]any) int {
+	return func(map[string]any) int { return n }
+}
+
+// prefetchChapters loads the chapter lists of books into s.Chapters
+// concurrently, so Book fields that need them don't each wait on their own
+// upstream request in turn. Failures are left for those fields to report.
+func (s *Server) prefetchChapters(ctx context.Context, translation string, books []Book) {
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(markdown_workers)
+	for _, book := range books {
+		g.Go(func() error {
+			var chapter_info ChapterInfo
+			s.Chapters.Get(ctx, translation, book.ID, &chapter_info)
+			return nil
+		})
+	}
+	g.Wait()
+}
+
+// graphQLChapters is the chapter list of a book, from s.Chapters.
+func (s *Server) graphQLChapters(ctx context.Context, book graphQLBook) (ChapterInfo, error) {
+	var chapter_info ChapterInfo
+	err := s.Chapters.Get(ctx, book.Translation, book.ID, &chapter_info)
+	return chapter_info, err
+}
+
+// loadGraphQLChapter checks number is a chapter of book before anything
+// asks for its verses.
+func (s *Server) loadGraphQLChapter(ctx context.Context, book graphQLBook, number int) (any, error) {
+	err := s.CheckChapter(ctx, book.Translation, book.Book, number)
+	if err != nil {
+		return nil, err
+	}
+	return graphQLChapter{Book: book, Number: number}, nil
+}
+
+var translation_arg = GraphQLArg{Name: "translation", Type: "String"}
+
+func (s *Server) newGraphQLSchema() *GraphQLSchema {
+	book := &GraphQLObject{Name: "Book"}
+	chapter := &GraphQLObject{Name: "Chapter"}
+	verse := &GraphQLObject{Name: "Verse"}
+
+	book.Fields = []*GraphQLField{
+		{Name: "id", Type: "String!", Cost: 1, Resolve: func(p GraphQLParams) (any, error) { return p.Source.(graphQLBook).ID, nil }},
+		{Name: "name", Type: "String!", Cost: 1, Resolve: func(p GraphQLParams) (any, error) { return p.Source.(graphQLBook).Name, nil }},
+		{Name: "slug", Type: "String!", Cost: 1, Resolve: func(p GraphQLParams) (any, error) { return BookSlug(p.Source.(graphQLBook).Name), nil }},
+		{Name: "testament", Type: "String!", Cost: 1, Resolve: func(p GraphQLParams) (any, error) { return Testament(p.Source.(graphQLBook).ID), nil }},
+		{Name: "translation", Type: "String!", Cost: 1, Resolve: func(p GraphQLParams) (any, error) { return p.Source.(graphQLBook).Translation, nil }},
+		{Name: "url", Type: "String!", Cost: 1, Resolve: func(p GraphQLParams) (any, error) {
+			book := p.Source.(graphQLBook)
+			return s.BookLink(book.Translation, book.Book).URL, nil
+		}},
+		{Name: "chapterCount", Type: "Int!", Cost: 1, Resolve: func(p GraphQLParams) (any, error) {
+			chapter_info, err := s.graphQLChapters(p.Context, p.Source.(graphQLBook))
+			return len(chapter_info.Chapters), err
+		}},
+		{Name: "chapters", Type: "[Int!]!", Cost: 1, Resolve: func(p GraphQLParams) (any, error) {
+			chapter_info, err := s.graphQLChapters(p.Context, p.Source.(graphQLBook))
+			numbers := make([]int, len(chapter_info.Chapters))
+			for i, chapter := range chapter_info.Chapters {
+				numbers[i] = chapter.Chapter
+			}
+			return numbers, err
+		}},
+		{Name: "chapter", Type: "Chapter", Cost: 1, Args: []GraphQLArg{{Name: "number", Type: "Int!"}}, Resolve: func(p GraphQLParams) (any, error) {
+			return s.loadGraphQLChapter(p.Context, p.Source.(graphQLBook), p.Args["number"].(int))
+		}},
+	}
+
+	chapter.Fields = []*GraphQLField{
+		{Name: "book", Type: "Book!", Cost: 1, Resolve: func(p GraphQLParams) (any, error) { return p.Source.(graphQLChapter).Book, nil }},
+		{Name: "number", Type: "Int!", Cost: 1, Resolve: func(p GraphQLParams) (any, error) { return p.Source.(graphQLChapter).Number, nil }},
+		{Name: "reference", Type: "String!", Cost: 1, Resolve: func(p GraphQLParams) (any, error) {
+			chapter := p.Source.(graphQLChapter)
+			return fmt.Sprintf("%s %d", chapter.Book.Name, chapter.Number), nil
+		}},
+		{Name: "url", Type: "String!", Cost: 1, Resolve: func(p GraphQLParams) (any, error) {
+			chapter := p.Source.(graphQLChapter)
+			return s.ChapterLink(chapter.Book.Translation, chapter.Book.Book, chapter.Number).URL, nil
+		}},
+		{Name: "verses", Type: "[Verse!]!", Description: "fetches the chapter, so it costs 10", Cost: 10, Size: listSize(30), Resolve: func(p GraphQLParams) (any, error) {
+			chapter := p.Source.(graphQLChapter)
+			var verse_info VerseInfo
+			err := s.Bible.GetVerseInfo(p.Context, chapter.Book.Translation, chapter.Book.ID, strconv.Itoa(chapter.Number), &verse_info)
+			if err != nil {
+				return nil, err
+			}
+			verses := make([]graphQLVerse, len(verse_info.Verses))
+			for i, v := range verse_info.Verses {
+				v.Text = verseText(v.Text)
+				verses[i] = graphQLVerse{Verse: v, Book: chapter.Book}
+			}
+			return verses, nil
+		}},
+	}
+
+	verse.Fields = []*GraphQLField{
+		{Name: "book", Type: "Book!", Cost: 1, Resolve: func(p GraphQLParams) (any, error) { return p.Source.(graphQLVerse).Book, nil }},
+		{Name: "chapter", Type: "Int!", Cost: 1, Resolve: func(p GraphQLParams) (any, error) { return p.Source.(graphQLVerse).Chapter, nil }},
+		{Name: "number", Type: "Int!", Cost: 1, Resolve: func(p GraphQLParams) (any, error) { return p.Source.(graphQLVerse).Verse.Verse, nil }},
+		{Name: "text", Type: "String!", Cost: 1, Resolve: func(p GraphQLParams) (any, error) { return p.Source.(graphQLVerse).Text, nil }},
+		{Name: "reference", Type: "String!", Cost: 1, Resolve: func(p GraphQLParams) (any, error) {
+			v := p.Source.(graphQLVerse)
+			return s.VerseLink(v.Book.Translation, v.Book.Book, v.Chapter, v.Verse.Verse).Text, nil
+		}},
+		{Name: "url", Type: "String!", Cost: 1, Resolve: func(p GraphQLParams) (any, error) {
+			v := p.Source.(graphQLVerse)
+			return s.VerseLink(v.Book.Translation, v.Book.Book, v.Chapter, v.Verse.Verse).URL, nil
+		}},
+	}
+
+	query := &GraphQLObject{Name: "Query", Fields: []*GraphQLField{
+		{Name: "books", Type: "[Book!]!", Cost: 1, Size: listSize(66), Args: []GraphQLArg{translation_arg}, Resolve: func(p GraphQLParams) (any, error) {
+			translation := graphQLTranslation(p.Args)
+			var book_info BookInfo
+			err := s.Books.Get(p.Context, translation, &book_info)
+			if err != nil {
+				return nil, err
+			}
+			if p.Selects("chapterCount", "chapters", "chapter") {
+				s.prefetchChapters(p.Context, translation, book_info.Books)
+			}
+			books := make([]graphQLBook, len(book_info.Books))
+			for i, book := range book_info.Books {
+				books[i] = graphQLBook{Book: book, Translation: translation}
+			}
+			return books, nil
+		}},
+		{Name: "book", Type: "Book", Cost: 1, Args: []GraphQLArg{{Name: "slug", Type: "String!"}, translation_arg}, Resolve: func(p GraphQLParams) (any, error) {
+			translation := graphQLTranslation(p.Args)
+			var book Book
+			err := s.Books.FindBook(p.Context, translation, p.Args["slug"].(string), &book)
+			if err != nil {
+				return nil, err
+			}
+			return graphQLBook{Book: book, Translation: translation}, nil
+		}},
+		{Name: "chapter", Type: "Chapter", Cost: 1, Args: []GraphQLArg{{Name: "book", Type: "String!"}, {Name: "number", Type: "Int!"}, translation_arg}, Resolve: func(p GraphQLParams) (any, error) {
+			translation := graphQLTranslation(p.Args)
+			var book Book
+			err := s.Books.FindBook(p.Context, translation, p.Args["book"].(string), &book)
+			if err != nil {
+				return nil, err
+			}
+			return s.loadGraphQLChapter(p.Context, graphQLBook{Book: book, Translation: translation}, p.Args["number"].(int))
+		}},
+		{Name: "verse", Type: "Verse", Description: "fetches the chapter, so it costs 10", Cost: 10, Args: []GraphQLArg{{Name: "ref", Type: "String!"}, translation_arg}, Resolve: func(p GraphQLParams) (any, error) {
+			translation := graphQLTranslation(p.Args)
+			text := p.Args["ref"].(string)
+			ref, err := ParseReference(text)
+			if err != nil {
+				return nil, err
+			}
+			if ref.VerseStart == 0 || ref.ChapterEnd != ref.ChapterStart || ref.VerseEnd != ref.VerseStart {
+				return nil, fmt.Errorf("%w: %q isn't a single verse like \"John 3:16\"", ErrInvalidReference, text)
+			}
+			var book Book
+			var verse_info VerseInfo
+			var v Verse
+			err = s.LoadVerse(p.Context, translation, ref.Book, strconv.Itoa(ref.ChapterStart), ref.VerseStart, &book, &verse_info, &v)
+			if err != nil {
+				return nil, err
+			}
+			v.Text = verseText(v.Text)
+			return graphQLVerse{Verse: v, Book: graphQLBook{Book: book, Translation: translation}}, nil
+		}},
+		{Name: "search", Type: "[Verse!]!", Description: "searches the default translation", Cost: 1, Size: func(args map[string]any) int {
+			return graphQLSearchLimit(args)
+		}, Args: []GraphQLArg{{Name: "q", Type: "String!"}, {Name: "limit", Type: "Int"}}, Resolve: func(p GraphQLParams) (any, error) {
+			expr, _, err := ParseSearch(p.Args["q"].(string))
+			if err != nil {
+				return nil, err
+			}
+			s.Search.StartCrawl(default_translation)
+			hits := s.Search.Search(expr, SearchScope{})
+			verses := []graphQLVerse{}
+			for _, hit := range hits[:min(len(hits), graphQLSearchLimit(p.Args))] {
+				v := hit.Verse
+				v.Text = verseText(v.Text)
+				verses = append(verses, graphQLVerse{Verse: v, Book: graphQLBook{Book: hit.Book, Translation: default_translation}})
+			}
+			return verses, nil
+		}},
+	}}
+
+	return &GraphQLSchema{
+		Query:     query,
+		Types:     map[string]*GraphQLObject{"Book": book, "Chapter": chapter, "Verse": verse},
+		MaxDepth:  graphql_max_depth,
+		MaxCost:   graphql_max_cost,
+		ErrorText: s.graphQLErrorText,
+	}
+}
+
+// graphQLSearchLimit is the limit argument of search, kept between 1 and
+// search_max_per_page.
+func graphQLSearchLimit(args map[string]any) int {
+	limit, ok := args["limit"].(int)
+	if !ok {
+		return graphql_search_limit
+	}
+	return max(1, min(limit, search_max_per_page))
+}
+
+// graphQLErrorText words resolver errors the way the REST API does,
+// logging the ones that aren't the query's fault.
+func (s *Server) graphQLErrorText(ctx context.Context, err error) string {
+	if errors.Is(err, ErrInvalidReference) {
+		return strings.TrimPrefix(err.Error(), ErrInvalidReference.Error()+": ")
+	}
+	status, message := ErrorStatus(err)
+	if status >= http.StatusInternalServerError && !errors.Is(err, context.Canceled) {
+		Logger(ctx).Error("resolving GraphQL field", "err", err)
+	}
+	return message
+}
+
+// writeGraphQLError answers a query that couldn't be run at all.
+func writeGraphQLError(w http.ResponseWriter, err error) {
+	var graphql_err *GraphQLError
+	if !errors.As(err, &graphql_err) {
+		graphql_err = &GraphQLError{Message: err.Error()}
+	}
+	WriteJSON(w, http.StatusBadRequest, GraphQLResponse{Errors: []*GraphQLError{graphql_err}})
+}
+
+// serveGraphQL runs a query sent as JSON in a POST body, or in ?query=,
+// ?variables= and ?operationName= on a GET. A GET from a browser without a
+// query shows the playground, if -graphql-playground is set.
+func (s *Server) serveGraphQL(w http.ResponseWriter, r *http.Request) {
+	var request GraphQLRequest
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, graphql_body_size)
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			writeGraphQLError(w, &GraphQLError{Message: `the body should be JSON like {"query": "{ books { name } }"}`})
+			return
+		}
+	} else {
+		values := r.URL.Query()
+		request.Query = values.Get("query")
+		request.OperationName = values.Get("operationName")
+		if request.Query == "" && graphql_playground && !WantsJSON(r) {
+			s.getGraphQLPlayground(w, r)
+			return
+		}
+		if variables := values.Get("variables"); variables != "" {
+			err := json.Unmarshal([]byte(variables), &request.Variables)
+			if err != nil {
+				writeGraphQLError(w, &GraphQLError{Message: "?variables= should be a JSON object"})
+				return
+			}
+		}
+	}
+	selections, err := s.graphql.Prepare(request)
+	if err != nil {
+		writeGraphQLError(w, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, s.graphql.Execute(r.Context(), selections))
+}
+
+// graphql_example is what the playground starts with.
+const graphql_example = `query {
+  verse(ref: "John 3:16") {
+    reference
+    text
+  }
+  book(slug: "psalms") {
+    name
+    chapterCount
+  }
+}`
+
+func (s *Server) getGraphQLPlayground(w http.ResponseWriter, r *http.Request) {
+	page := GraphQLPage{
+		Endpoint: s.Path("graphql"),
+		Example:  graphql_example,
+		Schema:   s.graphql.SDL(),
+	}
+	s.RenderPage(w, r, http.StatusOK, "graphql.html", "GraphQL playground", page)
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The gRPC service of bible.proto, served over HTTP/2 by net/http on its
+// own listener. Messages are encoded by hand with protowire, so there is no
+// generated code to keep in step with the proto file.
+
+// grpc_service is the package and name of the service in bible.proto.
+const grpc_service = "bible.v1.Bible"
+
+// grpc_max_message is the largest request message read. Requests are a
+// few short strings.
+const grpc_max_message = 64 << 10
+
+// GRPCCode is a gRPC status code.
+type GRPCCode int
+
+const (
+	grpc_ok                 GRPCCode = 0
+	grpc_canceled           GRPCCode = 1
+	grpc_invalid_argument   GRPCCode = 3
+	grpc_deadline_exceeded  GRPCCode = 4
+	grpc_not_found          GRPCCode = 5
+	grpc_resource_exhausted GRPCCode = 8
+	grpc_unimplemented      GRPCCode = 12
+	grpc_internal           GRPCCode = 13
+	grpc_unavailable        GRPCCode = 14
+)
+
+// GRPCError is an error with the status a call ends with.
+type GRPCError struct {
+	Code    GRPCCode
+	Message string
+}
+
+func (e *GRPCError) Error() string {
+	return fmt.Sprintf("grpc status %d: %s", e.Code, e.Message)
+}
+
+// grpcMethods are the RPCs of grpc_service. Each takes the encoded
+// request message and returns the encoded response.
+func (s *Server) grpcMethods() map[string]func(ctx context.Context, request grpcFields) ([]byte, error) {
+	return map[string]func(ctx context.Context, request grpcFields) ([]byte, error){
+		"GetBooks":   s.grpcGetBooks,
+		"GetChapter": s.grpcGetChapter,
+		"GetVerse":   s.grpcGetVerse,
+		"GetPassage": s.grpcGetPassage,
+		"Search":     s.grpcSearch,
+	}
+}
+
+// grpcStatus turns an error into the status a call ends with, the same
+// way ErrorStatus words it for the HTTP API. A deadline the client set
+// that passed is DEADLINE_EXCEEDED even when it ran out during an upstream
+// request.
+func grpcStatus(ctx context.Context, err error) (GRPCCode, string) {
+	var grpc_err *GRPCError
+	switch {
+	case errors.As(err, &grpc_err):
+		return grpc_err.Code, grpc_err.Message
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return grpc_deadline_exceeded, "the deadline passed before the call finished"
+	case errors.Is(ctx.Err(), context.Canceled):
+		return grpc_canceled, "the call was canceled"
+	case errors.Is(err, ErrInvalidReference):
+		return grpc_invalid_argument, strings.TrimPrefix(err.Error(), ErrInvalidReference.Error()+": ")
+	}
+	status, message := ErrorStatus(err)
+	switch {
+	case status == http.StatusNotFound:
+		return grpc_not_found, message
+	case status < http.StatusInternalServerError:
+		// bad input, and books too ambiguous to pick one of
+		return grpc_invalid_argument, message
+	case status == http.StatusBadGateway || status == http.StatusGatewayTimeout:
+		return grpc_unavailable, message
+	}
+	return grpc_internal, message
+}
+
+// ParseGRPCTimeout reads a grpc-timeout header, like "500m" for 500
+// milliseconds or "10S" for ten seconds.
+func ParseGRPCTimeout(value string) (time.Duration, error) {
+	if len(value) < 2 || len(value) > 9 {
+		return 0, fmt.Errorf("%q isn't a grpc-timeout", value)
+	}
+	n, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q isn't a grpc-timeout", value)
+	}
+	units := map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second, 'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond}
+	unit, ok := units[value[len(value)-1]]
+	if !ok {
+		return 0, fmt.Errorf("%q has no grpc-timeout unit", value)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// grpcMessageEscape percent-encodes a status message for the
+// grpc-message trailer.
+func grpcMessageEscape(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// serveGRPC answers unary calls to grpc_service. Calls end with their
+// status in the grpc-status and grpc-message trailers, and a grpc-timeout
+// becomes the deadline of the context every upstream request is made
+// with.
+func (s *Server) serveGRPC(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 {
+		http.Error(w, "gRPC needs HTTP/2", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "gRPC calls are POSTs", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "this is a gRPC server", http.StatusUnsupportedMediaType)
+		return
+	}
+	if entry, ok := r.Context().Value(requestLogKey{}).(*requestLog); ok {
+		entry.route = r.URL.Path
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "application/grpc+proto")
+	header.Add("Trailer", "Grpc-Status")
+	header.Add("Trailer", "Grpc-Message")
+	finish := func(code GRPCCode, message string) {
+		header.Set("Grpc-Status", strconv.Itoa(int(code)))
+		if message != "" {
+			header.Set("Grpc-Message", grpcMessageEscape(message))
+		}
+	}
+
+	ctx := r.Context()
+	if value := r.Header.Get("Grpc-Timeout"); value != "" {
+		timeout, err := ParseGRPCTimeout(value)
+		if err != nil {
+			finish(grpc_invalid_argument, err.Error())
+			return
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	service, method, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	call, ok := s.grpcMethods()[method]
+	if service != grpc_service || !ok {
+		finish(grpc_unimplemented, fmt.Sprintf("there's no method %s", r.URL.Path))
+		return
+	}
+	if encoding := r.Header.Get("Grpc-Encoding"); encoding != "" && encoding != "identity" {
+		header.Set("Grpc-Accept-Encoding", "identity")
+		finish(grpc_unimplemented, fmt.Sprintf("messages compressed with %s aren't supported", encoding))
+		return
+	}
+
+	var prefix [5]byte
+	_, err := io.ReadFull(r.Body, prefix[:])
+	if err != nil {
+		finish(grpc_invalid_argument, "the request has no message")
+		return
+	}
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if prefix[0] != 0 {
+		finish(grpc_unimplemented, "compressed messages aren't supported")
+		return
+	}
+	if length > grpc_max_message {
+		finish(grpc_resource_exhausted, fmt.Sprintf("the request is more than %d bytes", grpc_max_message))
+		return
+	}
+	message := make([]byte, length)
+	_, err = io.ReadFull(r.Body, message)
+	if err != nil {
+		finish(grpc_invalid_argument, "the request message is cut short")
+		return
+	}
+	request, err := decodeGRPCFields(message)
+	if err != nil {
+		finish(grpc_invalid_argument, err.Error())
+		return
+	}
+
+	response, err := call(ctx, request)
+	if err != nil {
+		code, message := grpcStatus(ctx, err)
+		if code == grpc_internal || code == grpc_unavailable {
+			Logger(ctx).Error("gRPC call failed", "method", method, "err", err)
+		}
+		finish(code, message)
+		return
+	}
+	frame := make([]byte, 5, 5+len(response))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(response)))
+	w.Write(append(frame, response...))
+	finish(grpc_ok, "")
+}
+
+// grpcFields are the scalar fields of a request message by number:
+// strings as string and integers and bools as uint64.
+type grpcFields map[protowire.Number]any
+
+func decodeGRPCFields(data []byte) (grpcFields, error) {
+	fields := grpcFields{}
+	for len(data) > 0 {
+		number, kind, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, fmt.Errorf("the request message is malformed: %w", protowire.ParseError(n))
+		}
+		data = data[n:]
+		switch kind {
+		case protowire.BytesType:
+			value, n := protowire.ConsumeString(data)
+			if n < 0 {
+				return nil, fmt.Errorf("field %d is malformed: %w", number, protowire.ParseError(n))
+			}
+			fields[number] = value
+			data = data[n:]
+		case protowire.VarintType:
+			value, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, fmt.Errorf("field %d is malformed: %w", number, protowire.ParseError(n))
+			}
+			fields[number] = value
+			data = data[n:]
+		default:
+			// fields this version doesn't know, skipped like protobuf does
+			n := protowire.ConsumeFieldValue(number, kind, data)
+			if n < 0 {
+				return nil, fmt.Errorf("field %d is malformed: %w", number, protowire.ParseError(n))
+			}
+			data = data[n:]
+		}
+	}
+	return fields, nil
+}
+
+func (f grpcFields) String(number protowire.Number) string {
+	value, _ := f[number].(string)
+	return value
+}
+
+// Int reads an int32 field, which negative numbers are sign extended in.
+func (f grpcFields) Int(number protowire.Number) int {
+	value, _ := f[number].(uint64)
+	return int(int32(value))
+}
+
+// translation is field 1 of every request that has one, or the default.
+func (f grpcFields) translation() string {
+	if translation := f.String(1); translation != "" {
+		return strings.ToLower(translation)
+	}
+	return default_translation
+}
+
+// appendGRPCString and the other appenders leave out fields with the zero
+// value, as proto3 does.
+func appendGRPCString(b []byte, number protowire.Number, value string) []byte {
+	if value == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, number, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+func appendGRPCInt(b []byte, number protowire.Number, value int) []byte {
+	if value == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, number, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(int64(value)))
+}
+
+func appendGRPCBool(b []byte, number protowire.Number, value bool) []byte {
+	if !value {
+		return b
+	}
+	b = protowire.AppendTag(b, number, protowire.VarintType)
+	return protowire.AppendVarint(b, 1)
+}
+
+func appendGRPCMessage(b []byte, number protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, number, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
+
+func encodeGRPCTranslation(t Translation) []byte {
+	var b []byte
+	b = appendGRPCString(b, 1, t.Identifier)
+	b = appendGRPCString(b, 2, t.Name)
+	b = appendGRPCString(b, 3, t.Language)
+	b = appendGRPCString(b, 4, t.LanguageCode)
+	return appendGRPCString(b, 5, t.License)
+}
+
+func encodeGRPCBook(book Book) []byte {
+	var b []byte
+	b = appendGRPCString(b, 1, book.ID)
+	b = appendGRPCString(b, 2, book.Name)
+	b = appendGRPCString(b, 3, book.URL)
+	b = appendGRPCString(b, 4, book.Testament)
+	return appendGRPCString(b, 5, book.Slug)
+}
+
+func encodeGRPCVerse(verse Verse) []byte {
+	var b []byte
+	b = appendGRPCString(b, 1, verse.BookID)
+	b = appendGRPCString(b, 2, verse.BookName)
+	b = appendGRPCInt(b, 3, verse.Chapter)
+	b = appendGRPCInt(b, 4, verse.Verse)
+	return appendGRPCString(b, 5, verseText(verse.Text))
+}
+
+// encodeGRPCVerses is a VerseList, or a Passage after its reference.
+func encodeGRPCVerses(b []byte, number protowire.Number, verses []Verse) []byte {
+	for _, verse := range verses {
+		b = appendGRPCMessage(b, number, encodeGRPCVerse(verse))
+	}
+	return b
+}
+
+func (s *Server) grpcGetBooks(ctx context.Context, request grpcFields) ([]byte, error) {
+	var book_info BookInfo
+	err := s.Books.Get(ctx, request.translation(), &book_info)
+	if err != nil {
+		return nil, err
+	}
+	b := appendGRPCMessage(nil, 1, encodeGRPCTranslation(book_info.Translation))
+	for _, book := range book_info.Books {
+		b = appendGRPCMessage(b, 2, encodeGRPCBook(book))
+	}
+	return b, nil
+}
+
+func (s *Server) grpcGetChapter(ctx context.Context, request grpcFields) ([]byte, error) {
+	var book Book
+	var verse_info VerseInfo
+	err := s.LoadVerses(ctx, request.translation(), request.String(2), strconv.Itoa(request.Int(3)), &book, &verse_info)
+	if err != nil {
+		return nil, err
+	}
+	b := appendGRPCMessage(nil, 1, encodeGRPCTranslation(verse_info.Translation))
+	return encodeGRPCVerses(b, 2, verse_info.Verses), nil
+}
+
+func (s *Server) grpcGetVerse(ctx context.Context, request grpcFields) ([]byte, error) {
+	var book Book
+	var verse_info VerseInfo
+	var verse Verse
+	err := s.LoadVerse(ctx, request.translation(), request.String(2), strconv.Itoa(request.Int(3)), request.Int(4), &book, &verse_info, &verse)
+	if err != nil {
+		return nil, err
+	}
+	b := appendGRPCMessage(nil, 1, encodeGRPCTranslation(verse_info.Translation))
+	return appendGRPCMessage(b, 2, encodeGRPCVerse(verse)), nil
+}
+
+func (s *Server) grpcGetPassage(ctx context.Context, request grpcFields) ([]byte, error) {
+	passage, err := s.LoadPassage(ctx, request.translation(), request.String(2))
+	if err != nil {
+		return nil, err
+	}
+	b := appendGRPCMessage(nil, 1, encodeGRPCTranslation(passage.Translation))
+	b = appendGRPCString(b, 2, passage.Reference.String())
+	return encodeGRPCVerses(b, 3, passage.Verses), nil
+}
+
+func (s *Server) grpcSearch(ctx context.Context, request grpcFields) ([]byte, error) {
+	values := map[string][]string{"q": {request.String(1)}, "book": {request.String(2)}, "testament": {request.String(3)}}
+	if page := request.Int(4); page != 0 {
+		values["page"] = []string{strconv.Itoa(page)}
+	}
+	if per_page := request.Int(5); per_page != 0 {
+		values["per_page"] = []string{strconv.Itoa(per_page)}
+	}
+	query, err := s.ParseSearchValues(ctx, values)
+	if err != nil {
+		return nil, err
+	}
+	response := s.NewSearchResponse(query)
+	var b []byte
+	b = appendGRPCString(b, 1, response.Query)
+	b = appendGRPCInt(b, 2, response.Total)
+	b = appendGRPCInt(b, 3, response.Page)
+	b = appendGRPCInt(b, 4, response.PerPage)
+	b = appendGRPCInt(b, 5, response.Pages)
+	b = appendGRPCBool(b, 6, response.Complete)
+	return encodeGRPCVerses(b, 7, response.Results), nil
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// grpcServer serves s.serveGRPC over HTTP/2 without TLS, the way main
+// does on -grpc-addr, and returns a client that speaks it.
+func grpcServer(t *testing.T, s *Server) (*httptest.Server, *http.Client) {
+	t.Helper()
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(s.serveGRPC))
+	server.Config.Protocols = &protocols
+	server.Start()
+	t.Cleanup(server.Close)
+	return server, &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+}
+
+// grpcResult is how a call ended, with the response message if it
+// succeeded.
+type grpcResult struct {
+	code    GRPCCode
+	message string
+	body    []byte
+}
+
+// grpcCall makes a unary call of method with the request message, and a
+// grpc-timeout if timeout isn't empty.
+func grpcCall(t *testing.T, server *httptest.Server, client *http.Client, method string, request []byte, timeout string) grpcResult {
+	t.Helper()
+	frame := make([]byte, 5, 5+len(request))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(request)))
+	r, err := http.NewRequest(http.MethodPost, server.URL+"/"+grpc_service+"/"+method, bytes.NewReader(append(frame, request...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", "application/grpc")
+	if timeout != "" {
+		r.Header.Set("Grpc-Timeout", timeout)
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("answered over HTTP/%d.%d", resp.ProtoMajor, resp.ProtoMinor)
+	}
+
+	// a call that fails before writing a message has its status in the
+	// headers
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+		message = resp.Header.Get("Grpc-Message")
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		t.Fatalf("grpc-status %q", status)
+	}
+	result := grpcResult{code: GRPCCode(code), message: message}
+	if len(body) > 0 {
+		if len(body) < 5 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+			t.Fatalf("malformed response frame %q", body)
+		}
+		result.body = body[5:]
+	}
+	return result
+}
+
+// grpcTestField is a field of a response message.
+type grpcTestField struct {
+	number protowire.Number
+	bytes  []byte
+	varint uint64
+}
+
+// decodeGRPCTest splits a response message into its fields.
+func decodeGRPCTest(t *testing.T, b []byte) []grpcTestField {
+	t.Helper()
+	var fields []grpcTestField
+	for len(b) > 0 {
+		number, kind, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("bad tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		field := grpcTestField{number: number}
+		switch kind {
+		case protowire.BytesType:
+			field.bytes, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			field.varint, n = protowire.ConsumeVarint(b)
+		default:
+			t.Fatalf("field %d has wire type %d", number, kind)
+		}
+		if n < 0 {
+			t.Fatalf("bad field %d: %v", number, protowire.ParseError(n))
+		}
+		b = b[n:]
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// grpcTestVerses returns the verse numbers and texts of the Verse
+// messages in field number of a response.
+func grpcTestVerses(t *testing.T, body []byte, number protowire.Number) ([]int, []string) {
+	t.Helper()
+	var numbers []int
+	var texts []string
+	for _, field := range decodeGRPCTest(t, body) {
+		if field.number != number {
+			continue
+		}
+		for _, verse_field := range decodeGRPCTest(t, field.bytes) {
+			switch verse_field.number {
+			case 4:
+				numbers = append(numbers, int(verse_field.varint))
+			case 5:
+				texts = append(texts, string(verse_field.bytes))
+			}
+		}
+	}
+	return numbers, texts
+}
+
+func chapterRequest(book string, chapter int) []byte {
+	return appendGRPCInt(appendGRPCString(nil, 2, book), 3, chapter)
+}
+
+func passageRequest(ref string) []byte {
+	return appendGRPCString(nil, 2, ref)
+}
+
+func TestGRPCGetChapter(t *testing.T) {
+	server, client := grpcServer(t, testServer(t, fakeUpstream(t).URL))
+
+	result := grpcCall(t, server, client, "GetChapter", chapterRequest("john", 3), "")
+	if result.code != grpc_ok {
+		t.Fatalf("status %d: %s", result.code, result.message)
+	}
+	fields := decodeGRPCTest(t, result.body)
+	if len(fields) == 0 || fields[0].number != 1 {
+		t.Fatalf("response doesn't start with the translation: %+v", fields)
+	}
+	translation := decodeGRPCTest(t, fields[0].bytes)
+	if len(translation) == 0 || string(translation[0].bytes) != "web" {
+		t.Errorf("translation %+v, want web", translation)
+	}
+	numbers, texts := grpcTestVerses(t, result.body, 2)
+	if len(numbers) != 36 || numbers[15] != 16 {
+		t.Fatalf("got verses %v, want 1 to 36", numbers)
+	}
+	if want := "For God so loved the world"; len(texts) < 16 || !strings.HasPrefix(texts[15], want) {
+		t.Errorf("verse 16 is %q, want it to start %q", texts[15], want)
+	}
+}
+
+func TestGRPCGetPassage(t *testing.T) {
+	server, client := grpcServer(t, testServer(t, fakeUpstream(t).URL))
+
+	result := grpcCall(t, server, client, "GetPassage", passageRequest("John 3:16-18"), "")
+	if result.code != grpc_ok {
+		t.Fatalf("status %d: %s", result.code, result.message)
+	}
+	var reference string
+	for _, field := range decodeGRPCTest(t, result.body) {
+		if field.number == 2 {
+			reference = string(field.bytes)
+		}
+	}
+	if reference != "John 3:16-18" {
+		t.Errorf("reference %q", reference)
+	}
+	if numbers, _ := grpcTestVerses(t, result.body, 3); len(numbers) != 3 || numbers[0] != 16 || numbers[2] != 18 {
+		t.Errorf("got verses %v, want 16 to 18", numbers)
+	}
+}
+
+func TestGRPCStatus(t *testing.T) {
+	server, client := grpcServer(t, testServer(t, fakeUpstream(t).URL))
+
+	tests := []struct {
+		name    string
+		method  string
+		request []byte
+		code    GRPCCode
+	}{
+		{"chapter past the end", "GetChapter", chapterRequest("john", 40), grpc_not_found},
+		{"unknown book", "GetChapter", chapterRequest("nope", 1), grpc_not_found},
+		{"verse past the end", "GetPassage", passageRequest("John 3:40"), grpc_not_found},
+		{"backwards range", "GetPassage", passageRequest("John 3:18-16"), grpc_invalid_argument},
+		{"no reference", "GetPassage", passageRequest(""), grpc_invalid_argument},
+		{"unknown method", "GetPsalm", nil, grpc_unimplemented},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := grpcCall(t, server, client, test.method, test.request, "")
+			if result.code != test.code {
+				t.Errorf("status %d (%s), want %d", result.code, result.message, test.code)
+			}
+			if result.message == "" {
+				t.Errorf("no grpc-message")
+			}
+			if result.body != nil {
+				t.Errorf("failed call sent a message %q", result.body)
+			}
+		})
+	}
+}
+
+func TestGRPCDeadline(t *testing.T) {
+	release := make(chan struct{})
+	upstream, _ := countingUpstream(t, "/data/web/JHN/3", release)
+	t.Cleanup(func() { close(release) })
+	server, client := grpcServer(t, testServer(t, upstream.URL))
+
+	start := time.Now()
+	result := grpcCall(t, server, client, "GetChapter", chapterRequest("john", 3), "50m")
+	if result.code != grpc_deadline_exceeded {
+		t.Errorf("status %d (%s), want DEADLINE_EXCEEDED", result.code, result.message)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("call took %v with a 50ms deadline", elapsed)
+	}
+
+	result = grpcCall(t, server, client, "GetChapter", chapterRequest("john", 3), "soon")
+	if result.code != grpc_invalid_argument {
+		t.Errorf("bad grpc-timeout: status %d (%s), want INVALID_ARGUMENT", result.code, result.message)
+	}
+}
+
+func TestGRPCUpstreamDown(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	t.Cleanup(upstream.Close)
+	server, client := grpcServer(t, testServer(t, upstream.URL))
+
+	result := grpcCall(t, server, client, "GetChapter", chapterRequest("john", 3), "")
+	if result.code != grpc_unavailable {
+		t.Errorf("status %d (%s), want UNAVAILABLE", result.code, result.message)
+	}
+}
+
+func TestGRPCNeedsHTTP2(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/"+grpc_service+"/GetChapter", bytes.NewReader(nil))
+	r.Header.Set("Content-Type", "application/grpc")
+	testServer(t, fakeUpstream(t).URL).serveGRPC(w, r)
+	if w.Code != http.StatusHTTPVersionNotSupported {
+		t.Errorf("status %d over HTTP/1.1", w.Code)
+	}
+}
+
+func TestParseGRPCTimeout(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"500m", 500 * time.Millisecond, true},
+		{"10S", 10 * time.Second, true},
+		{"1H", time.Hour, true},
+		{"250u", 250 * time.Microsecond, true},
+		{"S", 0, false},
+		{"10", 0, false},
+		{"10s", 0, false},
+		{"-1S", 0, false},
+		{"123456789S", 0, false},
+	}
+	for _, test := range tests {
+		got, err := ParseGRPCTimeout(test.value)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("ParseGRPCTimeout(%q) = %v, %v", test.value, got, err)
+		}
+	}
+}
+
+func TestGRPCStatusCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if code, _ := grpcStatus(ctx, ctx.Err()); code != grpc_canceled {
+		t.Errorf("status %d, want CANCELLED", code)
+	}
+}
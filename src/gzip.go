@@ -0,0 +1,134 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// gzip_min_size is the smallest body worth compressing; below it the gzip
+// header and footer cost more than they save.
+const gzip_min_size = 1024
+
+var gzip_writers = sync.Pool{
+	New: func() any { return gzip.NewWriter(nil) },
+}
+
+// gzipWriter holds back the start of a response until it knows whether the
+// body is big enough to compress.
+type gzipWriter struct {
+	http.ResponseWriter
+	status  int
+	pending []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (g *gzipWriter) WriteHeader(status int) {
+	if g.status == 0 {
+		g.status = status
+	}
+}
+
+func (g *gzipWriter) Write(p []byte) (int, error) {
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	if g.gz != nil {
+		return g.gz.Write(p)
+	}
+	if g.decided {
+		return g.ResponseWriter.Write(p)
+	}
+	g.pending = append(g.pending, p...)
+	if len(g.pending) >= gzip_min_size {
+		g.start(true)
+	}
+	return len(p), nil
+}
+
+// start sends the headers, compressed or not, followed by anything held back.
+func (g *gzipWriter) start(compress bool) {
+	g.decided = true
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	header := g.Header()
+	// an event stream is flushed an event at a time, which gzip does little
+	// for, and some proxies hold compressed streams back
+	if strings.HasPrefix(header.Get("Content-Type"), "text/event-stream") {
+		compress = false
+	}
+	if compress && header.Get("Content-Encoding") == "" {
+		if header.Get("Content-Type") == "" {
+			header.Set("Content-Type", http.DetectContentType(g.pending))
+		}
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		// the compressed bytes differ from what the ETag hashed, so it
+		// can only vouch for them weakly
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		g.gz = gzip_writers.Get().(*gzip.Writer)
+		g.gz.Reset(g.ResponseWriter)
+	}
+	g.ResponseWriter.WriteHeader(g.status)
+	if len(g.pending) > 0 {
+		if g.gz != nil {
+			g.gz.Write(g.pending)
+		} else {
+			g.ResponseWriter.Write(g.pending)
+		}
+	}
+	g.pending = nil
+}
+
+func (g *gzipWriter) Flush() {
+	if !g.decided {
+		g.start(true)
+	}
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+	if flusher, ok := g.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (g *gzipWriter) close() {
+	if !g.decided {
+		g.start(false)
+	}
+	if g.gz != nil {
+		g.gz.Close()
+		gzip_writers.Put(g.gz)
+	}
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// Gzip compresses responses for clients that advertise gzip support.
+func Gzip(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		// HEAD goes through the gzip writer too, so it answers with the same
+		// headers as GET; the server drops the body
+		if !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		g := &gzipWriter{ResponseWriter: w}
+		defer g.close()
+		next.ServeHTTP(g, r)
+	})
+}
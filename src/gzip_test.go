@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		accept_encoding string
+		want            bool
+	}{
+		{"gzip", true},
+		{"gzip, deflate, br", true},
+		{"br;q=1.0, GZIP;q=0.5", true},
+		{"deflate, gzip ; q=0.8", true},
+		{"gzip;q=0", false},
+		{"gzip; q=0", false},
+		{"deflate, br", false},
+		{"identity", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		t.Run(test.accept_encoding, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Encoding", test.accept_encoding)
+			if got := acceptsGzip(r); got != test.want {
+				t.Errorf("acceptsGzip(%q) = %v, want %v", test.accept_encoding, got, test.want)
+			}
+		})
+	}
+}
+
+func gunzip(t *testing.T, body []byte) []byte {
+	t.Helper()
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plain
+}
+
+func TestGzip(t *testing.T) {
+	big := strings.Repeat("In the beginning, God created the heavens and the earth. ", 40)
+	tests := []struct {
+		name            string
+		accept_encoding string
+		content_type    string
+		etag            string
+		body            string
+		gzipped         bool
+		want_etag       string
+	}{
+		{"big", "gzip", "text/html; charset=utf-8", "", big, true, ""},
+		{"small", "gzip", "text/html; charset=utf-8", "", "<p>short</p>", false, ""},
+		{"empty", "gzip", "", "", "", false, ""},
+		{"no gzip", "", "text/html; charset=utf-8", "", big, false, ""},
+		{"refused gzip", "gzip;q=0", "text/html; charset=utf-8", "", big, false, ""},
+		{"event stream", "gzip", "text/event-stream", "", big, false, ""},
+		{"strong etag", "gzip", "text/html; charset=utf-8", `"abc"`, big, true, `W/"abc"`},
+		{"weak etag", "gzip", "text/html; charset=utf-8", `W/"abc"`, big, true, `W/"abc"`},
+		{"etag uncompressed", "gzip", "text/html; charset=utf-8", `"abc"`, "<p>short</p>", false, `"abc"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := Gzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if test.content_type != "" {
+					w.Header().Set("Content-Type", test.content_type)
+				}
+				if test.etag != "" {
+					w.Header().Set("ETag", test.etag)
+				}
+				// in pieces, so the first write is too small to decide on
+				for chunk := range slices.Chunk([]byte(test.body), 100) {
+					w.Write(chunk)
+				}
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.accept_encoding != "" {
+				r.Header.Set("Accept-Encoding", test.accept_encoding)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if vary := w.Header().Get("Vary"); vary != "Accept-Encoding" {
+				t.Errorf("Vary %q, want Accept-Encoding", vary)
+			}
+			gzipped := w.Header().Get("Content-Encoding") == "gzip"
+			if gzipped != test.gzipped {
+				t.Fatalf("gzipped %v, want %v", gzipped, test.gzipped)
+			}
+			body := w.Body.Bytes()
+			if gzipped {
+				body = gunzip(t, body)
+			}
+			if string(body) != test.body {
+				t.Errorf("body %q, want %q", body, test.body)
+			}
+			if etag := w.Header().Get("ETag"); etag != test.want_etag {
+				t.Errorf("ETag %q, want %q", etag, test.want_etag)
+			}
+		})
+	}
+}
+
+func TestGzipChapterPage(t *testing.T) {
+	handler := newTestServer(t)
+	for _, target := range []string{"/psalms/119", "/john/3", "/api/v1/psalms/119"} {
+		t.Run(target, func(t *testing.T) {
+			plain := get(t, handler, target)
+			r := httptest.NewRequest(http.MethodGet, target, nil)
+			r.Header.Set("Accept-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Header().Get("Content-Encoding") != "gzip" {
+				t.Fatalf("GET %s wasn't gzipped", target)
+			}
+			if w.Body.Len() >= plain.Body.Len() {
+				t.Errorf("GET %s: gzipped %d bytes, plain %d", target, w.Body.Len(), plain.Body.Len())
+			}
+			if !bytes.Equal(gunzip(t, w.Body.Bytes()), plain.Body.Bytes()) {
+				t.Errorf("GET %s: gzipped body doesn't decompress to the plain one", target)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type HeaderBook struct {
+	Slug     string
+	Name     string
+	Selected bool
+}
+
+type HeaderSection struct {
+	Title string
+	Books []HeaderBook
+}
+
+type HeaderChapter struct {
+	Number   int
+	Selected bool
+}
+
+// HeaderNav is the book and chapter picker at the top of every page.
+type HeaderNav struct {
+	Translation string
+	Sections    []HeaderSection
+	Chapters    []HeaderChapter
+}
+
+// PageHeader builds the picker for the page r is showing. It only uses lists
+// that are already cached, so an error page doesn't go back to bible-api.com,
+// and returns nil if the book list isn't cached at all.
+func (s *Server) PageHeader(r *http.Request) *HeaderNav {
+	if r == nil {
+		return nil
+	}
+	translation := RequestTranslation(r)
+	var book_info BookInfo
+	if !s.Books.Peek(translation, &book_info) {
+		return nil
+	}
+
+	nav := &HeaderNav{}
+	if translation != default_translation {
+		nav.Translation = translation
+	}
+	vars := mux.Vars(r)
+	current := NormalizeSlug(vars["book"])
+	var current_book *Book
+	sections := map[string][]HeaderBook{}
+	for i, book := range book_info.Books {
+		selected := current != "" && NormalizeSlug(book.Slug) == current
+		if selected {
+			current_book = &book_info.Books[i]
+		}
+		sections[book.Testament] = append(sections[book.Testament], HeaderBook{Slug: book.Slug, Name: book.Name, Selected: selected})
+	}
+	for _, testament := range testament_order {
+		if len(sections[testament]) > 0 {
+			nav.Sections = append(nav.Sections, HeaderSection{Title: testament_names[testament], Books: sections[testament]})
+		}
+	}
+
+	var chapter_info ChapterInfo
+	if current_book != nil && s.Chapters.Peek(translation, current_book.ID, &chapter_info) {
+		chapter, _ := strconv.Atoi(vars["chapter"])
+		for _, c := range chapter_info.Chapters {
+			nav.Chapters = append(nav.Chapters, HeaderChapter{Number: c.Chapter, Selected: c.Chapter == chapter})
+		}
+	}
+	return nav
+}
+
+// getGoto sends the header picker or the index's jump box to the page they
+// name. A chapter left over from the previously shown book that this one
+// doesn't have goes to the book's chapter list instead.
+func (s *Server) getGoto(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Has("ref") {
+		s.gotoReference(w, r, query.Get("ref"))
+		return
+	}
+	translation := RequestTranslation(r)
+	var book Book
+	err := s.Books.FindBook(r.Context(), translation, query.Get("book"), &book)
+	if err != nil {
+		s.fetchError(w, r, translation, query.Get("book"), err)
+		return
+	}
+
+	target := s.BookLink(translation, book).URL
+	if number, err := ParseNumber("chapter", query.Get("chapter")); err == nil {
+		err = s.CheckChapter(r.Context(), translation, book, number)
+		if err == nil {
+			target = s.ChapterLink(translation, book, number).URL
+		}
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// gotoReference redirects to the page showing a typed reference: the book,
+// chapter, verse or verse range, or /passage for spans across chapters.
+func (s *Server) gotoReference(w http.ResponseWriter, r *http.Request, text string) {
+	ref, err := ParseReference(text)
+	if err != nil {
+		message := fmt.Sprintf("\"%s\" isn't a reference like \"John 3:16\".", text)
+		s.renderBooks(w, r, http.StatusBadRequest, BooksPage{Ref: text, Error: message})
+		return
+	}
+	translation := RequestTranslation(r)
+	var book Book
+	err = s.Books.FindBook(r.Context(), translation, ref.Book, &book)
+	if err != nil {
+		s.fetchError(w, r, translation, ref.Book, err)
+		return
+	}
+
+	target := s.BookLink(translation, book).URL
+	switch {
+	case ref.ChapterStart == 0:
+	case ref.ChapterStart != ref.ChapterEnd:
+		ref.Book = book.Name
+		query := url.Values{"ref": {ref.String()}}
+		if translation != default_translation {
+			query.Set("translation", translation)
+		}
+		target = s.Path("reference") + "?" + query.Encode()
+	case ref.VerseStart == 0:
+		target = s.ChapterLink(translation, book, ref.ChapterStart).URL
+	case ref.VerseStart == ref.VerseEnd:
+		target = s.VerseLink(translation, book, ref.ChapterStart, ref.VerseStart).URL
+	default:
+		target = s.ChapterLink(translation, book, ref.ChapterStart).URL + fmt.Sprintf("/%d-%d", ref.VerseStart, ref.VerseEnd)
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// readiness_interval is how often /readyz actually checks bible-api.com.
+// Probes in between get the last result.
+const readiness_interval = 30 * time.Second
+
+type HealthResponse struct {
+	Status          string `json:"status"`
+	Upstream        string `json:"upstream,omitempty"`
+	UpstreamChecked string `json:"upstream_checked,omitempty"`
+	// Circuits is the circuit breaker state of each upstream host.
+	Circuits     map[string]string `json:"circuits,omitempty"`
+	BookCacheAge string            `json:"book_cache_age,omitempty"`
+}
+
+type upstreamCheck struct {
+	Server *Server
+
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+// Result pings bible-api.com if the last check is older than
+// readiness_interval, and returns the latest result either way. A check
+// also loads the book list if it isn't cached yet.
+func (c *upstreamCheck) Result(ctx context.Context) (time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.checked) < readiness_interval {
+		return c.checked, c.err
+	}
+	resp, err := c.Server.Bible.Response(ctx, "/data")
+	if err == nil {
+		resp.Body.Close()
+		if _, ok := c.Server.Books.Age(default_translation); !ok {
+			var book_info BookInfo
+			c.Server.Books.Get(ctx, default_translation, &book_info)
+		}
+	}
+	c.checked, c.err = time.Now(), err
+	return c.checked, c.err
+}
+
+func getHealth(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// getReady reports ready once the book list of the default translation is
+// cached. The upstream status is informational, since cached pages can
+// still be served while bible-api.com is down.
+func (s *Server) getReady(w http.ResponseWriter, r *http.Request) {
+	response := HealthResponse{Status: "ready"}
+	if local_data != nil {
+		response.Upstream = "not used, serving -data"
+	} else {
+		checked, err := s.upstream.Result(r.Context())
+		response.Upstream = "ok"
+		if err != nil {
+			_, response.Upstream = ErrorStatus(err)
+		}
+		response.UpstreamChecked = checked.UTC().Format(time.RFC3339)
+		response.Circuits = s.Bible.Circuits()
+	}
+
+	age, ok := s.Books.Age(default_translation)
+	if !ok {
+		response.Status = "not ready"
+		WriteJSON(w, http.StatusServiceUnavailable, response)
+		return
+	}
+	response.BookCacheAge = age.Round(time.Second).String()
+	WriteJSON(w, http.StatusOK, response)
+}
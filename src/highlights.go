@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// HighlightColor is one of the colors verses can be highlighted in, with
+// the background tint it is drawn with.
+type HighlightColor struct {
+	Name string
+	CSS  string
+}
+
+var highlight_colors = []HighlightColor{
+	{Name: "yellow", CSS: "#fff3a0"},
+	{Name: "green", CSS: "#c8f0c0"},
+	{Name: "blue", CSS: "#c4e0ff"},
+	{Name: "pink", CSS: "#ffd0e4"},
+}
+
+// highlightCSS is the tint of a color name, or "" for one that isn't a
+// highlight color.
+func highlightCSS(name string) string {
+	for _, color := range highlight_colors {
+		if color.Name == name {
+			return color.CSS
+		}
+	}
+	return ""
+}
+
+// VerseHighlight is a verse a visitor colored in.
+type VerseHighlight struct {
+	Book    string
+	Chapter int
+	Verse   int
+	Color   string
+}
+
+func (h VerseHighlight) bookmark() Bookmark {
+	return Bookmark{Book: h.Book, Chapter: h.Chapter, Verse: h.Verse}
+}
+
+// encodeHighlights writes highlights, oldest first, like "JHN.3.16.yellow"
+// for the highlights cookie, dropping the oldest that don't fit.
+func encodeHighlights(highlights []VerseHighlight) string {
+	parts := make([]string, len(highlights))
+	size := 0
+	for i, highlight := range highlights {
+		parts[i] = highlight.bookmark().String() + "." + highlight.Color
+		size += len(parts[i]) + 1
+	}
+	for len(parts) > 0 && size-1 > cookie_value_size {
+		size -= len(parts[0]) + 1
+		parts = parts[1:]
+	}
+	return strings.Join(parts, "-")
+}
+
+// decodeHighlights reads the highlights cookie, skipping anything it doesn't
+// recognise.
+func decodeHighlights(value string) []VerseHighlight {
+	var highlights []VerseHighlight
+	for _, part := range strings.Split(value, "-") {
+		i := strings.LastIndexByte(part, '.')
+		if i < 0 || highlightCSS(part[i+1:]) == "" {
+			continue
+		}
+		bookmark, err := ParseBookmark(part[:i])
+		if err != nil || bookmark.Verse == 0 {
+			continue
+		}
+		highlights = append(highlights, VerseHighlight{Book: bookmark.Book, Chapter: bookmark.Chapter, Verse: bookmark.Verse, Color: part[i+1:]})
+	}
+	return highlights
+}
+
+// LoadHighlights returns all of the visitor's highlights, oldest first.
+func (s *Server) LoadHighlights(r *http.Request) []VerseHighlight {
+	if s.Store == nil {
+		value, _ := SignedCookie(r, "highlights")
+		return decodeHighlights(value)
+	}
+	user, ok := SignedCookie(r, "user")
+	if !ok {
+		return nil
+	}
+	highlights, err := s.Store.LoadHighlights(r.Context(), user)
+	if err != nil {
+		storeError(err)
+		return nil
+	}
+	return highlights
+}
+
+// ChapterHighlights returns the colors of the highlighted verses of one
+// chapter by verse number, with a single store query or cookie read.
+func (s *Server) ChapterHighlights(r *http.Request, book string, chapter int) map[int]string {
+	var highlights []VerseHighlight
+	if s.Store == nil {
+		value, _ := SignedCookie(r, "highlights")
+		highlights = decodeHighlights(value)
+	} else if user, ok := SignedCookie(r, "user"); ok {
+		var err error
+		highlights, err = s.Store.LoadChapterHighlights(r.Context(), user, book, chapter)
+		if err != nil {
+			storeError(err)
+		}
+	}
+	colors := map[int]string{}
+	for _, highlight := range highlights {
+		if highlight.Book == book && highlight.Chapter == chapter {
+			colors[highlight.Verse] = highlight.Color
+		}
+	}
+	return colors
+}
+
+// SaveHighlight colors a verse, or clears it when the color is "".
+func (s *Server) SaveHighlight(w http.ResponseWriter, r *http.Request, highlight VerseHighlight) error {
+	if s.Store == nil {
+		highlights := slices.DeleteFunc(s.LoadHighlights(r), func(h VerseHighlight) bool { return h.bookmark() == highlight.bookmark() })
+		if highlight.Color != "" {
+			highlights = append(highlights, highlight)
+		}
+		SetSignedCookie(w, r, "highlights", encodeHighlights(highlights))
+		return nil
+	}
+	if highlight.Color == "" {
+		user, ok := SignedCookie(r, "user")
+		if !ok {
+			return nil
+		}
+		return s.Store.DeleteHighlight(r.Context(), user, highlight)
+	}
+	return s.Store.SaveHighlight(r.Context(), UserToken(w, r), highlight)
+}
+
+// ChapterVerse is a verse of a chapter page with its highlight, if any.
+type ChapterVerse struct {
+	Number    int
+	Text      string
+	Reference string
+	Highlight string
+}
+
+// HighlightVerses merges a chapter's highlights into its verses.
+func HighlightVerses(verses []Verse, book Book, colors map[int]string) []ChapterVerse {
+	merged := make([]ChapterVerse, len(verses))
+	for i, verse := range verses {
+		merged[i] = ChapterVerse{
+			Number:    verse.Verse,
+			Text:      verse.Text,
+			Reference: Bookmark{Book: book.ID, Chapter: verse.Chapter, Verse: verse.Verse}.String(),
+			Highlight: highlightCSS(colors[verse.Verse]),
+		}
+	}
+	return merged
+}
+
+// postHighlight colors the verse in the form, or clears it with an empty
+// color, and goes back to the verse on the page the form was on.
+func (s *Server) postHighlight(w http.ResponseWriter, r *http.Request) {
+	translation := RequestTranslation(r)
+	bookmark, err := ParseBookmark(r.PostFormValue("verse"))
+	if err == nil && bookmark.Verse == 0 {
+		err = errors.New("a chapter can't be highlighted")
+	}
+	color := r.PostFormValue("color")
+	if err == nil && color != "" && highlightCSS(color) == "" {
+		err = fmt.Errorf("%q isn't a highlight color", color)
+	}
+	if err != nil {
+		s.fetchError(w, r, translation, "", fmt.Errorf("%w: %s", ErrInvalidHighlight, err))
+		return
+	}
+	err = s.checkBookmark(r.Context(), translation, bookmark)
+	if errors.Is(err, ErrInvalidBookmark) {
+		err = fmt.Errorf("%w: %s", ErrInvalidHighlight, err)
+	}
+	if err != nil {
+		s.fetchError(w, r, translation, "", err)
+		return
+	}
+
+	err = s.SaveHighlight(w, r, VerseHighlight{Book: bookmark.Book, Chapter: bookmark.Chapter, Verse: bookmark.Verse, Color: color})
+	if err != nil {
+		Logger(r.Context()).Error("saving highlight", "err", err)
+		s.renderError(w, r, http.StatusInternalServerError, "Your highlight couldn't be saved. Please try again.")
+		return
+	}
+	target := backURL(r, "")
+	if target == "" {
+		target = s.Path("highlights")
+	} else {
+		target += "#v" + strconv.Itoa(bookmark.Verse)
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+type HighlightItem struct {
+	Link    Link
+	Snippet string
+	Color   string
+}
+
+type HighlightGroup struct {
+	Book       string
+	Highlights []HighlightItem
+}
+
+// getHighlights lists the visitor's highlights grouped by book, in Bible
+// order.
+func (s *Server) getHighlights(w http.ResponseWriter, r *http.Request) {
+	translation := RequestTranslation(r)
+	var book_info BookInfo
+	err := s.Books.Get(r.Context(), translation, &book_info)
+	if err != nil {
+		s.fetchError(w, r, translation, "", err)
+		return
+	}
+
+	by_book := map[string][]VerseHighlight{}
+	for _, highlight := range s.LoadHighlights(r) {
+		by_book[highlight.Book] = append(by_book[highlight.Book], highlight)
+	}
+	var page HighlightsPage
+	for _, book := range book_info.Books {
+		highlights := by_book[book.ID]
+		if len(highlights) == 0 {
+			continue
+		}
+		slices.SortFunc(highlights, func(a VerseHighlight, b VerseHighlight) int {
+			if a.Chapter != b.Chapter {
+				return a.Chapter - b.Chapter
+			}
+			return a.Verse - b.Verse
+		})
+		group := HighlightGroup{Book: book.Name}
+		for _, highlight := range highlights {
+			group.Highlights = append(group.Highlights, s.highlightItem(r.Context(), translation, book, highlight))
+		}
+		page.Groups = append(page.Groups, group)
+	}
+	s.RenderPage(w, r, http.StatusOK, "highlights.html", "Highlights", page)
+}
+
+func (s *Server) highlightItem(ctx context.Context, translation string, book Book, highlight VerseHighlight) HighlightItem {
+	item := HighlightItem{Link: s.VerseLink(translation, book, highlight.Chapter, highlight.Verse), Color: highlightCSS(highlight.Color)}
+	var verse_info VerseInfo
+	var verse Verse
+	err := s.LoadVerse(ctx, translation, BookSlug(book.Name), strconv.Itoa(highlight.Chapter), highlight.Verse, &book, &verse_info, &verse)
+	if err == nil {
+		item.Snippet = Truncate(verseText(verse.Text), snippet_length)
+	}
+	return item
+}
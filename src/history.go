@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// max_history_size keeps the history cookie well under the 4096 bytes
+// browsers allow.
+const max_history_size = 100
+
+// history_size is how many chapters a visitor's reading history holds, set
+// with -history. 0 turns history off, for shared computers.
+var history_size = 20
+
+// HistoryEntry is a chapter a visitor read and when.
+type HistoryEntry struct {
+	Book    string
+	Chapter int
+	Viewed  time.Time
+}
+
+// encodeHistory writes entries, newest first, like "ROM.8.1760000000".
+func encodeHistory(entries []HistoryEntry) string {
+	parts := make([]string, len(entries))
+	for i, entry := range entries {
+		parts[i] = fmt.Sprintf("%s.%d.%d", entry.Book, entry.Chapter, entry.Viewed.Unix())
+	}
+	return strings.Join(parts, "-")
+}
+
+// decodeHistory reads the history cookie, skipping anything it doesn't
+// recognise.
+func decodeHistory(value string) []HistoryEntry {
+	var entries []HistoryEntry
+	for _, part := range strings.Split(value, "-") {
+		fields := strings.Split(part, ".")
+		if len(fields) != 3 || fields[0] == "" {
+			continue
+		}
+		chapter, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		viewed, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, HistoryEntry{Book: fields[0], Chapter: chapter, Viewed: time.Unix(viewed, 0).UTC()})
+	}
+	return entries
+}
+
+// LoadHistory returns the chapters the visitor read, newest first.
+func LoadHistory(r *http.Request) []HistoryEntry {
+	if history_size == 0 {
+		return nil
+	}
+	value, _ := SignedCookie(r, "history")
+	return decodeHistory(value)
+}
+
+// AddHistory moves a chapter to the front of the visitor's history, dropping
+// the oldest past history_size.
+func AddHistory(w http.ResponseWriter, r *http.Request, entry HistoryEntry) {
+	entries := []HistoryEntry{entry}
+	for _, old := range LoadHistory(r) {
+		if old.Book != entry.Book || old.Chapter != entry.Chapter {
+			entries = append(entries, old)
+		}
+	}
+	entries = entries[:min(len(entries), history_size)]
+	SetSignedCookie(w, r, "history", encodeHistory(entries))
+}
+
+// historyWriter adds to the visitor's history just before a successful
+// response's headers go out, when cookies can still be set.
+type historyWriter struct {
+	http.ResponseWriter
+	r       *http.Request
+	books   *BookCache
+	written bool
+}
+
+func (h *historyWriter) WriteHeader(status int) {
+	if !h.written {
+		h.written = true
+		if status == http.StatusOK {
+			h.record()
+		}
+	}
+	h.ResponseWriter.WriteHeader(status)
+}
+
+func (h *historyWriter) Write(p []byte) (int, error) {
+	if !h.written {
+		h.WriteHeader(http.StatusOK)
+	}
+	return h.ResponseWriter.Write(p)
+}
+
+func (h *historyWriter) record() {
+	vars := mux.Vars(h.r)
+	chapter, err := strconv.Atoi(vars["chapter"])
+	if err != nil {
+		return
+	}
+	var book Book
+	err = h.books.FindBook(h.r.Context(), RequestTranslation(h.r), vars["book"], &book)
+	if err != nil {
+		return
+	}
+	AddHistory(h.ResponseWriter, h.r, HistoryEntry{Book: book.ID, Chapter: chapter, Viewed: time.Now().UTC()})
+}
+
+// RecordHistory adds the chapter of a chapter or verse page to the
+// visitor's reading history, but only once the page has loaded, so errors
+// and missing chapters are left out. HEAD requests record nothing but are
+// Private too, so their headers match GET's.
+func (s *Server) RecordHistory(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if history_size == 0 {
+			next(w, r)
+			return
+		}
+		Private(w)
+		if r.Method != http.MethodGet {
+			next(w, r)
+			return
+		}
+		next(&historyWriter{ResponseWriter: w, r: r, books: s.Books}, r)
+	}
+}
+
+// ContinueLink is the "Continue reading" link to the chapter the visitor
+// read last, or nil if they haven't read any.
+func (s *Server) ContinueLink(w http.ResponseWriter, r *http.Request, translation string) *Link {
+	if history_size == 0 {
+		return nil
+	}
+	Private(w)
+	entries := LoadHistory(r)
+	if len(entries) == 0 {
+		return nil
+	}
+	var book Book
+	err := s.Books.BookByID(r.Context(), translation, entries[0].Book, &book)
+	if err != nil {
+		return nil
+	}
+	link := s.ChapterLink(translation, book, entries[0].Chapter)
+	link.Text = "Continue reading: " + link.Text
+	return &link
+}
+
+type HistoryItem struct {
+	Link   Link
+	Viewed time.Time
+}
+
+func (s *Server) getHistory(w http.ResponseWriter, r *http.Request) {
+	translation := RequestTranslation(r)
+	page := HistoryPage{Clear: s.Path("clear-history")}
+	for _, entry := range LoadHistory(r) {
+		item := HistoryItem{Link: Link{Text: fmt.Sprintf("%s %d", entry.Book, entry.Chapter)}, Viewed: entry.Viewed}
+		var book Book
+		if s.Books.BookByID(r.Context(), translation, entry.Book, &book) == nil {
+			item.Link = s.ChapterLink(translation, book, entry.Chapter)
+		}
+		page.Items = append(page.Items, item)
+	}
+	s.RenderPage(w, r, http.StatusOK, "history.html", "Reading history", page)
+}
+
+func (s *Server) postClearHistory(w http.ResponseWriter, r *http.Request) {
+	ClearCookie(w, "history")
+	redirectBack(w, r, s.Path("history"))
+}
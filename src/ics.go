@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// ics_line_length is the most octets RFC 5545 allows on one line before it
+// has to be folded.
+const ics_line_length = 75
+
+// CalendarEvent is one all-day event of an iCalendar feed.
+type CalendarEvent struct {
+	UID         string
+	Date        time.Time
+	Summary     string
+	Description string
+	URL         string
+}
+
+// ICSEscape escapes text for a TEXT property value: backslashes, commas,
+// semicolons and newlines.
+func ICSEscape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+// FoldICSLine breaks a content line into lines of at most 75 octets, each
+// continuation starting with a space, and ends every line with CRLF. It
+// only breaks between characters, never inside a UTF-8 sequence.
+func FoldICSLine(line string) string {
+	var b strings.Builder
+	limit := ics_line_length
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// the leading space counts towards the next line's length
+		limit = ics_line_length - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// WriteCalendar writes events as a VCALENDAR that calendar apps can
+// subscribe to. DTSTAMP is the event's own date so the output only changes
+// when the events do.
+func WriteCalendar(w io.Writer, name string, events []CalendarEvent) error {
+	var b strings.Builder
+	line := func(format string, args ...any) {
+		b.WriteString(FoldICSLine(fmt.Sprintf(format, args...)))
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//%s//Reading plans//EN", site_name)
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:%s", ICSEscape(name))
+	for _, event := range events {
+		day := event.Date.UTC().Truncate(24 * time.Hour)
+		line("BEGIN:VEVENT")
+		line("UID:%s", event.UID)
+		line("DTSTAMP:%s", day.Format("20060102T150405Z"))
+		line("DTSTART;VALUE=DATE:%s", day.Format("20060102"))
+		line("DTEND;VALUE=DATE:%s", day.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY:%s", ICSEscape(event.Summary))
+		if event.Description != "" {
+			line("DESCRIPTION:%s", ICSEscape(event.Description))
+		}
+		if event.URL != "" {
+			line("URL:%s", event.URL)
+		}
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// planStart reads the ?start= date of a plan calendar, defaulting to the
+// first of January this year so the calendar doesn't move from one fetch to
+// the next. The bool is false for a malformed date.
+func planStart(r *http.Request) (time.Time, bool) {
+	value := r.URL.Query().Get("start")
+	if value == "" {
+		return time.Date(time.Now().UTC().Year(), time.January, 1, 0, 0, 0, 0, time.UTC), true
+	}
+	date, err := time.Parse(time.DateOnly, value)
+	return date, err == nil
+}
+
+// PlanEvents lays a plan's days out from start, one event a day. origin is
+// the scheme and host the chapter links are made absolute with.
+func (s *Server) PlanEvents(plan Plan, start time.Time, origin string) []CalendarEvent {
+	host := strings.TrimPrefix(strings.TrimPrefix(origin, "https://"), "http://")
+	events := make([]CalendarEvent, len(plan.Days))
+	for i, day := range plan.Days {
+		var links []string
+		for _, chapter := range day.Chapters {
+			link := s.ChapterLink(plan.Translation, chapter.Book, chapter.Chapter)
+			links = append(links, link.Text+": "+origin+link.URL)
+		}
+		events[i] = CalendarEvent{
+			UID:         fmt.Sprintf("%s-%s-%s-day-%d@%s", plan.Slug, plan.Translation, start.Format("20060102"), day.Number, host),
+			Date:        start.AddDate(0, 0, i),
+			Summary:     day.Summary(),
+			Description: strings.Join(links, "\n"),
+			URL:         origin + s.PlanURL(plan.Translation, plan.Slug, day.Number),
+		}
+	}
+	return events
+}
+
+// getPlanCalendar serves /plans/{plan}/calendar.ics, which calendar apps can
+// subscribe to. ?start=2024-01-01 moves the first day.
+func (s *Server) getPlanCalendar(w http.ResponseWriter, r *http.Request) {
+	translation := RequestTranslation(r)
+	start, ok := planStart(r)
+	if !ok {
+		http.Error(w, "start must look like 2024-01-01.", http.StatusBadRequest)
+		return
+	}
+
+	var plan Plan
+	err := s.LoadPlan(r.Context(), translation, mux.Vars(r)["plan"], &plan)
+	if err != nil {
+		textError(w, r, err)
+		return
+	}
+	var buf bytes.Buffer
+	err = WriteCalendar(&buf, plan.Name, s.PlanEvents(plan, start, absoluteURL(r, "")))
+	if err != nil {
+		textError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", plan.Slug+".ics"))
+	w.Write(buf.Bytes())
+}
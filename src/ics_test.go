@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestICSEscape(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Psalms 1-5", "Psalms 1-5"},
+		{"Psalms 1-5; Proverbs 1", `Psalms 1-5\; Proverbs 1`},
+		{"Genesis 1, 2", `Genesis 1\, 2`},
+		{`C:\Bible`, `C:\\Bible`},
+		{"line one\nline two", `line one\nline two`},
+		{"line one\r\nline two", `line one\nline two`},
+		{`a\;b`, `a\\\;b`},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			if got := ICSEscape(test.text); got != test.want {
+				t.Errorf("ICSEscape(%q) = %q, want %q", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFoldICSLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"short", "SUMMARY:Psalms 1-5", "SUMMARY:Psalms 1-5\r\n"},
+		{"exactly 75", strings.Repeat("a", 75), strings.Repeat("a", 75) + "\r\n"},
+		{"76", strings.Repeat("a", 76), strings.Repeat("a", 75) + "\r\n a\r\n"},
+		{"three lines", strings.Repeat("a", 75+74+1), strings.Repeat("a", 75) + "\r\n " + strings.Repeat("a", 74) + "\r\n a\r\n"},
+		// ’ is three octets, and would straddle the 75th
+		{"multi-byte", strings.Repeat("a", 73) + "’b", strings.Repeat("a", 73) + "\r\n ’b\r\n"},
+		{"multi-byte at the end", strings.Repeat("a", 72) + "’b", strings.Repeat("a", 72) + "’\r\n b\r\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := FoldICSLine(test.line)
+			if got != test.want {
+				t.Errorf("FoldICSLine(%q) =\n%q\nwant\n%q", test.line, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFoldICSLineLimits(t *testing.T) {
+	for _, line := range []string{
+		strings.Repeat("Señor ", 40),
+		strings.Repeat("’", 100),
+		strings.Repeat("👋a", 60),
+		"DESCRIPTION:" + strings.Repeat("Genesis 1: https://example.com/genesis/1\\n", 10),
+	} {
+		folded := FoldICSLine(line)
+		if !strings.HasSuffix(folded, "\r\n") {
+			t.Errorf("FoldICSLine(%q) doesn't end with CRLF", line)
+		}
+		for i, part := range strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n") {
+			if len(part) > ics_line_length {
+				t.Errorf("line %d is %d octets: %q", i, len(part), part)
+			}
+			if !utf8.ValidString(part) {
+				t.Errorf("line %d splits a character: %q", i, part)
+			}
+			if i > 0 && !strings.HasPrefix(part, " ") {
+				t.Errorf("continuation line %d doesn't start with a space", i)
+			}
+		}
+		if unfolded := unfoldICS(folded); unfolded != line+"\r\n" {
+			t.Errorf("unfolds to %q, want %q", unfolded, line)
+		}
+	}
+}
+
+// unfoldICS undoes FoldICSLine, as RFC 5545 section 3.1 says.
+func unfoldICS(text string) string {
+	return strings.ReplaceAll(text, "\r\n ", "")
+}
+
+type icsProperty struct {
+	Name   string
+	Params string
+	Value  string
+}
+
+// icsComponent is a parsed BEGIN:...END: block, with the components nested
+// in it.
+type icsComponent struct {
+	Name       string
+	Properties []icsProperty
+	Components []*icsComponent
+}
+
+func (c *icsComponent) Get(name string) string {
+	for _, property := range c.Properties {
+		if property.Name == name {
+			return property.Value
+		}
+	}
+	return ""
+}
+
+func unescapeICS(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+			switch value[i] {
+			case 'n', 'N':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(value[i])
+			}
+			continue
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// parseICS reads an iCalendar document strictly enough to catch lines that
+// aren't folded, aren't CRLF terminated, or don't nest.
+func parseICS(t *testing.T, text string) *icsComponent {
+	t.Helper()
+	if !strings.HasSuffix(text, "\r\n") {
+		t.Fatalf("calendar doesn't end with CRLF")
+	}
+	for i, line := range strings.Split(strings.TrimSuffix(text, "\r\n"), "\r\n") {
+		if len(line) > ics_line_length {
+			t.Errorf("line %d is %d octets", i, len(line))
+		}
+		if strings.Contains(line, "\n") {
+			t.Errorf("line %d has a bare LF", i)
+		}
+	}
+	var stack []*icsComponent
+	var root *icsComponent
+	for _, line := range strings.Split(strings.TrimSuffix(unfoldICS(text), "\r\n"), "\r\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			t.Fatalf("line %q has no value", line)
+		}
+		name, params, _ := strings.Cut(name, ";")
+		switch name {
+		case "BEGIN":
+			component := &icsComponent{Name: value}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Components = append(parent.Components, component)
+			} else if root != nil {
+				t.Fatalf("second top level component %s", value)
+			} else {
+				root = component
+			}
+			stack = append(stack, component)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != value {
+				t.Fatalf("END:%s doesn't close anything", value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				t.Fatalf("property %s outside a component", name)
+			}
+			component := stack[len(stack)-1]
+			component.Properties = append(component.Properties, icsProperty{Name: name, Params: params, Value: unescapeICS(value)})
+		}
+	}
+	if len(stack) != 0 || root == nil {
+		t.Fatalf("calendar isn't closed")
+	}
+	return root
+}
+
+func TestWriteCalendarRoundTrip(t *testing.T) {
+	events := []CalendarEvent{
+		{UID: "a@example.com", Date: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), Summary: "Psalms 1-5; Proverbs 1", Description: "Psalms 1: https://example.com/psalms/1\nProverbs 1: https://example.com/proverbs/1", URL: "https://example.com/plans/psalms-proverbs/day/1"},
+		{UID: "b@example.com", Date: time.Date(2026, 1, 2, 15, 0, 0, 0, time.UTC), Summary: `Genesis 1, 2; C:\Bible`},
+		{UID: "c@example.com", Date: time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC), Summary: strings.Repeat("L’Éternel est mon berger; ", 8)},
+	}
+	var buf bytes.Buffer
+	err := WriteCalendar(&buf, "Psalms, and Proverbs; in a month", events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calendar := parseICS(t, buf.String())
+	if calendar.Name != "VCALENDAR" || calendar.Get("VERSION") != "2.0" || calendar.Get("PRODID") == "" {
+		t.Errorf("calendar %s, VERSION %q, PRODID %q", calendar.Name, calendar.Get("VERSION"), calendar.Get("PRODID"))
+	}
+	if name := calendar.Get("X-WR-CALNAME"); name != "Psalms, and Proverbs; in a month" {
+		t.Errorf("X-WR-CALNAME %q", name)
+	}
+	if len(calendar.Components) != len(events) {
+		t.Fatalf("%d components, want %d", len(calendar.Components), len(events))
+	}
+	for i, event := range calendar.Components {
+		want := events[i]
+		day := want.Date.UTC().Truncate(24 * time.Hour)
+		for name, value := range map[string]string{
+			"UID":         want.UID,
+			"SUMMARY":     want.Summary,
+			"DESCRIPTION": want.Description,
+			"URL":         want.URL,
+			"DTSTART":     day.Format("20060102"),
+			"DTEND":       day.AddDate(0, 0, 1).Format("20060102"),
+			"DTSTAMP":     day.Format("20060102T150405Z"),
+		} {
+			if got := event.Get(name); got != value {
+				t.Errorf("event %d: %s %q, want %q", i, name, got, value)
+			}
+		}
+		if event.Name != "VEVENT" {
+			t.Errorf("event %d is a %s", i, event.Name)
+		}
+	}
+}
+
+func TestPlanCalendar(t *testing.T) {
+	upstream, _ := bibleUpstream(t)
+	bible := NewBibleClient(upstream.URL)
+	bible.Retries = 0
+	s := NewServer(bible, nil)
+	handler := s.Routes(false, false)
+
+	w := get(t, handler, "/plans/psalms-proverbs/calendar.ics?start=2026-02-20")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if content_type := w.Header().Get("Content-Type"); content_type != "text/calendar; charset=utf-8" {
+		t.Errorf("Content-Type %q", content_type)
+	}
+	calendar := parseICS(t, w.Body.String())
+	if len(calendar.Components) != 31 {
+		t.Fatalf("%d events, want 31", len(calendar.Components))
+	}
+	uids := map[string]bool{}
+	for i, event := range calendar.Components {
+		day := time.Date(2026, 2, 20+i, 0, 0, 0, 0, time.UTC)
+		if start := event.Get("DTSTART"); start != day.Format("20060102") {
+			t.Errorf("day %d starts %s, want %s", i+1, start, day.Format("20060102"))
+		}
+		uid := event.Get("UID")
+		if uids[uid] || !strings.HasSuffix(uid, "@example.com") {
+			t.Errorf("day %d: UID %q", i+1, uid)
+		}
+		uids[uid] = true
+		if url := event.Get("URL"); url != fmt.Sprintf("http://example.com/plans/psalms-proverbs/day/%d", i+1) {
+			t.Errorf("day %d: URL %q", i+1, url)
+		}
+	}
+	first := calendar.Components[0]
+	if summary := first.Get("SUMMARY"); !strings.HasPrefix(summary, "PSA 1-") || !strings.HasSuffix(summary, "; PRO 1") {
+		t.Errorf("day 1 summary %q", summary)
+	}
+	if description := first.Get("DESCRIPTION"); !strings.HasPrefix(description, "PSA 1: http://example.com/psa/1\n") {
+		t.Errorf("day 1 description %q", description)
+	}
+
+	tests := []struct {
+		target string
+		status int
+	}{
+		{"/plans/psalms-proverbs/calendar.ics?start=20-02-2026", http.StatusBadRequest},
+		{"/plans/nope/calendar.ics", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if w := get(t, handler, test.target); w.Code != test.status {
+			t.Errorf("GET %s: status %d, want %d", test.target, w.Code, test.status)
+		}
+	}
+}
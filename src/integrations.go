@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// integration_deadline leaves room under the 3 seconds Slack and
+	// Discord give a webhook to answer in. Slower lookups answer later by
+	// another route.
+	integration_deadline = 2500 * time.Millisecond
+	// integration_late_timeout is how long a late lookup can keep going
+	// before it gives up.
+	integration_late_timeout = 30 * time.Second
+	// integration_retries is how many times a call to a chat service is
+	// retried after a network error, 429 or 5xx.
+	integration_retries = 2
+)
+
+var ErrBadSignature = errors.New("bad signature")
+
+// answerInTime runs lookup and returns its answer if it's ready within
+// integration_deadline. Otherwise it returns false, and late is given the
+// answer once there is one. The lookup outlives the request so it can
+// finish either way.
+func answerInTime[T any](r *http.Request, lookup func(context.Context) T, late func(context.Context, T)) (T, bool) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), integration_late_timeout)
+	answer := make(chan T, 1)
+	go func() {
+		defer cancel()
+		answer <- lookup(ctx)
+	}()
+
+	select {
+	case result := <-answer:
+		return result, true
+	case <-time.After(integration_deadline):
+		go func() {
+			late(context.WithoutCancel(r.Context()), <-answer)
+		}()
+		var zero T
+		return zero, false
+	}
+}
+
+// integrationErrorText explains err to whoever ran a chat command for text.
+func integrationErrorText(text string, err error) string {
+	if errors.Is(err, ErrInvalidReference) {
+		return fmt.Sprintf("%q isn't a reference like \"John 3:16\".", text)
+	}
+	_, message := ErrorStatus(err)
+	return message
+}
+
+// sendIntegration sends payload as JSON to a chat service's API, through
+// the same http.Client as upstream requests, retrying network errors, 429s
+// and 5xxs with backoff. header adds to the request's
+// headers and may be nil.
+func (s *Server) sendIntegration(ctx context.Context, method string, request_url string, header http.Header, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		wait, err := s.sendIntegrationOnce(ctx, method, request_url, header, body)
+		if err == nil {
+			return nil
+		}
+		if wait == 0 {
+			wait = backoff(attempt)
+		}
+		if attempt > integration_retries || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		Logger(ctx).Warn("retrying integration request", "attempt", attempt, "wait", wait, "err", err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// sendIntegrationOnce makes a single call, also returning how long a 429 or
+// 503 asked to be left alone for. Errors name the host but not the path,
+// which can hold a bot token.
+func (s *Server) sendIntegrationOnce(ctx context.Context, method string, request_url string, header http.Header, body []byte) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, method, request_url, bytes.NewReader(body))
+	if err != nil {
+		return 0, errors.New("bad integration URL")
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := s.Bible.HTTP.Do(req)
+	if err != nil {
+		var url_err *url.Error
+		if errors.As(err, &url_err) {
+			err = url_err.Err
+		}
+		return 0, fmt.Errorf("%w: %s %s: %w", ErrUpstreamUnavailable, method, req.URL.Host, err)
+	}
+	defer res.Body.Close()
+	message, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	if res.StatusCode < 300 {
+		return 0, nil
+	}
+	err = fmt.Errorf("%s %s returned %s: %s", method, req.URL.Host, res.Status, bytes.TrimSpace(message))
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+		err = fmt.Errorf("%w: %w", ErrUpstreamUnavailable, err)
+	}
+	return retryAfter(res.Header), err
+}
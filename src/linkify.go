@@ -0,0 +1,123 @@
+package main
+
+import (
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	// inline_reference_pattern finds references written in running text,
+	// like "Gen. 1:1", "1 Cor 13:4-7" or "Song of Solomon 2:1-3:5". Only
+	// references with a verse are matched, a bare "John 3" is too often
+	// just a name and a number.
+	inline_reference_pattern = regexp.MustCompile(`\b(?:([1-3]) ?)?([A-Z][a-z]+(?: of [A-Z][a-z]+)?)\.? (\d{1,3}):(\d{1,3})(?:[-–](\d{1,3})(?::(\d{1,3}))?)?\b`)
+	// clock_suffix_pattern spots "3:16 PM" after a match, which is a time
+	clock_suffix_pattern = regexp.MustCompile(`^\s?(?i:[ap]\.?m)\b`)
+	html_tag_pattern     = regexp.MustCompile(`<[^>]*>`)
+)
+
+// linkify_stop_words are abbreviations of books that are also everyday
+// words, so "It is 3:16" doesn't link to Isaiah.
+var linkify_stop_words = map[string]bool{
+	"is": true, "am": true, "he": true, "re": true, "mr": true, "pm": true,
+}
+
+// inlineBookID resolves the book of an inline reference from the usual
+// abbreviations or the full names of the default translation's books.
+func (s *Server) inlineBookID(name string) (string, bool) {
+	if linkify_stop_words[strings.ToLower(name)] {
+		return "", false
+	}
+	if id, ok := LookupAbbreviation(name); ok {
+		return id, true
+	}
+	var book_info BookInfo
+	if !s.Books.Peek(default_translation, &book_info) {
+		return "", false
+	}
+	for _, book := range book_info.Books {
+		if NormalizeSlug(book.Name) == NormalizeSlug(name) {
+			return book.ID, true
+		}
+	}
+	return "", false
+}
+
+// linkifyText wraps the references in a run of escaped text in links to
+// /passage.
+func (s *Server) linkifyText(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, match := range inline_reference_pattern.FindAllStringSubmatchIndex(text, -1) {
+		start, end := match[0], match[1]
+		if clock_suffix_pattern.MatchString(text[end:]) {
+			continue
+		}
+		name := text[match[4]:match[5]]
+		if match[2] >= 0 {
+			name = text[match[2]:match[3]] + " " + name
+		}
+		if _, ok := s.inlineBookID(name); !ok {
+			continue
+		}
+		ref, err := ParseReference(strings.ReplaceAll(text[start:end], ".", ""))
+		if err != nil {
+			continue
+		}
+		b.WriteString(text[last:start])
+		b.WriteString(`<a href="`)
+		b.WriteString(template.HTMLEscapeString(s.Path("reference") + "?ref=" + url.QueryEscape(ref.String())))
+		b.WriteString(`">`)
+		b.WriteString(text[start:end])
+		b.WriteString("</a>")
+		last = end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// LinkifyHTML links the references in HTML, leaving tags alone and not
+// nesting links inside links that are already there.
+func (s *Server) LinkifyHTML(html string) string {
+	var b strings.Builder
+	in_link := false
+	last := 0
+	for _, tag := range html_tag_pattern.FindAllStringIndex(html, -1) {
+		text := html[last:tag[0]]
+		if in_link {
+			b.WriteString(text)
+		} else {
+			b.WriteString(s.linkifyText(text))
+		}
+		name := strings.ToLower(html[tag[0]:tag[1]])
+		switch {
+		case strings.HasPrefix(name, "<a ") || name == "<a>":
+			in_link = true
+		case name == "</a>":
+			in_link = false
+		}
+		b.WriteString(html[tag[0]:tag[1]])
+		last = tag[1]
+	}
+	if in_link {
+		b.WriteString(html[last:])
+	} else {
+		b.WriteString(s.linkifyText(html[last:]))
+	}
+	return b.String()
+}
+
+// linkify is the template function that links references in text, which
+// is escaped first, or in HTML that already is.
+func (s *Server) linkify(value any) template.HTML {
+	switch value := value.(type) {
+	case template.HTML:
+		return template.HTML(s.LinkifyHTML(string(value)))
+	case string:
+		return template.HTML(s.LinkifyHTML(template.HTMLEscapeString(value)))
+	default:
+		return template.HTML(template.HTMLEscaper(value))
+	}
+}
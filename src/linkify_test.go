@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"html/template"
+	"testing"
+)
+
+// newLinkifyServer is a server that knows the fixture books' full names, as
+// it does once any page has loaded them.
+func newLinkifyServer(t *testing.T) *Server {
+	t.Helper()
+	s := NewServer(NewBibleClient(fakeUpstream(t).URL), nil)
+	var book_info BookInfo
+	err := s.Books.Get(context.Background(), default_translation, &book_info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestLinkify(t *testing.T) {
+	s := newLinkifyServer(t)
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"(see Gen. 1:1)", `(see <a href="/passage?ref=Gen+1%3A1">Gen. 1:1</a>)`},
+		{"Jn 3:16", `<a href="/passage?ref=Jn+3%3A16">Jn 3:16</a>`},
+		{"1 Cor 13:4-7", `<a href="/passage?ref=1+Cor+13%3A4-7">1 Cor 13:4-7</a>`},
+		{"1Cor 13:4", `<a href="/passage?ref=1Cor+13%3A4">1Cor 13:4</a>`},
+		{"Psalm 119:176", `<a href="/passage?ref=Psalm+119%3A176">Psalm 119:176</a>`},
+		{"Ps 23:1–6", `<a href="/passage?ref=Ps+23%3A1-6">Ps 23:1–6</a>`},
+		{"Song of Solomon 2:1-3:5", `<a href="/passage?ref=Song+of+Solomon+2%3A1-3%3A5">Song of Solomon 2:1-3:5</a>`},
+		{"(cf. Rom 5:8; 1 Jn 4:9)", `(cf. <a href="/passage?ref=Rom+5%3A8">Rom 5:8</a>; <a href="/passage?ref=1+Jn+4%3A9">1 Jn 4:9</a>)`},
+		{"Rev 22:21.", `<a href="/passage?ref=Rev+22%3A21">Rev 22:21</a>.`},
+		{"a & b Gen 1:1", `a &amp; b <a href="/passage?ref=Gen+1%3A1">Gen 1:1</a>`},
+		// times aren't references
+		{"meet at 3:16 PM", "meet at 3:16 PM"},
+		{"John 3:16pm", "John 3:16pm"},
+		{"John 3:16 am", "John 3:16 am"},
+		{"John 3:16 a.m.", "John 3:16 a.m."},
+		{"It is 3:16", "It is 3:16"},
+		{"AM 3:16", "AM 3:16"},
+		// nor are names without a verse, or books that don't exist
+		{"John 3", "John 3"},
+		{"Foo 3:16", "Foo 3:16"},
+		{"3:16", "3:16"},
+		{"John 3:0", "John 3:0"},
+		{"ratio 4:3", "ratio 4:3"},
+		// text is escaped before it's linked
+		{`<a href="/x">John 3:16</a>`, `&lt;a href=&#34;/x&#34;&gt;<a href="/passage?ref=John+3%3A16">John 3:16</a>&lt;/a&gt;`},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			if got := s.linkify(test.text); string(got) != test.want {
+				t.Errorf("linkify(%q) =\n%s\nwant\n%s", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestLinkifyHTML(t *testing.T) {
+	s := newLinkifyServer(t)
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{"between tags", "<p>See Jn 3:16.</p>", `<p>See <a href="/passage?ref=Jn+3%3A16">Jn 3:16</a>.</p>`},
+		{"inside an existing link", `<a href="/x">Jn 3:16</a> and Gen 1:1`, `<a href="/x">Jn 3:16</a> and <a href="/passage?ref=Gen+1%3A1">Gen 1:1</a>`},
+		{"inside a link with nested tags", `<A HREF="/x"><b>Jn 3:16</b></A>`, `<A HREF="/x"><b>Jn 3:16</b></A>`},
+		{"unclosed link", `<a href="/x">Jn 3:16`, `<a href="/x">Jn 3:16`},
+		{"attributes", `<span title="Jn 3:16">x</span>`, `<span title="Jn 3:16">x</span>`},
+		{"split by a tag", "Jn <b>3:16</b>", "Jn <b>3:16</b>"},
+		{"abbr isn't a link", `<abbr>Jn</abbr> Gen 1:1`, `<abbr>Jn</abbr> <a href="/passage?ref=Gen+1%3A1">Gen 1:1</a>`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := s.linkify(template.HTML(test.html)); string(got) != test.want {
+				t.Errorf("linkify(%q) =\n%s\nwant\n%s", test.html, got, test.want)
+			}
+		})
+	}
+}
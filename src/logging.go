@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type loggerKey struct{}
+
+// requestLog carries what the access log needs from deeper in the stack.
+// Logging runs before mux has matched a route, so recordRoute fills in the
+// route variables once it has.
+type requestLog struct {
+	route string
+	vars  map[string]string
+	// path is the request's path, with any secret_vars redacted
+	path string
+}
+
+// secret_vars are route variables that are credentials, like the secret
+// component of the Telegram webhook's path. They're logged as "REDACTED",
+// and so is the part of the path they came from.
+var secret_vars = map[string]bool{"secret": true}
+
+type requestLogKey struct{}
+
+// Logger returns the logger for a request, which tags every message with
+// the request's method, path and remote address.
+func Logger(ctx context.Context) *slog.Logger {
+	logger, ok := ctx.Value(loggerKey{}).(*slog.Logger)
+	if !ok {
+		return slog.Default()
+	}
+	return logger
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (s *statusWriter) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusWriter) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(p)
+	s.size += n
+	return n, err
+}
+
+func (s *statusWriter) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func requestLogger(r *http.Request, path string) *slog.Logger {
+	return slog.Default().With("method", r.Method, "path", path, "remote", remoteIP(r))
+}
+
+// Logging writes an access log line for every request and gives handlers a
+// request-scoped logger through Logger.
+func Logging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		logger := requestLogger(r, r.URL.Path)
+		entry := &requestLog{path: r.URL.Path}
+		ctx := context.WithValue(r.Context(), loggerKey{}, logger)
+		ctx = context.WithValue(ctx, requestLogKey{}, entry)
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+
+		observeRequest(entry.route, sw.status, time.Since(start))
+		if entry.path != r.URL.Path {
+			logger = requestLogger(r, entry.path)
+		}
+		logger.Info("request",
+			"route", entry.vars,
+			"status", sw.status,
+			"size", sw.size,
+			"duration", time.Since(start),
+		)
+	})
+}
+
+// recordRoute tells Logging which route matched and its variables. If any
+// are secret_vars, the request's logger is swapped for one with them
+// redacted from the path.
+func recordRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if entry, ok := r.Context().Value(requestLogKey{}).(*requestLog); ok {
+			entry.vars = mux.Vars(r)
+			if route := mux.CurrentRoute(r); route != nil {
+				entry.route, _ = route.GetPathTemplate()
+			}
+			redacted := false
+			for name, value := range entry.vars {
+				if secret_vars[name] && value != "" {
+					if !redacted {
+						entry.vars = maps.Clone(entry.vars)
+						redacted = true
+					}
+					entry.vars[name] = "REDACTED"
+					entry.path = strings.ReplaceAll(entry.path, value, "REDACTED")
+				}
+			}
+			if redacted {
+				ctx := context.WithValue(r.Context(), loggerKey{}, requestLogger(r, entry.path))
+				r = r.WithContext(ctx)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ParseLogLevel reads -log-level values like "debug" or "warn".
+func ParseLogLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(name))
+	return level, err
+}
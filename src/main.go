@@ -1,29 +1,63 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
-	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 type Translation struct {
 	Identifier   string `json:"identifier"`
 	Name         string `json:"name"`
 	Language     string `json:"language"`
-	LanguageCode string `json:"langauge_code"`
+	LanguageCode string `json:"language_code"`
 	License      string `json:"license"`
 }
 
+// UnmarshalJSON accepts bible-api.com's misspelled "langauge_code" as well as
+// "language_code", preferring the correct spelling if both are present.
+func (t *Translation) UnmarshalJSON(data []byte) error {
+	type plain Translation
+	var aux struct {
+		plain
+		Misspelled string `json:"langauge_code"`
+	}
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+	*t = Translation(aux.plain)
+	if t.LanguageCode == "" {
+		t.LanguageCode = aux.Misspelled
+	}
+	return nil
+}
+
 type Book struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
-	URL  string `json:"url"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	Testament string `json:"testament,omitempty"`
+	Slug      string `json:"slug,omitempty"`
 }
 
 type BookInfo struct {
@@ -46,8 +80,8 @@ type ChapterInfo struct {
 type Verse struct {
 	BookID   string `json:"book_id"`
 	BookName string `json:"book_name"`
-	Chapter  int8   `json:"chapter"`
-	Verse    int8   `json:"verse"`
+	Chapter  int    `json:"chapter"`
+	Verse    int    `json:"verse"`
 	Text     string `json:"text"`
 }
 
@@ -56,183 +90,912 @@ type VerseInfo struct {
 	Verses      []Verse     `json:"verses"`
 }
 
-func APIResponse(url string) (*http.Response, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
+type TranslationList struct {
+	Translations []Translation `json:"translations"`
+}
+
+func (l TranslationList) Has(identifier string) bool {
+	for _, t := range l.Translations {
+		if t.Identifier == identifier {
+			return true
+		}
 	}
+	return false
+}
+
+var default_translation = "web"
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("invalid request")
+// LoadChapters resolves a book slug and fetches its chapter list. It is shared
+// by the HTML and JSON handlers.
+func (s *Server) LoadChapters(ctx context.Context, translation string, slug string, book *Book, chapter_info *ChapterInfo) error {
+	err := s.Books.FindBook(ctx, translation, slug, book)
+	if err != nil {
+		return err
 	}
-	return resp, err
+	return s.Chapters.Get(ctx, translation, book.ID, chapter_info)
 }
 
-func GetBookInfo(book_info *BookInfo) error {
-	resp, err := APIResponse("https://bible-api.com/data/web")
+// LoadVerses resolves a book slug and fetches the verses of one chapter.
+// The chapter is checked against the cached chapter list first, so a bad
+// one never reaches bible-api.com.
+func (s *Server) LoadVerses(ctx context.Context, translation string, slug string, chapter string, book *Book, verse_info *VerseInfo) error {
+	number, err := ParseNumber("chapter", chapter)
+	if err != nil {
+		return err
+	}
+	err = s.Books.FindBook(ctx, translation, slug, book)
+	if err != nil {
+		return err
+	}
+	err = s.CheckChapter(ctx, translation, *book, number)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+	return s.Bible.GetVerseInfo(ctx, translation, book.ID, strconv.Itoa(number), verse_info)
+}
 
-	err = json.NewDecoder(resp.Body).Decode(&book_info)
+// CheckChapter returns a ChapterNotFoundError if book has fewer than
+// chapter chapters.
+func (s *Server) CheckChapter(ctx context.Context, translation string, book Book, chapter int) error {
+	var chapter_info ChapterInfo
+	err := s.Chapters.Get(ctx, translation, book.ID, &chapter_info)
 	if err != nil {
 		return err
 	}
+	if chapter > len(chapter_info.Chapters) {
+		return &ChapterNotFoundError{Book: book.Name, Chapter: chapter, Last: len(chapter_info.Chapters)}
+	}
 	return nil
 }
 
-func GetChapterInfo(book string, chapter_info *ChapterInfo) error {
-	url := fmt.Sprintf("https://bible-api.com/data/web/%s", book)
-	resp, err := APIResponse(url)
+func (s *Server) ChapterLink(translation string, book Book, chapter int) Link {
+	return Link{
+		Text: fmt.Sprintf("%s %d", book.Name, chapter),
+		URL:  s.TranslationPath(translation, "chapter", "book", BookSlug(book.Name), "chapter", strconv.Itoa(chapter)),
+	}
+}
+
+// Breadcrumbs builds the "Bible › John › Chapter 3" trail. book may be nil
+// and chapter 0 to stop the trail early.
+func (s *Server) Breadcrumbs(translation string, book *Book, chapter int) []Link {
+	crumbs := []Link{{Text: "Bible", URL: s.TranslationPath(translation, "books")}}
+	if book == nil {
+		return crumbs
+	}
+	crumbs = append(crumbs, s.BookLink(translation, *book))
+	if chapter > 0 {
+		link := s.ChapterLink(translation, *book, chapter)
+		link.Text = fmt.Sprintf("Chapter %d", chapter)
+		crumbs = append(crumbs, link)
+	}
+	return crumbs
+}
+
+// ChapterNavigation returns the links to the chapters either side of chapter,
+// crossing into the next book after a book's last chapter. Either link is
+// nil at the ends of the Bible.
+func (s *Server) ChapterNavigation(ctx context.Context, translation string, book Book, chapter int) (*Link, *Link) {
+	var previous, next *Link
+	if chapter > 1 {
+		link := s.ChapterLink(translation, book, chapter-1)
+		link.Text = fmt.Sprintf("← Chapter %d", chapter-1)
+		previous = &link
+	}
+
+	var chapter_info ChapterInfo
+	err := s.Chapters.Get(ctx, translation, book.ID, &chapter_info)
 	if err != nil {
-		return err
+		Logger(ctx).Warn("no next chapter link", "err", err)
+		return previous, nil
+	}
+	if chapter < len(chapter_info.Chapters) {
+		link := s.ChapterLink(translation, book, chapter+1)
+		link.Text = fmt.Sprintf("Chapter %d →", chapter+1)
+		return previous, &link
 	}
-	defer resp.Body.Close()
 
-	err = json.NewDecoder(resp.Body).Decode(&chapter_info)
+	var book_info BookInfo
+	err = s.Books.Get(ctx, translation, &book_info)
 	if err != nil {
-		return err
+		Logger(ctx).Warn("no next book link", "err", err)
+		return previous, nil
 	}
-	return nil
+	for i, b := range book_info.Books {
+		if b.ID == book.ID && i+1 < len(book_info.Books) {
+			link := s.ChapterLink(translation, book_info.Books[i+1], 1)
+			link.Text += " →"
+			next = &link
+		}
+	}
+	return previous, next
 }
 
-func GetVerseInfo(book string, chapter string, verse_info *VerseInfo) error {
-	url := fmt.Sprintf("https://bible-api.com/data/asv/%s/%v", book, chapter)
-	resp, err := APIResponse(url)
+// LoadVerse fetches a single verse, reporting a VerseNotFoundError when the
+// chapter is shorter than that.
+func (s *Server) LoadVerse(ctx context.Context, translation string, slug string, chapter string, number int, book *Book, verse_info *VerseInfo, verse *Verse) error {
+	if number < 1 {
+		return &InvalidNumberError{Kind: "verse", Value: strconv.Itoa(number)}
+	}
+	err := s.LoadVerses(ctx, translation, slug, chapter, book, verse_info)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+	for _, v := range verse_info.Verses {
+		if v.Verse == number {
+			*verse = v
+			return nil
+		}
+	}
+	return &VerseNotFoundError{Reference: fmt.Sprintf("%s %s", book.Name, chapter), Verse: number, Last: LastVerse(verse_info.Verses)}
+}
+
+func (s *Server) VerseLink(translation string, book Book, chapter int, verse int) Link {
+	return Link{
+		Text: fmt.Sprintf("%s %d:%d", book.Name, chapter, verse),
+		URL:  s.TranslationPath(translation, "verse", "book", BookSlug(book.Name), "chapter", strconv.Itoa(chapter), "verse", strconv.Itoa(verse)),
+	}
+}
+
+// BookSlug is the canonical URL form of a book name, like
+// "song-of-solomon". Other spellings redirect to it, see CanonicalBook.
+func BookSlug(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(strings.ReplaceAll(name, ".", ""))), "-")
+}
+
+// RequestTranslation is the translation named by a /kjv/... prefix or a
+// ?translation= parameter, or the default.
+func RequestTranslation(r *http.Request) string {
+	translation := mux.Vars(r)["translation"]
+	if translation == "" {
+		translation = r.URL.Query().Get("translation")
+	}
+	if translation == "" {
+		return default_translation
+	}
+	return strings.ToLower(translation)
+}
+
+// base_path is where the site lives when a reverse proxy serves it below
+// the root, like "/bible". It is empty or starts with a slash, never ending
+// in one.
+var base_path = ""
+
+// SitePath joins elem onto base_path. A trailing slash on the last element
+// is kept, so SitePath("/") is the site root. Links to pages are built from
+// their routes with Server.Path. SitePath is for the paths that aren't one
+// route's: the request's own path, the cookie path, robots.txt's prefixes
+// and the API's versioned paths.
+func SitePath(elem ...string) string {
+	p := path.Join(append([]string{"/", base_path}, elem...)...)
+	if len(elem) > 0 && strings.HasSuffix(elem[len(elem)-1], "/") && p != "/" {
+		p += "/"
+	}
+	return p
+}
 
-	err = json.NewDecoder(resp.Body).Decode(&verse_info)
+// Path is the path to the route called name, under base_path, with pairs
+// of variable names and values filled in as for mux.Route.URLPath. Values
+// are escaped, so each stays one path segment. A route that doesn't exist
+// or doesn't take the values is a mistake in the code, so it panics.
+func (s *Server) Path(name string, pairs ...string) string {
+	route := s.routes.Load().Get(name)
+	if route == nil {
+		panic("no route called " + name)
+	}
+	escaped := slices.Clone(pairs)
+	for i := 1; i < len(escaped); i += 2 {
+		escaped[i] = url.PathEscape(escaped[i])
+	}
+	u, err := route.URLPath(escaped...)
 	if err != nil {
-		return err
+		panic(fmt.Sprintf("link to %s: %v", name, err))
 	}
-	return nil
+	return SitePath(u.Path)
 }
 
-func HtmlStart(w http.ResponseWriter, title string) {
-	fmt.Fprintf(w, `
-	<!DOCTYPE html>
-	<html>
-	<head>
-		<title>%s</title>
-	</head>
-	<body>
-	`, title)
+// TranslationPath builds every link inside a translation so the chosen
+// translation survives navigation. The default translation keeps the short
+// URLs, the others use the pages under /{translation}.
+func (s *Server) TranslationPath(translation string, name string, pairs ...string) string {
+	if translation == default_translation {
+		return s.Path(name, pairs...)
+	}
+	return s.Path(translated_route+name, append([]string{"translation", translation}, pairs...)...)
 }
 
-func HtmlEnd(w http.ResponseWriter) {
-	fmt.Fprint(w, `
-	</body>
-	</html>
-	`)
+// isTranslationPath matches paths whose first segment is a translation, so
+// /kjv/john is read as a book in the KJV rather than John in chapter "john".
+func (s *Server) isTranslationPath(r *http.Request, rm *mux.RouteMatch) bool {
+	first, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	return first != "" && s.Translations.Has(r.Context(), strings.ToLower(first))
 }
 
-func getBooks(w http.ResponseWriter, r *http.Request) {
-	var book_info BookInfo
-	err := GetBookInfo(&book_info)
+func (s *Server) getTranslations(w http.ResponseWriter, r *http.Request) {
+	var translation_list TranslationList
+	err := s.Translations.Get(r.Context(), &translation_list)
 	if err != nil {
-		http.NotFound(w, r)
-		fmt.Println(err)
+		s.fetchError(w, r, default_translation, "", err)
 		return
 	}
-	HtmlStart(w, "ASV Bible")
-	for _, book := range book_info.Books {
-		io.WriteString(w, fmt.Sprintf("<a href=\"/%s\">%s</a> <br>", strings.ReplaceAll(strings.ToLower(book.Name), " ", ""), book.Name))
+
+	var page TranslationsPage
+	for _, t := range translation_list.Translations {
+		page.Translations = append(page.Translations, TranslationRow{
+			Translation: t,
+			Books:       Link{Text: "Books", URL: s.TranslationPath(t.Identifier, "books")},
+			Sample:      Link{Text: "John 3", URL: s.TranslationPath(t.Identifier, "chapter", "book", "john", "chapter", "3")},
+		})
 	}
-	HtmlEnd(w)
-	// show all books
+	s.RenderPage(w, r, http.StatusOK, "translations.html", "Translations", page)
 }
 
-func getChapters(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	book_name := vars["book"]
+// fetchError reports a failed page load. Unknown books get suggestions, and
+// when the requested translation doesn't exist upstream the user is told
+// which ones do.
+func (s *Server) fetchError(w http.ResponseWriter, r *http.Request, translation string, slug string, err error) {
+	if errors.Is(err, context.Canceled) {
+		// the client went away, there is nobody to answer
+		return
+	}
+	Logger(r.Context()).Error("request failed", "err", err)
+
+	var ambiguous *AmbiguousBookError
+	if errors.As(err, &ambiguous) {
+		page := AmbiguousBookPage{Slug: ambiguous.Slug}
+		for _, book := range ambiguous.Candidates {
+			page.Candidates = append(page.Candidates, s.BookLink(translation, book))
+		}
+		s.RenderPage(w, r, http.StatusMultipleChoices, "ambiguous_book.html", "Which book?", page)
+		return
+	}
+
+	if errors.Is(err, ErrBookNotFound) {
+		var book_info BookInfo
+		s.Books.Get(r.Context(), translation, &book_info)
+		s.bookNotFound(w, r, translation, slug, book_info.Books)
+		return
+	}
+
+	if errors.Is(err, ErrNotFound) {
+		var translation_list TranslationList
+		if s.Translations.Get(r.Context(), &translation_list) == nil && !translation_list.Has(translation) {
+			page := UnknownTranslationPage{Requested: translation}
+			for _, t := range translation_list.Translations {
+				page.Translations = append(page.Translations, Link{Text: t.Identifier + " - " + t.Name, URL: s.TranslationPath(t.Identifier, "books")})
+			}
+			s.RenderPage(w, r, http.StatusBadRequest, "unknown_translation.html", "Unknown translation", page)
+			return
+		}
+	}
+
+	status, message := ErrorStatus(err)
+	s.renderError(w, r, status, message)
+}
+
+func (s *Server) bookNotFound(w http.ResponseWriter, r *http.Request, translation string, slug string, books []Book) {
+	page := BookNotFoundPage{Slug: slug, IndexURL: s.TranslationPath(translation, "books")}
+	for _, book := range SuggestBooks(slug, books) {
+		page.Suggestions = append(page.Suggestions, s.BookLink(translation, book))
+	}
+	s.RenderPage(w, r, http.StatusNotFound, "book_not_found.html", "Book not found", page)
+}
+
+func (s *Server) BookLink(translation string, book Book) Link {
+	return Link{Text: book.Name, URL: s.TranslationPath(translation, "book", "book", BookSlug(book.Name))}
+}
+
+func (s *Server) getBooks(w http.ResponseWriter, r *http.Request) {
+	s.renderBooks(w, r, http.StatusOK, BooksPage{})
+}
+
+// renderBooks shows the index, filling in the book list for the request's
+// translation. The jump box comes back to it with Ref and Error set when a
+// reference can't be read.
+func (s *Server) renderBooks(w http.ResponseWriter, r *http.Request, status int, page BooksPage) {
+	translation := RequestTranslation(r)
 	var book_info BookInfo
-	err := GetBookInfo(&book_info)
+	err := s.Books.Get(r.Context(), translation, &book_info)
 	if err != nil {
-		http.NotFound(w, r)
-		fmt.Println(err)
+		s.fetchError(w, r, translation, "", err)
 		return
 	}
 
-	var book_code string
+	if translation != default_translation {
+		page.Translation = translation
+	}
+	page.Continue = s.ContinueLink(w, r, translation)
+	sections := map[string][]TimedLink{}
 	for _, book := range book_info.Books {
-		//fmt.Println(strings.ReplaceAll(strings.ToLower(book.Name), " ", ""))
-		if strings.Compare(strings.ReplaceAll(strings.ToLower(book.Name), " ", ""), book_name) == 0 {
-			book_code = book.ID
+		link := TimedLink{Link: s.BookLink(translation, book)}
+		var chapter_info ChapterInfo
+		if s.Chapters.Peek(translation, book.ID, &chapter_info) {
+			if words, ok := word_counts.Book(translation, book.ID, chapter_info.Chapters); ok {
+				link.ReadingTime = ReadingTime(words)
+			}
 		}
+		sections[book.Testament] = append(sections[book.Testament], link)
 	}
+	for _, testament := range testament_order {
+		if len(sections[testament]) > 0 {
+			page.Sections = append(page.Sections, BookSection{Title: testament_names[testament], Books: sections[testament]})
+		}
+	}
+	s.RenderPage(w, r, status, "books.html", book_info.Translation.Name, page)
+}
 
+func (s *Server) getChapters(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	book_name := vars["book"]
+	translation := RequestTranslation(r)
+
+	var book Book
 	var chapter_info ChapterInfo
-	err = GetChapterInfo(book_code, &chapter_info)
+	err := s.LoadChapters(r.Context(), translation, book_name, &book, &chapter_info)
 	if err != nil {
-		http.NotFound(w, r)
-		fmt.Println(err)
+		s.fetchError(w, r, translation, book_name, err)
 		return
 	}
-	HtmlStart(w, chapter_info.Chapters[0].Book)
+
+	page := ChaptersPage{Breadcrumbs: s.Breadcrumbs(translation, &book, 0)}
+	page.Full = Link{Text: "Read the whole book", URL: s.TranslationPath(translation, "full", "book", BookSlug(book.Name))}
 	for _, chapter := range chapter_info.Chapters {
-		io.WriteString(w, fmt.Sprintf("<a href=\"%s/%v\">%v</a> <br>", r.URL.Path, chapter.Chapter, chapter.Chapter))
+		link := TimedLink{Link: s.ChapterLink(translation, book, chapter.Chapter)}
+		link.Text = strconv.Itoa(chapter.Chapter)
+		if words, ok := word_counts.Chapter(translation, book.ID, chapter.Chapter); ok {
+			link.ReadingTime = ReadingTime(words)
+		}
+		page.Chapters = append(page.Chapters, link)
 	}
-	HtmlEnd(w)
-	// only show chapters
+	s.RenderPage(w, r, http.StatusOK, "chapters.html", book.Name, page)
 }
 
-func getVerses(w http.ResponseWriter, r *http.Request) {
+func (s *Server) getVerses(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("print") == "1" {
+		s.getPrint(w, r)
+		return
+	}
 	vars := mux.Vars(r)
 	book_name := vars["book"]
 	chapter := vars["chapter"]
+	translation := RequestTranslation(r)
 
-	var book_info BookInfo
-	err := GetBookInfo(&book_info)
+	var book Book
+	var verse_info VerseInfo
+	err := s.LoadVerses(r.Context(), translation, book_name, chapter, &book, &verse_info)
 	if err != nil {
-		http.NotFound(w, r)
-		fmt.Println(err)
+		s.fetchError(w, r, translation, book_name, err)
 		return
 	}
 
-	var book_code string
-	for _, book := range book_info.Books {
+	page := VersesPage{ReadingTime: ReadingTime(VerseWords(verse_info.Verses)), Mode: ReadingMode(w, r), Colors: highlight_colors, Highlights: s.Path("highlights")}
+	page.Modes = ModeLinks(r, page.Mode)
+	page.Print = s.TranslationPath(translation, "print", "book", BookSlug(book.Name), "chapter", chapter)
+	var colors map[int]string
+	chapter_number, err := strconv.Atoi(chapter)
+	if err == nil {
+		colors = s.ChapterHighlights(r, book.ID, chapter_number)
+		page.Breadcrumbs = s.Breadcrumbs(translation, &book, chapter_number)
+		page.Previous, page.Next = s.ChapterNavigation(r.Context(), translation, book, chapter_number)
+		page.Bookmark = s.NewBookmarkForm(w, r, book, chapter_number, 0)
+	}
+	page.Verses = HighlightVerses(verse_info.Verses, book, colors)
+	if page.Mode == ModeParagraph {
+		page.Paragraphs = Paragraphs(page.Verses)
+	}
+	s.RenderPage(w, r, http.StatusOK, "verses.html", fmt.Sprintf("%s %s", book.Name, chapter), page)
+}
 
-		if strings.Compare(strings.ReplaceAll(strings.ToLower(book.Name), " ", ""), book_name) == 0 {
+func (s *Server) getPassage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	book_name := vars["book"]
+	chapter := vars["chapter"]
+	translation := RequestTranslation(r)
 
-			book_code = book.ID
-		}
+	ranges, err := ParseVerseRanges(vars["verses"])
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, fmt.Sprintf("\"%s\" isn't a verse or range of verses.", vars["verses"]))
+		return
 	}
 
+	var book Book
 	var verse_info VerseInfo
-	err = GetVerseInfo(book_code, chapter, &verse_info)
+	err = s.LoadVerses(r.Context(), translation, book_name, chapter, &book, &verse_info)
 	if err != nil {
-		http.NotFound(w, r)
-		fmt.Println(err)
+		s.fetchError(w, r, translation, book_name, err)
 		return
 	}
-	HtmlStart(w, chapter)
-	for _, verse := range verse_info.Verses {
-		io.WriteString(w, fmt.Sprintf("%v : %s<br>", verse.Verse, verse.Text))
+
+	title := fmt.Sprintf("%s %s:%s", book.Name, chapter, FormatVerseRanges(ranges))
+	page := PassagePage{Reference: title, Total: len(verse_info.Verses), Poetry: ReadingMode(w, r) == ModePoetry}
+	chapter_number, err := strconv.Atoi(chapter)
+	if err == nil {
+		page.Breadcrumbs = s.Breadcrumbs(translation, &book, chapter_number)
+	}
+	page.Verses = PassageVerses(verse_info.Verses, ranges)
+	page.Print = s.TranslationPath(translation, "print", "book", BookSlug(book.Name), "chapter", chapter) + "?verses=" + url.QueryEscape(FormatVerseRanges(ranges))
+	page.Social = NewSocialMeta(title, page.Verses)
+	status := http.StatusOK
+	if len(page.Verses) == 0 {
+		// the page says which verses the chapter does have
+		status = http.StatusNotFound
 	}
-	HtmlEnd(w)
-	// show verses and values
+	s.RenderPage(w, r, status, "passage.html", title, page)
 }
 
-func getPassage(w http.ResponseWriter, r *http.Request) {
-	// later, plan if i need this rn
+func (s *Server) getVerse(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	book_name := vars["book"]
+	chapter := vars["chapter"]
+	translation := RequestTranslation(r)
+
+	number, err := strconv.Atoi(vars["verse"])
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, fmt.Sprintf("\"%s\" isn't a verse number.", vars["verse"]))
+		return
+	}
+
+	var book Book
+	var verse_info VerseInfo
+	var verse Verse
+	err = s.LoadVerse(r.Context(), translation, book_name, chapter, number, &book, &verse_info, &verse)
+	if err != nil {
+		s.fetchError(w, r, translation, book_name, err)
+		return
+	}
+
+	page := VersePage{Verse: verse}
+	page.Reference = fmt.Sprintf("%s %d:%d", book.Name, verse.Chapter, verse.Verse)
+	page.Breadcrumbs = s.Breadcrumbs(translation, &book, verse.Chapter)
+	page.Chapter = s.ChapterLink(translation, book, verse.Chapter)
+	page.Chapter.Text = "Read all of " + page.Chapter.Text
+	page.Cite = s.CiteLink(translation, book, verse.Chapter, verse.Verse)
+	page.CrossRefs = s.CrossRefLinks(r.Context(), translation, book, verse.Chapter, verse.Verse)
+	page.Bookmark = s.NewBookmarkForm(w, r, book, verse.Chapter, verse.Verse)
+	page.Note = s.NewNoteForm(w, r, translation, book, verse.Chapter, verse.Verse)
+	page.Social = NewSocialMeta(page.Reference, []Verse{verse})
+	page.Social.Image = absoluteURL(r, s.ShareImagePath(translation, book, verse.Chapter, verse.Verse))
+	page.OEmbed = s.OEmbedPath(r)
+	previous, next := AdjacentVerses(verse_info.Verses, number)
+	if previous != 0 {
+		link := s.VerseLink(translation, book, verse.Chapter, previous)
+		link.Text = "← " + link.Text
+		page.Previous = &link
+	}
+	if next != 0 {
+		link := s.VerseLink(translation, book, verse.Chapter, next)
+		link.Text += " →"
+		page.Next = &link
+	}
+	s.RenderPage(w, r, http.StatusOK, "verse.html", page.Reference, page)
+}
+
+func envString(key string, fallback string) string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	return value
+}
+
+// Listen opens addr, which is a TCP address like ":3000" or a Unix socket
+// path written as "unix:/run/bible.sock". A socket file left behind by an
+// earlier run is removed first.
+func Listen(addr string) (net.Listener, error) {
+	path, is_unix := strings.CutPrefix(addr, "unix:")
+	if !is_unix {
+		return net.Listen("tcp", addr)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("%q has no socket path", addr)
+	}
+	info, err := os.Stat(path)
+	if err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	return net.Listen("unix", path)
+}
+
+// listenPort is the TCP port a listener is on, or "" for a Unix socket.
+func listenPort(listener net.Listener) string {
+	addr, ok := listener.Addr().(*net.TCPAddr)
+	if !ok {
+		return ""
+	}
+	return strconv.Itoa(addr.Port)
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("%s: %v", key, err)
+	}
+	return d
 }
 
 func main() {
-	m := mux.NewRouter()
-	m.HandleFunc("/", getBooks)
-	m.HandleFunc("/{book}", getChapters)
-	m.HandleFunc("/{book}/{chapter}", getVerses)
-	// later
-	m.HandleFunc("/{book}{chapter}/{verses}", getPassage)
-
-	err := http.ListenAndServe(":3000", m)
-	if errors.Is(err, http.ErrServerClosed) {
-		fmt.Printf("server closed\n")
-	} else {
-		log.Fatal(err)
+	bible := NewBibleClient("https://bible-api.com")
+	flag.StringVar(&default_translation, "translation", default_translation, "translation used when a request doesn't pick one with a /kjv/ style prefix or ?translation=")
+	upstreams := flag.String("upstream", bible.BaseURL, "base URL of bible-api.com or a mirror of it, or a comma separated list to fall back through in order when the first can't be reached")
+	flag.DurationVar(&bible.HTTP.Timeout, "upstream-timeout", envDuration("BIBLE_APP_UPSTREAM_TIMEOUT", 10*time.Second), "timeout for requests to bible-api.com")
+	flag.IntVar(&bible.Retries, "upstream-retries", bible.Retries, "how many times to retry a failed request to bible-api.com")
+	flag.DurationVar(&bible.RetryBudget, "upstream-retry-budget", bible.RetryBudget, "longest time to keep retrying one request to bible-api.com")
+	flag.IntVar(&bible.BreakerFailures, "circuit-failures", bible.BreakerFailures, "failed requests in a row to an upstream host before requests to it fail straight away for -circuit-cooldown, 0 to keep trying")
+	flag.DurationVar(&bible.BreakerCooldown, "circuit-cooldown", bible.BreakerCooldown, "how long requests to an upstream host fail straight away once -circuit-failures is reached, before one is let through to check on it")
+	flag.IntVar(&reading_speed, "reading-speed", reading_speed, "words per minute reading time estimates assume")
+	no_crossrefs := flag.Bool("no-crossrefs", false, "don't list cross references under verses")
+	flag.IntVar(&history_size, "history", history_size, "how many recently read chapters to remember for each visitor, 0 turns reading history off for shared computers")
+	crawl_interval := flag.Duration("crawl-interval", 250*time.Millisecond, "pause between upstream requests while building the search index")
+	db_path := flag.String("db", "", "SQLite file to keep fetched chapters in, so they survive restarts")
+	prefetch := flag.Bool("prefetch", false, "fetch every chapter of -translation into -db, then exit")
+	data_path := flag.String("data", "", "serve a translation from a local JSON dump instead of bible-api.com")
+	download_path := flag.String("download", "", "write -translation to this file as a JSON dump for -data, then exit")
+	index_at_startup := flag.Bool("index-at-startup", false, "build the search index when the server starts instead of on the first search")
+	book_ttl := flag.Duration("book-ttl", 24*time.Hour, "how long the cached book list is used before refreshing")
+	chapter_ttl := flag.Duration("chapter-ttl", 24*time.Hour, "how long cached chapter lists are used before refreshing")
+	max_stale := flag.Duration("max-stale", 24*time.Hour, "how long past their TTL cached books, chapters and translations are still served while they refresh in the background")
+	addr := flag.String("addr", envString("BIBLE_APP_ADDR", ":3000"), "address to listen on, like :3000 or unix:/path/to.sock, also read from BIBLE_APP_ADDR")
+	tls_cert := flag.String("tls-cert", "", "certificate file to serve HTTPS with, needs -tls-key")
+	tls_key := flag.String("tls-key", "", "private key file for -tls-cert")
+	autocert_domains := flag.String("autocert-domain", "", "comma separated domains to get certificates for from Let's Encrypt, instead of -tls-cert")
+	autocert_cache := flag.String("autocert-cache", "autocert", "directory to keep -autocert-domain certificates in")
+	grpc_addr := flag.String("grpc-addr", "", "address to serve the gRPC service of bible.proto on, over HTTP/2 without TLS, like :50051, empty for none")
+	redirect_addr := flag.String("redirect-addr", ":80", "address for plain HTTP that redirects to HTTPS when TLS is on, empty for none")
+	shutdown_grace := flag.Duration("shutdown-grace", 30*time.Second, "how long to let open requests finish after SIGINT or SIGTERM")
+	flag.StringVar(&base_path, "base-path", "", "path the site is served under behind a reverse proxy, like /bible")
+	metrics := flag.Bool("metrics", true, "serve Prometheus metrics at /metrics")
+	otel_endpoint := flag.String("otel-endpoint", "", "OTLP/HTTP collector to send traces of requests and upstream calls to, like http://localhost:4318, empty for no tracing")
+	otel_sample := flag.Float64("otel-sample", 1, "fraction of requests to trace with -otel-endpoint, from 0 to 1, unless the caller's traceparent says otherwise")
+	debug := flag.Bool("debug", false, "serve pprof profiles under /debug/pprof/ and runtime stats at /debug/vars")
+	debug_addr := flag.String("debug-addr", "localhost:6060", "localhost address to serve -debug on, empty to serve it on -addr with everything else")
+	rate_limit := flag.Float64("rate-limit", 0, "requests per second allowed from each client IP, 0 for no limit")
+	rate_burst := flag.Int("rate-burst", 20, "requests a client IP can make in a burst before -rate-limit applies")
+	trust_proxy := flag.Bool("trust-proxy", false, "take client IPs from X-Forwarded-For, only safe behind a reverse proxy that sets it")
+	flag.StringVar(&slack_signing_secret, "slack-signing-secret", os.Getenv("BIBLE_APP_SLACK_SIGNING_SECRET"), "signing secret of a Slack app whose slash command posts to /integrations/slack, also read from BIBLE_APP_SLACK_SIGNING_SECRET")
+	discord_key := flag.String("discord-public-key", os.Getenv("BIBLE_APP_DISCORD_PUBLIC_KEY"), "public key of a Discord application whose interactions endpoint is /integrations/discord, also read from BIBLE_APP_DISCORD_PUBLIC_KEY")
+	discord_application := flag.String("discord-application-id", os.Getenv("BIBLE_APP_DISCORD_APPLICATION_ID"), "ID of the Discord application for -register-discord-commands, also read from BIBLE_APP_DISCORD_APPLICATION_ID")
+	discord_token := flag.String("discord-bot-token", os.Getenv("BIBLE_APP_DISCORD_BOT_TOKEN"), "bot token for -register-discord-commands, also read from BIBLE_APP_DISCORD_BOT_TOKEN")
+	register_discord := flag.Bool("register-discord-commands", false, "register the /verse command with Discord, then exit")
+	flag.StringVar(&telegram_token, "telegram-bot-token", os.Getenv("BIBLE_APP_TELEGRAM_BOT_TOKEN"), "token of a Telegram bot whose webhook is /integrations/telegram, also read from BIBLE_APP_TELEGRAM_BOT_TOKEN")
+	set_telegram_webhook := flag.Bool("set-telegram-webhook", false, "point the -telegram-bot-token bot's webhook at this server under -canonical-url when it starts")
+	smtp_host := flag.String("smtp-host", "", "SMTP server to send the daily verse email through, empty turns email off")
+	smtp_port := flag.Int("smtp-port", 587, "port of -smtp-host")
+	smtp_user := flag.String("smtp-user", "", "user to log in to -smtp-host as, empty for none")
+	smtp_password := flag.String("smtp-password", os.Getenv("BIBLE_APP_SMTP_PASSWORD"), "password for -smtp-user, also read from BIBLE_APP_SMTP_PASSWORD")
+	email_from := flag.String("email-from", "", "From address of the daily verse email, like \"Bible App <verse@example.com>\"")
+	email_time := flag.String("email-time", "07:00", "local time of day the daily verse email is sent at")
+	email_timezone := flag.String("email-timezone", "UTC", "time zone of -email-time, like Europe/London")
+	email_interval := flag.Duration("email-interval", 500*time.Millisecond, "pause between emails, to stay under the SMTP server's rate limits")
+	flag.BoolVar(&graphql_playground, "graphql-playground", false, "show a page to try GraphQL queries on when /graphql is opened in a browser")
+	cors_origins := flag.String("cors-origins", "*", "comma separated origins whose pages may call /api, or * for any")
+	embed_origins := flag.String("embed-origins", "*", "comma separated origins allowed to frame the /embed widget, like https://example.com, * for any or empty for none")
+	flag.StringVar(&canonical_url, "canonical-url", "", "scheme and host the site is reached at, like https://bible.example.com, for absolute links in the sitemap")
+	sitemap_translation_list := flag.String("sitemap-translations", "", "comma separated translations to list in /sitemap.xml, the default translation if empty")
+	og_background_color := flag.String("og-background", "#1f2a38", "background color of verse share images")
+	secret := flag.String("cookie-secret", os.Getenv("BIBLE_APP_COOKIE_SECRET"), "key that signs visitor cookies like reading plan progress, also read from BIBLE_APP_COOKIE_SECRET")
+	flag.StringVar(&admin_token, "admin-token", os.Getenv("BIBLE_APP_ADMIN_TOKEN"), "bearer token for /admin, also read from BIBLE_APP_ADMIN_TOKEN")
+	flag.StringVar(&admin_user, "admin-user", "admin", "user for basic auth to /admin with -admin-password")
+	flag.StringVar(&admin_password, "admin-password", os.Getenv("BIBLE_APP_ADMIN_PASSWORD"), "password for basic auth to /admin, also read from BIBLE_APP_ADMIN_PASSWORD; /admin isn't served without it or -admin-token")
+	log_level := flag.String("log-level", "info", "least severe log messages to write: debug, info, warn or error")
+	flag.Parse()
+
+	upstream_urls := strings.Split(*upstreams, ",")
+	for i, upstream := range upstream_urls {
+		upstream_urls[i] = strings.TrimSuffix(strings.TrimSpace(upstream), "/")
+		if upstream_urls[i] == "" {
+			log.Fatal("-upstream has an empty URL")
+		}
+	}
+	bible.BaseURL, bible.Mirrors = upstream_urls[0], upstream_urls[1:]
+	base_path = strings.TrimSuffix(path.Join("/", base_path), "/")
+	api_cors.Origins = strings.Split(*cors_origins, ",")
+	if *embed_origins != "" {
+		security_policy.EmbedOrigins = strings.Split(*embed_origins, ",")
+	}
+	if reading_speed < 1 {
+		log.Fatal("-reading-speed must be at least 1")
+	}
+	crossrefs_enabled = !*no_crossrefs
+	if canonical_url != "" {
+		u, err := url.Parse(canonical_url)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Fatal("-canonical-url must look like https://bible.example.com")
+		}
+		canonical_url = u.Scheme + "://" + u.Host
+	}
+	if *sitemap_translation_list != "" {
+		for _, translation := range strings.Split(*sitemap_translation_list, ",") {
+			sitemap_translations = append(sitemap_translations, strings.ToLower(strings.TrimSpace(translation)))
+		}
+	}
+	if history_size < 0 || history_size > max_history_size {
+		log.Fatalf("-history must be between 0 and %d", max_history_size)
+	}
+	background, err := ParseHexColor(*og_background_color)
+	if err != nil {
+		log.Fatalf("-og-background: %v", err)
+	}
+	og_background = background
+	level, err := ParseLogLevel(*log_level)
+	if err != nil {
+		log.Fatalf("-log-level: %v", err)
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+	cookie_secret = []byte(*secret)
+	if *secret == "" {
+		slog.Warn("no -cookie-secret, visitor cookies won't survive a restart")
+		cookie_secret = []byte(RandomToken(32))
+	}
+
+	if *discord_key != "" {
+		discord_public_key, err = ParseDiscordPublicKey(*discord_key)
+		if err != nil {
+			log.Fatalf("-discord-public-key: %v", err)
+		}
+	}
+	if *set_telegram_webhook && (telegram_token == "" || canonical_url == "") {
+		log.Fatal("-set-telegram-webhook needs -telegram-bot-token and -canonical-url")
+	}
+	if *register_discord {
+		if *discord_application == "" || *discord_token == "" {
+			log.Fatal("-register-discord-commands needs -discord-application-id and -discord-bot-token")
+		}
+		err := NewServer(bible, nil).RegisterDiscordCommands(context.Background(), *discord_application, *discord_token)
+		if err != nil {
+			log.Fatal(err)
+		}
+		slog.Info("registered discord commands", "application", *discord_application)
+		return
+	}
+
+	if *download_path != "" {
+		err := NewServer(bible, nil).Download(context.Background(), default_translation, *download_path, *crawl_interval)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *data_path != "" {
+		var err error
+		local_data, err = LoadDump(*data_path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		default_translation = local_data.BookInfo.Translation.Identifier
+	}
+
+	var store *Store
+	if *db_path != "" {
+		var err error
+		store, err = OpenStore(*db_path)
+		if err != nil {
+			// the app still works against the live API without it
+			slog.Warn("could not open store, fetching live", "err", err)
+			store = nil
+		}
+	}
+	server := NewServer(bible, store)
+	server.Books.TTL, server.Chapters.TTL = *book_ttl, *chapter_ttl
+	server.Search.Interval = *crawl_interval
+	server.Books.MaxStale, server.Chapters.MaxStale, server.Translations.MaxStale = *max_stale, *max_stale, *max_stale
+	if *smtp_host != "" {
+		switch {
+		case store == nil:
+			log.Fatal("-smtp-host needs a working -db to keep subscribers in")
+		case canonical_url == "":
+			log.Fatal("-smtp-host needs -canonical-url for the links in emails")
+		case *secret == "":
+			log.Fatal("-smtp-host needs -cookie-secret so confirmation and unsubscribe links keep working after a restart")
+		case *email_from == "":
+			log.Fatal("-smtp-host needs -email-from")
+		}
+		at, err := time.Parse("15:04", *email_time)
+		if err != nil {
+			log.Fatal("-email-time must look like 07:00")
+		}
+		location, err := time.LoadLocation(*email_timezone)
+		if err != nil {
+			log.Fatalf("-email-timezone: %v", err)
+		}
+		mailer = &Mailer{
+			Server:   server,
+			Addr:     net.JoinHostPort(*smtp_host, strconv.Itoa(*smtp_port)),
+			From:     *email_from,
+			Hour:     at.Hour(),
+			Minute:   at.Minute(),
+			Location: location,
+			Interval: *email_interval,
+			Origin:   canonical_url,
+		}
+		if *smtp_user != "" {
+			mailer.Auth = smtp.PlainAuth("", *smtp_user, *smtp_password, *smtp_host)
+		}
+	}
+	if *prefetch {
+		if store == nil {
+			log.Fatal("-prefetch needs a working -db")
+		}
+		err := server.Prefetch(context.Background(), default_translation, *crawl_interval)
+		store.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if (*tls_cert == "") != (*tls_key == "") {
+		log.Fatal("-tls-cert and -tls-key must be used together")
+	}
+	if *tls_cert != "" && *autocert_domains != "" {
+		log.Fatal("use either -tls-cert or -autocert-domain, not both")
+	}
+	use_tls := *tls_cert != "" || *autocert_domains != ""
+
+	listener, err := Listen(*addr)
+	if err != nil {
+		log.Fatalf("can't listen on %s: %v", *addr, err)
+	}
+	slog.Info("listening", "addr", listener.Addr().String(), "tls", use_tls)
+	var redirect_listener net.Listener
+	if use_tls && *redirect_addr != "" {
+		redirect_listener, err = Listen(*redirect_addr)
+		if err != nil {
+			log.Fatalf("can't listen on %s: %v", *redirect_addr, err)
+		}
+		slog.Info("redirecting to HTTPS", "addr", redirect_listener.Addr().String())
+	}
+
+	var grpc_listener net.Listener
+	if *grpc_addr != "" {
+		grpc_listener, err = Listen(*grpc_addr)
+		if err != nil {
+			log.Fatalf("can't listen on %s: %v", *grpc_addr, err)
+		}
+		slog.Info("serving gRPC", "addr", grpc_listener.Addr().String())
+	}
+
+	var stop_tracing func(context.Context) error
+	if *otel_endpoint != "" {
+		if *otel_sample < 0 || *otel_sample > 1 {
+			log.Fatal("-otel-sample must be from 0 to 1")
+		}
+		stop_tracing, err = StartTracing(context.Background(), *otel_endpoint, *otel_sample)
+		if err != nil {
+			log.Fatalf("-otel-endpoint: %v", err)
+		}
+		slog.Info("tracing", "endpoint", *otel_endpoint, "sample", *otel_sample)
+	}
+
+	var debug_listener net.Listener
+	if *debug {
+		server.publishDebugVars()
+		if *debug_addr != "" {
+			if !IsLocalAddr(*debug_addr) {
+				log.Fatalf("-debug-addr must be a localhost address like localhost:6060, not %s", *debug_addr)
+			}
+			debug_listener, err = Listen(*debug_addr)
+			if err != nil {
+				log.Fatalf("can't listen on %s: %v", *debug_addr, err)
+			}
+			slog.Info("serving debug endpoints", "addr", debug_listener.Addr().String())
+		} else {
+			slog.Warn("serving debug endpoints on the public listener")
+		}
+	}
+
+	var book_info BookInfo
+	err = server.Books.Get(context.Background(), default_translation, &book_info)
+	if err != nil {
+		slog.Warn("could not load book list", "err", err)
+	}
+
+	if *index_at_startup {
+		server.Search.StartCrawl(default_translation)
+	}
+
+	m := server.Routes(*metrics, *debug && debug_listener == nil)
+
+	var handler http.Handler = m
+	if *rate_limit > 0 {
+		limiter := NewRateLimiter(*rate_limit, *rate_burst)
+		limiter.TrustProxy = *trust_proxy
+		limiter.Server = server
+		handler = limiter.Limit(handler)
+	}
+	handler = BasePath(security_policy.Headers(handler))
+	if tracer != nil {
+		handler = Tracing(handler)
+	}
+	site := listenedServer{
+		server:    &http.Server{Handler: Logging(handler)},
+		listener:  listener,
+		tls:       use_tls,
+		cert_file: *tls_cert,
+		key_file:  *tls_key,
+	}
+	var redirect http.Handler = redirectHTTPS(listenPort(listener))
+	if *autocert_domains != "" {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(strings.Split(*autocert_domains, ",")...),
+			Cache:      autocert.DirCache(*autocert_cache),
+		}
+		site.server.TLSConfig = manager.TLSConfig()
+		// answers Let's Encrypt's http-01 challenges, and redirects the rest
+		redirect = manager.HTTPHandler(redirect)
+	}
+	// event streams never finish on their own
+	site.server.RegisterOnShutdown(votd_events.Close)
+	servers := []listenedServer{site}
+	if redirect_listener != nil {
+		servers = append(servers, listenedServer{server: &http.Server{Handler: redirect}, listener: redirect_listener})
+	}
+
+	if debug_listener != nil {
+		servers = append(servers, listenedServer{server: &http.Server{Handler: server.DebugHandler()}, listener: debug_listener})
+	}
+	if grpc_listener != nil {
+		// gRPC is HTTP/2 only, and without TLS the client has to know that
+		// up front
+		var protocols http.Protocols
+		protocols.SetUnencryptedHTTP2(true)
+		servers = append(servers, listenedServer{
+			server:   &http.Server{Handler: Logging(http.HandlerFunc(server.serveGRPC)), Protocols: &protocols},
+			listener: grpc_listener,
+		})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// a second signal kills the process straight away
+		<-ctx.Done()
+		stop()
+	}()
+	go votd_events.Run(ctx)
+	if store != nil {
+		go server.DispatchWebhooks(ctx, votd_events)
+	}
+	if mailer != nil {
+		go mailer.Run(ctx)
+	}
+	if *set_telegram_webhook {
+		go func() {
+			err := server.SetTelegramWebhook(ctx, telegram_token, canonical_url)
+			if err != nil {
+				slog.Error("setting telegram webhook", "err", err)
+				return
+			}
+			slog.Info("set telegram webhook", "url", canonical_url+SitePath("integrations", "telegram"))
+		}()
+	}
+	serve_err := Serve(ctx, *shutdown_grace, servers)
+	if serve_err != nil {
+		slog.Error("server failed", "err", serve_err)
+	}
+	cache_refresher.Close()
+	bible.HTTP.CloseIdleConnections()
+	if stop_tracing != nil {
+		// sends the spans still waiting in the batch
+		shutdown_ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = stop_tracing(shutdown_ctx)
+		cancel()
+		if err != nil {
+			slog.Error("flushing traces", "err", err)
+		}
+	}
+	var close_err error
+	if store != nil {
+		close_err = store.Close()
+		if close_err != nil {
+			slog.Error("closing store", "err", close_err)
+		}
+	}
+	slog.Info("server closed")
+	if serve_err != nil || close_err != nil {
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDecodePsalm119(t *testing.T) {
+	data, err := os.ReadFile("testdata/upstream/data/web/PSA/119.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var verse_info VerseInfo
+	err = json.Unmarshal(data, &verse_info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verse_info.Verses) != 176 {
+		t.Fatalf("decoded %d verses, want 176", len(verse_info.Verses))
+	}
+	for i, verse := range verse_info.Verses {
+		if verse.Chapter != 119 || verse.Verse != i+1 {
+			t.Errorf("verse %d decoded as %d:%d, want 119:%d", i, verse.Chapter, verse.Verse, i+1)
+		}
+	}
+}
+
+func TestDecodeLargeNumbers(t *testing.T) {
+	tests := []struct {
+		json    string
+		chapter int
+		verse   int
+	}{
+		{`{"chapter": 119, "verse": 176}`, 119, 176},
+		{`{"chapter": 150, "verse": 6}`, 150, 6},
+		{`{"chapter": 127, "verse": 128}`, 127, 128},
+		{`{"chapter": 1, "verse": 1}`, 1, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.json, func(t *testing.T) {
+			var verse Verse
+			err := json.Unmarshal([]byte(test.json), &verse)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if verse.Chapter != test.chapter || verse.Verse != test.verse {
+				t.Errorf("decoded %d:%d, want %d:%d", verse.Chapter, verse.Verse, test.chapter, test.verse)
+			}
+		})
+	}
+}
+
+func TestTranslationLanguageCode(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want string
+	}{
+		{"correct spelling", `{"identifier": "web", "language_code": "eng"}`, "eng"},
+		{"upstream typo", `{"identifier": "web", "langauge_code": "eng"}`, "eng"},
+		{"both, correct first", `{"language_code": "eng", "langauge_code": "typo"}`, "eng"},
+		{"both, typo first", `{"langauge_code": "typo", "language_code": "eng"}`, "eng"},
+		{"empty correct spelling", `{"language_code": "", "langauge_code": "eng"}`, "eng"},
+		{"neither", `{"identifier": "web"}`, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var translation Translation
+			err := json.Unmarshal([]byte(test.json), &translation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if translation.LanguageCode != test.want {
+				t.Errorf("LanguageCode %q, want %q", translation.LanguageCode, test.want)
+			}
+		})
+	}
+}
+
+func TestTranslationMarshalsCorrectSpelling(t *testing.T) {
+	var translation Translation
+	err := json.Unmarshal([]byte(`{"identifier": "web", "name": "World English Bible", "langauge_code": "eng"}`), &translation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if translation.Identifier != "web" || translation.Name != "World English Bible" {
+		t.Errorf("decoded %+v, lost the other fields", translation)
+	}
+	data, err := json.Marshal(translation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"language_code":"eng"`) || strings.Contains(string(data), "langauge") {
+		t.Errorf("marshaled %s, want only language_code", data)
+	}
+}
+
+// setBasePath serves the site under base for the rest of the test.
+func setBasePath(t *testing.T, base string) {
+	saved := base_path
+	base_path = base
+	t.Cleanup(func() { base_path = saved })
+}
+
+func TestTranslationPath(t *testing.T) {
+	s := testServer(t, fakeUpstream(t).URL)
+	tests := []struct {
+		base        string
+		translation string
+		name        string
+		pairs       []string
+		want        string
+	}{
+		{"", default_translation, "books", nil, "/"},
+		{"", default_translation, "chapter", []string{"book", "john", "chapter", "3"}, "/john/3"},
+		{"", "kjv", "books", nil, "/kjv/"},
+		{"", "kjv", "chapter", []string{"book", "john", "chapter", "3"}, "/kjv/john/3"},
+		{"", "a b/c", "book", []string{"book", "john"}, "/a%20b%2Fc/john"},
+		{"", "<script>", "books", nil, "/%3Cscript%3E/"},
+		{"/bible", default_translation, "books", nil, "/bible/"},
+		{"/bible", default_translation, "chapter", []string{"book", "john", "chapter", "3"}, "/bible/john/3"},
+		{"/bible", "kjv", "verse", []string{"book", "john", "chapter", "3", "verse", "16"}, "/bible/kjv/john/3/16"},
+	}
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			setBasePath(t, test.base)
+			if got := s.TranslationPath(test.translation, test.name, test.pairs...); got != test.want {
+				t.Errorf("TranslationPath(%q, %q, %q) under %q = %q, want %q", test.translation, test.name, test.pairs, test.base, got, test.want)
+			}
+		})
+	}
+}
+
+// A link to a route that doesn't exist, or with values it doesn't take, is
+// a mistake in the code rather than a link that quietly goes nowhere.
+func TestPathBadRoute(t *testing.T) {
+	s := testServer(t, fakeUpstream(t).URL)
+	tests := []struct {
+		name  string
+		pairs []string
+	}{
+		{"nowhere", nil},
+		{"chapter", []string{"book", "john"}},
+		{"verse", []string{"book", "john", "chapter", "3", "verse", "sixteen"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Path(%q, %q) didn't panic", test.name, test.pairs)
+				}
+			}()
+			s.Path(test.name, test.pairs...)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/sync/errgroup"
+)
+
+// markdown_workers caps how many chapters /{book}.md fetches at once.
+const markdown_workers = 4
+
+// MarkdownFrontmatter is the YAML block at the top of exported documents.
+func MarkdownFrontmatter(reference string, translation Translation) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "reference: %s\n", strconv.Quote(reference))
+	fmt.Fprintf(&b, "translation: %s\n", strconv.Quote(translation.Name))
+	if translation.License != "" {
+		fmt.Fprintf(&b, "license: %s\n", strconv.Quote(translation.License))
+	}
+	b.WriteString("---\n\n")
+	return b.String()
+}
+
+// MarkdownVerses writes each verse as its own paragraph starting with a
+// bold verse number, or all of them as one flowing paragraph.
+func MarkdownVerses(verses []Verse, paragraph bool) string {
+	var parts []string
+	for _, verse := range verses {
+		parts = append(parts, fmt.Sprintf("**%d** %s", verse.Verse, verseText(verse.Text)))
+	}
+	if paragraph {
+		return strings.Join(parts, " ") + "\n"
+	}
+	return strings.Join(parts, "\n\n") + "\n"
+}
+
+func paragraphMode(r *http.Request) bool {
+	return r.URL.Query().Get("mode") == "paragraph"
+}
+
+func writeMarkdown(w http.ResponseWriter, document string) {
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	fmt.Fprint(w, document)
+}
+
+func (s *Server) markdownVerses(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var book Book
+	var verse_info VerseInfo
+	err := s.LoadVerses(r.Context(), RequestTranslation(r), vars["book"], vars["chapter"], &book, &verse_info)
+	if err != nil {
+		textError(w, r, err)
+		return
+	}
+
+	reference := fmt.Sprintf("%s %s", book.Name, vars["chapter"])
+	document := MarkdownFrontmatter(reference, verse_info.Translation)
+	document += "# " + reference + "\n\n"
+	document += MarkdownVerses(verse_info.Verses, paragraphMode(r))
+	writeMarkdown(w, document)
+}
+
+// markdownBook serves /{book}.md, every chapter of a book under H2 headings.
+func (s *Server) markdownBook(w http.ResponseWriter, r *http.Request) {
+	slug := mux.Vars(r)["book"]
+	translation := RequestTranslation(r)
+
+	var book Book
+	var chapter_info ChapterInfo
+	err := s.LoadChapters(r.Context(), translation, slug, &book, &chapter_info)
+	if err != nil {
+		textError(w, r, err)
+		return
+	}
+
+	chapters := make([]VerseInfo, len(chapter_info.Chapters))
+	g, ctx := errgroup.WithContext(r.Context())
+	g.SetLimit(markdown_workers)
+	for i, chapter := range chapter_info.Chapters {
+		g.Go(func() error {
+			var chapter_book Book
+			return s.LoadVerses(ctx, translation, slug, strconv.Itoa(chapter.Chapter), &chapter_book, &chapters[i])
+		})
+	}
+	err = g.Wait()
+	if err != nil {
+		textError(w, r, err)
+		return
+	}
+
+	paragraph := paragraphMode(r)
+	document := MarkdownFrontmatter(book.Name, chapter_info.Translation)
+	document += "# " + book.Name + "\n"
+	for i, chapter := range chapter_info.Chapters {
+		document += fmt.Sprintf("\n## Chapter %d\n\n", chapter.Chapter)
+		document += MarkdownVerses(chapters[i].Verses, paragraph)
+	}
+	writeMarkdown(w, document)
+}
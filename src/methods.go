@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// checked_methods are the methods a 405 response considers for its Allow
+// header.
+var checked_methods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}
+
+// RestrictMethods limits every route of router that doesn't name its
+// methods, which is all but the form posts, to methods. Anything else gets
+// the router's MethodNotAllowedHandler.
+func RestrictMethods(router *mux.Router, methods ...string) {
+	router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		if route.GetHandler() == nil {
+			// a subrouter's prefix, its own routes are walked next
+			return nil
+		}
+		if _, err := route.GetMethods(); err != nil {
+			route.Methods(methods...)
+		}
+		return nil
+	})
+}
+
+// AllowedMethods lists the methods router has a route for r's path with.
+func AllowedMethods(router *mux.Router, r *http.Request) []string {
+	var allowed []string
+	for _, method := range checked_methods {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		var match mux.RouteMatch
+		if router.Match(probe, &match) && match.MatchErr == nil {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
+
+// MethodNotAllowed answers a request whose path exists with a method it
+// doesn't take, listing the ones it does in Allow.
+func (s *Server) MethodNotAllowed(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed := AllowedMethods(router, r)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		message := "This address doesn't take " + r.Method + " requests."
+		if WantsJSON(r) || strings.HasPrefix(r.URL.Path, "/api/") {
+			WriteJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Status: http.StatusMethodNotAllowed, Error: message})
+			return
+		}
+		s.renderError(w, r, http.StatusMethodNotAllowed, message)
+	})
+}
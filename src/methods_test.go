@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMethodNotAllowed(t *testing.T) {
+	handler := newTestServer(t)
+	tests := []struct {
+		method string
+		target string
+		allow  string
+	}{
+		{http.MethodPut, "/", "GET, HEAD"},
+		{http.MethodDelete, "/", "GET, HEAD"},
+		{http.MethodPost, "/john/3", "GET, HEAD"},
+		{http.MethodPut, "/john/3", "GET, HEAD"},
+		{http.MethodDelete, "/john/3", "GET, HEAD"},
+		{http.MethodPatch, "/john/3/16", "GET, HEAD"},
+		{http.MethodDelete, "/kjv/john/3", "GET, HEAD"},
+		{http.MethodPut, "/search", "GET, HEAD"},
+		{http.MethodPut, "/bookmarks", "GET, HEAD, POST"},
+		{http.MethodDelete, "/highlights", "GET, HEAD, POST"},
+		// /theme is a book as far as GET knows
+		{http.MethodPut, "/theme", "GET, HEAD, POST"},
+		{http.MethodDelete, "/bookmarks/import", "GET, HEAD, POST"},
+		{http.MethodDelete, "/plans/psalms-proverbs/day/1", "GET, HEAD, POST"},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(test.method, test.target, nil))
+			if w.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("status %d, want %d", w.Code, http.StatusMethodNotAllowed)
+			}
+			if allow := w.Header().Get("Allow"); allow != test.allow {
+				t.Errorf("Allow %q, want %q", allow, test.allow)
+			}
+			if !strings.Contains(w.Body.String(), "doesn&#39;t take "+test.method+" requests") {
+				t.Errorf("body doesn't say why")
+			}
+		})
+	}
+}
+
+func TestAPIMethodNotAllowed(t *testing.T) {
+	handler := newTestServer(t)
+	tests := []struct {
+		method string
+		target string
+		allow  string
+	}{
+		{http.MethodPut, "/api/v1/john/3", "GET, HEAD, OPTIONS"},
+		{http.MethodDelete, "/api/v1/books", "GET, HEAD, OPTIONS"},
+		{http.MethodPost, "/api/v1/john/3/16", "GET, HEAD, OPTIONS"},
+		{http.MethodGet, "/api/v1/passages", "POST, OPTIONS"},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(test.method, test.target, nil))
+			if w.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("status %d, want %d", w.Code, http.StatusMethodNotAllowed)
+			}
+			if allow := w.Header().Get("Allow"); allow != test.allow {
+				t.Errorf("Allow %q, want %q", allow, test.allow)
+			}
+			var response ErrorResponse
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			if err != nil || response.Status != http.StatusMethodNotAllowed {
+				t.Errorf("body %s isn't a JSON error", w.Body)
+			}
+		})
+	}
+}
+
+// Paths no route has stay 404s whatever the method.
+func TestMethodNotFound(t *testing.T) {
+	handler := newTestServer(t)
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, "/no/such/page/here", nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d, want %d", method, w.Code, http.StatusNotFound)
+		}
+	}
+}
+
+// A HEAD response has the headers GET would, Content-Length included, and
+// no body. It goes through a real server, which is what drops the body.
+func TestHead(t *testing.T) {
+	server := httptest.NewServer(newTestServer(t))
+	t.Cleanup(server.Close)
+	tests := []struct {
+		target          string
+		accept_encoding string
+	}{
+		{"/", ""},
+		{"/john/3", ""},
+		{"/john/3", "gzip"},
+		{"/psalms/119/176", ""},
+		{"/api/v1/john/3", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.target+" "+test.accept_encoding, func(t *testing.T) {
+			responses := map[string]*http.Response{}
+			bodies := map[string][]byte{}
+			for _, method := range []string{http.MethodGet, http.MethodHead} {
+				r, _ := http.NewRequest(method, server.URL+test.target, nil)
+				// set by hand, so the client doesn't decompress the body
+				r.Header.Set("Accept-Encoding", test.accept_encoding)
+				response, err := server.Client().Do(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				bodies[method], _ = io.ReadAll(response.Body)
+				response.Body.Close()
+				responses[method] = response
+			}
+			get, head := responses[http.MethodGet], responses[http.MethodHead]
+			if get.StatusCode != http.StatusOK || head.StatusCode != http.StatusOK {
+				t.Fatalf("GET status %d, HEAD status %d", get.StatusCode, head.StatusCode)
+			}
+			if len(bodies[http.MethodHead]) != 0 {
+				t.Errorf("HEAD has a %d byte body", len(bodies[http.MethodHead]))
+			}
+			for _, name := range []string{"Content-Type", "Content-Encoding", "Content-Length", "Cache-Control", "Etag", "Vary"} {
+				if got, want := head.Header.Values(name), get.Header.Values(name); !slices.Equal(got, want) {
+					t.Errorf("HEAD %s %q, GET has %q", name, got, want)
+				}
+			}
+			if length := get.Header.Get("Content-Length"); length != "" && length != strconv.Itoa(len(bodies[http.MethodGet])) {
+				t.Errorf("Content-Length %s, body is %d bytes", length, len(bodies[http.MethodGet]))
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	request_count = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bible_http_requests_total",
+		Help: "Requests served, by route and status code.",
+	}, []string{"route", "status"})
+	request_duration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "bible_http_request_duration_seconds",
+		Help:    "Time taken to serve requests, by route and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "status"})
+	upstream_count = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bible_upstream_requests_total",
+		Help: "Requests made to bible-api.com, by endpoint and outcome.",
+	}, []string{"endpoint", "outcome"})
+	upstream_duration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "bible_upstream_request_duration_seconds",
+		Help:    "Time taken by bible-api.com, by endpoint and outcome.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"endpoint", "outcome"})
+	upstream_served = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bible_upstream_served_total",
+		Help: "Requests to bible-api.com answered, by the upstream host that answered them, the primary or a mirror.",
+	}, []string{"host"})
+	cache_lookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bible_cache_lookups_total",
+		Help: "In-memory cache lookups, by cache and result (hit, miss or stale).",
+	}, []string{"cache", "result"})
+	cache_refreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bible_cache_refreshes_total",
+		Help: "Background refreshes of stale cache entries, by result (ok, failed, canceled or skipped when too many were running).",
+	}, []string{"result"})
+	rate_limited = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "bible_rate_limited_requests_total",
+		Help: "Requests turned away with a 429 by -rate-limit.",
+	})
+)
+
+// observeRequest records a served request. route is the mux path template,
+// so /john/3 and /genesis/1 count together as /{book}/{chapter}.
+func observeRequest(route string, status int, duration time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	code := strconv.Itoa(status)
+	request_count.WithLabelValues(route, code).Inc()
+	request_duration.WithLabelValues(route, code).Observe(duration.Seconds())
+}
+
+// upstreamEndpoint names the kind of bible-api.com request from the number
+// of path segments after /data.
+func upstreamEndpoint(path string) string {
+	switch strings.Count(strings.TrimPrefix(path, "/data"), "/") {
+	case 0:
+		return "translations"
+	case 1:
+		return "books"
+	case 2:
+		return "chapters"
+	default:
+		return "verses"
+	}
+}
+
+func upstreamOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case IsTimeout(err):
+		return "timeout"
+	case errors.Is(err, ErrCircuitOpen):
+		return "circuit_open"
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrUpstreamUnavailable):
+		return "unavailable"
+	default:
+		return "bad_response"
+	}
+}
+
+func observeUpstream(path string, duration time.Duration, err error) {
+	endpoint, outcome := upstreamEndpoint(path), upstreamOutcome(err)
+	upstream_count.WithLabelValues(endpoint, outcome).Inc()
+	upstream_calls.Add(endpoint+" "+outcome, 1)
+	if outcome != "circuit_open" {
+		// nothing was sent, so there's nothing to time
+		upstream_duration.WithLabelValues(endpoint, outcome).Observe(duration.Seconds())
+	}
+}
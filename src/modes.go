@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Chapter pages show verses one per line, run together into paragraphs, or
+// as poetry with the upstream line breaks.
+const (
+	ModeVerse     = "verse"
+	ModeParagraph = "paragraph"
+	ModePoetry    = "poetry"
+)
+
+var reading_modes = []Link{
+	{Text: "Verses", URL: ModeVerse},
+	{Text: "Paragraphs", URL: ModeParagraph},
+	{Text: "Poetry", URL: ModePoetry},
+}
+
+// paragraph_mark starts a new paragraph in translations that mark them,
+// like the KJV.
+const paragraph_mark = "¶"
+
+func validMode(mode string) bool {
+	return mode == ModeVerse || mode == ModeParagraph || mode == ModePoetry
+}
+
+// ReadingMode is ?mode= if it's valid, which is remembered in the mode
+// cookie, or else the mode last chosen.
+func ReadingMode(w http.ResponseWriter, r *http.Request) string {
+	Private(w)
+	mode := r.URL.Query().Get("mode")
+	if validMode(mode) {
+		if saved, _ := SignedCookie(r, "mode"); saved != mode {
+			SetSignedCookie(w, r, "mode", mode)
+		}
+		return mode
+	}
+	if saved, ok := SignedCookie(r, "mode"); ok && validMode(saved) {
+		return saved
+	}
+	return ModeVerse
+}
+
+// ModeLink switches a chapter page to another reading mode.
+type ModeLink struct {
+	Link
+	Selected bool
+}
+
+// ModeLinks links the page to each reading mode, keeping the rest of its
+// query.
+func ModeLinks(r *http.Request, selected string) []ModeLink {
+	links := make([]ModeLink, len(reading_modes))
+	for i, mode := range reading_modes {
+		query := r.URL.Query()
+		query.Set("mode", mode.URL)
+		links[i] = ModeLink{Link: Link{Text: mode.Text, URL: SitePath(r.URL.Path) + "?" + query.Encode()}, Selected: mode.URL == selected}
+	}
+	return links
+}
+
+// Paragraphs groups verses into paragraphs, starting a new one at each
+// verse beginning with "¶". Translations without the marks come out as a
+// single paragraph.
+func Paragraphs(verses []ChapterVerse) [][]ChapterVerse {
+	var paragraphs [][]ChapterVerse
+	for _, verse := range verses {
+		text := verseText(verse.Text)
+		if len(paragraphs) == 0 || strings.HasPrefix(text, paragraph_mark) {
+			paragraphs = append(paragraphs, nil)
+		}
+		verse.Text = paragraphText(text)
+		paragraphs[len(paragraphs)-1] = append(paragraphs[len(paragraphs)-1], verse)
+	}
+	return paragraphs
+}
+
+// paragraphText is a verse as running text, without the paragraph mark the
+// paragraph break stands in for.
+func paragraphText(text string) string {
+	return strings.TrimSpace(strings.TrimPrefix(verseText(text), paragraph_mark))
+}
+
+// PoetryLines splits a verse into the lines bible-api.com breaks poetry
+// into, trimmed and without blank ones.
+func PoetryLines(text string) []string {
+	normalized := NormalizeVerse(text, "\n")
+	if normalized == "" {
+		return nil
+	}
+	return strings.Split(normalized, "\n")
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Psalm 23:1-4 and John 3:21-23 as bible-api.com has them, in the WEB and
+// the KJV, which marks paragraphs.
+var (
+	psalm_23_web = []ChapterVerse{
+		{Number: 1, Text: "Yahweh is my shepherd;\nI shall lack nothing.\n"},
+		{Number: 2, Text: "He makes me lie down in green pastures.\nHe leads me beside still waters.\n"},
+		{Number: 3, Text: "He restores my soul.\nHe guides me in the paths of righteousness for his name’s sake.\n"},
+		{Number: 4, Text: "Even though I walk through the valley of the shadow of death,\nI will fear no evil, for you are with me.\nYour rod and your staff,\nthey comfort me.\n"},
+	}
+	john_3_kjv = []ChapterVerse{
+		{Number: 21, Text: "But he that doeth truth cometh to the light, that his deeds may be made manifest, that they are wrought in God.\n"},
+		{Number: 22, Text: "¶ After these things came Jesus and his disciples into the land of Judæa; and there he tarried with them, and baptized.\n"},
+		{Number: 23, Text: "And John also was baptizing in Ænon near to Salim, because there was much water there: and they came, and were baptized.\n"},
+	}
+)
+
+func TestParagraphs(t *testing.T) {
+	tests := []struct {
+		name   string
+		verses []ChapterVerse
+		// want is the verse numbers of each paragraph
+		want [][]int
+		// text is the first verse of the last paragraph
+		text string
+	}{
+		{"unmarked", psalm_23_web, [][]int{{1, 2, 3, 4}}, "Yahweh is my shepherd; I shall lack nothing."},
+		{"marked", john_3_kjv, [][]int{{21}, {22, 23}}, "After these things came Jesus and his disciples into the land of Judæa; and there he tarried with them, and baptized."},
+		{"marked first verse", john_3_kjv[1:], [][]int{{22, 23}}, "After these things came Jesus and his disciples into the land of Judæa; and there he tarried with them, and baptized."},
+		{"no verses", nil, nil, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			paragraphs := Paragraphs(test.verses)
+			var got [][]int
+			for _, paragraph := range paragraphs {
+				var numbers []int
+				for _, verse := range paragraph {
+					numbers = append(numbers, verse.Number)
+					if strings.Contains(verse.Text, "\n") || strings.Contains(verse.Text, paragraph_mark) {
+						t.Errorf("verse %d: %q", verse.Number, verse.Text)
+					}
+				}
+				got = append(got, numbers)
+			}
+			if !slices.EqualFunc(got, test.want, slices.Equal) {
+				t.Fatalf("Paragraphs = %v, want %v", got, test.want)
+			}
+			if test.text == "" {
+				return
+			}
+			if first := paragraphs[len(paragraphs)-1][0].Text; first != test.text {
+				t.Errorf("first verse %q, want %q", first, test.text)
+			}
+		})
+	}
+	if psalm_23_web[0].Text != "Yahweh is my shepherd;\nI shall lack nothing.\n" {
+		t.Errorf("Paragraphs changed the verses it was given")
+	}
+}
+
+func TestPoetryLinesPsalm23(t *testing.T) {
+	want := [][]string{
+		{"Yahweh is my shepherd;", "I shall lack nothing."},
+		{"He makes me lie down in green pastures.", "He leads me beside still waters."},
+		{"He restores my soul.", "He guides me in the paths of righteousness for his name’s sake."},
+		{"Even though I walk through the valley of the shadow of death,", "I will fear no evil, for you are with me.", "Your rod and your staff,", "they comfort me."},
+	}
+	for i, verse := range psalm_23_web {
+		if got := PoetryLines(verse.Text); !slices.Equal(got, want[i]) {
+			t.Errorf("verse %d: PoetryLines = %q, want %q", verse.Number, got, want[i])
+		}
+	}
+	// prose is a line a verse
+	for _, verse := range john_3_kjv {
+		if got := PoetryLines(verse.Text); len(got) != 1 {
+			t.Errorf("John 3:%d is %d lines", verse.Number, len(got))
+		}
+	}
+}
+
+func TestReadingMode(t *testing.T) {
+	saved := httptest.NewRecorder()
+	SetSignedCookie(saved, httptest.NewRequest(http.MethodGet, "/", nil), "mode", ModePoetry)
+	tests := []struct {
+		name   string
+		target string
+		cookie *http.Cookie
+		want   string
+		// set is the mode cookie saved, if any
+		set string
+	}{
+		{"default", "/john/3", nil, ModeVerse, ""},
+		{"chosen", "/john/3?mode=paragraph", nil, ModeParagraph, ModeParagraph},
+		{"remembered", "/john/3", saved.Result().Cookies()[0], ModePoetry, ""},
+		{"chosen again", "/john/3?mode=poetry", saved.Result().Cookies()[0], ModePoetry, ""},
+		{"changed", "/john/3?mode=verse", saved.Result().Cookies()[0], ModeVerse, ModeVerse},
+		{"invalid", "/john/3?mode=sideways", saved.Result().Cookies()[0], ModePoetry, ""},
+		{"forged", "/john/3", &http.Cookie{Name: "mode", Value: "paragraph.forged"}, ModeVerse, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, test.target, nil)
+			if test.cookie != nil {
+				r.AddCookie(test.cookie)
+			}
+			w := httptest.NewRecorder()
+			if got := ReadingMode(w, r); got != test.want {
+				t.Errorf("ReadingMode = %q, want %q", got, test.want)
+			}
+			if cache_control := w.Header().Get("Cache-Control"); !strings.HasPrefix(cache_control, "private") {
+				t.Errorf("Cache-Control %q", cache_control)
+			}
+			set := ""
+			for _, cookie := range w.Result().Cookies() {
+				if cookie.Name == "mode" {
+					r := httptest.NewRequest(http.MethodGet, "/", nil)
+					r.AddCookie(cookie)
+					set, _ = SignedCookie(r, "mode")
+				}
+			}
+			if set != test.set {
+				t.Errorf("saved mode %q, want %q", set, test.set)
+			}
+		})
+	}
+}
+
+func TestModeLinks(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/john/3?mode=poetry&translation=kjv", nil)
+	links := ModeLinks(r, ModePoetry)
+	want := []ModeLink{
+		{Link{Text: "Verses", URL: "/john/3?mode=verse&translation=kjv"}, false},
+		{Link{Text: "Paragraphs", URL: "/john/3?mode=paragraph&translation=kjv"}, false},
+		{Link{Text: "Poetry", URL: "/john/3?mode=poetry&translation=kjv"}, true},
+	}
+	if !slices.Equal(links, want) {
+		t.Errorf("ModeLinks = %+v, want %+v", links, want)
+	}
+}
+
+func TestChapterModes(t *testing.T) {
+	handler := newTestServer(t)
+	tests := []struct {
+		target string
+		want   []string
+	}{
+		{"/psalms/119", []string{`<span class="verse-number">1 : </span>Blessed are those whose ways are blameless, who walk according to Yahweh’s law.</span>`, "<strong>Verses</strong>"}},
+		{"/psalms/119?mode=paragraph", []string{"<p><span id=\"v1\"><sup class=\"verse-number\">1</sup>Blessed are those whose ways are blameless, who walk according to Yahweh’s law.</span> ", "<strong>Paragraphs</strong>"}},
+		{"/psalms/119?mode=poetry", []string{"text-indent: -2em\">Blessed are those whose ways are blameless,</span>", "text-indent: -2em\">who walk according to Yahweh’s law.</span>", "<strong>Poetry</strong>"}},
+	}
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			w := get(t, handler, test.target)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d", w.Code)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(w.Body.String(), want) {
+					t.Errorf("body doesn't contain %s", want)
+				}
+			}
+		})
+	}
+}
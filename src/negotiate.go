@@ -0,0 +1,65 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Formats maps a format name like "json" or "txt" to the handler that
+// produces it. "html" is used for anything not in the map.
+type Formats map[string]http.HandlerFunc
+
+// RequestFormat returns the format named by ?format=, or "json" when the
+// Accept header prefers application/json over text/html, or "html".
+func RequestFormat(r *http.Request) string {
+	format := r.URL.Query().Get("format")
+	if format != "" {
+		return format
+	}
+	if prefersJSON(r.Header.Get("Accept")) {
+		return "json"
+	}
+	return "html"
+}
+
+func WantsJSON(r *http.Request) bool {
+	return RequestFormat(r) == "json"
+}
+
+func prefersJSON(accept string) bool {
+	json_q, html_q := 0.0, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		media_type, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+		}
+		switch media_type {
+		case "application/json":
+			json_q = max(json_q, q)
+		case "text/html":
+			html_q = max(html_q, q)
+		}
+	}
+	return json_q > html_q
+}
+
+// Negotiated serves whichever of formats the client asked for.
+func Negotiated(formats Formats) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		handler, ok := formats[RequestFormat(r)]
+		if !ok {
+			handler = formats["html"]
+		}
+		handler(w, r)
+	}
+}
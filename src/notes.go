@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// max_note_length is the most characters a note can have.
+const max_note_length = 2000
+
+// Note is a visitor's private note on a verse. Notes are only kept in the
+// store, so they are hidden entirely without -db.
+type Note struct {
+	Book    string
+	Chapter int
+	Verse   int
+	Text    string
+	Updated time.Time
+}
+
+// NoteForm is the note box under a verse, with the note so far if there is
+// one.
+type NoteForm struct {
+	Action    string
+	Text      string
+	MaxLength int
+}
+
+// NotePath is where a verse's note form posts to.
+func (s *Server) NotePath(translation string, book Book, chapter int, verse int) string {
+	link := s.Path("note", "book", BookSlug(book.Name), "chapter", strconv.Itoa(chapter), "verse", strconv.Itoa(verse))
+	if translation != default_translation {
+		link += "?translation=" + translation
+	}
+	return link
+}
+
+// NewNoteForm makes the note box for a verse page, or returns nil without a
+// store.
+func (s *Server) NewNoteForm(w http.ResponseWriter, r *http.Request, translation string, book Book, chapter int, verse int) *NoteForm {
+	if s.Store == nil {
+		return nil
+	}
+	Private(w)
+	form := &NoteForm{Action: s.NotePath(translation, book, chapter, verse), MaxLength: max_note_length}
+	user, ok := SignedCookie(r, "user")
+	if !ok {
+		return form
+	}
+	var note Note
+	err := s.Store.LoadNote(r.Context(), user, book.ID, chapter, verse, &note)
+	if err != nil && !errors.Is(err, errStoreMiss) {
+		storeError(err)
+	}
+	form.Text = note.Text
+	return form
+}
+
+// postNote saves the note on a verse, or deletes it when the text is empty
+// or delete=1.
+func (s *Server) postNote(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	translation := RequestTranslation(r)
+	number, err := ParseNumber("verse", vars["verse"])
+	if err != nil {
+		s.fetchError(w, r, translation, vars["book"], err)
+		return
+	}
+	// only verses that exist can have notes
+	var book Book
+	var verse_info VerseInfo
+	var verse Verse
+	err = s.LoadVerse(r.Context(), translation, vars["book"], vars["chapter"], number, &book, &verse_info, &verse)
+	if err != nil {
+		s.fetchError(w, r, translation, vars["book"], err)
+		return
+	}
+	chapter := verse.Chapter
+
+	text := strings.TrimSpace(strings.ReplaceAll(r.PostFormValue("text"), "\r\n", "\n"))
+	if utf8.RuneCountInString(text) > max_note_length {
+		s.renderError(w, r, http.StatusBadRequest, fmt.Sprintf("Notes can be up to %d characters long.", max_note_length))
+		return
+	}
+	if text == "" || r.PostFormValue("delete") == "1" {
+		user, ok := SignedCookie(r, "user")
+		if ok {
+			err = s.Store.DeleteNote(r.Context(), user, book.ID, chapter, number)
+		}
+	} else {
+		err = s.Store.SaveNote(r.Context(), UserToken(w, r), Note{Book: book.ID, Chapter: chapter, Verse: number, Text: text, Updated: time.Now().UTC()})
+	}
+	if err != nil {
+		Logger(r.Context()).Error("saving note", "err", err)
+		s.renderError(w, r, http.StatusInternalServerError, "Your note couldn't be saved. Please try again.")
+		return
+	}
+	redirectBack(w, r, s.VerseLink(translation, book, chapter, number).URL)
+}
+
+type NoteItem struct {
+	Link    Link
+	Text    string
+	Updated time.Time
+}
+
+// getNotes lists the visitor's notes, newest first, or those containing
+// ?q=.
+func (s *Server) getNotes(w http.ResponseWriter, r *http.Request) {
+	translation := RequestTranslation(r)
+	page := NotesPage{Query: strings.TrimSpace(r.URL.Query().Get("q")), Translation: translation}
+	if translation == default_translation {
+		page.Translation = ""
+	}
+	var notes []Note
+	if user, ok := SignedCookie(r, "user"); ok {
+		var err error
+		notes, err = s.Store.LoadNotes(r.Context(), user, page.Query)
+		if err != nil {
+			Logger(r.Context()).Error("loading notes", "err", err)
+			s.renderError(w, r, http.StatusInternalServerError, "Your notes couldn't be loaded. Please try again.")
+			return
+		}
+	}
+	for _, note := range notes {
+		item := NoteItem{Link: Link{Text: fmt.Sprintf("%s %d:%d", note.Book, note.Chapter, note.Verse)}, Text: note.Text, Updated: note.Updated}
+		var book Book
+		if s.Books.BookByID(r.Context(), translation, note.Book, &book) == nil {
+			item.Link = s.VerseLink(translation, book, note.Chapter, note.Verse)
+		}
+		page.Notes = append(page.Notes, item)
+	}
+	s.RenderPage(w, r, http.StatusOK, "notes.html", "Notes", page)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// TranslationDump is a whole translation in one file, built from the same
+// responses bible-api.com gives for /data/{translation}, /data/{translation}/{book}
+// and /data/{translation}/{book}/{chapter}.
+type TranslationDump struct {
+	BookInfo BookInfo               `json:"book_info"`
+	Chapters map[string]ChapterInfo `json:"chapters"`
+	Verses   map[string]VerseInfo   `json:"verses"`
+}
+
+// local_data replaces bible-api.com entirely when -data is given.
+var local_data *TranslationDump
+
+func dumpVerseKey(book string, chapter string) string {
+	return book + "/" + chapter
+}
+
+func LoadDump(path string) (*TranslationDump, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var dump TranslationDump
+	err = json.NewDecoder(f).Decode(&dump)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &dump, nil
+}
+
+func (d *TranslationDump) translationError(translation string) error {
+	if translation != d.BookInfo.Translation.Identifier {
+		return fmt.Errorf("%w: translation %q is not in the local data", ErrNotFound, translation)
+	}
+	return nil
+}
+
+func (d *TranslationDump) GetBookInfo(translation string, book_info *BookInfo) error {
+	err := d.translationError(translation)
+	if err != nil {
+		return err
+	}
+	*book_info = d.BookInfo
+	return nil
+}
+
+func (d *TranslationDump) GetChapterInfo(translation string, book string, chapter_info *ChapterInfo) error {
+	err := d.translationError(translation)
+	if err != nil {
+		return err
+	}
+	info, ok := d.Chapters[book]
+	if !ok {
+		return fmt.Errorf("%w: book %q is not in the local data", ErrNotFound, book)
+	}
+	*chapter_info = info
+	return nil
+}
+
+func (d *TranslationDump) GetVerseInfo(translation string, book string, chapter string, verse_info *VerseInfo) error {
+	err := d.translationError(translation)
+	if err != nil {
+		return err
+	}
+	info, ok := d.Verses[dumpVerseKey(book, chapter)]
+	if !ok {
+		return fmt.Errorf("%w: %s %s is not in the local data", ErrNotFound, book, chapter)
+	}
+	*verse_info = info
+	return nil
+}
+
+// Download fetches a whole translation from the live API and writes it to
+// path in the form -data reads.
+func (s *Server) Download(ctx context.Context, translation string, path string, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	dump := TranslationDump{Chapters: map[string]ChapterInfo{}, Verses: map[string]VerseInfo{}}
+	err := s.Bible.GetBookInfo(ctx, translation, &dump.BookInfo)
+	if err != nil {
+		return err
+	}
+	for _, book := range dump.BookInfo.Books {
+		<-ticker.C
+		var chapter_info ChapterInfo
+		err = s.Bible.GetChapterInfo(ctx, translation, book.ID, &chapter_info)
+		if err != nil {
+			return err
+		}
+		dump.Chapters[book.ID] = chapter_info
+
+		for _, chapter := range chapter_info.Chapters {
+			<-ticker.C
+			number := strconv.Itoa(chapter.Chapter)
+			var verse_info VerseInfo
+			err = s.Bible.GetVerseInfo(ctx, translation, book.ID, number, &verse_info)
+			if err != nil {
+				return err
+			}
+			dump.Verses[dumpVerseKey(book.ID, number)] = verse_info
+		}
+		fmt.Printf("downloaded %s (%d chapters)\n", book.Name, len(chapter_info.Chapters))
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(f).Encode(dump)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	og_width  = 1200
+	og_height = 630
+	og_margin = 80
+	// verse text is tried at og_max_size, then og_size_step smaller at a
+	// time down to og_min_size until it fits
+	og_max_size       = 64
+	og_min_size       = 28
+	og_size_step      = 6
+	og_reference_size = 34
+	og_cache_size     = 256
+)
+
+// og_background is the share image background, set with -og-background.
+var og_background = color.RGBA{R: 0x1f, G: 0x2a, B: 0x38, A: 0xff}
+
+var og_foreground = color.RGBA{R: 0xf5, G: 0xf1, B: 0xe8, A: 0xff}
+
+var og_font = sync.OnceValues(func() (*opentype.Font, error) {
+	return opentype.Parse(goregular.TTF)
+})
+
+// ParseHexColor reads a color written like "#1f2a38" or "1f2a38".
+func ParseHexColor(value string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(value, "#")
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("%q isn't a color like #1f2a38", value)
+	}
+	return color.RGBA{R: uint8(n >> 16), G: uint8(n >> 8), B: uint8(n), A: 0xff}, nil
+}
+
+// WrapText breaks text into lines no wider than width when drawn with face.
+// A word wider than width gets a line to itself.
+func WrapText(face font.Face, text string, width fixed.Int26_6) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if line != "" && font.MeasureString(face, candidate) > width {
+			lines = append(lines, line)
+			line = word
+			continue
+		}
+		line = candidate
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// elide drops words from the end of line until it fits in width with "…"
+// after it.
+func elide(face font.Face, line string, width fixed.Int26_6) string {
+	words := strings.Fields(line)
+	for len(words) > 0 {
+		candidate := strings.Join(words, " ") + "…"
+		if font.MeasureString(face, candidate) <= width {
+			return candidate
+		}
+		words = words[:len(words)-1]
+	}
+	return "…"
+}
+
+// layoutVerse picks the largest font size the verse fits at in height,
+// stepping down to og_min_size. Past that the lines that don't fit are cut
+// and the last one ends in an ellipsis.
+func layoutVerse(f *opentype.Font, text string, width int, height int) (font.Face, []string, error) {
+	for size := og_max_size; ; size -= og_size_step {
+		size = max(size, og_min_size)
+		face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: float64(size), DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			return nil, nil, err
+		}
+		lines := WrapText(face, text, fixed.I(width))
+		fit := max(height/face.Metrics().Height.Ceil(), 1)
+		if len(lines) <= fit {
+			return face, lines, nil
+		}
+		if size == og_min_size {
+			lines = lines[:fit]
+			lines[fit-1] = elide(face, lines[fit-1], fixed.I(width))
+			return face, lines, nil
+		}
+		face.Close()
+	}
+}
+
+// RenderShareImage draws a verse and its reference onto a 1200×630 PNG, the
+// size link previews expect.
+func RenderShareImage(text string, reference string) ([]byte, error) {
+	f, err := og_font()
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewRGBA(image.Rect(0, 0, og_width, og_height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(og_background), image.Point{}, draw.Src)
+
+	reference_face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: og_reference_size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer reference_face.Close()
+	reference_height := 2 * reference_face.Metrics().Height.Ceil()
+
+	text_width := og_width - 2*og_margin
+	face, lines, err := layoutVerse(f, text, text_width, og_height-2*og_margin-reference_height)
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	drawer := font.Drawer{Dst: img, Src: image.NewUniform(og_foreground), Face: face}
+	line_height := face.Metrics().Height
+	y := fixed.I(og_margin) + face.Metrics().Ascent
+	for _, line := range lines {
+		drawer.Dot = fixed.Point26_6{X: fixed.I(og_margin), Y: y}
+		drawer.DrawString(line)
+		y += line_height
+	}
+
+	drawer.Face = reference_face
+	drawer.Dot = fixed.Point26_6{X: fixed.I(og_margin), Y: fixed.I(og_height - og_margin)}
+	drawer.DrawString("— " + reference)
+
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type imageCacheEntry struct {
+	key   string
+	data  []byte
+	added time.Time
+}
+
+// ImageCache keeps the most recently used share images, since drawing one
+// takes far longer than serving it. It holds at most Size images.
+type ImageCache struct {
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+	group   FetchGroup
+	Size    int
+}
+
+func (c *ImageCache) Get(ctx context.Context, key string, data *[]byte, render func(context.Context, *[]byte) error) error {
+	c.mu.Lock()
+	element, ok := c.entries[key]
+	if ok {
+		c.order.MoveToFront(element)
+		*data = element.Value.(imageCacheEntry).data
+	}
+	c.mu.Unlock()
+	if ok {
+		recordLookup(ctx, "og_image", "hit")
+		return nil
+	}
+	recordLookup(ctx, "og_image", "miss")
+
+	err := sharedFetch(ctx, &c.group, key, data, render)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = c.order.PushFront(imageCacheEntry{key: key, data: *data, added: time.Now()})
+	}
+	for c.order.Len() > c.Size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(imageCacheEntry).key)
+	}
+	return nil
+}
+
+func (c *ImageCache) Entries() []CacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := make([]CacheEntry, 0, c.order.Len())
+	for element := c.order.Front(); element != nil; element = element.Next() {
+		entry := element.Value.(imageCacheEntry)
+		entries = append(entries, CacheEntry{Key: entry.key, Size: len(entry.data), Added: entry.added})
+	}
+	return entries
+}
+
+func (c *ImageCache) Flush(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	flushed := 0
+	for k, element := range c.entries {
+		if key == "" || k == key {
+			c.order.Remove(element)
+			delete(c.entries, k)
+			flushed++
+		}
+	}
+	return flushed
+}
+
+// ShareImagePath is the /og image of one verse.
+func (s *Server) ShareImagePath(translation string, book Book, chapter int, verse int) string {
+	link := s.Path("share-image", "book", BookSlug(book.Name), "chapter", strconv.Itoa(chapter), "verse", strconv.Itoa(verse))
+	if translation != default_translation {
+		link += "?translation=" + translation
+	}
+	return link
+}
+
+// absoluteURL makes a site path into the full URL link previews need, from
+// the host the request came in on.
+func absoluteURL(r *http.Request, site_path string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + site_path
+}
+
+// getShareImage serves /og/{book}/{chapter}/{verse}.png.
+func (s *Server) getShareImage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	translation := RequestTranslation(r)
+	number, err := ParseNumber("verse", vars["verse"])
+	if err != nil {
+		textError(w, r, err)
+		return
+	}
+
+	var book Book
+	var verse_info VerseInfo
+	var verse Verse
+	err = s.LoadVerse(r.Context(), translation, vars["book"], vars["chapter"], number, &book, &verse_info, &verse)
+	if err != nil {
+		textError(w, r, err)
+		return
+	}
+
+	key := fmt.Sprintf("%s/%s/%d/%d", translation, book.ID, verse.Chapter, verse.Verse)
+	var data []byte
+	err = s.Images.Get(r.Context(), key, &data, func(ctx context.Context, data *[]byte) error {
+		reference := fmt.Sprintf("%s %d:%d (%s)", book.Name, verse.Chapter, verse.Verse, verse_info.Translation.Name)
+		var err error
+		*data, err = RenderShareImage(verseText(verse.Text), reference)
+		return err
+	})
+	if err != nil {
+		textError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpenAPIParam is a path or query parameter of an API operation.
+type OpenAPIParam struct {
+	Name        string
+	In          string
+	Description string
+	Type        string
+	Required    bool
+	Enum        []string
+}
+
+// APIOperation describes one endpoint of the API, a GET unless Method says
+// otherwise. Its request and response schemas come from the Go types the
+// handler decodes and encodes, so the spec can't drift from what is
+// actually sent.
+type APIOperation struct {
+	Path     string
+	Method   string
+	ID       string
+	Summary  string
+	Params   []OpenAPIParam
+	Body     reflect.Type
+	Response reflect.Type
+}
+
+var (
+	translation_param = OpenAPIParam{Name: "translation", In: "query", Description: "translation identifier, like kjv, instead of the default", Type: "string"}
+	book_param        = OpenAPIParam{Name: "book", In: "path", Description: "book slug, name or abbreviation, like john or 1cor", Type: "string", Required: true}
+	chapter_param     = OpenAPIParam{Name: "chapter", In: "path", Description: "chapter number", Type: "integer", Required: true}
+)
+
+var api_operations = []APIOperation{
+	{
+		Path: "/api/v1/books", ID: "listBooks", Summary: "List the books of a translation",
+		Params:   []OpenAPIParam{translation_param},
+		Response: reflect.TypeFor[BookInfo](),
+	},
+	{
+		Path: "/api/v1/{book}/chapters", ID: "listChapters", Summary: "List the chapters of a book",
+		Params:   []OpenAPIParam{book_param, translation_param},
+		Response: reflect.TypeFor[ChapterInfo](),
+	},
+	{
+		Path: "/api/v1/{book}/{chapter}", ID: "getChapter", Summary: "Get the verses of a chapter",
+		Params:   []OpenAPIParam{book_param, chapter_param, translation_param},
+		Response: reflect.TypeFor[VerseInfo](),
+	},
+	{
+		Path: "/api/v1/{book}/{chapter}/{verse}", ID: "getVerse", Summary: "Get a single verse",
+		Params:   []OpenAPIParam{book_param, chapter_param, {Name: "verse", In: "path", Description: "verse number", Type: "integer", Required: true}, translation_param},
+		Response: reflect.TypeFor[SingleVerseInfo](),
+	},
+	{
+		Path: "/api/v1/random", ID: "getRandomVerse", Summary: "Get a random verse",
+		Params: []OpenAPIParam{
+			{Name: "book", In: "query", Description: "only pick from this book", Type: "string"},
+			{Name: "testament", In: "query", Description: "only pick from this testament", Type: "string", Enum: []string{OldTestament, NewTestament}},
+			translation_param,
+		},
+		Response: reflect.TypeFor[SingleVerseInfo](),
+	},
+	{
+		Path: "/api/v1/votd", ID: "getVerseOfTheDay", Summary: "Get the verse of the day",
+		Params:   []OpenAPIParam{{Name: "date", In: "query", Description: "day to get the verse of, like 2024-01-01, today if missing", Type: "string"}, translation_param},
+		Response: reflect.TypeFor[VerseOfTheDayInfo](),
+	},
+	{
+		Path: "/api/v1/complete", ID: "completeReference", Summary: "Suggest books and chapters for a partly typed reference",
+		Params:   []OpenAPIParam{{Name: "q", In: "query", Description: "what has been typed so far, like \"1 c\"", Type: "string"}, translation_param},
+		Response: reflect.TypeFor[[]Completion](),
+	},
+	{
+		Path: "/api/v1/passages", Method: http.MethodPost, ID: "getPassages", Summary: "Get several passages at once, each with its own status",
+		Params:   []OpenAPIParam{{Name: "translation", In: "query", Description: "translation identifier, if the body doesn't name one", Type: "string"}},
+		Body:     reflect.TypeFor[PassagesRequest](),
+		Response: reflect.TypeFor[[]PassageResult](),
+	},
+	{
+		Path: "/search", ID: "search", Summary: "Search the text of the default translation",
+		Params: []OpenAPIParam{
+			{Name: "format", In: "query", Description: "json, or send Accept: application/json", Type: "string", Required: true, Enum: []string{"json"}},
+			{Name: "q", In: "query", Description: "words that must all appear; quote phrases, -word excludes, a|b accepts either", Type: "string", Required: true},
+			{Name: "book", In: "query", Description: "only search this book", Type: "string"},
+			{Name: "testament", In: "query", Description: "only search this testament", Type: "string", Enum: []string{"ot", "nt", "ap"}},
+			{Name: "page", In: "query", Description: "page of results, from 1", Type: "integer"},
+			{Name: "per_page", In: "query", Description: "results per page, at most 100", Type: "integer"},
+		},
+		Response: reflect.TypeFor[SearchResponse](),
+	},
+}
+
+// openAPISchemas builds JSON Schemas from Go types, collecting each struct
+// once under components/schemas by its type name.
+type openAPISchemas map[string]any
+
+func (s openAPISchemas) schema(t reflect.Type) map[string]any {
+	switch t {
+	case reflect.TypeFor[time.Time]():
+		return map[string]any{"type": "string", "format": "date-time"}
+	case reflect.TypeFor[template.HTML]():
+		return map[string]any{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.schema(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		ref := map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := s[t.Name()]; ok {
+			return ref
+		}
+		// a placeholder first, in case the struct refers to itself
+		s[t.Name()] = nil
+		properties := map[string]any{}
+		var required []string
+		for i := range t.NumField() {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = s.schema(field.Type)
+			if !strings.Contains(options, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		object := map[string]any{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			object["required"] = required
+		}
+		s[t.Name()] = object
+		return ref
+	}
+	return map[string]any{}
+}
+
+// OpenAPISpec is the OpenAPI 3 document for api_operations.
+func OpenAPISpec() map[string]any {
+	schemas := openAPISchemas{}
+	error_response := map[string]any{
+		"description": "The error, with the same status as the response",
+		"content":     map[string]any{"application/json": map[string]any{"schema": schemas.schema(reflect.TypeFor[ErrorResponse]())}},
+	}
+	paths := map[string]any{}
+	for _, operation := range api_operations {
+		var params []any
+		for _, param := range operation.Params {
+			schema := map[string]any{"type": param.Type}
+			if len(param.Enum) > 0 {
+				schema["enum"] = param.Enum
+			}
+			params = append(params, map[string]any{
+				"name":        param.Name,
+				"in":          param.In,
+				"description": param.Description,
+				"required":    param.Required,
+				"schema":      schema,
+			})
+		}
+		spec := map[string]any{
+			"operationId": operation.ID,
+			"summary":     operation.Summary,
+			"parameters":  params,
+			"responses": map[string]any{
+				"200": map[string]any{
+					"description": "OK",
+					"content":     map[string]any{"application/json": map[string]any{"schema": schemas.schema(operation.Response)}},
+				},
+				"default": error_response,
+			},
+		}
+		if operation.Body != nil {
+			spec["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"application/json": map[string]any{"schema": schemas.schema(operation.Body)}},
+			}
+		}
+		method := http.MethodGet
+		if operation.Method != "" {
+			method = operation.Method
+		}
+		paths[operation.Path] = map[string]any{strings.ToLower(method): spec}
+	}
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       site_name + " API",
+			"description": "Bible text from bible-api.com as JSON.",
+			"version":     current_api_version,
+		},
+		"servers":    []any{map[string]any{"url": SitePath("/")}},
+		"paths":      paths,
+		"components": map[string]any{"schemas": map[string]any(schemas)},
+	}
+}
+
+// openapi_spec is built once at startup, after the flags have set
+// -base-path.
+var openapi_spec = sync.OnceValue(OpenAPISpec)
+
+func getOpenAPI(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, openapi_spec())
+}
+
+type APIDocsPage struct {
+	Spec string
+}
+
+// getAPIDocs serves /api/v1/docs, Swagger UI pointed at its openapi.json. It
+// is a page of its own since Swagger UI brings its own layout.
+func (s *Server) getAPIDocs(w http.ResponseWriter, r *http.Request) {
+	var buf strings.Builder
+	err := s.templates["apidocs.html"].ExecuteTemplate(&buf, "apidocs", APIDocsPage{Spec: SitePath("api", current_api_version, "openapi.json")})
+	if err != nil {
+		Logger(r.Context()).Error("rendering API docs", "err", err)
+		s.renderError(w, r, http.StatusInternalServerError, "Something went wrong while building this page.")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(buf.String()))
+}
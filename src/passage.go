@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// VerseRange is an inclusive range of verse numbers within a chapter.
+type VerseRange struct {
+	Start int
+	End   int
+}
+
+var ErrInvalidVerses = errors.New("invalid verse range")
+
+// ParseVerseRanges parses verse specs like "16", "16-18" or "1,3,5-7".
+func ParseVerseRanges(spec string) ([]VerseRange, error) {
+	var ranges []VerseRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidVerses, spec)
+		}
+
+		start_str, end_str, is_range := strings.Cut(part, "-")
+		start, err := parseVerseNumber(start_str)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidVerses, spec)
+		}
+		end := start
+		if is_range {
+			end, err = parseVerseNumber(end_str)
+			if err != nil || end < start {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidVerses, spec)
+			}
+		}
+		ranges = append(ranges, VerseRange{Start: start, End: end})
+	}
+	return ranges, nil
+}
+
+func parseVerseNumber(s string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 {
+		return 0, errors.New("verse numbers start at 1")
+	}
+	return n, nil
+}
+
+// FormatVerseRanges turns ranges back into the "1,3,5-7" form used in titles.
+func FormatVerseRanges(ranges []VerseRange) string {
+	parts := make([]string, 0, len(ranges))
+	for _, vr := range ranges {
+		if vr.Start == vr.End {
+			parts = append(parts, strconv.Itoa(vr.Start))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", vr.Start, vr.End))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseNumber reads a chapter or verse number from the URL, which must be a
+// whole number of at least 1. kind names it in the error.
+func ParseNumber(kind string, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, &InvalidNumberError{Kind: kind, Value: value}
+	}
+	return n, nil
+}
+
+func VerseInRanges(verse int, ranges []VerseRange) bool {
+	for _, vr := range ranges {
+		if verse >= vr.Start && verse <= vr.End {
+			return true
+		}
+	}
+	return false
+}
+
+// LastVerse is the number of the last of a chapter's verses, which isn't
+// always how many it has, since translations leave some numbers out.
+func LastVerse(verses []Verse) int {
+	if len(verses) == 0 {
+		return 0
+	}
+	return verses[len(verses)-1].Verse
+}
+
+// AdjacentVerses are the numbers of the verses before and after number in a
+// chapter, skipping any the translation leaves out, or 0 where there's
+// none.
+func AdjacentVerses(verses []Verse, number int) (previous int, next int) {
+	for _, verse := range verses {
+		if verse.Verse < number {
+			previous = max(previous, verse.Verse)
+		}
+		if verse.Verse > number && (next == 0 || verse.Verse < next) {
+			next = verse.Verse
+		}
+	}
+	return previous, next
+}
+
+// PassageVerses keeps the verses that fall inside ranges.
+func PassageVerses(verses []Verse, ranges []VerseRange) []Verse {
+	var passage []Verse
+	for _, verse := range verses {
+		if VerseInRanges(verse.Verse, ranges) {
+			passage = append(passage, verse)
+		}
+	}
+	return passage
+}
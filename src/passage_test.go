@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseVerseRanges(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []VerseRange
+	}{
+		{"16", []VerseRange{{16, 16}}},
+		{"16-18", []VerseRange{{16, 18}}},
+		{"1,3,5-7", []VerseRange{{1, 1}, {3, 3}, {5, 7}}},
+		{" 1 , 3 - 4 ", []VerseRange{{1, 1}, {3, 4}}},
+		{"7-7", []VerseRange{{7, 7}}},
+		{"176", []VerseRange{{176, 176}}},
+		{"5-7,1", []VerseRange{{5, 7}, {1, 1}}},
+	}
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			ranges, err := ParseVerseRanges(test.spec)
+			if err != nil {
+				t.Fatalf("ParseVerseRanges(%q): %v", test.spec, err)
+			}
+			if !slices.Equal(ranges, test.want) {
+				t.Errorf("ParseVerseRanges(%q) = %v, want %v", test.spec, ranges, test.want)
+			}
+		})
+	}
+}
+
+func TestParseVerseRangesInvalid(t *testing.T) {
+	for _, spec := range []string{"", ",", "1,", ",1", "0", "-1", "1-", "-", "18-16", "a", "1-b", "1--2", "1,,2", "1.5"} {
+		t.Run(spec, func(t *testing.T) {
+			ranges, err := ParseVerseRanges(spec)
+			if !errors.Is(err, ErrInvalidVerses) {
+				t.Errorf("ParseVerseRanges(%q) = %v, %v, want ErrInvalidVerses", spec, ranges, err)
+			}
+		})
+	}
+}
+
+func TestFormatVerseRanges(t *testing.T) {
+	tests := []struct {
+		ranges []VerseRange
+		want   string
+	}{
+		{[]VerseRange{{16, 16}}, "16"},
+		{[]VerseRange{{16, 18}}, "16-18"},
+		{[]VerseRange{{1, 1}, {3, 3}, {5, 7}}, "1,3,5-7"},
+		{nil, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			if got := FormatVerseRanges(test.ranges); got != test.want {
+				t.Errorf("FormatVerseRanges(%v) = %q, want %q", test.ranges, got, test.want)
+			}
+		})
+	}
+}
+
+func TestVerseInRanges(t *testing.T) {
+	ranges := []VerseRange{{1, 1}, {3, 3}, {5, 7}}
+	tests := []struct {
+		verse int
+		want  bool
+	}{
+		{1, true},
+		{2, false},
+		{3, true},
+		{4, false},
+		{5, true},
+		{6, true},
+		{7, true},
+		{8, false},
+	}
+	for _, test := range tests {
+		if got := VerseInRanges(test.verse, ranges); got != test.want {
+			t.Errorf("VerseInRanges(%d) = %t, want %t", test.verse, got, test.want)
+		}
+	}
+}
+
+// verseNumbers is a chapter with just the numbered verses, like one whose
+// translation leaves some out.
+func verseNumbers(numbers ...int) []Verse {
+	verses := make([]Verse, len(numbers))
+	for i, number := range numbers {
+		verses[i] = Verse{Verse: number}
+	}
+	return verses
+}
+
+func TestAdjacentVerses(t *testing.T) {
+	tests := []struct {
+		name     string
+		verses   []Verse
+		number   int
+		previous int
+		next     int
+	}{
+		{"middle", verseNumbers(1, 2, 3), 2, 1, 3},
+		{"first", verseNumbers(1, 2, 3), 1, 0, 2},
+		{"last", verseNumbers(1, 2, 3), 3, 2, 0},
+		{"gap after", verseNumbers(10, 11, 13, 14), 11, 10, 13},
+		{"gap before", verseNumbers(10, 11, 13, 14), 13, 11, 14},
+		{"missing verse", verseNumbers(10, 11, 13, 14), 12, 11, 13},
+		{"past the end", verseNumbers(1, 2, 3), 5, 3, 0},
+		{"no verses", nil, 1, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			previous, next := AdjacentVerses(test.verses, test.number)
+			if previous != test.previous || next != test.next {
+				t.Errorf("AdjacentVerses(%d) = %d, %d, want %d, %d", test.number, previous, next, test.previous, test.next)
+			}
+		})
+	}
+}
+
+func TestLastVerse(t *testing.T) {
+	tests := []struct {
+		name   string
+		verses []Verse
+		want   int
+	}{
+		{"numbered in full", verseNumbers(1, 2, 3), 3},
+		{"missing verses", verseNumbers(1, 2, 4, 5, 7), 7},
+		{"no verses", nil, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := LastVerse(test.verses); got != test.want {
+				t.Errorf("LastVerse = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPassageVerses(t *testing.T) {
+	verses := verseNumbers(1, 2, 3, 5, 6, 7, 8)
+	tests := []struct {
+		spec string
+		want []int
+	}{
+		{"2", []int{2}},
+		{"2-5", []int{2, 3, 5}},
+		{"1,3,5-7", []int{1, 3, 5, 6, 7}},
+		{"4", nil},
+		{"9-12", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			ranges, err := ParseVerseRanges(test.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, verse := range PassageVerses(verses, ranges) {
+				got = append(got, verse.Verse)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("PassageVerses(%q) = %v, want %v", test.spec, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPassagePages(t *testing.T) {
+	handler := newTestServer(t)
+	tests := []struct {
+		name   string
+		target string
+		status int
+		want   []string
+	}{
+		{"single verse", "/john/3/16", http.StatusOK, []string{"John 3:16", "For God so loved the world"}},
+		{"range", "/john/3/16-17", http.StatusOK, []string{"John 3:16-17", "For God so loved the world", "For God didn’t send his Son"}},
+		{"list", "/john/3/1,16", http.StatusOK, []string{"John 3:1,16", "Nicodemus", "For God so loved the world"}},
+		{"range past the end", "/john/3/35-40", http.StatusOK, []string{"Verse 35 of John 3.", "Verse 36 of John 3."}},
+		{"range out of the chapter", "/john/3/37-40", http.StatusNotFound, []string{"John 3:37-40 is not in this chapter. It has 36 verses.", `href="/john/3"`}},
+		{"backwards range", "/john/3/18-16", http.StatusBadRequest, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := get(t, handler, test.target)
+			if w.Code != test.status {
+				t.Fatalf("GET %s: status %d, want %d", test.target, w.Code, test.status)
+			}
+			body := w.Body.String()
+			for _, want := range test.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("GET %s: body doesn't contain %q", test.target, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/sync/errgroup"
+)
+
+// default_chapter_verses weighs a chapter missing from verse_counts, like
+// those of the Apocrypha.
+const default_chapter_verses = 26
+
+// PlanDefinition describes a reading plan. Each track is split over Days on
+// its own and the tracks are read side by side, so a Psalms and Proverbs
+// plan has some of each every day instead of all the Psalms first.
+type PlanDefinition struct {
+	Slug        string
+	Name        string
+	Description string
+	Days        int
+	Tracks      []func(book Book) bool
+}
+
+func inTestaments(testaments ...string) func(book Book) bool {
+	return func(book Book) bool {
+		for _, testament := range testaments {
+			if Testament(book.ID) == testament {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func isBook(id string) func(book Book) bool {
+	return func(book Book) bool {
+		return book.ID == id
+	}
+}
+
+var reading_plans = []PlanDefinition{
+	{
+		Slug:        "bible-in-a-year",
+		Name:        "The Bible in a year",
+		Description: "Genesis to Revelation in 365 days.",
+		Days:        365,
+		Tracks:      []func(Book) bool{inTestaments(OldTestament, NewTestament)},
+	},
+	{
+		Slug:        "new-testament-90",
+		Name:        "The New Testament in 90 days",
+		Description: "Matthew to Revelation in three months.",
+		Days:        90,
+		Tracks:      []func(Book) bool{inTestaments(NewTestament)},
+	},
+	{
+		Slug:        "psalms-proverbs",
+		Name:        "Psalms and Proverbs in a month",
+		Description: "A few psalms and a chapter of Proverbs every day for 31 days.",
+		Days:        31,
+		Tracks:      []func(Book) bool{isBook("PSA"), isBook("PRO")},
+	},
+}
+
+func findPlan(slug string) (PlanDefinition, bool) {
+	for _, plan := range reading_plans {
+		if plan.Slug == slug {
+			return plan, true
+		}
+	}
+	return PlanDefinition{}, false
+}
+
+type PlanChapter struct {
+	Book    Book
+	Chapter int
+	Verses  int
+}
+
+// chapterVerses is how many verses a chapter weighs in a plan.
+func chapterVerses(book_id string, chapter int) int {
+	counts := verse_counts[book_id]
+	if chapter < 1 || chapter > len(counts) {
+		return default_chapter_verses
+	}
+	return counts[chapter-1]
+}
+
+// SplitPlan divides chapters, in order, into days readings of about the same
+// number of verses. Each day ends at whichever chapter boundary comes
+// closest to its share of the total, and every day gets at least one
+// chapter while there are enough to go round; if there are fewer chapters
+// than days the last days are empty.
+func SplitPlan(chapters []PlanChapter, days int) [][]PlanChapter {
+	total := 0
+	for _, chapter := range chapters {
+		total += chapter.Verses
+	}
+	split := make([][]PlanChapter, days)
+	i, read := 0, 0
+	for day := range days {
+		target := float64(total) * float64(day+1) / float64(days)
+		later_days := days - day - 1
+		for i < len(chapters) {
+			taken := len(split[day]) > 0
+			if taken && later_days > 0 && len(chapters)-i <= later_days {
+				break
+			}
+			if taken && later_days > 0 && float64(read)+float64(chapters[i].Verses)/2 > target {
+				break
+			}
+			split[day] = append(split[day], chapters[i])
+			read += chapters[i].Verses
+			i++
+		}
+	}
+	return split
+}
+
+type PlanDay struct {
+	Number   int
+	Chapters []PlanChapter
+}
+
+// Plan is a PlanDefinition laid out over the chapters of a translation.
+type Plan struct {
+	PlanDefinition
+	Translation string
+	Days        []PlanDay
+}
+
+// BuildPlan lays definition out over books and their chapters, given in
+// Bible order.
+func BuildPlan(definition PlanDefinition, translation string, books []Book, chapters map[string][]Chapter) Plan {
+	plan := Plan{PlanDefinition: definition, Translation: translation, Days: make([]PlanDay, definition.Days)}
+	for i := range plan.Days {
+		plan.Days[i].Number = i + 1
+	}
+	for _, track := range definition.Tracks {
+		var track_chapters []PlanChapter
+		for _, book := range books {
+			if !track(book) {
+				continue
+			}
+			for _, chapter := range chapters[book.ID] {
+				track_chapters = append(track_chapters, PlanChapter{Book: book, Chapter: chapter.Chapter, Verses: chapterVerses(book.ID, chapter.Chapter)})
+			}
+		}
+		for i, day := range SplitPlan(track_chapters, definition.Days) {
+			plan.Days[i].Chapters = append(plan.Days[i].Chapters, day...)
+		}
+	}
+	return plan
+}
+
+// PlanCache keeps plans once laid out. They only change if a translation's
+// chapter list does, which it doesn't.
+type PlanCache struct {
+	mu      sync.RWMutex
+	entries map[string]planCacheEntry
+	group   FetchGroup
+}
+
+type planCacheEntry struct {
+	plan  Plan
+	added time.Time
+}
+
+func (c *PlanCache) Entries() []CacheEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entries := make([]CacheEntry, 0, len(c.entries))
+	for key, entry := range c.entries {
+		entries = append(entries, CacheEntry{Key: key, Size: estimateSize(entry.plan), Added: entry.added})
+	}
+	return entries
+}
+
+func (c *PlanCache) Flush(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return flushMap(c.entries, key)
+}
+
+// LoadPlan lays out a reading plan over the chapter lists of a translation,
+// fetching those it doesn't have cached yet.
+func (s *Server) LoadPlan(ctx context.Context, translation string, slug string, plan *Plan) error {
+	definition, ok := findPlan(slug)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrPlanNotFound, slug)
+	}
+	key := translation + "/" + slug
+	s.Plans.mu.RLock()
+	cached, ok := s.Plans.entries[key]
+	s.Plans.mu.RUnlock()
+	if ok {
+		recordLookup(ctx, "plans", "hit")
+		*plan = cached.plan
+		return nil
+	}
+	recordLookup(ctx, "plans", "miss")
+
+	err := sharedFetch(ctx, &s.Plans.group, key, plan, func(ctx context.Context, plan *Plan) error {
+		var book_info BookInfo
+		err := s.Books.Get(ctx, translation, &book_info)
+		if err != nil {
+			return err
+		}
+		var books []Book
+		for _, book := range book_info.Books {
+			for _, track := range definition.Tracks {
+				if track(book) {
+					books = append(books, book)
+					break
+				}
+			}
+		}
+
+		chapter_lists := make([][]Chapter, len(books))
+		g, ctx := errgroup.WithContext(ctx)
+		g.SetLimit(markdown_workers)
+		for i, book := range books {
+			g.Go(func() error {
+				var chapter_info ChapterInfo
+				err := s.Chapters.Get(ctx, translation, book.ID, &chapter_info)
+				chapter_lists[i] = chapter_info.Chapters
+				return err
+			})
+		}
+		err = g.Wait()
+		if err != nil {
+			return err
+		}
+		chapters := map[string][]Chapter{}
+		for i, book := range books {
+			chapters[book.ID] = chapter_lists[i]
+		}
+		*plan = BuildPlan(definition, translation, books, chapters)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.Plans.mu.Lock()
+	s.Plans.entries[key] = planCacheEntry{plan: *plan, added: time.Now()}
+	s.Plans.mu.Unlock()
+	return nil
+}
+
+// PlanReading is a run of chapters of one book read on a day, like
+// "Genesis 1-3".
+type PlanReading struct {
+	Text     string
+	Chapters []Link
+}
+
+// runs groups a day's chapters into runs of the same book.
+func (d PlanDay) runs() [][]PlanChapter {
+	var runs [][]PlanChapter
+	for i, chapter := range d.Chapters {
+		if i > 0 && chapter.Book.ID == d.Chapters[i-1].Book.ID && chapter.Chapter == d.Chapters[i-1].Chapter+1 {
+			runs[len(runs)-1] = append(runs[len(runs)-1], chapter)
+			continue
+		}
+		runs = append(runs, []PlanChapter{chapter})
+	}
+	return runs
+}
+
+// runText names a run of chapters, like "Genesis 1-3".
+func runText(run []PlanChapter) string {
+	first, last := run[0], run[len(run)-1]
+	if first.Chapter == last.Chapter {
+		return fmt.Sprintf("%s %d", first.Book.Name, first.Chapter)
+	}
+	return fmt.Sprintf("%s %d-%d", first.Book.Name, first.Chapter, last.Chapter)
+}
+
+// PlanReadings is a day's runs of chapters, each chapter linked to.
+func (s *Server) PlanReadings(translation string, d PlanDay) []PlanReading {
+	var readings []PlanReading
+	for _, run := range d.runs() {
+		reading := PlanReading{Text: runText(run)}
+		for _, chapter := range run {
+			link := s.ChapterLink(translation, chapter.Book, chapter.Chapter)
+			link.Text = strconv.Itoa(chapter.Chapter)
+			reading.Chapters = append(reading.Chapters, link)
+		}
+		readings = append(readings, reading)
+	}
+	return readings
+}
+
+// Summary is the day's readings on one line, like "Psalms 1-5; Proverbs 1".
+func (d PlanDay) Summary() string {
+	var parts []string
+	for _, run := range d.runs() {
+		parts = append(parts, runText(run))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// PlanProgress is the set of days of a plan that have been read.
+type PlanProgress map[int]bool
+
+// progressCookie is the cookie a plan's progress is kept in without -db.
+func progressCookie(slug string) string {
+	return "plan-" + slug
+}
+
+// encodeProgress packs the days read into a bitset, so a whole year fits in
+// a 62 character cookie.
+func encodeProgress(progress PlanProgress) string {
+	var bits []byte
+	for day, done := range progress {
+		if !done || day < 1 {
+			continue
+		}
+		for len(bits) <= (day-1)/8 {
+			bits = append(bits, 0)
+		}
+		bits[(day-1)/8] |= 1 << ((day - 1) % 8)
+	}
+	return base64.RawURLEncoding.EncodeToString(bits)
+}
+
+func decodeProgress(value string) PlanProgress {
+	progress := PlanProgress{}
+	bits, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return progress
+	}
+	for i, b := range bits {
+		for bit := range 8 {
+			if b&(1<<bit) != 0 {
+				progress[i*8+bit+1] = true
+			}
+		}
+	}
+	return progress
+}
+
+// LoadProgress reads which days of a plan the visitor has read, from the
+// store when there is one and otherwise from their cookie.
+func (s *Server) LoadProgress(r *http.Request, slug string) PlanProgress {
+	if s.Store == nil {
+		value, _ := SignedCookie(r, progressCookie(slug))
+		return decodeProgress(value)
+	}
+	user, ok := SignedCookie(r, "user")
+	if !ok {
+		return PlanProgress{}
+	}
+	progress, err := s.Store.LoadPlanProgress(r.Context(), user, slug)
+	if err != nil {
+		storeError(err)
+		return PlanProgress{}
+	}
+	return progress
+}
+
+// SaveProgress marks one day of a plan as read or not.
+func (s *Server) SaveProgress(w http.ResponseWriter, r *http.Request, slug string, day int, done bool) error {
+	if s.Store == nil {
+		progress := s.LoadProgress(r, slug)
+		progress[day] = done
+		SetSignedCookie(w, r, progressCookie(slug), encodeProgress(progress))
+		return nil
+	}
+	return s.Store.SavePlanDay(r.Context(), UserToken(w, r), slug, day, done)
+}
+
+type PlanListItem struct {
+	Link        Link
+	Description string
+	Days        int
+	Read        int
+}
+
+type PlanDayItem struct {
+	Link    Link
+	Summary string
+	Read    bool
+}
+
+// PlanURL is the overview of a plan, or one of its days when day isn't 0.
+func (s *Server) PlanURL(translation string, slug string, day int) string {
+	link := s.Path("plan", "plan", slug)
+	if day > 0 {
+		link = s.Path("plan-day", "plan", slug, "day", strconv.Itoa(day))
+	}
+	if translation != default_translation {
+		link += "?translation=" + url.QueryEscape(translation)
+	}
+	return link
+}
+
+func (s *Server) getPlans(w http.ResponseWriter, r *http.Request) {
+	translation := RequestTranslation(r)
+	var page PlansPage
+	for _, plan := range reading_plans {
+		read := 0
+		for _, done := range s.LoadProgress(r, plan.Slug) {
+			if done {
+				read++
+			}
+		}
+		page.Plans = append(page.Plans, PlanListItem{
+			Link:        Link{Text: plan.Name, URL: s.PlanURL(translation, plan.Slug, 0)},
+			Description: plan.Description,
+			Days:        plan.Days,
+			Read:        read,
+		})
+	}
+	s.RenderPage(w, r, http.StatusOK, "plans.html", "Reading plans", page)
+}
+
+func (s *Server) getPlan(w http.ResponseWriter, r *http.Request) {
+	translation := RequestTranslation(r)
+	var plan Plan
+	err := s.LoadPlan(r.Context(), translation, mux.Vars(r)["plan"], &plan)
+	if err != nil {
+		s.fetchError(w, r, translation, "", err)
+		return
+	}
+
+	progress := s.LoadProgress(r, plan.Slug)
+	page := PlanPage{Name: plan.Name, Description: plan.Description, Total: len(plan.Days)}
+	for _, day := range plan.Days {
+		item := PlanDayItem{
+			Link:    Link{Text: fmt.Sprintf("Day %d", day.Number), URL: s.PlanURL(translation, plan.Slug, day.Number)},
+			Summary: day.Summary(),
+			Read:    progress[day.Number],
+		}
+		if item.Read {
+			page.Read++
+		} else if page.Continue == nil {
+			page.Continue = &Link{Text: fmt.Sprintf("Continue with day %d: %s", day.Number, item.Summary), URL: item.Link.URL}
+		}
+		page.Days = append(page.Days, item)
+	}
+	page.Calendar = s.Path("plan-calendar", "plan", plan.Slug)
+	if translation != default_translation {
+		page.Calendar += "?translation=" + url.QueryEscape(translation)
+	}
+	page.Percent = page.Read * 100 / max(page.Total, 1)
+	s.RenderPage(w, r, http.StatusOK, "plan.html", plan.Name, page)
+}
+
+// loadPlanDay reads the plan and day number of a /plans/{plan}/day/{day}
+// request.
+func (s *Server) loadPlanDay(r *http.Request, plan *Plan) (int, error) {
+	vars := mux.Vars(r)
+	err := s.LoadPlan(r.Context(), RequestTranslation(r), vars["plan"], plan)
+	if err != nil {
+		return 0, err
+	}
+	day, err := ParseNumber("day", vars["day"])
+	if err != nil {
+		return 0, err
+	}
+	if day > len(plan.Days) {
+		return 0, &PlanDayNotFoundError{Plan: plan.Name, Day: day, Last: len(plan.Days)}
+	}
+	return day, nil
+}
+
+func (s *Server) getPlanDay(w http.ResponseWriter, r *http.Request) {
+	translation := RequestTranslation(r)
+	var plan Plan
+	number, err := s.loadPlanDay(r, &plan)
+	if err != nil {
+		s.fetchError(w, r, translation, "", err)
+		return
+	}
+
+	day := plan.Days[number-1]
+	page := PlanDayPage{
+		Plan:     Link{Text: plan.Name, URL: s.PlanURL(translation, plan.Slug, 0)},
+		Day:      number,
+		Total:    len(plan.Days),
+		Readings: s.PlanReadings(translation, day),
+		Read:     s.LoadProgress(r, plan.Slug)[number],
+		Action:   s.PlanURL(translation, plan.Slug, number),
+	}
+	if number > 1 {
+		page.Previous = &Link{Text: fmt.Sprintf("← Day %d", number-1), URL: s.PlanURL(translation, plan.Slug, number-1)}
+	}
+	if number < len(plan.Days) {
+		page.Next = &Link{Text: fmt.Sprintf("Day %d →", number+1), URL: s.PlanURL(translation, plan.Slug, number+1)}
+	}
+	s.RenderPage(w, r, http.StatusOK, "plan_day.html", fmt.Sprintf("%s: day %d", plan.Name, number), page)
+}
+
+// postPlanDay marks a day read, or unread with done=0, and goes back to the
+// page the form was on.
+func (s *Server) postPlanDay(w http.ResponseWriter, r *http.Request) {
+	translation := RequestTranslation(r)
+	var plan Plan
+	number, err := s.loadPlanDay(r, &plan)
+	if err != nil {
+		s.fetchError(w, r, translation, "", err)
+		return
+	}
+	err = s.SaveProgress(w, r, plan.Slug, number, r.PostFormValue("done") != "0")
+	if err != nil {
+		Logger(r.Context()).Error("saving plan progress", "err", err)
+		s.renderError(w, r, http.StatusInternalServerError, "Your progress couldn't be saved. Please try again.")
+		return
+	}
+	redirectBack(w, r, s.PlanURL(translation, plan.Slug, number))
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func planChapters(verses ...int) []PlanChapter {
+	chapters := make([]PlanChapter, len(verses))
+	for i, n := range verses {
+		chapters[i] = PlanChapter{Book: Book{ID: "PSA", Name: "Psalms"}, Chapter: i + 1, Verses: n}
+	}
+	return chapters
+}
+
+func TestSplitPlan(t *testing.T) {
+	tests := []struct {
+		name   string
+		verses []int
+		days   int
+		// want is the chapters of each day
+		want [][]int
+	}{
+		{"even", []int{10, 10, 10, 10}, 2, [][]int{{1, 2}, {3, 4}}},
+		{"one a day", []int{10, 10, 10}, 3, [][]int{{1}, {2}, {3}}},
+		{"one day", []int{10, 20, 30}, 1, [][]int{{1, 2, 3}}},
+		{"long chapter alone", []int{5, 5, 100, 5, 5}, 3, [][]int{{1, 2}, {3}, {4, 5}}},
+		{"balanced by verses", []int{30, 10, 10, 10, 30, 10, 10, 10}, 2, [][]int{{1, 2, 3, 4}, {5, 6, 7, 8}}},
+		{"closest boundary", []int{10, 10, 12, 10}, 2, [][]int{{1, 2}, {3, 4}}},
+		{"everything in the last day if it's that long", []int{1, 1, 1, 100}, 2, [][]int{{1, 2, 3}, {4}}},
+		{"every day gets one", []int{100, 1, 1}, 3, [][]int{{1}, {2}, {3}}},
+		{"fewer chapters than days", []int{10, 10}, 4, [][]int{{1}, {2}, nil, nil}},
+		{"no chapters", nil, 2, [][]int{nil, nil}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			split := SplitPlan(planChapters(test.verses...), test.days)
+			got := make([][]int, len(split))
+			for i, day := range split {
+				for _, chapter := range day {
+					got[i] = append(got[i], chapter.Chapter)
+				}
+			}
+			if !slices.EqualFunc(got, test.want, slices.Equal) {
+				t.Errorf("SplitPlan(%v, %d) = %v, want %v", test.verses, test.days, got, test.want)
+			}
+		})
+	}
+}
+
+// wholeBible is every chapter of verse_counts, which isn't in Bible order,
+// but SplitPlan doesn't care.
+func wholeBible() []PlanChapter {
+	var chapters []PlanChapter
+	for _, id := range slices.Sorted(maps.Keys(verse_counts)) {
+		for i, n := range verse_counts[id] {
+			chapters = append(chapters, PlanChapter{Book: Book{ID: id, Name: id}, Chapter: i + 1, Verses: n})
+		}
+	}
+	return chapters
+}
+
+func TestSplitPlanBalanced(t *testing.T) {
+	chapters := wholeBible()
+	if len(chapters) != 1189 {
+		t.Fatalf("%d chapters, want 1189", len(chapters))
+	}
+	total, longest := 0, 0
+	for _, chapter := range chapters {
+		total += chapter.Verses
+		longest = max(longest, chapter.Verses)
+	}
+	for _, days := range []int{1, 31, 90, 365, 1189} {
+		split := SplitPlan(chapters, days)
+		if len(split) != days {
+			t.Fatalf("%d days: got %d", days, len(split))
+		}
+		// every chapter once, in order, and no day left empty
+		var joined []PlanChapter
+		read := 0
+		for day, reading := range split {
+			if len(reading) == 0 {
+				t.Errorf("%d days: day %d is empty", days, day+1)
+			}
+			joined = append(joined, reading...)
+			for _, chapter := range reading {
+				read += chapter.Verses
+			}
+			// each day ends near its share of the total, unless there
+			// are only enough chapters for one a day
+			if days == len(chapters) {
+				if len(reading) != 1 {
+					t.Errorf("%d days: day %d has %d chapters", days, day+1, len(reading))
+				}
+				continue
+			}
+			target := total * (day + 1) / days
+			if read < target-longest || read > target+longest {
+				t.Errorf("%d days: day %d ends at verse %d, want about %d", days, day+1, read, target)
+			}
+		}
+		if !slices.Equal(joined, chapters) {
+			t.Errorf("%d days: the days don't add up to the chapters in order", days)
+		}
+	}
+}
+
+func TestBuildPlanTracks(t *testing.T) {
+	books := []Book{{ID: "PSA", Name: "Psalms"}, {ID: "PRO", Name: "Proverbs"}}
+	chapters := map[string][]Chapter{}
+	for _, book := range books {
+		for i := range verse_counts[book.ID] {
+			chapters[book.ID] = append(chapters[book.ID], Chapter{BookID: book.ID, Chapter: i + 1})
+		}
+	}
+	definition, _ := findPlan("psalms-proverbs")
+	plan := BuildPlan(definition, "web", books, chapters)
+	if len(plan.Days) != 31 {
+		t.Fatalf("%d days, want 31", len(plan.Days))
+	}
+	for i, day := range plan.Days {
+		if day.Number != i+1 {
+			t.Errorf("day %d numbered %d", i+1, day.Number)
+		}
+		// both tracks are read every day, psalms first
+		first, last := day.Chapters[0], day.Chapters[len(day.Chapters)-1]
+		if first.Book.ID != "PSA" || last.Book.ID != "PRO" || last.Chapter != i+1 {
+			t.Errorf("day %d: %s", i+1, day.Summary())
+		}
+	}
+}
+
+func TestPlanDaySummary(t *testing.T) {
+	psalms := Book{ID: "PSA", Name: "Psalms"}
+	proverbs := Book{ID: "PRO", Name: "Proverbs"}
+	tests := []struct {
+		chapters []PlanChapter
+		want     string
+	}{
+		{[]PlanChapter{{Book: psalms, Chapter: 1}}, "Psalms 1"},
+		{[]PlanChapter{{Book: psalms, Chapter: 1}, {Book: psalms, Chapter: 2}, {Book: psalms, Chapter: 3}}, "Psalms 1-3"},
+		{[]PlanChapter{{Book: psalms, Chapter: 1}, {Book: psalms, Chapter: 2}, {Book: proverbs, Chapter: 1}}, "Psalms 1-2; Proverbs 1"},
+		{[]PlanChapter{{Book: psalms, Chapter: 1}, {Book: psalms, Chapter: 3}}, "Psalms 1; Psalms 3"},
+		{nil, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			if got := (PlanDay{Chapters: test.chapters}).Summary(); got != test.want {
+				t.Errorf("Summary = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestProgressEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		progress PlanProgress
+		want     []int
+	}{
+		{"none", PlanProgress{}, nil},
+		{"first", PlanProgress{1: true}, []int{1}},
+		{"byte boundaries", PlanProgress{8: true, 9: true, 16: true, 17: true}, []int{8, 9, 16, 17}},
+		{"unread days", PlanProgress{1: true, 2: false, 3: true}, []int{1, 3}},
+		{"last of the year", PlanProgress{365: true}, []int{365}},
+		{"out of range", PlanProgress{0: true, -1: true, 2: true}, []int{2}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decoded := decodeProgress(encodeProgress(test.progress))
+			got := slices.Sorted(maps.Keys(decoded))
+			if !slices.Equal(got, test.want) {
+				t.Errorf("round trip gave days %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	year := PlanProgress{}
+	for day := 1; day <= 365; day++ {
+		year[day] = true
+	}
+	if encoded := encodeProgress(year); len(encoded) > 62 {
+		t.Errorf("a year of progress is %d characters", len(encoded))
+	}
+	if progress := decodeProgress("not base64!"); len(progress) != 0 {
+		t.Errorf("decoded garbage as %v", progress)
+	}
+}
+
+func TestPlanProgress(t *testing.T) {
+	upstream, _ := bibleUpstream(t)
+	bible := NewBibleClient(upstream.URL)
+	bible.Retries = 0
+	handler := NewServer(bible, nil).Routes(false, false)
+
+	w := get(t, handler, "/plans/psalms-proverbs")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "Continue with day 1") {
+		t.Errorf("a new plan doesn't continue with day 1")
+	}
+
+	var cookies []*http.Cookie
+	for _, day := range []string{"1", "2", "4"} {
+		r := httptest.NewRequest(http.MethodPost, "/plans/psalms-proverbs/day/"+day, strings.NewReader(url.Values{"done": {"1"}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("POST day %s: status %d", day, w.Code)
+		}
+		cookies = w.Result().Cookies()
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/plans/psalms-proverbs", nil)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	body := w.Body.String()
+	if !strings.Contains(body, "Continue with day 3") {
+		t.Errorf("plan doesn't continue with the first unread day")
+	}
+
+	tests := []struct {
+		target string
+		status int
+	}{
+		{"/plans/psalms-proverbs/day/31", http.StatusOK},
+		{"/plans/psalms-proverbs/day/32", http.StatusNotFound},
+		{"/plans/psalms-proverbs/day/0", http.StatusBadRequest},
+		{"/plans/nope", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if w := get(t, handler, test.target); w.Code != test.status {
+			t.Errorf("GET %s: status %d, want %d", test.target, w.Code, test.status)
+		}
+	}
+}
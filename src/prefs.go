@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Prefs are how a visitor likes pages to look. Each setting is applied as a
+// class on <body> that style.css knows about.
+type Prefs struct {
+	FontSize     string
+	FontFamily   string
+	LineHeight   string
+	VerseNumbers bool
+}
+
+// PrefOption is one choice of a setting on /prefs.
+type PrefOption struct {
+	Value string
+	Label string
+}
+
+var (
+	font_sizes = []PrefOption{
+		{Value: "small", Label: "Small"},
+		{Value: "medium", Label: "Medium"},
+		{Value: "large", Label: "Large"},
+		{Value: "x-large", Label: "Extra large"},
+	}
+	font_families = []PrefOption{
+		{Value: "serif", Label: "Serif"},
+		{Value: "sans", Label: "Sans-serif"},
+	}
+	line_heights = []PrefOption{
+		{Value: "compact", Label: "Compact"},
+		{Value: "normal", Label: "Normal"},
+		{Value: "relaxed", Label: "Relaxed"},
+	}
+)
+
+var default_prefs = Prefs{FontSize: "medium", FontFamily: "serif", LineHeight: "normal", VerseNumbers: true}
+
+func validPref(options []PrefOption, value string) bool {
+	return slices.ContainsFunc(options, func(option PrefOption) bool { return option.Value == value })
+}
+
+// Class is the class attribute of <body>, like
+// "font-large family-sans spacing-relaxed no-verse-numbers".
+func (p Prefs) Class() string {
+	class := fmt.Sprintf("font-%s family-%s spacing-%s", p.FontSize, p.FontFamily, p.LineHeight)
+	if !p.VerseNumbers {
+		class += " no-verse-numbers"
+	}
+	return class
+}
+
+// String writes prefs for the prefs cookie, like "sans-relaxed-0-large".
+// Font sizes can have a "-" in them, so they go last when reading it back.
+func (p Prefs) String() string {
+	numbers := "0"
+	if p.VerseNumbers {
+		numbers = "1"
+	}
+	return strings.Join([]string{p.FontFamily, p.LineHeight, numbers, p.FontSize}, "-")
+}
+
+// ParsePrefs reads the prefs cookie, or form values joined the same way.
+func ParsePrefs(value string) (Prefs, error) {
+	parts := strings.SplitN(value, "-", 4)
+	if len(parts) != 4 {
+		return default_prefs, fmt.Errorf("%q isn't a set of preferences", value)
+	}
+	prefs := Prefs{FontFamily: parts[0], LineHeight: parts[1], VerseNumbers: parts[2] == "1", FontSize: parts[3]}
+	switch {
+	case !validPref(font_sizes, prefs.FontSize):
+		return default_prefs, fmt.Errorf("%q isn't a font size", prefs.FontSize)
+	case !validPref(font_families, prefs.FontFamily):
+		return default_prefs, fmt.Errorf("%q isn't a font", prefs.FontFamily)
+	case !validPref(line_heights, prefs.LineHeight):
+		return default_prefs, fmt.Errorf("%q isn't a line spacing", prefs.LineHeight)
+	case parts[2] != "0" && parts[2] != "1":
+		return default_prefs, fmt.Errorf("%q isn't on or off", parts[2])
+	}
+	return prefs, nil
+}
+
+type prefsKey struct{}
+
+// WithPrefs reads the prefs cookie into the request's context for
+// RenderPage.
+func WithPrefs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefs := default_prefs
+		if value, ok := SignedCookie(r, "prefs"); ok {
+			prefs, _ = ParsePrefs(value)
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), prefsKey{}, prefs)))
+	})
+}
+
+// RequestPrefs returns the prefs WithPrefs found, or the defaults for
+// requests that didn't go through it, like a 404.
+func RequestPrefs(r *http.Request) Prefs {
+	if r == nil {
+		return default_prefs
+	}
+	if prefs, ok := r.Context().Value(prefsKey{}).(Prefs); ok {
+		return prefs
+	}
+	return default_prefs
+}
+
+// localPath is a path on this site to go back to after saving prefs, or
+// fallback for anything else.
+func localPath(value string, fallback string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme != "" || u.Host != "" || !strings.HasPrefix(u.Path, "/") || strings.HasPrefix(value, "//") {
+		return fallback
+	}
+	return u.RequestURI()
+}
+
+// getPrefs shows the preferences form, remembering the page the gear icon
+// was clicked on to go back to.
+func (s *Server) getPrefs(w http.ResponseWriter, r *http.Request) {
+	Private(w)
+	back := localPath(r.URL.Query().Get("back"), backURL(r, s.Path("books")))
+	page := PrefsPage{
+		Prefs:        RequestPrefs(r),
+		Action:       s.Path("prefs"),
+		Back:         back,
+		FontSizes:    font_sizes,
+		FontFamilies: font_families,
+		LineHeights:  line_heights,
+	}
+	s.RenderPage(w, r, http.StatusOK, "prefs.html", "Display preferences", page)
+}
+
+// postPrefs saves the preferences in the form, or forgets them with
+// reset=1, and goes back to where the visitor was.
+func (s *Server) postPrefs(w http.ResponseWriter, r *http.Request) {
+	back := localPath(r.PostFormValue("back"), s.Path("books"))
+	if r.PostFormValue("reset") == "1" {
+		ClearCookie(w, "prefs")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	numbers := "0"
+	if r.PostFormValue("verse_numbers") == "1" {
+		numbers = "1"
+	}
+	prefs, err := ParsePrefs(strings.Join([]string{r.PostFormValue("font_family"), r.PostFormValue("line_height"), numbers, r.PostFormValue("font_size")}, "-"))
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "Those preferences aren't ones this site offers: "+err.Error()+".")
+		return
+	}
+	if prefs == default_prefs {
+		ClearCookie(w, "prefs")
+	} else {
+		SetSignedCookie(w, r, "prefs", prefs.String())
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// print_keep_verses is the longest section the print view asks browsers
+// not to split across pages. Longer ones break wherever the page ends.
+const print_keep_verses = 8
+
+type PrintSection struct {
+	Verses []ChapterVerse
+	Keep   bool
+}
+
+type PrintPage struct {
+	Reference   string
+	Translation string
+	License     string
+	Link        string
+	Sections    []PrintSection
+}
+
+// PrintSections splits verses into sections at the translation's paragraph
+// marks, marking the short ones to be kept on one page.
+func PrintSections(verses []ChapterVerse) []PrintSection {
+	var sections []PrintSection
+	for _, paragraph := range Paragraphs(verses) {
+		sections = append(sections, PrintSection{Verses: paragraph, Keep: len(paragraph) <= print_keep_verses})
+	}
+	return sections
+}
+
+// getPrint serves /{book}/{chapter}/print, the chapter or the verses in
+// ?verses= on a plain page to print and hand out.
+func (s *Server) getPrint(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	book_name := vars["book"]
+	chapter := vars["chapter"]
+	translation := RequestTranslation(r)
+
+	var ranges []VerseRange
+	if spec := r.URL.Query().Get("verses"); spec != "" {
+		var err error
+		ranges, err = ParseVerseRanges(spec)
+		if err != nil {
+			s.renderError(w, r, http.StatusBadRequest, fmt.Sprintf("\"%s\" isn't a verse or range of verses.", spec))
+			return
+		}
+	}
+
+	var book Book
+	var verse_info VerseInfo
+	err := s.LoadVerses(r.Context(), translation, book_name, chapter, &book, &verse_info)
+	if err != nil {
+		s.fetchError(w, r, translation, book_name, err)
+		return
+	}
+
+	verses := verse_info.Verses
+	reference := fmt.Sprintf("%s %s", book.Name, chapter)
+	link := s.TranslationPath(translation, "chapter", "book", BookSlug(book.Name), "chapter", chapter)
+	if ranges != nil {
+		verses = PassageVerses(verses, ranges)
+		if len(verses) == 0 {
+			s.renderError(w, r, http.StatusNotFound, fmt.Sprintf("%s:%s is not in this chapter. It has %d verses.", reference, FormatVerseRanges(ranges), len(verse_info.Verses)))
+			return
+		}
+		reference += ":" + FormatVerseRanges(ranges)
+		link = s.TranslationPath(translation, "passage", "book", BookSlug(book.Name), "chapter", chapter, "verses", FormatVerseRanges(ranges))
+	}
+
+	page := PrintPage{
+		Reference:   reference,
+		Translation: verse_info.Translation.Name,
+		License:     verse_info.Translation.License,
+		Link:        absoluteURL(r, link),
+		Sections:    PrintSections(HighlightVerses(verses, book, nil)),
+	}
+	var buf bytes.Buffer
+	err = s.templates["print.html"].ExecuteTemplate(&buf, "print", page)
+	if err != nil {
+		Logger(r.Context()).Error("rendering print view", "err", err)
+		s.renderError(w, r, http.StatusInternalServerError, "Something went wrong while building this page.")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	buf.WriteTo(w)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPrintPage(t *testing.T) {
+	handler := newTestServer(t)
+	tests := []struct {
+		name    string
+		target  string
+		status  int
+		want    []string
+		exclude []string
+	}{
+		{
+			"chapter", "/john/3/print", http.StatusOK,
+			[]string{"<title>John 3</title>", "<h1>John 3</h1>", "<sup>1</sup>Now there was a man of the Pharisees", "<sup>36</sup>", "John 3, World English Bible. Public Domain<br>", "http://example.com/john/3\n"},
+			nil,
+		},
+		{
+			"narrowed", "/john/3/print?verses=16-17", http.StatusOK,
+			[]string{"<title>John 3:16-17</title>", "<sup>16</sup>For God so loved the world", "<sup>17</sup>For God didn’t send his Son", "http://example.com/john/3/16-17\n"},
+			[]string{"<sup>15</sup>", "<sup>18</sup>"},
+		},
+		{
+			"separate verses", "/john/3/print?verses=1,16", http.StatusOK,
+			[]string{"<h1>John 3:1,16</h1>", "<sup>1</sup>", "<sup>16</sup>"},
+			[]string{"<sup>2</sup>", "<sup>17</sup>"},
+		},
+		{
+			"chapter page asking for print", "/john/3?print=1", http.StatusOK,
+			[]string{"<h1>John 3</h1>", "@page"},
+			nil,
+		},
+		{"invalid verses", "/john/3/print?verses=x", http.StatusBadRequest, []string{`&#34;x&#34; isn&#39;t a verse or range of verses.`}, nil},
+		{"backwards verses", "/john/3/print?verses=17-16", http.StatusBadRequest, nil, nil},
+		{"verses out of the chapter", "/john/3/print?verses=40", http.StatusNotFound, []string{"It has 36 verses."}, nil},
+		{"missing chapter", "/john/99/print", http.StatusNotFound, nil, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := get(t, handler, test.target)
+			if w.Code != test.status {
+				t.Fatalf("GET %s: status %d, want %d", test.target, w.Code, test.status)
+			}
+			body := w.Body.String()
+			for _, want := range test.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("GET %s: body doesn't contain %s", test.target, want)
+				}
+			}
+			for _, exclude := range test.exclude {
+				if strings.Contains(body, exclude) {
+					t.Errorf("GET %s: body contains %s", test.target, exclude)
+				}
+			}
+		})
+	}
+}
+
+// The print view is a page of its own, with the styles for paper and none
+// of the site around it.
+func TestPrintStylesheet(t *testing.T) {
+	w := get(t, newTestServer(t), "/john/3/print")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{"<style>", "@page { margin: 2cm; }", "section.keep { break-inside: avoid; page-break-inside: avoid; }", "color: #000; background: #fff;"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body doesn't contain %s", want)
+		}
+	}
+	for _, exclude := range []string{"<nav>", "<form", "style.css"} {
+		if strings.Contains(body, exclude) {
+			t.Errorf("print view has the site's %s", exclude)
+		}
+	}
+}
+
+func TestPrintLinks(t *testing.T) {
+	handler := newTestServer(t)
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/john/3", `href="/john/3/print"`},
+		{"/john/3/16-17", `href="/john/3/print?verses=16-17"`},
+	}
+	for _, test := range tests {
+		if body := get(t, handler, test.target).Body.String(); !strings.Contains(body, test.want) {
+			t.Errorf("GET %s: body doesn't contain %s", test.target, test.want)
+		}
+	}
+}
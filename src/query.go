@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// SearchExpr is a parsed search query, matched against verse text that has
+// been folded and had its whitespace collapsed by searchText.
+//
+// The syntax is words and "quoted phrases", all of which must match. A
+// leading - excludes a term, and | between terms matches either of them,
+// binding tighter than the implicit AND: `grace|mercy -fear` is verses with
+// grace or mercy but not fear. Words match anywhere in the text, phrases
+// match their words in order with any whitespace between them, and since
+// each verse is matched alone neither runs over into the next verse.
+type SearchExpr interface {
+	Match(text string) bool
+}
+
+type termExpr string
+
+func (e termExpr) Match(text string) bool {
+	return strings.Contains(text, string(e))
+}
+
+type orExpr []SearchExpr
+
+func (e orExpr) Match(text string) bool {
+	for _, sub := range e {
+		if sub.Match(text) {
+			return true
+		}
+	}
+	return false
+}
+
+type notExpr struct {
+	SearchExpr
+}
+
+func (e notExpr) Match(text string) bool {
+	return !e.SearchExpr.Match(text)
+}
+
+type andExpr []SearchExpr
+
+func (e andExpr) Match(text string) bool {
+	for _, sub := range e {
+		if !sub.Match(text) {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchSyntaxError points at the character of a query that couldn't be
+// parsed, counting from 1.
+type SearchSyntaxError struct {
+	Position int
+	Message  string
+}
+
+func (e *SearchSyntaxError) Error() string {
+	return fmt.Sprintf("search syntax error at character %d: %s", e.Position, e.Message)
+}
+
+// searchText puts verse text in the form SearchExpr.Match expects: folded
+// with Fold and with whitespace collapsed.
+func searchText(text string) string {
+	return strings.Join(strings.Fields(Fold(text)), " ")
+}
+
+type searchToken struct {
+	kind     rune // 'w' for a word or phrase, '|' or '-'
+	text     string
+	position int
+}
+
+func tokenizeSearch(query string) ([]searchToken, error) {
+	runes := []rune(query)
+	var tokens []searchToken
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '|':
+			tokens = append(tokens, searchToken{kind: '|', position: i + 1})
+			i++
+		case r == '-':
+			tokens = append(tokens, searchToken{kind: '-', position: i + 1})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, &SearchSyntaxError{Position: i + 1, Message: "this quote is never closed"}
+			}
+			phrase := searchText(string(runes[i+1 : end]))
+			if phrase == "" {
+				return nil, &SearchSyntaxError{Position: i + 1, Message: "the quotes are empty"}
+			}
+			tokens = append(tokens, searchToken{kind: 'w', text: phrase, position: i + 1})
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != '"' && runes[end] != '|' {
+				end++
+			}
+			tokens = append(tokens, searchToken{kind: 'w', text: Fold(string(runes[i:end])), position: i + 1})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// ParseSearch parses a query into the expression to match and the terms to
+// highlight, which are the ones that aren't excluded.
+func ParseSearch(query string) (SearchExpr, []string, error) {
+	tokens, err := tokenizeSearch(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	var and andExpr
+	var highlight []string
+	for i := 0; i < len(tokens); i++ {
+		negate := tokens[i].kind == '-'
+		if negate {
+			i++
+			if i == len(tokens) || tokens[i].kind != 'w' {
+				return nil, nil, &SearchSyntaxError{Position: tokens[i-1].position, Message: "- needs a word or phrase after it"}
+			}
+		}
+		if tokens[i].kind == '|' {
+			return nil, nil, &SearchSyntaxError{Position: tokens[i].position, Message: "| needs a word or phrase before it"}
+		}
+
+		group := orExpr{termExpr(tokens[i].text)}
+		terms := []string{tokens[i].text}
+		for i+1 < len(tokens) && tokens[i+1].kind == '|' {
+			i += 2
+			if i == len(tokens) || tokens[i].kind != 'w' {
+				return nil, nil, &SearchSyntaxError{Position: tokens[i-1].position, Message: "| needs a word or phrase after it"}
+			}
+			group = append(group, termExpr(tokens[i].text))
+			terms = append(terms, tokens[i].text)
+		}
+
+		var clause SearchExpr = group
+		if len(group) == 1 {
+			clause = group[0]
+		}
+		if negate {
+			clause = notExpr{clause}
+		} else {
+			highlight = append(highlight, terms...)
+		}
+		and = append(and, clause)
+	}
+	if len(highlight) == 0 {
+		return nil, nil, &SearchSyntaxError{Position: 1, Message: "there's nothing to search for that isn't excluded"}
+	}
+	return and, highlight, nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseSearch(t *testing.T) {
+	tests := []struct {
+		query string
+		text  string
+		match bool
+	}{
+		// implicit AND between terms
+		{"grace mercy", "Grace, mercy, and peace", true},
+		{"grace mercy", "Grace and peace", false},
+		{"grace mercy", "mercy and peace", false},
+		// words match inside other words
+		{"love", "Beloved, let us", true},
+		// OR binds tighter than AND
+		{"grace|mercy peace", "Grace and peace", true},
+		{"grace|mercy peace", "mercy and peace", true},
+		{"grace|mercy peace", "grace and mercy", false},
+		{"grace | mercy", "mercy", true},
+		{"a|b|c", "c", true},
+		// exclusion
+		{"-fear love", "perfect love casts out fear", false},
+		{"love -fear", "God is love", true},
+		{"grace|mercy -fear", "mercy without fear", false},
+		{"grace|mercy -fear", "mercy without dread", true},
+		{"-grace|mercy peace", "grace and peace", false},
+		{"-grace|mercy peace", "mercy and peace", false},
+		{"-grace|mercy peace", "joy and peace", true},
+		// phrases
+		{`"still small voice"`, "after the fire, a still small voice.", true},
+		{`"still small voice"`, "a still, small voice", false},
+		{`"still small voice"`, "a voice, still and small", false},
+		{`"still small voice"`, "a still\nsmall   voice", true},
+		{`"  still   small voice "`, "a still small voice", true},
+		{`-"small voice" still`, "a still small voice", false},
+		{`"lamp to my feet"|"light for my path"`, "and a light for my path.", true},
+		// case and accents
+		{"SENOR", "el Señor es mi pastor", true},
+		{`"Señor es"`, "el SENOR ES mi pastor", true},
+		{"well-being", "for your well-being", true},
+	}
+	for _, test := range tests {
+		t.Run(test.query+" "+test.text, func(t *testing.T) {
+			expr, _, err := ParseSearch(test.query)
+			if err != nil {
+				t.Fatalf("ParseSearch(%q): %v", test.query, err)
+			}
+			if got := expr.Match(searchText(test.text)); got != test.match {
+				t.Errorf("%q matches %q = %v, want %v", test.query, test.text, got, test.match)
+			}
+		})
+	}
+}
+
+// Each verse is matched alone, so a phrase can't run from one into the
+// next.
+func TestSearchPhraseVerseBoundary(t *testing.T) {
+	book := Book{ID: "GEN", Name: "Genesis"}
+	idx := newTestIndex(
+		IndexedVerse{Book: book, Verse: Verse{Chapter: 1, Verse: 1, Text: "In the beginning, God created the heavens and the earth.\n"}},
+		IndexedVerse{Book: book, Verse: Verse{Chapter: 1, Verse: 2, Text: "The earth was formless and empty.\n"}},
+	)
+	tests := []struct {
+		query string
+		hits  int
+	}{
+		{`"the earth"`, 2},
+		{`"earth. the earth"`, 0},
+		{`"earth the"`, 0},
+		{`earth formless`, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			expr, _, err := ParseSearch(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hits := idx.Search(expr, SearchScope{}); len(hits) != test.hits {
+				t.Errorf("%d hits, want %d", len(hits), test.hits)
+			}
+		})
+	}
+}
+
+func TestParseSearchTerms(t *testing.T) {
+	tests := []struct {
+		query string
+		terms []string
+	}{
+		{"grace mercy", []string{"grace", "mercy"}},
+		{"Grace|MERCY -fear", []string{"grace", "mercy"}},
+		{`"Still  small voice" -"earthquake"`, []string{"still small voice"}},
+		{"señor", []string{"senor"}},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			_, terms, err := ParseSearch(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(terms, test.terms) {
+				t.Errorf("terms %q, want %q", terms, test.terms)
+			}
+		})
+	}
+}
+
+func TestParseSearchInvalid(t *testing.T) {
+	tests := []struct {
+		query    string
+		position int
+	}{
+		{`"still small voice`, 1},
+		{`love "still`, 6},
+		{`señor "`, 7},
+		{`""`, 1},
+		{`love " "`, 6},
+		{"|grace", 1},
+		{"grace |", 7},
+		{"grace||mercy", 6},
+		{"love -", 6},
+		{"-|grace", 1},
+		{"-fear", 1},
+		{"-fear -dread", 1},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			_, _, err := ParseSearch(test.query)
+			var syntax *SearchSyntaxError
+			if !errors.As(err, &syntax) {
+				t.Fatalf("ParseSearch(%q) = %v, want a SearchSyntaxError", test.query, err)
+			}
+			if syntax.Position != test.position {
+				t.Errorf("ParseSearch(%q): error at %d (%s), want %d", test.query, syntax.Position, syntax.Message, test.position)
+			}
+		})
+	}
+}
+
+func TestSearchSyntaxErrorPage(t *testing.T) {
+	handler := newTestServer(t)
+	for _, target := range []string{"/search?q=love+%22still", "/search?q=love+%22still&format=json"} {
+		t.Run(target, func(t *testing.T) {
+			w := get(t, handler, target)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("GET %s: status %d, want %d", target, w.Code, http.StatusBadRequest)
+			}
+			if !strings.Contains(w.Body.String(), "character 6") {
+				t.Errorf("GET %s: body doesn't give the position", target)
+			}
+		})
+	}
+}
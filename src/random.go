@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+)
+
+// RandomVerse picks a book, then a chapter of it, then a verse of that, each
+// uniformly. book_filter narrows the pool to one book and testament to "ot"
+// or "nt"; either may be empty.
+func (s *Server) RandomVerse(ctx context.Context, translation string, book_filter string, testament string, book *Book, verse_info *VerseInfo, verse *Verse) error {
+	var pool []Book
+	if book_filter != "" {
+		err := s.Books.FindBook(ctx, translation, book_filter, book)
+		if err != nil {
+			return err
+		}
+		pool = []Book{*book}
+	} else {
+		var book_info BookInfo
+		err := s.Books.Get(ctx, translation, &book_info)
+		if err != nil {
+			return err
+		}
+		for _, b := range book_info.Books {
+			if testament == "" || Testament(b.ID) == testament {
+				pool = append(pool, b)
+			}
+		}
+	}
+	if len(pool) == 0 {
+		return fmt.Errorf("%w: no books match", ErrNotFound)
+	}
+	*book = pool[rand.IntN(len(pool))]
+
+	var chapter_info ChapterInfo
+	err := s.Chapters.Get(ctx, translation, book.ID, &chapter_info)
+	if err != nil {
+		return err
+	}
+	if len(chapter_info.Chapters) == 0 {
+		return fmt.Errorf("%w: %s has no chapters", ErrBadUpstreamResponse, book.Name)
+	}
+	chapter := chapter_info.Chapters[rand.IntN(len(chapter_info.Chapters))]
+
+	err = s.Bible.GetVerseInfo(ctx, translation, book.ID, strconv.Itoa(chapter.Chapter), verse_info)
+	if err != nil {
+		return err
+	}
+	if len(verse_info.Verses) == 0 {
+		return fmt.Errorf("%w: %s %d has no verses", ErrBadUpstreamResponse, book.Name, chapter.Chapter)
+	}
+	*verse = verse_info.Verses[rand.IntN(len(verse_info.Verses))]
+	return nil
+}
+
+func randomFilters(r *http.Request) (string, string, bool) {
+	testament := r.URL.Query().Get("testament")
+	if testament != "" && testament != OldTestament && testament != NewTestament {
+		return "", "", false
+	}
+	return r.URL.Query().Get("book"), testament, true
+}
+
+func (s *Server) getRandom(w http.ResponseWriter, r *http.Request) {
+	translation := RequestTranslation(r)
+	book_filter, testament, ok := randomFilters(r)
+	if !ok {
+		s.renderError(w, r, http.StatusBadRequest, "testament must be \"ot\" or \"nt\".")
+		return
+	}
+
+	var book Book
+	var verse_info VerseInfo
+	var verse Verse
+	err := s.RandomVerse(r.Context(), translation, book_filter, testament, &book, &verse_info, &verse)
+	if err != nil {
+		s.fetchError(w, r, translation, book_filter, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, s.VerseLink(translation, book, verse.Chapter, verse.Verse).URL, http.StatusFound)
+}
+
+func (s *Server) apiRandom(w http.ResponseWriter, r *http.Request) {
+	book_filter, testament, ok := randomFilters(r)
+	if !ok {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Status: http.StatusBadRequest, Error: "testament must be \"ot\" or \"nt\""})
+		return
+	}
+
+	var book Book
+	var verse_info VerseInfo
+	var verse Verse
+	err := s.RandomVerse(r.Context(), RequestTranslation(r), book_filter, testament, &book, &verse_info, &verse)
+	if err != nil {
+		apiError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	WriteJSON(w, http.StatusOK, SingleVerseInfo{Translation: verse_info.Translation, Verse: verse})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rate_limit_exempt are paths probes and scrapers hit, which shouldn't use
+// up a client's allowance or be turned away.
+var rate_limit_exempt = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// RateLimiter gives each client IP a token bucket that holds Burst requests
+// and refills at Rate per second. Buckets left alone for Idle are full again
+// and get dropped, so the table only holds recently active clients.
+type RateLimiter struct {
+	Rate       float64
+	Burst      int
+	Idle       time.Duration
+	TrustProxy bool
+	// Server renders the error page browsers that are turned away see.
+	Server *Server
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		Rate:    rate,
+		Burst:   burst,
+		Idle:    10 * time.Minute,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// Allow takes a token from ip's bucket. When the bucket is empty it returns
+// false and how long until the next token.
+func (l *RateLimiter) Allow(ip string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) > l.Idle {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[ip]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.Burst), last: now}
+		l.buckets[ip] = b
+	}
+	b.tokens = math.Min(float64(l.Burst), b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+func (l *RateLimiter) sweep(now time.Time) {
+	for ip, b := range l.buckets {
+		if now.Sub(b.last) > l.Idle {
+			delete(l.buckets, ip)
+		}
+	}
+	l.swept = now
+}
+
+// ClientIP is the address a request came from. Behind a trusted proxy that
+// is the last X-Forwarded-For entry, the one the proxy added itself;
+// earlier entries come from the client and can't be trusted.
+func ClientIP(r *http.Request, trust_proxy bool) string {
+	if trust_proxy {
+		forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+		ip := strings.TrimSpace(forwarded[len(forwarded)-1])
+		if ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Limit turns away clients that have run out of tokens with a 429.
+func (l *RateLimiter) Limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rate_limit_exempt[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ok, wait := l.Allow(ClientIP(r, l.TrustProxy), time.Now())
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		seconds := int(math.Ceil(wait.Seconds()))
+		rate_limited.Inc()
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		message := "Too many requests, please wait a moment and try again."
+		if WantsJSON(r) {
+			WriteJSON(w, http.StatusTooManyRequests, ErrorResponse{Status: http.StatusTooManyRequests, Error: message})
+			return
+		}
+		l.Server.renderError(w, r, http.StatusTooManyRequests, message)
+	})
+}
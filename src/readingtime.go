@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// reading_speed is the words per minute reading times are estimated at.
+var reading_speed = 200
+
+// ReadingTime formats an estimate like "~4 min read", rounding up so even a
+// short chapter is a minute.
+func ReadingTime(words int) string {
+	minutes := max((words+reading_speed-1)/reading_speed, 1)
+	return fmt.Sprintf("~%d min read", minutes)
+}
+
+// VerseWords is the CountWords total of verses.
+func VerseWords(verses []Verse) int {
+	words := 0
+	for _, verse := range verses {
+		words += CountWords(verse.Text)
+	}
+	return words
+}
+
+// WordCounts remembers how many words each chapter has once its text has
+// been loaded, so the book and chapter lists can show reading times without
+// fetching every chapter. The search index crawl and -prefetch fill it for
+// a whole translation.
+type WordCounts struct {
+	mu     sync.RWMutex
+	counts map[string]int
+}
+
+var word_counts = &WordCounts{counts: map[string]int{}}
+
+func wordCountKey(translation string, book string, chapter int) string {
+	return fmt.Sprintf("%s/%s/%d", translation, book, chapter)
+}
+
+func (c *WordCounts) Record(translation string, book string, chapter string, verses []Verse) {
+	number, err := strconv.Atoi(chapter)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	c.counts[wordCountKey(translation, book, number)] = VerseWords(verses)
+	c.mu.Unlock()
+}
+
+// Chapter returns the word count of one chapter if it is known.
+func (c *WordCounts) Chapter(translation string, book string, chapter int) (int, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	words, ok := c.counts[wordCountKey(translation, book, chapter)]
+	return words, ok
+}
+
+// Book adds up the word counts of chapters, but only when every one of them
+// is known, since a partial total would understate the book.
+func (c *WordCounts) Book(translation string, book string, chapters []Chapter) (int, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	total := 0
+	for _, chapter := range chapters {
+		words, ok := c.counts[wordCountKey(translation, book, chapter.Chapter)]
+		if !ok {
+			return 0, false
+		}
+		total += words
+	}
+	return total, len(chapters) > 0
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCountWords(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"For God so loved the world,", 6},
+		{"In the beginning, God created the heavens and the earth.\n", 10},
+		{"Blessed are those whose ways are blameless,\nwho walk according to Yahweh’s law.", 13},
+		// verse numbers and punctuation on their own aren't words
+		{"16 For God so loved the world", 6},
+		{"¶ Jesus wept. —", 2},
+		{"well-being", 1},
+		{"  \n ", 0},
+		{"", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			if got := CountWords(test.text); got != test.want {
+				t.Errorf("CountWords(%q) = %d, want %d", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadingTime(t *testing.T) {
+	tests := []struct {
+		words int
+		speed int
+		want  string
+	}{
+		// under a minute still reads as one
+		{0, 200, "~1 min read"},
+		{45, 200, "~1 min read"},
+		{200, 200, "~1 min read"},
+		// part of a minute rounds up
+		{201, 200, "~2 min read"},
+		{400, 200, "~2 min read"},
+		{563, 200, "~3 min read"},
+		{563, 100, "~6 min read"},
+		{563, 300, "~2 min read"},
+	}
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			speed := reading_speed
+			reading_speed = test.speed
+			t.Cleanup(func() { reading_speed = speed })
+			if got := ReadingTime(test.words); got != test.want {
+				t.Errorf("ReadingTime(%d) at %d words a minute = %q, want %q", test.words, test.speed, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFixtureReadingTimes(t *testing.T) {
+	handler := newTestServer(t)
+	tests := []struct {
+		fixture string
+		target  string
+		words   int
+		want    string
+	}{
+		{"GEN/1", "/genesis/1", 45, "~1 min read"},
+		{"JHN/3", "/john/3", 162, "~1 min read"},
+		{"SNG/2", "/song-of-solomon/2", 91, "~1 min read"},
+		{"PSA/119", "/psalms/119", 563, "~3 min read"},
+	}
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			body, err := os.ReadFile("testdata/upstream/data/web/" + test.fixture + ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var verse_info VerseInfo
+			if err := json.Unmarshal(body, &verse_info); err != nil {
+				t.Fatal(err)
+			}
+			if words := VerseWords(verse_info.Verses); words != test.words {
+				t.Errorf("%s has %d words, want %d", test.fixture, words, test.words)
+			}
+
+			w := get(t, handler, test.target)
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET %s: status %d", test.target, w.Code)
+			}
+			if want := "<p>" + test.want; !strings.Contains(w.Body.String(), want) {
+				t.Errorf("GET %s: body doesn't contain %s", test.target, want)
+			}
+		})
+	}
+}
+
+func TestChapterListReadingTimes(t *testing.T) {
+	saved := word_counts
+	word_counts = &WordCounts{counts: map[string]int{}}
+	t.Cleanup(func() { word_counts = saved })
+	handler := newTestServer(t)
+	// reading times are only known for chapters that have been loaded
+	if body := get(t, handler, "/psalms").Body.String(); strings.Contains(body, "min read") {
+		t.Errorf("GET /psalms: reading time shown before any chapter is loaded")
+	}
+	if w := get(t, handler, "/psalms/119"); w.Code != http.StatusOK {
+		t.Fatalf("GET /psalms/119: status %d", w.Code)
+	}
+	body := get(t, handler, "/psalms").Body.String()
+	if want := `<a href="/psalms/119">119</a> <small>~3 min read</small>`; !strings.Contains(body, want) {
+		t.Errorf("GET /psalms: body doesn't contain %s", want)
+	}
+	if n := strings.Count(body, "min read"); n != 1 {
+		t.Errorf("GET /psalms: %d reading times, want just Psalm 119's", n)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// startedWriter notes whether anything has gone out yet, so Recover knows
+// if an error page can still be sent.
+type startedWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (s *startedWriter) WriteHeader(status int) {
+	s.started = true
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *startedWriter) Write(p []byte) (int, error) {
+	s.started = true
+	return s.ResponseWriter.Write(p)
+}
+
+func (s *startedWriter) Flush() {
+	s.started = true
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Recover turns a panicking handler into a logged stack trace and a 500
+// page. If the response had already started there is no way to replace
+// it, so the connection is dropped instead.
+func (s *Server) Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &startedWriter{ResponseWriter: w}
+		defer func() {
+			value := recover()
+			if value == nil {
+				return
+			}
+			if value == http.ErrAbortHandler {
+				panic(value)
+			}
+			Logger(r.Context()).Error("handler panicked", "panic", fmt.Sprint(value), "stack", string(debug.Stack()))
+			if sw.started {
+				panic(http.ErrAbortHandler)
+			}
+			s.renderError(w, r, http.StatusInternalServerError, "Something went wrong while building this page.")
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecover(t *testing.T) {
+	s := NewServer(NewBibleClient(fakeUpstream(t).URL), nil)
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		// dropped is whether the client should see the connection cut,
+		// rather than a 500
+		dropped bool
+	}{
+		{"panic", func(w http.ResponseWriter, r *http.Request) {
+			var chapters []Chapter
+			_ = chapters[0]
+		}, false},
+		{"panic with an error", func(w http.ResponseWriter, r *http.Request) {
+			panic(io.ErrUnexpectedEOF)
+		}, false},
+		{"panic after the headers", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			panic("too late")
+		}, true},
+		{"panic part way through the body", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", "100")
+			io.WriteString(w, "<p>half a page")
+			panic("too late")
+		}, true},
+		{"aborted", func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(s.Recover(test.handler))
+			defer server.Close()
+			resp, err := http.Get(server.URL)
+			if err == nil {
+				_, err = io.ReadAll(resp.Body)
+				resp.Body.Close()
+			}
+			if test.dropped {
+				if err == nil {
+					t.Errorf("status %d, want the connection dropped", resp.StatusCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if resp.StatusCode != http.StatusInternalServerError {
+				t.Errorf("status %d, want %d", resp.StatusCode, http.StatusInternalServerError)
+			}
+			if content_type := resp.Header.Get("Content-Type"); !strings.HasPrefix(content_type, "text/html") {
+				t.Errorf("Content-Type %q, want an HTML page", content_type)
+			}
+		})
+	}
+}
+
+func TestRecoverPage(t *testing.T) {
+	s := NewServer(NewBibleClient(fakeUpstream(t).URL), nil)
+	handler := s.Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	w := get(t, handler, "/john/3")
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "Something went wrong while building this page.") {
+		t.Errorf("body doesn't have the error message")
+	}
+	if strings.Contains(body, "boom") {
+		t.Errorf("body shows the panic to the visitor")
+	}
+}
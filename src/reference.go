@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// max_reference_chapters caps how many chapters /passage will load for one
+// reference. Longer spans are better read with /{book}/full.
+const max_reference_chapters = 10
+
+var ErrInvalidReference = errors.New("invalid reference")
+
+// Reference is a parsed reference like "Genesis 1:1-2:3". A VerseStart of 0
+// means from the start of ChapterStart, a VerseEnd of 0 means to the end of
+// ChapterEnd, and a ChapterStart of 0 means the whole book.
+type Reference struct {
+	Book         string
+	ChapterStart int
+	VerseStart   int
+	ChapterEnd   int
+	VerseEnd     int
+}
+
+var (
+	reference_pattern = regexp.MustCompile(`^([1-3]?\s*[A-Za-z][A-Za-z. ]*?)\.?\s*(\d[\d:\-\s]*)?$`)
+	location_pattern  = regexp.MustCompile(`^(\d+)(?::(\d+))?(?:-(\d+)(?::(\d+))?)?$`)
+)
+
+// ParseReference parses free text like "Jn 3:16", "1 Cor 13", "Psalm
+// 23:1-6" or "Genesis 1:1–2:3". The book is returned as written, for
+// BookCache.FindBook to resolve.
+func ParseReference(s string) (Reference, error) {
+	s = strings.NewReplacer("–", "-", "—", "-").Replace(strings.TrimSpace(s))
+	match := reference_pattern.FindStringSubmatch(s)
+	if match == nil {
+		return Reference{}, fmt.Errorf("%w: %q", ErrInvalidReference, s)
+	}
+	ref := Reference{Book: strings.Join(strings.Fields(match[1]), " ")}
+	if match[2] == "" {
+		return ref, nil
+	}
+
+	location := location_pattern.FindStringSubmatch(strings.Join(strings.Fields(match[2]), ""))
+	if location == nil {
+		return Reference{}, fmt.Errorf("%w: %q", ErrInvalidReference, s)
+	}
+	numbers := make([]int, 4)
+	for i, part := range location[1:] {
+		if part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 1 {
+			return Reference{}, fmt.Errorf("%w: %q", ErrInvalidReference, s)
+		}
+		numbers[i] = n
+	}
+
+	ref.ChapterStart, ref.VerseStart = numbers[0], numbers[1]
+	switch {
+	case location[3] == "":
+		// "3" or "3:16"
+		ref.ChapterEnd, ref.VerseEnd = ref.ChapterStart, ref.VerseStart
+	case location[2] != "" && location[4] == "":
+		// "3:16-18", the end is a verse in the same chapter
+		ref.ChapterEnd, ref.VerseEnd = ref.ChapterStart, numbers[2]
+	default:
+		// "3-4" or "1:1-2:3"
+		ref.ChapterEnd, ref.VerseEnd = numbers[2], numbers[3]
+	}
+
+	if ref.ChapterEnd < ref.ChapterStart || (ref.ChapterEnd == ref.ChapterStart && ref.VerseEnd != 0 && ref.VerseEnd < ref.VerseStart) {
+		return Reference{}, fmt.Errorf("%w: %q ends before it starts", ErrInvalidReference, s)
+	}
+	return ref, nil
+}
+
+// String formats the reference the way ParseReference reads it.
+func (ref Reference) String() string {
+	if ref.ChapterStart == 0 {
+		return ref.Book
+	}
+	s := fmt.Sprintf("%s %d", ref.Book, ref.ChapterStart)
+	if ref.VerseStart > 0 {
+		s += fmt.Sprintf(":%d", ref.VerseStart)
+	}
+	if ref.ChapterEnd == ref.ChapterStart && ref.VerseEnd == ref.VerseStart {
+		return s
+	}
+	if ref.ChapterEnd == ref.ChapterStart && ref.VerseStart > 0 {
+		return s + fmt.Sprintf("-%d", ref.VerseEnd)
+	}
+	s += fmt.Sprintf("-%d", ref.ChapterEnd)
+	if ref.VerseEnd > 0 {
+		s += fmt.Sprintf(":%d", ref.VerseEnd)
+	}
+	return s
+}
+
+// Includes reports whether a verse falls inside the reference.
+func (ref Reference) Includes(chapter int, verse int) bool {
+	if chapter < ref.ChapterStart || chapter > ref.ChapterEnd {
+		return false
+	}
+	if chapter == ref.ChapterStart && verse < ref.VerseStart {
+		return false
+	}
+	if chapter == ref.ChapterEnd && ref.VerseEnd > 0 && verse > ref.VerseEnd {
+		return false
+	}
+	return true
+}
+
+// PassageURL is the absolute link to /passage for ref, for messages read
+// away from the site.
+func (s *Server) PassageURL(r *http.Request, translation string, ref Reference) string {
+	query := url.Values{"ref": {ref.String()}}
+	if translation != default_translation {
+		query.Set("translation", translation)
+	}
+	return canonicalOrigin(r) + s.Path("reference") + "?" + query.Encode()
+}
+
+// getReference serves /passage?ref=John+3:16-18.
+func (s *Server) getReference(w http.ResponseWriter, r *http.Request) {
+	translation := RequestTranslation(r)
+	text := r.URL.Query().Get("ref")
+	ref, err := ParseReference(text)
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, fmt.Sprintf("\"%s\" isn't a reference like \"John 3:16\".", text))
+		return
+	}
+
+	var book Book
+	err = s.Books.FindBook(r.Context(), translation, ref.Book, &book)
+	if err != nil {
+		s.fetchError(w, r, translation, ref.Book, err)
+		return
+	}
+	if ref.ChapterStart == 0 {
+		http.Redirect(w, r, s.BookLink(translation, book).URL, http.StatusFound)
+		return
+	}
+	if ref.ChapterEnd-ref.ChapterStart >= max_reference_chapters {
+		s.renderError(w, r, http.StatusBadRequest, fmt.Sprintf("That's more than %d chapters. Try reading the whole book instead.", max_reference_chapters))
+		return
+	}
+
+	ref.Book = book.Name
+	page := ReferencePage{Reference: ref.String()}
+	if translation != default_translation {
+		page.Translation = translation
+	}
+	slug := BookSlug(book.Name)
+	for chapter := ref.ChapterStart; chapter <= ref.ChapterEnd; chapter++ {
+		var verse_info VerseInfo
+		err = s.LoadVerses(r.Context(), translation, slug, strconv.Itoa(chapter), &book, &verse_info)
+		if err != nil {
+			s.fetchError(w, r, translation, slug, err)
+			return
+		}
+		section := ReferenceChapter{Chapter: s.ChapterLink(translation, book, chapter)}
+		for _, verse := range verse_info.Verses {
+			if ref.Includes(chapter, verse.Verse) {
+				section.Verses = append(section.Verses, verse)
+			}
+		}
+		page.Chapters = append(page.Chapters, section)
+	}
+	s.RenderPage(w, r, http.StatusOK, "reference.html", page.Reference, page)
+}
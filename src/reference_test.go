@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		text string
+		want Reference
+	}{
+		{"Jn 3:16", Reference{"Jn", 3, 16, 3, 16}},
+		{"John 3:16-18", Reference{"John", 3, 16, 3, 18}},
+		{"1 Cor 13", Reference{"1 Cor", 13, 0, 13, 0}},
+		{"1Cor 13:4-7", Reference{"1Cor", 13, 4, 13, 7}},
+		{"Psalm 23:1-6", Reference{"Psalm", 23, 1, 23, 6}},
+		{"Psalm 119:176", Reference{"Psalm", 119, 176, 119, 176}},
+		{"Genesis 1:1–2:3", Reference{"Genesis", 1, 1, 2, 3}},
+		{"Genesis 1:1—2:3", Reference{"Genesis", 1, 1, 2, 3}},
+		{"Genesis 1:1-2:3", Reference{"Genesis", 1, 1, 2, 3}},
+		{"John 3-4", Reference{"John", 3, 0, 4, 0}},
+		{"John 3-4:2", Reference{"John", 3, 0, 4, 2}},
+		{"John 3:1-3:5", Reference{"John", 3, 1, 3, 5}},
+		{"John", Reference{"John", 0, 0, 0, 0}},
+		{"Song of Solomon 2:1", Reference{"Song of Solomon", 2, 1, 2, 1}},
+		{"song  of   solomon 2", Reference{"song of solomon", 2, 0, 2, 0}},
+		{"Gen. 1:1", Reference{"Gen", 1, 1, 1, 1}},
+		{"  john   3 : 16 ", Reference{"john", 3, 16, 3, 16}},
+		{"John 3:16 - 18", Reference{"John", 3, 16, 3, 18}},
+		{"3 John 1:4", Reference{"3 John", 1, 4, 1, 4}},
+		{"Jude 3", Reference{"Jude", 3, 0, 3, 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			ref, err := ParseReference(test.text)
+			if err != nil {
+				t.Fatalf("ParseReference(%q): %v", test.text, err)
+			}
+			if ref != test.want {
+				t.Errorf("ParseReference(%q) = %+v, want %+v", test.text, ref, test.want)
+			}
+		})
+	}
+}
+
+func TestParseReferenceInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"3:16",
+		"John 0",
+		"John 3:0",
+		"John 0:1-2",
+		"John 4-3",
+		"John 3:18-16",
+		"John 3:16-4",
+		"John 3:16:1",
+		"John 3a",
+		"John 3:16-",
+		"John :16",
+		"4 John 1",
+		"John 3:16; 4:1",
+	}
+	for _, text := range tests {
+		t.Run(text, func(t *testing.T) {
+			ref, err := ParseReference(text)
+			if !errors.Is(err, ErrInvalidReference) {
+				t.Errorf("ParseReference(%q) = %+v, %v, want ErrInvalidReference", text, ref, err)
+			}
+		})
+	}
+}
+
+func TestReferenceString(t *testing.T) {
+	tests := []struct {
+		ref  Reference
+		want string
+	}{
+		{Reference{"John", 3, 16, 3, 16}, "John 3:16"},
+		{Reference{"John", 3, 16, 3, 18}, "John 3:16-18"},
+		{Reference{"John", 3, 0, 3, 0}, "John 3"},
+		{Reference{"John", 3, 0, 4, 0}, "John 3-4"},
+		{Reference{"John", 3, 0, 4, 2}, "John 3-4:2"},
+		{Reference{"Genesis", 1, 1, 2, 3}, "Genesis 1:1-2:3"},
+		{Reference{"John", 0, 0, 0, 0}, "John"},
+	}
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			if got := test.ref.String(); got != test.want {
+				t.Errorf("String() = %q, want %q", got, test.want)
+			}
+			// and it reads back the same
+			ref, err := ParseReference(test.want)
+			if err != nil || ref != test.ref {
+				t.Errorf("ParseReference(%q) = %+v, %v, want %+v", test.want, ref, err, test.ref)
+			}
+		})
+	}
+}
+
+func TestReferenceIncludes(t *testing.T) {
+	tests := []struct {
+		ref     string
+		chapter int
+		verse   int
+		want    bool
+	}{
+		{"John 3:16-18", 3, 16, true},
+		{"John 3:16-18", 3, 18, true},
+		{"John 3:16-18", 3, 15, false},
+		{"John 3:16-18", 3, 19, false},
+		{"John 3:16-18", 4, 16, false},
+		{"John 3", 3, 1, true},
+		{"John 3", 3, 36, true},
+		{"John 3", 2, 25, false},
+		{"Genesis 1:1-2:3", 1, 31, true},
+		{"Genesis 1:1-2:3", 2, 3, true},
+		{"Genesis 1:1-2:3", 2, 4, false},
+		{"John 3-4", 4, 54, true},
+		{"John 3-4", 5, 1, false},
+	}
+	for _, test := range tests {
+		ref, err := ParseReference(test.ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ref.Includes(test.chapter, test.verse); got != test.want {
+			t.Errorf("%s includes %d:%d = %v, want %v", test.ref, test.chapter, test.verse, got, test.want)
+		}
+	}
+}
+
+func TestReferencePage(t *testing.T) {
+	handler := newTestServer(t)
+	tests := []struct {
+		ref    string
+		status int
+		want   string
+	}{
+		{"John+3:16-17", http.StatusOK, "For God didn’t send his Son"},
+		{"Jn+3:16", http.StatusOK, "For God so loved the world"},
+		{"Psalm+119:176", http.StatusOK, "I have gone astray like a lost sheep"},
+		{"Song+of+Solomon+2:1", http.StatusOK, "I am a rose of Sharon"},
+		{"John+3:18-16", http.StatusBadRequest, "a reference like"},
+		{"Nope+3:16", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.ref, func(t *testing.T) {
+			w := get(t, handler, "/passage?ref="+test.ref)
+			if w.Code != test.status {
+				t.Fatalf("GET /passage?ref=%s: status %d, want %d", test.ref, w.Code, test.status)
+			}
+			if !strings.Contains(w.Body.String(), test.want) {
+				t.Errorf("GET /passage?ref=%s: body doesn't contain %q", test.ref, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	retry_base_delay = 250 * time.Millisecond
+	retry_max_delay  = 4 * time.Second
+)
+
+// retryable is true for network errors, 429 and 5xx, which is everything
+// BibleClient.Response reports as ErrUpstreamUnavailable. A 4xx will fail the same
+// way every time.
+func retryable(err error) bool {
+	return errors.Is(err, ErrUpstreamUnavailable)
+}
+
+// backoff is the wait before retry number attempt, doubling each time with
+// up to half of it randomised so clients don't retry in lockstep.
+func backoff(attempt int) time.Duration {
+	delay := min(retry_base_delay<<(attempt-1), retry_max_delay)
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// retryAfter reads a Retry-After header given in seconds or as an HTTP
+// date, returning 0 if there is none.
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	seconds, err := strconv.Atoi(value)
+	if err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	date, err := http.ParseTime(value)
+	if err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
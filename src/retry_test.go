@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		// want is checked to the second, as an HTTP date is
+		want time.Duration
+	}{
+		{"none", "", 0},
+		{"seconds", "3", 3 * time.Second},
+		{"zero", "0", 0},
+		{"negative", "-5", 0},
+		{"date", time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), 10 * time.Second},
+		{"past date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+		{"garbage", "soon", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := http.Header{}
+			if test.value != "" {
+				header.Set("Retry-After", test.value)
+			}
+			got := retryAfter(header)
+			if got < 0 || got > test.want || got < test.want-time.Second {
+				t.Errorf("retryAfter(%q) = %s, want %s", test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		// the wait is from half of full to full
+		full time.Duration
+	}{
+		{1, retry_base_delay},
+		{2, 2 * retry_base_delay},
+		{3, 4 * retry_base_delay},
+		{10, retry_max_delay},
+		{40, retry_max_delay},
+	}
+	for _, test := range tests {
+		for range 100 {
+			if wait := backoff(test.attempt); wait < test.full/2 || wait > test.full {
+				t.Fatalf("backoff(%d) = %s, want %s to %s", test.attempt, wait, test.full/2, test.full)
+			}
+		}
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name        string
+		statuses    []int
+		retry_after string
+		retries     int
+		budget      time.Duration
+		// requests is how many the upstream gets, err what the client ends
+		// with
+		requests int
+		err      error
+		// wait is the least the client should have waited
+		wait time.Duration
+	}{
+		{"ok", []int{200}, "", 2, time.Minute, 1, nil, 0},
+		{"recovers", []int{503, 502, 200}, "0", 2, time.Minute, 3, nil, retry_base_delay / 2},
+		{"rate limited", []int{429, 200}, "", 2, time.Minute, 2, nil, 0},
+		{"gives up", []int{503, 503, 503, 200}, "0", 2, time.Minute, 3, ErrUpstreamUnavailable, 0},
+		{"no retries", []int{503, 200}, "", 0, time.Minute, 1, ErrUpstreamUnavailable, 0},
+		{"not found isn't retried", []int{404, 200}, "", 2, time.Minute, 1, ErrNotFound, 0},
+		{"bad request isn't retried", []int{400, 200}, "", 2, time.Minute, 1, ErrBadUpstreamResponse, 0},
+		{"waits as asked", []int{503, 200}, "1", 2, time.Minute, 2, nil, time.Second},
+		{"asked to wait past the budget", []int{503, 200}, "30", 2, 5 * time.Second, 1, ErrUpstreamUnavailable, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests atomic.Int32
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := requests.Add(1)
+				status := test.statuses[n-1]
+				if status != http.StatusOK && test.retry_after != "" {
+					w.Header().Set("Retry-After", test.retry_after)
+				}
+				w.WriteHeader(status)
+				w.Write([]byte("{}"))
+			}))
+			t.Cleanup(upstream.Close)
+			bible := NewBibleClient(upstream.URL)
+			bible.Retries = test.retries
+			bible.RetryBudget = test.budget
+			bible.BreakerFailures = 0
+
+			start := time.Now()
+			resp, err := bible.Response(context.Background(), "/data/web/JHN/3")
+			elapsed := time.Since(start)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if !errors.Is(err, test.err) || (test.err == nil && err != nil) {
+				t.Errorf("Response: %v, want %v", err, test.err)
+			}
+			if n := int(requests.Load()); n != test.requests {
+				t.Errorf("%d requests, want %d", n, test.requests)
+			}
+			if elapsed < test.wait || elapsed > test.wait+3*time.Second {
+				t.Errorf("took %s, want about %s", elapsed, test.wait)
+			}
+		})
+	}
+}
+
+// A cancelled request stops retrying straight away.
+func TestRetriesCancelled(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "10")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(upstream.Close)
+	bible := NewBibleClient(upstream.URL)
+	bible.BreakerFailures = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := bible.Response(ctx, "/data/web/JHN/3")
+	if err == nil || time.Since(start) > 2*time.Second {
+		t.Errorf("Response = %v after %s", err, time.Since(start))
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// refresh_timeout is the longest a background refresh can take.
+const refresh_timeout = 30 * time.Second
+
+// Refresher runs the background refreshes of stale cache entries. Each key
+// is refreshed once at a time, at most Limit refreshes run together, and
+// Close stops them all so none outlive a shutdown. A refresh that can't
+// start is skipped, and the next request for the stale entry tries again.
+// The fetches themselves go through sharedFetch, so they're shared with any
+// request fetching the same thing, and a closed refresher stops waiting on
+// them.
+type Refresher struct {
+	Limit int
+
+	mu      sync.Mutex
+	running map[string]bool
+	closed  bool
+	wg      sync.WaitGroup
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func NewRefresher(limit int) *Refresher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Refresher{Limit: limit, running: map[string]bool{}, ctx: ctx, cancel: cancel}
+}
+
+var cache_refresher = NewRefresher(4)
+
+// Go runs refresh in the background unless key is already being refreshed,
+// Limit refreshes are running or the refresher is closed. It reports
+// whether refresh was started.
+func (r *Refresher) Go(key string, refresh func(context.Context) error) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || r.running[key] {
+		return false
+	}
+	if len(r.running) >= r.Limit {
+		cache_refreshes.WithLabelValues("skipped").Inc()
+		return false
+	}
+	r.running[key] = true
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ctx, cancel := context.WithTimeout(r.ctx, refresh_timeout)
+		defer cancel()
+		err := refresh(ctx)
+		switch {
+		case err == nil:
+			cache_refreshes.WithLabelValues("ok").Inc()
+		case errors.Is(err, context.Canceled):
+			cache_refreshes.WithLabelValues("canceled").Inc()
+		default:
+			cache_refreshes.WithLabelValues("failed").Inc()
+			slog.Warn("background cache refresh failed, still serving stale copy", "key", key, "err", err)
+		}
+		r.mu.Lock()
+		delete(r.running, key)
+		r.mu.Unlock()
+	}()
+	return true
+}
+
+// Close cancels the refreshes still running and waits for them to return.
+func (r *Refresher) Close() {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	r.cancel()
+	r.wg.Wait()
+}
+
+// cacheResult is the X-Cache value of a request: the worst of its cache
+// lookups, MISS over STALE over HIT. Lookups can run concurrently.
+type cacheResult struct {
+	mu     sync.Mutex
+	result string
+}
+
+type cacheResultKey struct{}
+
+var cache_result_rank = map[string]int{"hit": 1, "stale": 2, "miss": 3}
+
+// recordLookup counts a cache lookup, and notes it for the request's
+// X-Cache header.
+func recordLookup(ctx context.Context, cache string, result string) {
+	cache_lookups.WithLabelValues(cache, result).Inc()
+	if r, ok := ctx.Value(cacheResultKey{}).(*cacheResult); ok {
+		r.mu.Lock()
+		if cache_result_rank[result] > cache_result_rank[r.result] {
+			r.result = result
+		}
+		r.mu.Unlock()
+	}
+}
+
+// cacheHeaderWriter adds X-Cache as the response starts, once the handler
+// has done its lookups.
+type cacheHeaderWriter struct {
+	http.ResponseWriter
+	result  *cacheResult
+	started bool
+}
+
+func (c *cacheHeaderWriter) start() {
+	if c.started {
+		return
+	}
+	c.started = true
+	c.result.mu.Lock()
+	result := c.result.result
+	c.result.mu.Unlock()
+	switch result {
+	case "hit":
+		c.Header().Set("X-Cache", "HIT")
+	case "stale":
+		c.Header().Set("X-Cache", "STALE")
+	case "miss":
+		c.Header().Set("X-Cache", "MISS")
+	}
+}
+
+func (c *cacheHeaderWriter) WriteHeader(status int) {
+	c.start()
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *cacheHeaderWriter) Write(p []byte) (int, error) {
+	c.start()
+	return c.ResponseWriter.Write(p)
+}
+
+func (c *cacheHeaderWriter) Flush() {
+	c.start()
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// CacheHeader sets X-Cache on responses that looked anything up in the
+// in-memory caches: HIT if it was all fresh, STALE if a stale entry was
+// served, and MISS if something had to be fetched.
+func CacheHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result := &cacheResult{}
+		ctx := context.WithValue(r.Context(), cacheResultKey{}, result)
+		next.ServeHTTP(&cacheHeaderWriter{ResponseWriter: w, result: result}, r.WithContext(ctx))
+	})
+}
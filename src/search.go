@@ -0,0 +1,448 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type IndexedVerse struct {
+	Book  Book
+	Verse Verse
+	// text is Verse.Text through searchText, done once when indexing
+	text string
+}
+
+// SearchHit is a matching verse along with the verses either side of it in
+// the same chapter, nil at the start or end of one.
+type SearchHit struct {
+	IndexedVerse
+	Before *Verse
+	After  *Verse
+}
+
+// max_highlights caps the <mark> spans in one verse, so a query like "e"
+// doesn't turn a whole verse into highlights.
+const max_highlights = 10
+
+// SearchIndex holds every verse of one translation in memory. bible-api.com
+// has no search, so the index is filled by crawling it chapter by chapter.
+// The crawl remembers which chapters it has, so one that fails part way
+// picks up where it stopped next time.
+type SearchIndex struct {
+	// Server is where the crawl fetches chapters from.
+	Server *Server
+
+	mu          sync.RWMutex
+	translation string
+	verses      []IndexedVerse
+	done        map[string]bool
+	chapters    int
+	complete    bool
+	crawling    bool
+	Interval    time.Duration
+}
+
+// Progress reports how many chapters have been indexed out of how many are
+// known about so far.
+func (idx *SearchIndex) Progress() (int, int, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.done), idx.chapters, idx.complete
+}
+
+// StartCrawl begins filling the index in the background unless it is full
+// or already being filled.
+func (idx *SearchIndex) StartCrawl(translation string) {
+	idx.mu.Lock()
+	if idx.crawling || (idx.complete && idx.translation == translation) {
+		idx.mu.Unlock()
+		return
+	}
+	if idx.translation != translation {
+		idx.translation = translation
+		idx.verses = nil
+		idx.done = map[string]bool{}
+		idx.chapters = 0
+		idx.complete = false
+	}
+	idx.crawling = true
+	idx.mu.Unlock()
+
+	go func() {
+		err := idx.crawl(context.Background(), translation)
+		if err != nil {
+			slog.Error("search index crawl stopped", "err", err)
+		}
+		idx.mu.Lock()
+		idx.crawling = false
+		idx.mu.Unlock()
+	}()
+}
+
+func (idx *SearchIndex) crawl(ctx context.Context, translation string) error {
+	var book_info BookInfo
+	err := idx.Server.Books.Get(ctx, translation, &book_info)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(idx.Interval)
+	defer ticker.Stop()
+
+	idx.mu.Lock()
+	idx.chapters = 0
+	idx.mu.Unlock()
+
+	for _, book := range book_info.Books {
+		<-ticker.C
+		var chapter_info ChapterInfo
+		err = idx.Server.Chapters.Get(ctx, translation, book.ID, &chapter_info)
+		if err != nil {
+			return err
+		}
+		idx.mu.Lock()
+		idx.chapters += len(chapter_info.Chapters)
+		idx.mu.Unlock()
+
+		for _, chapter := range chapter_info.Chapters {
+			key := fmt.Sprintf("%s/%d", book.ID, chapter.Chapter)
+			idx.mu.RLock()
+			done := idx.done[key]
+			idx.mu.RUnlock()
+			if done {
+				continue
+			}
+
+			<-ticker.C
+			var verse_info VerseInfo
+			err = idx.Server.Bible.GetVerseInfo(ctx, translation, book.ID, strconv.Itoa(chapter.Chapter), &verse_info)
+			if err != nil {
+				return err
+			}
+
+			idx.mu.Lock()
+			for _, verse := range verse_info.Verses {
+				idx.verses = append(idx.verses, IndexedVerse{Book: book, Verse: verse, text: searchText(verse.Text)})
+			}
+			idx.done[key] = true
+			idx.mu.Unlock()
+		}
+	}
+
+	idx.mu.Lock()
+	idx.complete = true
+	idx.mu.Unlock()
+	return nil
+}
+
+// Search returns the verses in scope that match expr, ignoring case.
+func (idx *SearchIndex) Search(expr SearchExpr, scope SearchScope) []SearchHit {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	var results []SearchHit
+	for i, v := range idx.verses {
+		if !scope.Includes(v.Book) {
+			continue
+		}
+		if expr.Match(v.text) {
+			results = append(results, idx.hit(i))
+		}
+	}
+	return results
+}
+
+// hit is the verse at i with its neighbours. The index is filled a chapter
+// at a time, so they are the verses next to it if they share its chapter.
+func (idx *SearchIndex) hit(i int) SearchHit {
+	v := idx.verses[i]
+	hit := SearchHit{IndexedVerse: v}
+	same_chapter := func(other IndexedVerse) bool {
+		return other.Book.ID == v.Book.ID && other.Verse.Chapter == v.Verse.Chapter
+	}
+	if i > 0 && same_chapter(idx.verses[i-1]) {
+		hit.Before = &idx.verses[i-1].Verse
+	}
+	if i+1 < len(idx.verses) && same_chapter(idx.verses[i+1]) {
+		hit.After = &idx.verses[i+1].Verse
+	}
+	return hit
+}
+
+// Highlight escapes text and wraps occurrences of terms in <mark>, at most
+// max_highlights of them. Terms are matched against the folded text, see
+// Fold, and each match is mapped back to the characters it covers in text,
+// so accents are kept. Matching happens before escaping, so a term can't
+// match inside an entity like &amp;. Where terms overlap the longest one
+// wins.
+func Highlight(text string, terms []string) template.HTML {
+	if len(terms) == 0 {
+		return template.HTML(template.HTMLEscapeString(text))
+	}
+	// regexp alternation takes the first term that matches, so "love"
+	// must come before "lov"
+	terms = slices.Clone(terms)
+	sort.Slice(terms, func(i, j int) bool { return len(terms[i]) > len(terms[j]) })
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		// phrases match across any run of whitespace
+		quoted[i] = strings.Join(strings.Fields(regexp.QuoteMeta(term)), `\s+`)
+	}
+	pattern := regexp.MustCompile(strings.Join(quoted, "|"))
+
+	folded, offsets := foldOffsets(text)
+	var b strings.Builder
+	last := 0
+	for _, match := range pattern.FindAllStringIndex(folded, max_highlights) {
+		start, end := offsets[match[0]], offsets[match[1]]
+		if start < last {
+			continue
+		}
+		b.WriteString(template.HTMLEscapeString(text[last:start]))
+		b.WriteString("<mark>")
+		b.WriteString(template.HTMLEscapeString(text[start:end]))
+		b.WriteString("</mark>")
+		last = end
+	}
+	b.WriteString(template.HTMLEscapeString(text[last:]))
+	return template.HTML(b.String())
+}
+
+// SearchScope limits a search to one book, or one testament, or neither
+// when both are empty.
+type SearchScope struct {
+	BookID    string
+	Testament string
+}
+
+func (s SearchScope) Includes(book Book) bool {
+	return (s.BookID == "" || book.ID == s.BookID) && (s.Testament == "" || book.Testament == s.Testament)
+}
+
+const (
+	search_per_page     = 20
+	search_max_per_page = 100
+)
+
+// SearchQuery is a search as read from the URL: ?q=, the ?book= or
+// ?testament= scope, and which ?page= of ?per_page= results to show.
+type SearchQuery struct {
+	Text      string
+	Expr      SearchExpr
+	Terms     []string
+	Book      string
+	Testament string
+	Scope     SearchScope
+	Page      int
+	PerPage   int
+	Context   bool
+}
+
+// ParseSearchQuery reads a search from r. per_page is clamped to
+// search_max_per_page rather than refused.
+func (s *Server) ParseSearchQuery(r *http.Request) (SearchQuery, error) {
+	return s.ParseSearchValues(r.Context(), r.URL.Query())
+}
+
+// ParseSearchValues reads a search from query parameters, for callers
+// that don't have them in a URL.
+func (s *Server) ParseSearchValues(ctx context.Context, values url.Values) (SearchQuery, error) {
+	query := SearchQuery{
+		Text:      strings.TrimSpace(values.Get("q")),
+		Book:      values.Get("book"),
+		Testament: strings.ToLower(values.Get("testament")),
+		Page:      1,
+		PerPage:   search_per_page,
+		Context:   values.Get("context") == "1",
+	}
+	var err error
+	if query.Text != "" {
+		query.Expr, query.Terms, err = ParseSearch(query.Text)
+		if err != nil {
+			return query, err
+		}
+	}
+	if values.Get("page") != "" {
+		query.Page, err = ParseNumber("page", values.Get("page"))
+		if err != nil {
+			return query, err
+		}
+	}
+	if values.Get("per_page") != "" {
+		query.PerPage, err = ParseNumber("per_page", values.Get("per_page"))
+		if err != nil {
+			return query, err
+		}
+		query.PerPage = min(query.PerPage, search_max_per_page)
+	}
+	if query.Testament != "" {
+		if _, ok := testament_names[query.Testament]; !ok {
+			return query, &InvalidOptionError{Name: "testament", Value: query.Testament, Options: testament_order}
+		}
+		query.Scope.Testament = query.Testament
+	}
+	if query.Book != "" {
+		var book Book
+		err = s.Books.FindBook(ctx, default_translation, query.Book, &book)
+		if err != nil {
+			return query, err
+		}
+		query.Book = book.Slug
+		query.Scope.BookID = book.ID
+	}
+	return query, nil
+}
+
+// Run searches the index and returns one page of the hits, along with how
+// many there are in total.
+func (q SearchQuery) Run(idx *SearchIndex) ([]SearchHit, int) {
+	if q.Text == "" {
+		return nil, 0
+	}
+	hits := idx.Search(q.Expr, q.Scope)
+	start := min((q.Page-1)*q.PerPage, len(hits))
+	end := min(start+q.PerPage, len(hits))
+	return hits[start:end], len(hits)
+}
+
+// SearchURL links to page of the same search as q.
+func (s *Server) SearchURL(q SearchQuery, page int) string {
+	values := url.Values{"q": {q.Text}}
+	if q.Book != "" {
+		values.Set("book", q.Book)
+	}
+	if q.Testament != "" {
+		values.Set("testament", q.Testament)
+	}
+	if q.PerPage != search_per_page {
+		values.Set("per_page", strconv.Itoa(q.PerPage))
+	}
+	if q.Context {
+		values.Set("context", "1")
+	}
+	if page > 1 {
+		values.Set("page", strconv.Itoa(page))
+	}
+	return s.Path("search") + "?" + values.Encode()
+}
+
+type SearchResult struct {
+	Reference Link
+	Text      template.HTML
+	Before    string
+	After     string
+}
+
+// SearchResponse is the JSON form of a page of search results.
+type SearchResponse struct {
+	Query    string  `json:"query"`
+	Total    int     `json:"total"`
+	Page     int     `json:"page"`
+	PerPage  int     `json:"per_page"`
+	Pages    int     `json:"pages"`
+	Complete bool    `json:"complete"`
+	Results  []Verse `json:"results"`
+}
+
+func pageCount(total int, per_page int) int {
+	return (total + per_page - 1) / per_page
+}
+
+// NewSearchResponse runs query on the search index of the default
+// translation, starting the crawl that fills it if it hasn't started.
+func (s *Server) NewSearchResponse(query SearchQuery) SearchResponse {
+	s.Search.StartCrawl(default_translation)
+	_, _, complete := s.Search.Progress()
+	hits, total := query.Run(s.Search)
+
+	response := SearchResponse{
+		Query:    query.Text,
+		Total:    total,
+		Page:     query.Page,
+		PerPage:  query.PerPage,
+		Pages:    pageCount(total, query.PerPage),
+		Complete: complete,
+		Results:  []Verse{},
+	}
+	for _, hit := range hits {
+		verse := hit.Verse
+		verse.BookName = hit.Book.Name
+		verse.Text = verseText(verse.Text)
+		response.Results = append(response.Results, verse)
+	}
+	return response
+}
+
+func (s *Server) apiSearch(w http.ResponseWriter, r *http.Request) {
+	query, err := s.ParseSearchQuery(r)
+	if err != nil {
+		apiError(w, r, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, s.NewSearchResponse(query))
+}
+
+func (s *Server) getSearch(w http.ResponseWriter, r *http.Request) {
+	search, err := s.ParseSearchQuery(r)
+	if err != nil {
+		s.fetchError(w, r, default_translation, search.Book, err)
+		return
+	}
+	query := search.Text
+	page := SearchPage{Query: query, Book: search.Book, Testament: search.Testament, Context: search.Context}
+
+	s.Search.StartCrawl(default_translation)
+	page.Indexed, page.Chapters, page.Complete = s.Search.Progress()
+
+	for _, testament := range testament_order {
+		page.Testaments = append(page.Testaments, SearchOption{Value: testament, Text: testament_names[testament]})
+	}
+	var book_info BookInfo
+	if s.Books.Peek(default_translation, &book_info) {
+		for _, book := range book_info.Books {
+			page.Books = append(page.Books, SearchOption{Value: book.Slug, Text: book.Name})
+		}
+	}
+
+	if query != "" {
+		var hits []SearchHit
+		hits, page.Matches = search.Run(s.Search)
+		page.Page = search.Page
+		page.Pages = pageCount(page.Matches, search.PerPage)
+		if search.Page > 1 {
+			page.Previous = &Link{Text: "← Previous", URL: s.SearchURL(search, search.Page-1)}
+		}
+		if search.Page < page.Pages {
+			page.Next = &Link{Text: "Next →", URL: s.SearchURL(search, search.Page+1)}
+		}
+		for _, result := range hits {
+			found := SearchResult{
+				Reference: s.VerseLink(default_translation, result.Book, result.Verse.Chapter, result.Verse.Verse),
+				Text:      Highlight(verseText(result.Verse.Text), search.Terms),
+			}
+			if page.Context && result.Before != nil {
+				found.Before = verseText(result.Before.Text)
+			}
+			if page.Context && result.After != nil {
+				found.After = verseText(result.After.Text)
+			}
+			page.Results = append(page.Results, found)
+		}
+	}
+
+	title := "Search"
+	if query != "" {
+		title = fmt.Sprintf("Search: %s", query)
+	}
+	s.RenderPage(w, r, http.StatusOK, "search.html", title, page)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		terms []string
+		want  string
+	}{
+		{"one term", "For God so loved the world", []string{"loved"}, "For God so <mark>loved</mark> the world"},
+		{"ignores case", "For God so loved the world", []string{"god"}, "For <mark>God</mark> so loved the world"},
+		{"every occurrence", "love is patient, love is kind", []string{"love"}, "<mark>love</mark> is patient, <mark>love</mark> is kind"},
+		{"inside words", "Beloved, let us love", []string{"love"}, "Be<mark>love</mark>d, let us <mark>love</mark>"},
+		{"no terms", "a < b", nil, "a &lt; b"},
+		{"no match", "For God so loved the world", []string{"mercy"}, "For God so loved the world"},
+		{"start of the verse", "Jesus wept.", []string{"jesus"}, "<mark>Jesus</mark> wept."},
+		{"end of the verse", "Jesus wept.", []string{"wept."}, "Jesus <mark>wept.</mark>"},
+		{"whole verse", "Jesus wept.", []string{"jesus wept."}, "<mark>Jesus wept.</mark>"},
+		{"overlapping, longest wins", "For God so loved the world", []string{"love", "loved the"}, "For God so <mark>loved the</mark> world"},
+		{"overlapping, longest listed last", "For God so loved the world", []string{"loved the", "love"}, "For God so <mark>loved the</mark> world"},
+		{"overlapping, partly", "For God so loved the world", []string{"so love", "loved the"}, "For God <mark>so love</mark>d the world"},
+		{"adjacent", "a godsend", []string{"god", "send"}, "a <mark>god</mark><mark>send</mark>"},
+		{"phrase across whitespace", "Blessed are those\nwho walk", []string{"those who"}, "Blessed are <mark>those\nwho</mark> walk"},
+		{"escapes the text", `Jesus said, "<I AM>" & more`, []string{"i am"}, `Jesus said, &#34;&lt;<mark>I AM</mark>&gt;&#34; &amp; more`},
+		{"escapes the match", "bread & wine", []string{"& w"}, "bread <mark>&amp; w</mark>ine"},
+		{"not inside an entity", "bread & wine", []string{"amp"}, "bread &amp; wine"},
+		{"not inside a quote entity", `he said "go"`, []string{"34"}, "he said &#34;go&#34;"},
+		{"regexp characters", "Who? (Him.)", []string{"(him.)"}, "Who? <mark>(Him.)</mark>"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Highlight(test.text, test.terms); string(got) != test.want {
+				t.Errorf("Highlight(%q, %q) =\n%s\nwant\n%s", test.text, test.terms, got, test.want)
+			}
+		})
+	}
+}
+
+func TestHighlightCap(t *testing.T) {
+	text := strings.Repeat("e ", 30)
+	got := string(Highlight(text, []string{"e"}))
+	if n := strings.Count(got, "<mark>"); n != max_highlights {
+		t.Errorf("%d highlights, want %d", n, max_highlights)
+	}
+	if plain := strings.NewReplacer("<mark>", "", "</mark>", "").Replace(got); plain != text {
+		t.Errorf("highlighting changed the text to %q", plain)
+	}
+}
+
+func newTestIndex(verses ...IndexedVerse) *SearchIndex {
+	for i := range verses {
+		verses[i].text = searchText(verses[i].Verse.Text)
+	}
+	return &SearchIndex{verses: verses}
+}
+
+func TestSearchContext(t *testing.T) {
+	genesis := Book{ID: "GEN", Name: "Genesis", Testament: "OT"}
+	john := Book{ID: "JHN", Name: "John", Testament: "NT"}
+	idx := newTestIndex(
+		IndexedVerse{Book: genesis, Verse: Verse{Chapter: 1, Verse: 1, Text: "In the beginning, God created the heavens and the earth.\n"}},
+		IndexedVerse{Book: genesis, Verse: Verse{Chapter: 1, Verse: 2, Text: "The earth was formless and empty.\n"}},
+		IndexedVerse{Book: genesis, Verse: Verse{Chapter: 1, Verse: 3, Text: "God said, “Let there be light,” and there was light.\n"}},
+		IndexedVerse{Book: genesis, Verse: Verse{Chapter: 2, Verse: 1, Text: "The heavens, the earth, and all their vast array were finished.\n"}},
+		IndexedVerse{Book: john, Verse: Verse{Chapter: 1, Verse: 1, Text: "In the beginning was the Word.\n"}},
+	)
+	tests := []struct {
+		query  string
+		scope  SearchScope
+		hits   []string
+		before []string
+		after  []string
+	}{
+		{"light", SearchScope{}, []string{"GEN 1:3"}, []string{"GEN 1:2"}, []string{""}},
+		{"formless", SearchScope{}, []string{"GEN 1:2"}, []string{"GEN 1:1"}, []string{"GEN 1:3"}},
+		// the neighbours don't cross chapters or books
+		{"finished", SearchScope{}, []string{"GEN 2:1"}, []string{""}, []string{""}},
+		{"beginning", SearchScope{}, []string{"GEN 1:1", "JHN 1:1"}, []string{"", ""}, []string{"GEN 1:2", ""}},
+		{"beginning", SearchScope{Testament: "NT"}, []string{"JHN 1:1"}, []string{""}, []string{""}},
+		{"beginning", SearchScope{BookID: "GEN"}, []string{"GEN 1:1"}, []string{""}, []string{"GEN 1:2"}},
+	}
+	name := func(book Book, verse *Verse) string {
+		if verse == nil {
+			return ""
+		}
+		return fmt.Sprintf("%s %d:%d", book.ID, verse.Chapter, verse.Verse)
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			expr, _, err := ParseSearch(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hits := idx.Search(expr, test.scope)
+			if len(hits) != len(test.hits) {
+				t.Fatalf("%d hits, want %d", len(hits), len(test.hits))
+			}
+			for i, hit := range hits {
+				if got := name(hit.Book, &hit.Verse); got != test.hits[i] {
+					t.Errorf("hit %d is %s, want %s", i, got, test.hits[i])
+				}
+				if got := name(hit.Book, hit.Before); got != test.before[i] {
+					t.Errorf("hit %d: before %q, want %q", i, got, test.before[i])
+				}
+				if got := name(hit.Book, hit.After); got != test.after[i] {
+					t.Errorf("hit %d: after %q, want %q", i, got, test.after[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// SecurityPolicy builds the security headers sent with HTML pages. The
+// Content-Security-Policy is put together from the features that are turned
+// on, so enabling one only loosens the directives it needs, and only on the
+// pages that need it.
+type SecurityPolicy struct {
+	// ImageSources are allowed in <img> on top of the site itself. Pages
+	// that need more get a policy of their own from WithImages.
+	ImageSources []string
+	// EmbedOrigins may put Embeddable pages in an iframe, "*" for any site.
+	// Other pages can never be framed.
+	EmbedOrigins []string
+}
+
+var security_policy = &SecurityPolicy{}
+
+// ContentSecurityPolicy allows only the site's own scripts, and frames from
+// frame_ancestors, or from nowhere if it's empty.
+func (p *SecurityPolicy) ContentSecurityPolicy(frame_ancestors []string) string {
+	ancestors := "'none'"
+	if len(frame_ancestors) > 0 {
+		ancestors = strings.Join(frame_ancestors, " ")
+	}
+	directives := []string{
+		"default-src 'self'",
+		"script-src 'self'",
+		// the book index lays out its columns with a style attribute
+		"style-src 'self' 'unsafe-inline'",
+		"img-src " + strings.Join(append([]string{"'self'"}, p.ImageSources...), " "),
+		"form-action 'self'",
+		"base-uri 'self'",
+		"frame-ancestors " + ancestors,
+	}
+	return strings.Join(directives, "; ")
+}
+
+func (p *SecurityPolicy) set(header http.Header, embeddable bool) {
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+	if embeddable && len(p.EmbedOrigins) > 0 {
+		// X-Frame-Options can't name several origins, frame-ancestors
+		// takes over in every browser that supports it
+		header.Set("Content-Security-Policy", p.ContentSecurityPolicy(p.EmbedOrigins))
+		return
+	}
+	header.Set("Content-Security-Policy", p.ContentSecurityPolicy(nil))
+	header.Set("X-Frame-Options", "DENY")
+}
+
+// WithImages is a copy of p that also allows images from sources, like
+// "data:".
+func (p *SecurityPolicy) WithImages(sources ...string) *SecurityPolicy {
+	policy := *p
+	policy.ImageSources = append(append([]string{}, p.ImageSources...), sources...)
+	return &policy
+}
+
+// Page sets p's headers on a page, in place of the site's policy that
+// Headers would set.
+func (p *SecurityPolicy) Page(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p.set(w.Header(), false)
+		h(w, r)
+	}
+}
+
+// Embeddable marks a page that other sites may frame, from the origins in
+// -embed-origins.
+func (p *SecurityPolicy) Embeddable(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p.set(w.Header(), true)
+		h(w, r)
+	}
+}
+
+// securityWriter adds the headers once it can see the response is HTML.
+type securityWriter struct {
+	http.ResponseWriter
+	policy  *SecurityPolicy
+	started bool
+}
+
+func (s *securityWriter) start(body []byte) {
+	if s.started {
+		return
+	}
+	s.started = true
+	header := s.Header()
+	content_type := header.Get("Content-Type")
+	if content_type == "" && body != nil {
+		content_type = http.DetectContentType(body)
+	}
+	if strings.HasPrefix(content_type, "text/html") && header.Get("Content-Security-Policy") == "" {
+		s.policy.set(header, false)
+	}
+}
+
+func (s *securityWriter) WriteHeader(status int) {
+	s.start(nil)
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *securityWriter) Write(p []byte) (int, error) {
+	s.start(p)
+	return s.ResponseWriter.Write(p)
+}
+
+func (s *securityWriter) Flush() {
+	s.start(nil)
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Headers sets the security headers on every HTML response that an
+// Embeddable page hasn't already set them on.
+func (p *SecurityPolicy) Headers(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&securityWriter{ResponseWriter: w, policy: p}, r)
+	})
+}
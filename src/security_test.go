@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	embed_origins := security_policy.EmbedOrigins
+	security_policy.EmbedOrigins = []string{"https://example.com"}
+	t.Cleanup(func() { security_policy.EmbedOrigins = embed_origins })
+	handler := security_policy.Headers(newTestServer(t))
+
+	tests := []struct {
+		name string
+		path string
+		// csp are directives the Content-Security-Policy must have, and
+		// no policy at all is expected without any
+		csp           []string
+		frame_options string
+	}{
+		{"index", "/", []string{"img-src 'self';", "frame-ancestors 'none'"}, "DENY"},
+		{"chapter", "/john/3", []string{"script-src 'self'", "img-src 'self';", "frame-ancestors 'none'"}, "DENY"},
+		{"not found page", "/nope", []string{"img-src 'self';", "frame-ancestors 'none'"}, "DENY"},
+		{"api docs", "/api/v1/docs", []string{"img-src 'self' data:;", "frame-ancestors 'none'"}, "DENY"},
+		{"embed", "/embed/john/3/16", []string{"img-src 'self';", "frame-ancestors https://example.com"}, ""},
+		{"json", "/api/v1/john/3", nil, ""},
+		{"json not found", "/api/v1/nope/1", nil, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := get(t, handler, test.path)
+			csp := w.Header().Get("Content-Security-Policy")
+			if test.csp == nil && csp != "" {
+				t.Errorf("GET %s: Content-Security-Policy %q, want none", test.path, csp)
+			}
+			for _, directive := range test.csp {
+				if !strings.Contains(csp+";", directive) {
+					t.Errorf("GET %s: Content-Security-Policy %q doesn't have %q", test.path, csp, directive)
+				}
+			}
+			if frame_options := w.Header().Get("X-Frame-Options"); frame_options != test.frame_options {
+				t.Errorf("GET %s: X-Frame-Options %q, want %q", test.path, frame_options, test.frame_options)
+			}
+			if test.csp != nil && w.Header().Get("X-Content-Type-Options") != "nosniff" {
+				t.Errorf("GET %s: no X-Content-Type-Options: nosniff", test.path)
+			}
+		})
+	}
+}
+
+func TestWithImagesLeavesPolicyAlone(t *testing.T) {
+	policy := &SecurityPolicy{ImageSources: []string{"https://images.example.com"}}
+	docs := policy.WithImages("data:")
+	tests := []struct {
+		name   string
+		policy *SecurityPolicy
+		want   string
+	}{
+		{"original", policy, "img-src 'self' https://images.example.com;"},
+		{"copy", docs, "img-src 'self' https://images.example.com data:;"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			csp := test.policy.ContentSecurityPolicy(nil)
+			if !strings.Contains(csp, test.want) {
+				t.Errorf("Content-Security-Policy %q doesn't have %q", csp, test.want)
+			}
+		})
+	}
+}
+
+func TestSecurityHeadersOnlyOnHTML(t *testing.T) {
+	tests := []struct {
+		content_type string
+		body         string
+		want         bool
+	}{
+		{"text/html; charset=utf-8", "<p>hi</p>", true},
+		{"", "<!DOCTYPE html><p>hi</p>", true},
+		{"application/json", `{"ok":true}`, false},
+		{"text/plain; charset=utf-8", "hi", false},
+		{"image/png", "\x89PNG\r\n\x1a\n", false},
+	}
+	for _, test := range tests {
+		t.Run(test.content_type, func(t *testing.T) {
+			handler := (&SecurityPolicy{}).Headers(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if test.content_type != "" {
+					w.Header().Set("Content-Type", test.content_type)
+				}
+				w.Write([]byte(test.body))
+			}))
+			w := get(t, handler, "/")
+			if got := w.Header().Get("Content-Security-Policy") != ""; got != test.want {
+				t.Errorf("Content-Type %q: has a Content-Security-Policy %v, want %v", test.content_type, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// listenedServer is a server with the listener it runs on. TLS servers
+// take their certificate from cert_file and key_file, or from
+// server.TLSConfig when those are empty.
+type listenedServer struct {
+	server    *http.Server
+	listener  net.Listener
+	tls       bool
+	cert_file string
+	key_file  string
+}
+
+// Serve runs every server until ctx is done or one of them fails, then
+// shuts them all down together, giving open requests up to grace to
+// finish.
+func Serve(ctx context.Context, grace time.Duration, servers []listenedServer) error {
+	serve_err := make(chan error, len(servers))
+	for _, s := range servers {
+		go func() {
+			var err error
+			if s.tls {
+				err = s.server.ServeTLS(s.listener, s.cert_file, s.key_file)
+			} else {
+				err = s.server.Serve(s.listener)
+			}
+			if !errors.Is(err, http.ErrServerClosed) {
+				serve_err <- err
+			}
+		}()
+	}
+
+	var err error
+	select {
+	case err = <-serve_err:
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down", "grace", grace)
+	shutdown_ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			shutdown_err := s.server.Shutdown(shutdown_ctx)
+			if shutdown_err != nil {
+				slog.Error("shutdown", "addr", s.listener.Addr().String(), "err", shutdown_err)
+			}
+		}()
+	}
+	wg.Wait()
+	return err
+}
+
+// redirectHTTPS sends plain HTTP requests to the same path over HTTPS on
+// https_port, which is left out of the URL when it is 443.
+func redirectHTTPS(https_port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if https_port != "" && https_port != "443" {
+			host = net.JoinHostPort(host, https_port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
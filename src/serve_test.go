@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// serveInBackground runs Serve on a random port with handler, returning
+// the server's URL and the channel Serve's result arrives on.
+func serveInBackground(t *testing.T, ctx context.Context, grace time.Duration, handler http.Handler) (string, chan error) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(ctx, grace, []listenedServer{{server: &http.Server{Handler: handler}, listener: listener}})
+	}()
+	return "http://" + listener.Addr().String(), served
+}
+
+// A request in flight when the context is cancelled still gets its answer,
+// and Serve returns once it has.
+func TestServeShutdown(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		io.WriteString(w, "done")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	const grace = 5 * time.Second
+	url, served := serveInBackground(t, ctx, grace, handler)
+
+	type answer struct {
+		body string
+		err  error
+	}
+	answered := make(chan answer, 1)
+	go func() {
+		response, err := http.Get(url)
+		if err != nil {
+			answered <- answer{err: err}
+			return
+		}
+		defer response.Body.Close()
+		body, err := io.ReadAll(response.Body)
+		answered <- answer{string(body), err}
+	}()
+	receive(t, started)
+	start := time.Now()
+	cancel()
+
+	if a := receive(t, answered); a.err != nil || a.body != "done" {
+		t.Errorf("request in flight got %q, %v", a.body, a.err)
+	}
+	if err := receive(t, served); err != nil {
+		t.Errorf("Serve: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > grace {
+		t.Errorf("Serve took %v to return, more than the %v grace", elapsed, grace)
+	}
+	if _, err := http.Get(url); err == nil {
+		t.Errorf("still serving after Serve returned")
+	}
+}
+
+// A request that outlasts the grace period doesn't keep Serve from
+// returning.
+func TestServeShutdownGrace(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	const grace = 50 * time.Millisecond
+	url, served := serveInBackground(t, ctx, grace, handler)
+
+	go func() {
+		response, err := http.Get(url)
+		if err == nil {
+			response.Body.Close()
+		}
+	}()
+	receive(t, started)
+	start := time.Now()
+	cancel()
+	if err := receive(t, served); err != nil {
+		t.Errorf("Serve: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Serve took %v to return with a %v grace", elapsed, grace)
+	}
+}
+
+// One server failing shuts the others down and is what Serve returns.
+func TestServeFailure(t *testing.T) {
+	broken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	broken.Close()
+	working, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(context.Background(), time.Second, []listenedServer{
+			{server: &http.Server{Handler: http.NotFoundHandler()}, listener: working},
+			{server: &http.Server{Handler: http.NotFoundHandler()}, listener: broken},
+		})
+	}()
+	if err := receive(t, served); err == nil {
+		t.Errorf("Serve returned nil with a server that failed")
+	}
+	if _, err := http.Get("http://" + working.Addr().String()); err == nil {
+		t.Errorf("the working server is still up")
+	}
+}
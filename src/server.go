@@ -0,0 +1,217 @@
+package main
+
+import (
+	"container/list"
+	"html/template"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Server is what the handlers share: the client for bible-api.com, the
+// caches in front of it, and the store, which is nil without -db. main
+// builds one from its flags, and tests build one against a fake upstream.
+type Server struct {
+	Bible        *BibleClient
+	Books        *BookCache
+	Chapters     *ChapterCache
+	Translations *TranslationCache
+	Stats        *StatsCache
+	Plans        *PlanCache
+	Feeds        *FeedCache
+	Sitemaps     *SitemapCache
+	Images       *ImageCache
+	Search       *SearchIndex
+	Store        *Store
+
+	templates map[string]*template.Template
+	graphql   *GraphQLSchema
+	upstream  *upstreamCheck
+	// routes are the last ones Routes built, which Path builds links from
+	routes atomic.Pointer[mux.Router]
+}
+
+func NewServer(bible *BibleClient, store *Store) *Server {
+	bible.Store = store
+	s := &Server{
+		Bible:        bible,
+		Books:        NewBookCache(bible),
+		Chapters:     NewChapterCache(bible),
+		Translations: NewTranslationCache(bible),
+		Stats:        &StatsCache{entries: map[string]statsCacheEntry{}},
+		Plans:        &PlanCache{entries: map[string]planCacheEntry{}},
+		Images:       &ImageCache{order: list.New(), entries: map[string]*list.Element{}, Size: og_cache_size},
+		Store:        store,
+	}
+	s.Feeds = &FeedCache{Server: s, entries: map[string]feedCacheEntry{}}
+	s.Sitemaps = &SitemapCache{Server: s, entries: map[string]sitemapCacheEntry{}}
+	s.Search = &SearchIndex{Server: s, done: map[string]bool{}, Interval: 250 * time.Millisecond}
+	s.templates = parseTemplates(template.FuncMap{"linkify": s.linkify, "path": s.Path, "asset": s.AssetPath})
+	s.graphql = s.newGraphQLSchema()
+	s.upstream = &upstreamCheck{Server: s}
+	// links are built from the routes, so there are some from the start,
+	// which Routes replaces with the ones it serves
+	s.Routes(false, false)
+	return s
+}
+
+// Routes is the site's router, with /metrics on it if metrics is set and
+// /debug if debug is.
+func (s *Server) Routes(metrics bool, debug bool) *mux.Router {
+	m := mux.NewRouter()
+	m.Use(recordRoute, Gzip, s.Recover, CacheHeader, WithPrefs)
+	m.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if TrailingSlashRedirect(m, w, r) {
+			return
+		}
+		// a prefix route like /{translation} can hide a wrong method from
+		// mux, so it's checked again
+		if len(AllowedMethods(m, r)) > 0 {
+			m.MethodNotAllowedHandler.ServeHTTP(w, r)
+			return
+		}
+		message := "There's nothing at this address."
+		if WantsJSON(r) {
+			WriteJSON(w, http.StatusNotFound, ErrorResponse{Status: http.StatusNotFound, Error: message})
+			return
+		}
+		s.renderError(w, r, http.StatusNotFound, message)
+	})
+	if metrics {
+		m.Handle("/metrics", promhttp.Handler())
+	}
+	if debug {
+		registerDebug(m)
+	}
+	m.HandleFunc("/healthz", getHealth)
+	m.HandleFunc("/readyz", s.getReady)
+	var apis []*mux.Router
+	for _, version := range api_versions {
+		apis = append(apis, s.MountAPI(m, version))
+	}
+	m.PathPrefix("/api/").Methods(checked_methods...).Handler(api_cors.Handler(http.HandlerFunc(redirectAPIVersion)))
+	m.Handle("/graphql", api_cors.Handler(http.HandlerFunc(s.serveGraphQL))).Methods(http.MethodGet, http.MethodHead, http.MethodPost, http.MethodOptions).Name("graphql")
+	m.HandleFunc("/search", Negotiated(Formats{"html": s.getSearch, "json": s.apiSearch})).Name("search")
+	m.HandleFunc("/passage", s.getReference).Name("reference")
+	m.HandleFunc("/stats/{book}", s.CanonicalBook(Negotiated(Formats{"html": s.getStats, "json": s.apiStats})))
+	m.HandleFunc("/stats/{book}/{chapter}", s.CanonicalBook(Negotiated(Formats{"html": s.getStats, "json": s.apiStats})))
+	m.HandleFunc("/concordance/{word}", Negotiated(Formats{"html": s.getConcordance, "json": s.apiConcordance})).Name("concordance")
+	m.HandleFunc("/cite", Cached(text_max_age, s.getCiteReference)).Name("cite-reference")
+	m.HandleFunc("/cite/{book}/{chapter}/{verses}", s.CanonicalBook(Cached(text_max_age, s.getCite))).Name("cite")
+	m.HandleFunc("/og/{book}/{chapter}/{verse:[0-9]+}.png", s.CanonicalBook(Cached(text_max_age, s.getShareImage))).Name("share-image")
+	m.HandleFunc("/embed/{book}/{chapter}/{verse:[0-9]+}", s.CanonicalBook(Cached(text_max_age, security_policy.Embeddable(s.getEmbed)))).Name("embed")
+	m.HandleFunc("/oembed", s.getOEmbed).Name("oembed")
+	m.HandleFunc("/bookmarks", s.postBookmark).Methods(http.MethodPost)
+	m.HandleFunc("/bookmarks", s.getBookmarks).Name("bookmarks")
+	m.HandleFunc("/bookmarks.json", s.getBookmarksJSON).Name("bookmarks-json")
+	m.HandleFunc("/bookmarks/import", s.postBookmarksImport).Methods(http.MethodPost).Name("import-bookmarks")
+	if s.Store != nil {
+		m.HandleFunc("/notes", s.getNotes).Name("notes")
+		m.HandleFunc("/notes/{book}/{chapter}/{verse:[0-9]+}", s.postNote).Methods(http.MethodPost).Name("note")
+	}
+	if history_size > 0 {
+		m.HandleFunc("/history", s.getHistory).Name("history")
+		m.HandleFunc("/history/clear", s.postClearHistory).Methods(http.MethodPost).Name("clear-history")
+	}
+	if slack_signing_secret != "" {
+		m.HandleFunc("/integrations/slack", s.postSlack).Methods(http.MethodPost)
+	}
+	if discord_public_key != nil {
+		m.HandleFunc("/integrations/discord", s.postDiscord).Methods(http.MethodPost)
+	}
+	if telegram_token != "" {
+		m.HandleFunc("/integrations/telegram/{secret}", s.postTelegram).Methods(http.MethodPost).Name("telegram")
+	}
+	if admin_token != "" || admin_password != "" {
+		m.HandleFunc("/admin/cache", RequireAdmin(s.deleteAdminCache)).Methods(http.MethodDelete)
+		m.HandleFunc("/admin/cache", RequireAdmin(s.getAdminCache))
+	}
+	if mailer != nil {
+		m.HandleFunc("/subscribe", s.postSubscribe).Methods(http.MethodPost)
+		m.HandleFunc("/subscribe", s.getSubscribe).Name("subscribe")
+		m.HandleFunc("/subscribe/confirm", s.postConfirmSubscribe).Methods(http.MethodPost)
+		m.HandleFunc("/subscribe/confirm", s.getConfirmSubscribe).Name("confirm-subscribe")
+		m.HandleFunc("/unsubscribe", s.postUnsubscribe).Methods(http.MethodPost)
+		m.HandleFunc("/unsubscribe", s.getUnsubscribe).Name("unsubscribe")
+	}
+	m.HandleFunc("/highlights", s.postHighlight).Methods(http.MethodPost)
+	m.HandleFunc("/highlights", s.getHighlights).Name("highlights")
+	m.HandleFunc("/plans", s.getPlans).Name("plans")
+	m.HandleFunc("/plans/{plan}", s.getPlan).Name("plan")
+	m.HandleFunc("/plans/{plan}/calendar.ics", s.getPlanCalendar).Name("plan-calendar")
+	m.HandleFunc("/plans/{plan}/day/{day}", s.postPlanDay).Methods(http.MethodPost)
+	m.HandleFunc("/plans/{plan}/day/{day}", s.getPlanDay).Name("plan-day")
+	m.HandleFunc("/prefs", s.postPrefs).Methods(http.MethodPost)
+	m.HandleFunc("/prefs", s.getPrefs).Name("prefs")
+	m.HandleFunc("/theme", s.postTheme).Methods(http.MethodPost).Name("theme")
+	m.HandleFunc("/static/{name}", s.getStatic).Name("static")
+	m.HandleFunc("/favicon.ico", getFavicon)
+	m.HandleFunc("/goto", s.getGoto).Name("goto")
+	m.HandleFunc("/random", s.getRandom)
+	m.HandleFunc("/votd", s.getVerseOfTheDay).Name("votd")
+	m.HandleFunc("/events/votd", s.getVotdEvents)
+	m.HandleFunc("/feed.xml", s.getFeed).Name("feed")
+	m.HandleFunc("/sitemap.xml", s.getSitemap).Name("sitemap")
+	m.HandleFunc("/sitemap-{n:[0-9]+}.xml", s.getSitemap).Name("sitemap-part")
+	m.HandleFunc("/robots.txt", s.getRobots)
+	m.HandleFunc("/translations", Cached(index_max_age, s.getTranslations))
+	m.HandleFunc("/compare/{book}/{chapter}", Cached(text_max_age, s.getCompare)).Name("compare")
+	m.Path("/{translation}").MatcherFunc(s.isTranslationPath).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, SitePath(r.URL.Path, "/"), http.StatusMovedPermanently)
+	})
+	s.registerPages(m.PathPrefix("/{translation}").MatcherFunc(s.isTranslationPath).Subrouter(), translated_route)
+	s.registerPages(m, "")
+	// pages only read, so they take GET and HEAD, and the API takes CORS
+	// preflights too
+	for _, api := range apis {
+		RestrictMethods(api, http.MethodGet, http.MethodHead, http.MethodOptions)
+	}
+	RestrictMethods(m, http.MethodGet, http.MethodHead)
+	m.MethodNotAllowedHandler = s.MethodNotAllowed(m)
+	// the OpenAPI document is reflected from the API's types once, now
+	openapi_spec()
+	// links are built from the routes from now on
+	s.routes.Store(m)
+	return m
+}
+
+// registerAPI adds the JSON API's handlers to a version's subrouter.
+func (s *Server) registerAPI(api *mux.Router) {
+	api.HandleFunc("/openapi.json", Cached(index_max_age, getOpenAPI))
+	// Swagger UI draws its icons from data: URLs
+	api.HandleFunc("/docs", security_policy.WithImages("data:").Page(s.getAPIDocs))
+	api.HandleFunc("/books", Cached(index_max_age, s.apiBooks))
+	api.HandleFunc("/random", s.apiRandom)
+	api.HandleFunc("/votd", s.apiVerseOfTheDay)
+	api.HandleFunc("/complete", s.apiComplete)
+	api.HandleFunc("/passages", s.apiPassages).Methods(http.MethodPost, http.MethodOptions)
+	if s.Store != nil {
+		api.HandleFunc("/webhooks", s.apiAddWebhook).Methods(http.MethodPost, http.MethodOptions)
+		api.HandleFunc("/webhooks/{id}", s.apiDeleteWebhook).Methods(http.MethodDelete, http.MethodOptions)
+	}
+	api.HandleFunc("/{book}/chapters", Cached(text_max_age, s.apiChapters))
+	api.HandleFunc("/{book}/{chapter}", Cached(text_max_age, s.apiVerses))
+	api.HandleFunc("/{book}/{chapter}/{verse:[0-9]+}", Cached(text_max_age, s.apiVerse))
+}
+
+// translated_route starts the names of the pages under /{translation}, so
+// "translation/chapter" is "chapter" in another translation.
+const translated_route = "translation/"
+
+// registerPages adds the pages of a translation to r, naming their routes
+// with prefix.
+func (s *Server) registerPages(r *mux.Router, prefix string) {
+	r.HandleFunc("/", Cached(index_max_age, Negotiated(Formats{"html": s.getBooks, "json": s.apiBooks}))).Name(prefix + "books")
+	r.HandleFunc("/{book}.md", s.CanonicalBook(Cached(text_max_age, s.markdownBook)))
+	r.HandleFunc("/{book}", s.CanonicalBook(Cached(text_max_age, Negotiated(Formats{"html": s.getChapters, "json": s.apiChapters})))).Name(prefix + "book")
+	r.HandleFunc("/{book}/full", s.CanonicalBook(s.getFullBook)).Name(prefix + "full")
+	r.HandleFunc("/{book}/{chapter}.txt", s.CanonicalBook(Cached(text_max_age, s.textVerses)))
+	r.HandleFunc("/{book}/{chapter}", s.CanonicalBook(Cached(text_max_age, Negotiated(Formats{"html": s.RecordHistory(s.getVerses), "json": s.apiVerses, "txt": s.textVerses, "md": s.markdownVerses})))).Name(prefix + "chapter")
+	r.HandleFunc("/{book}/{chapter}/print", s.CanonicalBook(Cached(text_max_age, s.getPrint))).Name(prefix + "print")
+	r.HandleFunc("/{book}/{chapter}/{verses}.txt", s.CanonicalBook(Cached(text_max_age, s.textPassage)))
+	r.HandleFunc("/{book}/{chapter}/{verse:[0-9]+}", s.CanonicalBook(Cached(text_max_age, s.RecordHistory(s.getVerse)))).Name(prefix + "verse")
+	r.HandleFunc("/{book}/{chapter}/{verses}", s.CanonicalBook(Cached(text_max_age, Negotiated(Formats{"html": s.getPassage, "txt": s.textPassage})))).Name(prefix + "passage")
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// requests that fail on purpose would log errors otherwise
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// serveFixture answers like bible-api.com with the canned responses under
+// testdata/upstream, where /data/web/JHN/3 is data/web/JHN/3.json, and a
+// 404 for anything else, the way bible-api.com answers a book or chapter
+// it doesn't have.
+func serveFixture(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	body, err := os.ReadFile(path.Join("testdata/upstream", path.Clean(r.URL.Path)+".json"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"error":"not found"}`)
+		return
+	}
+	w.Write(body)
+}
+
+// fakeUpstream is a bible-api.com that serves the fixtures.
+func fakeUpstream(t *testing.T) *httptest.Server {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(serveFixture))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+// newTestServer is the site, without a store, against fakeUpstream.
+func newTestServer(t *testing.T) http.Handler {
+	t.Helper()
+	return testServer(t, fakeUpstream(t).URL).Routes(false, false)
+}
+
+// testServer is the site, without a store, against the bible-api.com at
+// base_url.
+func testServer(t *testing.T, base_url string) *Server {
+	t.Helper()
+	bible := NewBibleClient(base_url)
+	bible.Retries = 0
+	s := NewServer(bible, nil)
+	// a search starts crawling the upstream, which shouldn't outlive the
+	// test
+	s.Search.Interval = time.Millisecond
+	t.Cleanup(func() { waitForCrawl(s.Search) })
+	return s
+}
+
+func waitForCrawl(idx *SearchIndex) {
+	for {
+		idx.mu.RLock()
+		crawling := idx.crawling
+		idx.mu.RUnlock()
+		if !crawling {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func get(t *testing.T, handler http.Handler, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+func TestPages(t *testing.T) {
+	handler := newTestServer(t)
+	tests := []struct {
+		name   string
+		target string
+		status int
+		want   []string
+	}{
+		{"index", "/", http.StatusOK, []string{`href="/genesis"`, `href="/song-of-solomon"`, `href="/john"`}},
+		{"book", "/john", http.StatusOK, []string{`href="/john/1"`, `href="/john/3"`, `href="/john/21"`}},
+		{"chapter", "/john/3", http.StatusOK, []string{"For God so loved the world", "Nicodemus"}},
+		{"verse", "/john/3/16", http.StatusOK, []string{"For God so loved the world"}},
+		{"book with spaces", "/song-of-solomon", http.StatusOK, []string{`href="/song-of-solomon/1"`, `href="/song-of-solomon/8"`}},
+		{"chapter of book with spaces", "/song-of-solomon/2", http.StatusOK, []string{"I am a rose of Sharon"}},
+		{"longest chapter", "/psalms/119", http.StatusOK, []string{"Blessed are those whose ways are blameless", "Your word is a lamp to my feet", "I have gone astray like a lost sheep"}},
+		{"last verse of longest chapter", "/psalms/119/176", http.StatusOK, []string{"I have gone astray like a lost sheep"}},
+		{"psalm in a range", "/passage?ref=Psalm+119:105-106", http.StatusOK, []string{"Your word is a lamp to my feet", "Verse 106 of Psalm 119."}},
+		{"unknown book", "/nope", http.StatusNotFound, nil},
+		{"chapter of unknown book", "/nope/1", http.StatusNotFound, nil},
+		{"chapter past the end", "/john/22", http.StatusNotFound, nil},
+		{"verse past the end", "/psalms/119/177", http.StatusNotFound, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := get(t, handler, test.target)
+			if w.Code != test.status {
+				t.Fatalf("GET %s: status %d, want %d", test.target, w.Code, test.status)
+			}
+			body := w.Body.String()
+			for _, want := range test.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("GET %s: body doesn't contain %q", test.target, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCanonicalBookRedirects(t *testing.T) {
+	handler := newTestServer(t)
+	tests := []struct {
+		target   string
+		location string
+	}{
+		{"/songofsolomon/2", "/song-of-solomon/2"},
+		{"/Song-Of-Solomon/2", "/song-of-solomon/2"},
+		{"/jn/3", "/john/3"},
+		{"/psalms/0119", "/psalms/119"},
+		{"/psa/119/176", "/psalms/119/176"},
+	}
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			w := get(t, handler, test.target)
+			if w.Code != http.StatusMovedPermanently {
+				t.Fatalf("GET %s: status %d, want %d", test.target, w.Code, http.StatusMovedPermanently)
+			}
+			if location := w.Header().Get("Location"); location != test.location {
+				t.Errorf("GET %s: redirected to %q, want %q", test.target, location, test.location)
+			}
+		})
+	}
+}
+
+func TestAPIVerseCounts(t *testing.T) {
+	handler := newTestServer(t)
+	tests := []struct {
+		target string
+		verses int
+	}{
+		{"/api/v1/psalms/119", 176},
+		{"/api/v1/song-of-solomon/2", 17},
+		{"/api/v1/john/3", 36},
+	}
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			w := get(t, handler, test.target)
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET %s: status %d, want %d", test.target, w.Code, http.StatusOK)
+			}
+			var verse_info VerseInfo
+			err := json.Unmarshal(w.Body.Bytes(), &verse_info)
+			if err != nil {
+				t.Fatalf("GET %s: %v", test.target, err)
+			}
+			if len(verse_info.Verses) != test.verses {
+				t.Errorf("GET %s: %d verses, want %d", test.target, len(verse_info.Verses), test.verses)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// FetchGroup is where sharedFetch keeps the fetches in flight, by key. The
+// singleflight.Group runs them and hands every caller the result, and
+// calls tracks how many callers still wait on each, which singleflight
+// doesn't. Its zero value is ready to use.
+type FetchGroup struct {
+	group singleflight.Group
+	mu    sync.Mutex
+	calls map[string]*sharedCall
+}
+
+// sharedCall is one fetch in flight and how many callers wait on it.
+type sharedCall struct {
+	ctx     *sharedContext
+	waiters int
+}
+
+// sharedContext is the context a shared fetch runs with. It keeps the
+// values of the caller that started it, like its logger and trace span,
+// but it's only cancelled once every caller waiting on the fetch has given
+// up, and its deadline is the latest of theirs.
+type sharedContext struct {
+	context.Context
+	cancel context.CancelCauseFunc
+
+	mu        sync.Mutex
+	deadline  time.Time
+	unbounded bool
+	timer     *time.Timer
+}
+
+func newSharedContext(ctx context.Context) *sharedContext {
+	inner, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	return &sharedContext{Context: inner, cancel: cancel}
+}
+
+func (c *sharedContext) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.unbounded || c.timer == nil {
+		return time.Time{}, false
+	}
+	return c.deadline, true
+}
+
+func (c *sharedContext) Err() error {
+	err := c.Context.Err()
+	if err != nil && errors.Is(context.Cause(c.Context), context.DeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// wait takes a caller's deadline into account: the fetch gets until the
+// latest one, and none at all if a caller has none.
+func (c *sharedContext) wait(ctx context.Context) {
+	deadline, ok := ctx.Deadline()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case c.unbounded:
+	case !ok:
+		c.unbounded = true
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+	case c.timer == nil:
+		c.deadline = deadline
+		c.timer = time.AfterFunc(time.Until(deadline), func() {
+			c.cancel(context.DeadlineExceeded)
+		})
+	case deadline.After(c.deadline):
+		c.deadline = deadline
+		c.timer.Reset(time.Until(deadline))
+	}
+}
+
+func (c *sharedContext) release() {
+	c.mu.Lock()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.mu.Unlock()
+	c.cancel(context.Canceled)
+}
+
+// sharedFetch runs fetch once for every concurrent caller asking for the
+// same key, so fifty people opening /john/3 together cost one upstream
+// request. The fetch isn't tied to the first caller's context, since the
+// others are still waiting on it if that caller gives up. Once they all
+// have it's cancelled, and a caller asking after that starts a new one.
+func sharedFetch[T any](ctx context.Context, group *FetchGroup, key string, out *T, fetch func(context.Context, *T) error) error {
+	group.mu.Lock()
+	call, ok := group.calls[key]
+	if !ok || call.ctx.Err() != nil {
+		call = &sharedCall{ctx: newSharedContext(ctx)}
+		if group.calls == nil {
+			group.calls = map[string]*sharedCall{}
+		}
+		group.calls[key] = call
+		// a cancelled fetch can still be running, and mustn't be joined
+		group.group.Forget(key)
+	}
+	call.waiters++
+	call.ctx.wait(ctx)
+	result := group.group.DoChan(key, func() (any, error) {
+		var value T
+		err := fetch(call.ctx, &value)
+		group.mu.Lock()
+		if group.calls[key] == call {
+			delete(group.calls, key)
+		}
+		group.mu.Unlock()
+		call.ctx.release()
+		return value, err
+	})
+	group.mu.Unlock()
+
+	select {
+	case r := <-result:
+		if r.Err != nil {
+			return r.Err
+		}
+		*out = r.Val.(T)
+		return nil
+	case <-ctx.Done():
+		group.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			call.ctx.cancel(context.Canceled)
+		}
+		group.mu.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitForWaiters waits until n callers are waiting on the fetch for key.
+func waitForWaiters(t *testing.T, group *FetchGroup, key string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		group.mu.Lock()
+		call := group.calls[key]
+		waiters := 0
+		if call != nil {
+			waiters = call.waiters
+		}
+		group.mu.Unlock()
+		if waiters == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d callers never all waited on %s", n, key)
+}
+
+// countingUpstream serves the fixtures, counting the requests for each path
+// and holding the ones for hold until release is closed.
+func countingUpstream(t *testing.T, hold string, release chan struct{}) (*httptest.Server, *sync.Map) {
+	t.Helper()
+	var hits sync.Map
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count, _ := hits.LoadOrStore(r.URL.Path, new(atomic.Int32))
+		count.(*atomic.Int32).Add(1)
+		if r.URL.Path == hold {
+			<-release
+		}
+		serveFixture(w, r)
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream, &hits
+}
+
+func hitCount(hits *sync.Map, path string) int32 {
+	count, ok := hits.Load(path)
+	if !ok {
+		return 0
+	}
+	return count.(*atomic.Int32).Load()
+}
+
+func TestGetVerseInfoShared(t *testing.T) {
+	release := make(chan struct{})
+	upstream, hits := countingUpstream(t, "/data/web/JHN/3", release)
+	bible := NewBibleClient(upstream.URL)
+	bible.Retries = 0
+
+	const callers = 50
+	var wg sync.WaitGroup
+	errs := make([]error, callers)
+	verses := make([]int, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var verse_info VerseInfo
+			errs[i] = bible.GetVerseInfo(context.Background(), "web", "JHN", "3", &verse_info)
+			verses[i] = len(verse_info.Verses)
+		}()
+	}
+	waitForWaiters(t, &bible.group, "verses/web/JHN/3", callers)
+	close(release)
+	wg.Wait()
+
+	for i := range callers {
+		if errs[i] != nil || verses[i] != 36 {
+			t.Errorf("caller %d got %d verses, %v", i, verses[i], errs[i])
+		}
+	}
+	if n := hitCount(hits, "/data/web/JHN/3"); n != 1 {
+		t.Errorf("upstream asked for John 3 %d times, want once", n)
+	}
+}
+
+func TestChapterPageShared(t *testing.T) {
+	release := make(chan struct{})
+	upstream, hits := countingUpstream(t, "/data/web/JHN/3", release)
+	bible := NewBibleClient(upstream.URL)
+	bible.Retries = 0
+	handler := NewServer(bible, nil).Routes(false, false)
+
+	const callers = 50
+	var wg sync.WaitGroup
+	codes := make([]int, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/john/3", nil))
+			codes[i] = w.Code
+		}()
+	}
+	waitForWaiters(t, &bible.group, "verses/web/JHN/3", callers)
+	close(release)
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("request %d: status %d", i, code)
+		}
+	}
+	if n := hitCount(hits, "/data/web/JHN/3"); n != 1 {
+		t.Errorf("upstream asked for John 3 %d times, want once", n)
+	}
+	// the book and chapter lists come from the caches once fetched
+	if w := get(t, handler, "/john/3"); w.Code != http.StatusOK {
+		t.Errorf("status %d after the shared fetch", w.Code)
+	}
+	for _, path := range []string{"/data/web", "/data/web/JHN"} {
+		if n := hitCount(hits, path); n != 1 {
+			t.Errorf("upstream asked for %s %d times, want once", path, n)
+		}
+	}
+}
+
+// blockingFetch is a fetch that hands over its context, then waits to be
+// released.
+type blockingFetch struct {
+	calls   atomic.Int32
+	started chan context.Context
+	release chan struct{}
+	err     error
+}
+
+func newBlockingFetch() *blockingFetch {
+	return &blockingFetch{started: make(chan context.Context, 10), release: make(chan struct{})}
+}
+
+func (f *blockingFetch) fetch(ctx context.Context, out *int) error {
+	n := f.calls.Add(1)
+	f.started <- ctx
+	select {
+	case <-f.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	*out = int(n)
+	return f.err
+}
+
+type fetchResult struct {
+	value int
+	err   error
+}
+
+func startSharedFetch(group *FetchGroup, ctx context.Context, f *blockingFetch) chan fetchResult {
+	result := make(chan fetchResult, 1)
+	go func() {
+		var value int
+		err := sharedFetch(ctx, group, "key", &value, f.fetch)
+		result <- fetchResult{value, err}
+	}()
+	return result
+}
+
+func receive[T any](t *testing.T, c <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-c:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+		panic("unreachable")
+	}
+}
+
+func TestSharedFetch(t *testing.T) {
+	t.Run("concurrent callers share one fetch", func(t *testing.T) {
+		var group FetchGroup
+		f := newBlockingFetch()
+		var results []chan fetchResult
+		for range 50 {
+			results = append(results, startSharedFetch(&group, context.Background(), f))
+		}
+		waitForWaiters(t, &group, "key", 50)
+		close(f.release)
+		for i, result := range results {
+			if r := receive(t, result); r.err != nil || r.value != 1 {
+				t.Errorf("caller %d got %+v, want the first fetch", i, r)
+			}
+		}
+		if n := f.calls.Load(); n != 1 {
+			t.Errorf("fetched %d times, want once", n)
+		}
+	})
+
+	t.Run("one caller giving up leaves the fetch to the others", func(t *testing.T) {
+		var group FetchGroup
+		f := newBlockingFetch()
+		first_ctx, cancel := context.WithCancel(context.Background())
+		first := startSharedFetch(&group, first_ctx, f)
+		fetch_ctx := receive(t, f.started)
+		second := startSharedFetch(&group, context.Background(), f)
+		waitForWaiters(t, &group, "key", 2)
+
+		cancel()
+		if result := receive(t, first); !errors.Is(result.err, context.Canceled) {
+			t.Errorf("first caller got %+v, want context.Canceled", result)
+		}
+		if fetch_ctx.Err() != nil {
+			t.Fatalf("fetch cancelled with a caller still waiting: %v", fetch_ctx.Err())
+		}
+		close(f.release)
+		if result := receive(t, second); result.err != nil || result.value != 1 {
+			t.Errorf("second caller got %+v, want the first fetch", result)
+		}
+	})
+
+	t.Run("all callers giving up cancels the fetch", func(t *testing.T) {
+		var group FetchGroup
+		f := newBlockingFetch()
+		first_ctx, cancel_first := context.WithCancel(context.Background())
+		second_ctx, cancel_second := context.WithCancel(context.Background())
+		first := startSharedFetch(&group, first_ctx, f)
+		fetch_ctx := receive(t, f.started)
+		second := startSharedFetch(&group, second_ctx, f)
+		waitForWaiters(t, &group, "key", 2)
+
+		cancel_first()
+		cancel_second()
+		receive(t, first)
+		receive(t, second)
+		receive(t, fetch_ctx.Done())
+
+		// so the next caller starts again
+		third := startSharedFetch(&group, context.Background(), f)
+		receive(t, f.started)
+		close(f.release)
+		if result := receive(t, third); result.err != nil || result.value != 2 {
+			t.Errorf("third caller got %+v, want a second fetch", result)
+		}
+	})
+
+	t.Run("a cancelled fetch that hasn't returned isn't joined", func(t *testing.T) {
+		var group FetchGroup
+		stuck := make(chan struct{})
+		t.Cleanup(func() { close(stuck) })
+		ctx, cancel := context.WithCancel(context.Background())
+		first := make(chan error, 1)
+		go func() {
+			var value int
+			first <- sharedFetch(ctx, &group, "key", &value, func(ctx context.Context, out *int) error {
+				<-stuck
+				return nil
+			})
+		}()
+		waitForWaiters(t, &group, "key", 1)
+		cancel()
+		receive(t, first)
+
+		second := make(chan fetchResult, 1)
+		go func() {
+			var value int
+			err := sharedFetch(context.Background(), &group, "key", &value, func(ctx context.Context, out *int) error {
+				*out = 2
+				return nil
+			})
+			second <- fetchResult{value, err}
+		}()
+		if result := receive(t, second); result.err != nil || result.value != 2 {
+			t.Errorf("second caller got %+v, want a new fetch", result)
+		}
+	})
+
+	t.Run("the fetch keeps the caller's values", func(t *testing.T) {
+		type key struct{}
+		var group FetchGroup
+		f := newBlockingFetch()
+		close(f.release)
+		result := startSharedFetch(&group, context.WithValue(context.Background(), key{}, "trace"), f)
+		fetch_ctx := receive(t, f.started)
+		receive(t, result)
+		if fetch_ctx.Value(key{}) != "trace" {
+			t.Errorf("fetch context lost the caller's values")
+		}
+	})
+
+	t.Run("errors are shared", func(t *testing.T) {
+		var group FetchGroup
+		f := newBlockingFetch()
+		f.err = ErrUpstreamUnavailable
+		first := startSharedFetch(&group, context.Background(), f)
+		receive(t, f.started)
+		second := startSharedFetch(&group, context.Background(), f)
+		waitForWaiters(t, &group, "key", 2)
+		close(f.release)
+		for _, result := range []fetchResult{receive(t, first), receive(t, second)} {
+			if !errors.Is(result.err, ErrUpstreamUnavailable) {
+				t.Errorf("caller got %+v, want ErrUpstreamUnavailable", result)
+			}
+		}
+		if n := f.calls.Load(); n != 1 {
+			t.Errorf("fetched %d times, want once", n)
+		}
+	})
+
+	t.Run("keys are fetched apart", func(t *testing.T) {
+		var group FetchGroup
+		f := newBlockingFetch()
+		close(f.release)
+		var a, b int
+		if err := sharedFetch(context.Background(), &group, "a", &a, f.fetch); err != nil {
+			t.Fatal(err)
+		}
+		if err := sharedFetch(context.Background(), &group, "b", &b, f.fetch); err != nil {
+			t.Fatal(err)
+		}
+		if n := f.calls.Load(); n != 2 {
+			t.Errorf("fetched %d times, want twice", n)
+		}
+	})
+
+	t.Run("finished fetches aren't reused", func(t *testing.T) {
+		var group FetchGroup
+		f := newBlockingFetch()
+		close(f.release)
+		for want := 1; want <= 2; want++ {
+			result := receive(t, startSharedFetch(&group, context.Background(), f))
+			<-f.started
+			if result.err != nil || result.value != want {
+				t.Errorf("call %d got %+v", want, result)
+			}
+		}
+	})
+}
+
+func TestSharedFetchDeadline(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		deadlines []time.Duration // 0 for none
+		want      time.Duration   // 0 for none
+	}{
+		{"one caller", []time.Duration{time.Hour}, time.Hour},
+		{"latest wins", []time.Duration{time.Hour, 2 * time.Hour}, 2 * time.Hour},
+		{"earlier doesn't shorten it", []time.Duration{2 * time.Hour, time.Hour}, 2 * time.Hour},
+		{"no deadline", []time.Duration{0}, 0},
+		{"a caller without one lifts it", []time.Duration{time.Hour, 0, 2 * time.Hour}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var group FetchGroup
+			f := newBlockingFetch()
+			var results []chan fetchResult
+			var fetch_ctx context.Context
+			for i, d := range test.deadlines {
+				ctx := context.Background()
+				if d != 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithDeadline(ctx, now.Add(d))
+					defer cancel()
+				}
+				results = append(results, startSharedFetch(&group, ctx, f))
+				if i == 0 {
+					fetch_ctx = receive(t, f.started)
+				}
+				waitForWaiters(t, &group, "key", i+1)
+			}
+			deadline, ok := fetch_ctx.Deadline()
+			if test.want == 0 {
+				if ok {
+					t.Errorf("fetch deadline %v, want none", deadline)
+				}
+			} else if !ok || !deadline.Equal(now.Add(test.want)) {
+				t.Errorf("fetch deadline %v, %v, want %v", deadline, ok, now.Add(test.want))
+			}
+			close(f.release)
+			for _, result := range results {
+				receive(t, result)
+			}
+		})
+	}
+}
+
+func TestSharedFetchDeadlineExceeded(t *testing.T) {
+	var group FetchGroup
+	f := newBlockingFetch()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	result := startSharedFetch(&group, ctx, f)
+	fetch_ctx := receive(t, f.started)
+	if r := receive(t, result); !errors.Is(r.err, context.DeadlineExceeded) {
+		t.Errorf("caller got %+v, want context.DeadlineExceeded", r)
+	}
+	receive(t, fetch_ctx.Done())
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/sync/errgroup"
+)
+
+// max_sitemap_urls is the most URLs the sitemap protocol allows in one
+// file. Past it /sitemap.xml becomes an index of /sitemap-1.xml and on.
+const max_sitemap_urls = 50000
+
+var (
+	// canonical_url is the scheme and host links in the sitemap are made
+	// absolute with, from -canonical-url. Without it the request's host is
+	// used.
+	canonical_url = ""
+	// sitemap_translations are listed in the sitemap, from
+	// -sitemap-translations. Without it only the default translation is.
+	sitemap_translations []string
+)
+
+// canonicalOrigin is -canonical-url, or the scheme and host the request
+// came in on.
+func canonicalOrigin(r *http.Request) string {
+	if canonical_url != "" {
+		return canonical_url
+	}
+	return absoluteURL(r, "")
+}
+
+func sitemapTranslations() []string {
+	if len(sitemap_translations) == 0 {
+		return []string{default_translation}
+	}
+	return sitemap_translations
+}
+
+type SitemapURL struct {
+	Loc string `xml:"loc"`
+}
+
+type SitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []SitemapURL `xml:"url"`
+}
+
+type SitemapIndex struct {
+	XMLName  xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []SitemapURL `xml:"sitemap"`
+}
+
+// SitemapURLs lists the index, books and chapters of each translation, in
+// Bible order. Chapter lists come from s.Chapters, so after the first
+// build they cost no upstream requests.
+func (s *Server) SitemapURLs(ctx context.Context, translations []string, origin string) ([]string, error) {
+	var urls []string
+	for _, translation := range translations {
+		var book_info BookInfo
+		err := s.Books.Get(ctx, translation, &book_info)
+		if err != nil {
+			return nil, err
+		}
+		chapters := make([]ChapterInfo, len(book_info.Books))
+		g, ctx := errgroup.WithContext(ctx)
+		g.SetLimit(markdown_workers)
+		for i, book := range book_info.Books {
+			g.Go(func() error {
+				return s.Chapters.Get(ctx, translation, book.ID, &chapters[i])
+			})
+		}
+		err = g.Wait()
+		if err != nil {
+			return nil, err
+		}
+
+		urls = append(urls, origin+s.TranslationPath(translation, "books"))
+		for i, book := range book_info.Books {
+			urls = append(urls, origin+s.BookLink(translation, book).URL)
+			for _, chapter := range chapters[i].Chapters {
+				urls = append(urls, origin+s.ChapterLink(translation, book, chapter.Chapter).URL)
+			}
+		}
+	}
+	return urls, nil
+}
+
+// BuildSitemaps writes the sitemap files. The first is /sitemap.xml, which
+// holds every URL when they fit in one file, or otherwise is the index of
+// the rest, /sitemap-1.xml onwards.
+func (s *Server) BuildSitemaps(urls []string, origin string) ([][]byte, error) {
+	var files []any
+	if len(urls) <= max_sitemap_urls {
+		files = append(files, sitemapURLSet(urls))
+	} else {
+		var index SitemapIndex
+		for start := 0; start < len(urls); start += max_sitemap_urls {
+			part := urls[start:min(start+max_sitemap_urls, len(urls))]
+			files = append(files, sitemapURLSet(part))
+			index.Sitemaps = append(index.Sitemaps, SitemapURL{Loc: origin + s.Path("sitemap-part", "n", strconv.Itoa(len(index.Sitemaps)+1))})
+		}
+		files = append([]any{index}, files...)
+	}
+
+	bodies := make([][]byte, len(files))
+	for i, file := range files {
+		encoded, err := xml.MarshalIndent(file, "", "\t")
+		if err != nil {
+			return nil, err
+		}
+		bodies[i] = append([]byte(xml.Header), encoded...)
+	}
+	return bodies, nil
+}
+
+func sitemapURLSet(urls []string) SitemapURLSet {
+	set := SitemapURLSet{URLs: make([]SitemapURL, len(urls))}
+	for i, url := range urls {
+		set.URLs[i] = SitemapURL{Loc: url}
+	}
+	return set
+}
+
+type sitemapCacheEntry struct {
+	files [][]byte
+	// books is when each translation's book list was fetched. A refresh of
+	// any of them builds the sitemap again.
+	books map[string]time.Time
+	added time.Time
+}
+
+// SitemapCache keeps the built sitemap for each origin, since the set of
+// chapters only changes when bible-api.com changes its book lists.
+type SitemapCache struct {
+	// Server is what the sitemaps are built from.
+	Server *Server
+
+	mu      sync.Mutex
+	entries map[string]sitemapCacheEntry
+	group   FetchGroup
+}
+
+func (c *SitemapCache) Get(ctx context.Context, translations []string, origin string, files *[][]byte) error {
+	books := map[string]time.Time{}
+	for _, translation := range translations {
+		// refreshes the book list when it's past -book-ttl
+		var book_info BookInfo
+		err := c.Server.Books.Get(ctx, translation, &book_info)
+		if err != nil {
+			return err
+		}
+		books[translation], _ = c.Server.Books.Fetched(translation)
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[origin]
+	c.mu.Unlock()
+	if ok && maps.Equal(entry.books, books) {
+		recordLookup(ctx, "sitemap", "hit")
+		*files = entry.files
+		return nil
+	}
+	recordLookup(ctx, "sitemap", "miss")
+
+	err := sharedFetch(ctx, &c.group, origin, files, func(ctx context.Context, files *[][]byte) error {
+		urls, err := c.Server.SitemapURLs(ctx, translations, origin)
+		if err != nil {
+			return err
+		}
+		*files, err = c.Server.BuildSitemaps(urls, origin)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.entries[origin] = sitemapCacheEntry{files: *files, books: books, added: time.Now()}
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *SitemapCache) Entries() []CacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := make([]CacheEntry, 0, len(c.entries))
+	for origin, entry := range c.entries {
+		size := 0
+		for _, file := range entry.files {
+			size += len(file)
+		}
+		entries = append(entries, CacheEntry{Key: origin, Size: size, Added: entry.added})
+	}
+	return entries
+}
+
+func (c *SitemapCache) Flush(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return flushMap(c.entries, key)
+}
+
+// getSitemap serves /sitemap.xml and, when it is an index, /sitemap-{n}.xml.
+func (s *Server) getSitemap(w http.ResponseWriter, r *http.Request) {
+	n := 0
+	if part := mux.Vars(r)["n"]; part != "" {
+		n, _ = strconv.Atoi(part)
+		if n == 0 {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	var files [][]byte
+	err := s.Sitemaps.Get(r.Context(), sitemapTranslations(), canonicalOrigin(r), &files)
+	if err != nil {
+		textError(w, r, err)
+		return
+	}
+	// with a single file there is no /sitemap-1.xml
+	if n >= len(files) || (n > 0 && len(files) == 1) {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(index_max_age.Seconds())))
+	http.ServeContent(w, r, "sitemap.xml", time.Time{}, bytes.NewReader(files[n]))
+}
+
+// robots_disallowed are pages that only show a visitor's own data.
+var robots_disallowed = []string{"bookmarks", "highlights", "history", "notes", "prefs"}
+
+// getRobots serves /robots.txt, which points crawlers at the sitemap.
+func (s *Server) getRobots(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	for _, page := range robots_disallowed {
+		fmt.Fprintf(&b, "Disallow: %s\n", SitePath(page))
+	}
+	fmt.Fprintf(&b, "\nSitemap: %s%s\n", canonicalOrigin(r), s.Path("sitemap"))
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(index_max_age.Seconds())))
+	fmt.Fprint(w, b.String())
+}
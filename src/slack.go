@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// slack_max_skew is how far a request's timestamp can be from now, so a
+	// captured request can't be replayed later.
+	slack_max_skew  = 5 * time.Minute
+	slack_body_size = 16 << 10
+	// slack_text_limit is the most a section block can hold.
+	slack_text_limit = 3000
+)
+
+// slack_signing_secret is the app's signing secret from Slack, from
+// -slack-signing-secret. /integrations/slack is only served with one.
+var slack_signing_secret = ""
+
+// VerifySlackSignature checks a request against Slack's signing secret,
+// which signs "v0:timestamp:body" with HMAC-SHA256.
+func VerifySlackSignature(secret string, header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: no timestamp", ErrBadSignature)
+	}
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > slack_max_skew || skew < -slack_max_skew {
+		return fmt.Errorf("%w: timestamp is %s off", ErrBadSignature, skew.Round(time.Second))
+	}
+	signature, ok := strings.CutPrefix(header.Get("X-Slack-Signature"), "v0=")
+	if !ok {
+		return fmt.Errorf("%w: no v0 signature", ErrBadSignature)
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: signature isn't hex", ErrBadSignature)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return fmt.Errorf("%w: signature doesn't match", ErrBadSignature)
+	}
+	return nil
+}
+
+// SlackMessage is a slash command answer. "in_channel" messages are shown
+// to everyone, "ephemeral" ones only to whoever ran the command.
+type SlackMessage struct {
+	ResponseType string       `json:"response_type"`
+	Text         string       `json:"text"`
+	Blocks       []SlackBlock `json:"blocks,omitempty"`
+}
+
+type SlackBlock struct {
+	Type     string      `json:"type"`
+	Text     *SlackText  `json:"text,omitempty"`
+	Elements []SlackText `json:"elements,omitempty"`
+}
+
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// slackEscape escapes the three characters Slack's mrkdwn reserves.
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// SlackPassageMessage shows a passage to the channel, with the reference
+// linking back to the site.
+func SlackPassageMessage(passage Passage, link string) SlackMessage {
+	reference := passage.Reference.String()
+	text := Truncate(PassageText(passage, func(label string) string { return "*" + label + "*" }), slack_text_limit-1)
+	return SlackMessage{
+		ResponseType: "in_channel",
+		Text:         reference + ": " + passage.Verses[0].Text,
+		Blocks: []SlackBlock{
+			{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: slackEscape(text)}},
+			{Type: "context", Elements: []SlackText{
+				{Type: "mrkdwn", Text: fmt.Sprintf("<%s|%s> · %s", link, slackEscape(reference), slackEscape(passage.Translation.Name))},
+			}},
+		},
+	}
+}
+
+// SlackError is a message only the person who ran the command sees.
+func SlackError(message string) SlackMessage {
+	return SlackMessage{ResponseType: "ephemeral", Text: message}
+}
+
+// slackResponseURL checks that a response_url really is Slack's, so the
+// server can't be pointed at anything else.
+func slackResponseURL(value string) (string, bool) {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme != "https" || (u.Host != "slack.com" && !strings.HasSuffix(u.Host, ".slack.com")) {
+		return "", false
+	}
+	return u.String(), true
+}
+
+// postSlack serves POST /integrations/slack, the slash command endpoint.
+// "/bible John 3:16" posts the verse to the channel.
+func (s *Server) postSlack(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, slack_body_size))
+	if err != nil {
+		http.Error(w, "Request body too large.", http.StatusRequestEntityTooLarge)
+		return
+	}
+	err = VerifySlackSignature(slack_signing_secret, r.Header, body, time.Now())
+	if err != nil {
+		Logger(r.Context()).Warn("rejected slack request", "err", err)
+		http.Error(w, "Bad signature.", http.StatusUnauthorized)
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "Bad form.", http.StatusBadRequest)
+		return
+	}
+
+	text := strings.TrimSpace(form.Get("text"))
+	if text == "" {
+		WriteJSON(w, http.StatusOK, SlackError(fmt.Sprintf("Give a reference, like %s John 3:16 or %s Ps 23.", form.Get("command"), form.Get("command"))))
+		return
+	}
+	_, err = ParseReference(text)
+	if err != nil {
+		WriteJSON(w, http.StatusOK, SlackError(integrationErrorText(text, err)))
+		return
+	}
+
+	translation := default_translation
+	lookup := func(ctx context.Context) SlackMessage {
+		passage, err := s.LoadPassage(ctx, translation, text)
+		if err != nil {
+			return SlackError(integrationErrorText(text, err))
+		}
+		return SlackPassageMessage(passage, s.PassageURL(r, translation, passage.Reference))
+	}
+	response_url, can_answer_late := slackResponseURL(form.Get("response_url"))
+	late := func(ctx context.Context, message SlackMessage) {
+		if !can_answer_late {
+			return
+		}
+		err := s.sendIntegration(ctx, http.MethodPost, response_url, nil, message)
+		if err != nil {
+			Logger(ctx).Error("answering slack command", "err", err)
+		}
+	}
+	message, ok := answerInTime(r, lookup, late)
+	switch {
+	case ok:
+		WriteJSON(w, http.StatusOK, message)
+	case can_answer_late:
+		WriteJSON(w, http.StatusOK, SlackError(fmt.Sprintf("Looking up %s…", text)))
+	default:
+		WriteJSON(w, http.StatusOK, SlackError("That took too long to look up. Please try again in a moment."))
+	}
+}
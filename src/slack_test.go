@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signSlack(secret string, timestamp string, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySlackSignature(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	body := "command=%2Fbible&text=John+3%3A16"
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		ok        bool
+	}{
+		{"valid", timestamp, signSlack("secret", timestamp, body), true},
+		{"a little early", strconv.FormatInt(now.Add(-4*time.Minute).Unix(), 10), signSlack("secret", strconv.FormatInt(now.Add(-4*time.Minute).Unix(), 10), body), true},
+		{"a little late", strconv.FormatInt(now.Add(4*time.Minute).Unix(), 10), signSlack("secret", strconv.FormatInt(now.Add(4*time.Minute).Unix(), 10), body), true},
+		{"wrong secret", timestamp, signSlack("other", timestamp, body), false},
+		{"other body", timestamp, signSlack("secret", timestamp, body+"0"), false},
+		{"signed for another time", timestamp, signSlack("secret", "1", body), false},
+		{"replayed", strconv.FormatInt(now.Add(-6*time.Minute).Unix(), 10), signSlack("secret", strconv.FormatInt(now.Add(-6*time.Minute).Unix(), 10), body), false},
+		{"from the future", strconv.FormatInt(now.Add(6*time.Minute).Unix(), 10), signSlack("secret", strconv.FormatInt(now.Add(6*time.Minute).Unix(), 10), body), false},
+		{"no timestamp", "", signSlack("secret", "", body), false},
+		{"no signature", timestamp, "", false},
+		{"another version", timestamp, "v1=" + strings.TrimPrefix(signSlack("secret", timestamp, body), "v0="), false},
+		{"not hex", timestamp, "v0=zz", false},
+		{"truncated", timestamp, signSlack("secret", timestamp, body)[:20], false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("X-Slack-Request-Timestamp", test.timestamp)
+			header.Set("X-Slack-Signature", test.signature)
+			err := VerifySlackSignature("secret", header, []byte(body), now)
+			if test.ok && err != nil {
+				t.Errorf("VerifySlackSignature: %v", err)
+			}
+			if !test.ok && !errors.Is(err, ErrBadSignature) {
+				t.Errorf("VerifySlackSignature = %v, want ErrBadSignature", err)
+			}
+		})
+	}
+}
+
+func TestSlackPassageMessage(t *testing.T) {
+	translation := Translation{Identifier: "web", Name: "World English Bible"}
+	tests := []struct {
+		name    string
+		passage Passage
+		section string
+		context string
+	}{
+		{
+			"one verse",
+			Passage{Reference: Reference{Book: "John", ChapterStart: 3, VerseStart: 16, ChapterEnd: 3, VerseEnd: 16}, Translation: translation, Verses: []Verse{{Chapter: 3, Verse: 16, Text: "For God so loved the world."}}},
+			"For God so loved the world.",
+			"<https://example.com/passage|John 3:16> · World English Bible",
+		},
+		{
+			"numbered",
+			Passage{Reference: Reference{Book: "John", ChapterStart: 3, VerseStart: 36, ChapterEnd: 4, VerseEnd: 1}, Translation: translation, Verses: []Verse{{Chapter: 3, Verse: 36, Text: "One."}, {Chapter: 4, Verse: 1, Text: "Two."}}},
+			"*36* One. *4:1* Two.",
+			"<https://example.com/passage|John 3:36-4:1> · World English Bible",
+		},
+		{
+			"escaped",
+			Passage{Reference: Reference{Book: "Genesis", ChapterStart: 1, VerseStart: 1, ChapterEnd: 1, VerseEnd: 1}, Translation: Translation{Name: "A <b> & B"}, Verses: []Verse{{Chapter: 1, Verse: 1, Text: "<@U123> & <!channel>"}}},
+			"&lt;@U123&gt; &amp; &lt;!channel&gt;",
+			"<https://example.com/passage|Genesis 1:1> · A &lt;b&gt; &amp; B",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message := SlackPassageMessage(test.passage, "https://example.com/passage")
+			if message.ResponseType != "in_channel" || len(message.Blocks) != 2 {
+				t.Fatalf("message %+v", message)
+			}
+			if got := message.Blocks[0].Text.Text; got != test.section {
+				t.Errorf("section %q, want %q", got, test.section)
+			}
+			if got := message.Blocks[1].Elements[0].Text; got != test.context {
+				t.Errorf("context %q, want %q", got, test.context)
+			}
+			if !strings.HasPrefix(message.Text, test.passage.Reference.String()+": ") {
+				t.Errorf("fallback text %q", message.Text)
+			}
+		})
+	}
+
+	long := Passage{Reference: Reference{Book: "Psalms", ChapterStart: 119, VerseStart: 1, ChapterEnd: 119, VerseEnd: 176}, Translation: translation}
+	for i := 1; i <= 176; i++ {
+		long.Verses = append(long.Verses, Verse{Chapter: 119, Verse: i, Text: "Blessed are those whose ways are blameless."})
+	}
+	section := SlackPassageMessage(long, "https://example.com/passage").Blocks[0].Text.Text
+	if n := len([]rune(section)); n > slack_text_limit || !strings.HasSuffix(section, "…") {
+		t.Errorf("long passage is %d characters, ending %q", n, section[len(section)-10:])
+	}
+}
+
+func TestSlackResponseURL(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"https://hooks.slack.com/commands/T0/1/abc", true},
+		{"https://slack.com/api/x", true},
+		{"http://hooks.slack.com/commands/T0/1/abc", false},
+		{"https://hooks.slack.com.evil.example/x", false},
+		{"https://evilslack.com/x", false},
+		{"https://127.0.0.1/x", false},
+		{"", false},
+		{"::", false},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			if _, ok := slackResponseURL(test.value); ok != test.ok {
+				t.Errorf("slackResponseURL(%q) ok = %t, want %t", test.value, ok, test.ok)
+			}
+		})
+	}
+}
+
+// slackRequest is a slash command signed with secret.
+func slackRequest(secret string, form url.Values) *http.Request {
+	body := form.Encode()
+	r := httptest.NewRequest(http.MethodPost, "/integrations/slack", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	r.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	r.Header.Set("X-Slack-Signature", signSlack(secret, timestamp, body))
+	return r
+}
+
+func TestPostSlack(t *testing.T) {
+	slack_signing_secret = "secret"
+	t.Cleanup(func() { slack_signing_secret = "" })
+	handler := newTestServer(t)
+	tests := []struct {
+		name    string
+		request *http.Request
+		status  int
+		kind    string
+		text    string
+	}{
+		{"verse", slackRequest("secret", url.Values{"command": {"/bible"}, "text": {"John 3:16"}}), http.StatusOK, "in_channel", "John 3:16: For God so loved the world"},
+		{"abbreviated", slackRequest("secret", url.Values{"command": {"/bible"}, "text": {"  Jn 3:16  "}}), http.StatusOK, "in_channel", "John 3:16: For God so loved the world"},
+		{"no reference", slackRequest("secret", url.Values{"command": {"/bible"}, "text": {" "}}), http.StatusOK, "ephemeral", "Give a reference, like /bible John 3:16 or /bible Ps 23."},
+		{"not a reference", slackRequest("secret", url.Values{"command": {"/bible"}, "text": {"John 3:x"}}), http.StatusOK, "ephemeral", `"John 3:x" isn't a reference like "John 3:16".`},
+		{"no such verse", slackRequest("secret", url.Values{"command": {"/bible"}, "text": {"John 3:99"}}), http.StatusOK, "ephemeral", ""},
+		{"bad signature", slackRequest("other", url.Values{"command": {"/bible"}, "text": {"John 3:16"}}), http.StatusUnauthorized, "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, test.request)
+			if w.Code != test.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+			if test.kind == "" {
+				return
+			}
+			var message SlackMessage
+			err := json.Unmarshal(w.Body.Bytes(), &message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if message.ResponseType != test.kind || !strings.HasPrefix(message.Text, test.text) {
+				t.Errorf("%s %q, want %s %q", message.ResponseType, message.Text, test.kind, test.text)
+			}
+		})
+	}
+}
+
+// roundTripFunc is an http.RoundTripper.
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// A lookup slower than Slack waits for is answered at the response_url.
+func TestPostSlackLate(t *testing.T) {
+	slack_signing_secret = "secret"
+	t.Cleanup(func() { slack_signing_secret = "" })
+	late := make(chan SlackMessage, 1)
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message SlackMessage
+		json.NewDecoder(r.Body).Decode(&message)
+		late <- message
+	}))
+	t.Cleanup(slack.Close)
+	upstream := fakeUpstream(t)
+
+	bible := NewBibleClient(upstream.URL)
+	bible.Retries = 0
+	// upstream is slow to send the chapter, and hooks.slack.com is the
+	// test server
+	bible.HTTP = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		switch {
+		case r.URL.Host == "hooks.slack.com":
+			r.URL.Scheme, r.URL.Host = "http", strings.TrimPrefix(slack.URL, "http://")
+		case r.URL.Path == "/data/web/JHN/3":
+			time.Sleep(integration_deadline + 100*time.Millisecond)
+		}
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+	handler := NewServer(bible, nil).Routes(false, false)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, slackRequest("secret", url.Values{"command": {"/bible"}, "text": {"John 3:16"}, "response_url": {"https://hooks.slack.com/commands/T0/1/abc"}}))
+	var message SlackMessage
+	json.Unmarshal(w.Body.Bytes(), &message)
+	if message.ResponseType != "ephemeral" || message.Text != "Looking up John 3:16…" {
+		t.Errorf("first answer %+v", message)
+	}
+	select {
+	case message := <-late:
+		if message.ResponseType != "in_channel" || !strings.HasPrefix(message.Text, "John 3:16: ") {
+			t.Errorf("late answer %+v", message)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no late answer")
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// leading_zeros_pattern finds the zeros padding a number, like the 0 in
+// "03" or both in "016-018", but not a lone "0".
+var leading_zeros_pattern = regexp.MustCompile(`(^|[^0-9])0+([0-9])`)
+
+// canonicalVar is the canonical spelling of a route variable: translations
+// in lower case and chapter and verse numbers without leading zeros.
+func canonicalVar(name string, value string) string {
+	switch name {
+	case "translation":
+		return strings.ToLower(value)
+	case "chapter", "verse", "verses":
+		return leading_zeros_pattern.ReplaceAllString(value, "$1$2")
+	}
+	return value
+}
+
+// CanonicalBook redirects any spelling of a page other than its canonical
+// URL with a 301: books other than by their slug, like /songofsolomon/2,
+// /jn/3 or /John/3, chapters and verses with leading zeros, like /john/03,
+// and upper case translations, like /KJV/john/3. Slugs that don't resolve
+// are left for the handler to report.
+func (s *Server) CanonicalBook(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		var book Book
+		err := s.Books.FindBook(r.Context(), RequestTranslation(r), vars["book"], &book)
+		if err != nil {
+			next(w, r)
+			return
+		}
+
+		changed := false
+		var pairs []string
+		for name, value := range vars {
+			canonical := canonicalVar(name, value)
+			if name == "book" {
+				canonical = BookSlug(book.Name)
+			}
+			changed = changed || canonical != value
+			pairs = append(pairs, name, canonical)
+		}
+		if !changed {
+			next(w, r)
+			return
+		}
+		canonical, err := mux.CurrentRoute(r).URLPath(pairs...)
+		if err != nil {
+			next(w, r)
+			return
+		}
+		canonical.Path = SitePath(canonical.Path)
+		canonical.RawQuery = r.URL.RawQuery
+		http.Redirect(w, r, canonical.String(), http.StatusMovedPermanently)
+	}
+}
+
+// TrailingSlashRedirect sends a GET for a path with a trailing slash that
+// no route has, like /john/3/, to the same path without it, keeping the
+// query. It reports whether it did.
+func TrailingSlashRedirect(router *mux.Router, w http.ResponseWriter, r *http.Request) bool {
+	if (r.Method != http.MethodGet && r.Method != http.MethodHead) || r.URL.Path == "/" || !strings.HasSuffix(r.URL.Path, "/") {
+		return false
+	}
+	trimmed := r.Clone(r.Context())
+	trimmed.URL.Path = strings.TrimRight(r.URL.Path, "/")
+	trimmed.URL.RawPath = ""
+	var match mux.RouteMatch
+	if trimmed.URL.Path == "" || !router.Match(trimmed, &match) || match.MatchErr != nil {
+		return false
+	}
+	target := url.URL{Path: SitePath(trimmed.URL.Path), RawQuery: r.URL.RawQuery}
+	http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+	return true
+}
+
+// canonical_dropped_params only change how a page looks, not what it is,
+// so they are left out of its canonical URL.
+var canonical_dropped_params = []string{"mode", "print", "translation", "back", "width"}
+
+// CanonicalURL is the URL search engines should index a page under, on
+// -canonical-url. A ?translation= is moved into the path, the way
+// TranslationPath links to it.
+func CanonicalURL(r *http.Request) string {
+	site_path := r.URL.Path
+	if _, in_path := mux.Vars(r)["translation"]; !in_path {
+		if translation := RequestTranslation(r); translation != default_translation {
+			site_path = "/" + url.PathEscape(translation) + site_path
+		}
+	}
+	query := r.URL.Query()
+	for _, name := range canonical_dropped_params {
+		query.Del(name)
+	}
+	canonical := url.URL{Path: SitePath(site_path), RawQuery: query.Encode()}
+	return canonicalOrigin(r) + canonical.String()
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestCanonicalVar(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"chapter", "03", "3"},
+		{"chapter", "003", "3"},
+		{"chapter", "3", "3"},
+		{"chapter", "10", "10"},
+		{"chapter", "0", "0"},
+		{"chapter", "00", "0"},
+		{"verse", "016", "16"},
+		{"verses", "016-018", "16-18"},
+		{"verses", "01,03-05", "1,3-5"},
+		{"verses", "100-101", "100-101"},
+		{"translation", "KJV", "kjv"},
+		{"book", "John", "John"},
+	}
+	for _, test := range tests {
+		t.Run(test.name+" "+test.value, func(t *testing.T) {
+			if got := canonicalVar(test.name, test.value); got != test.want {
+				t.Errorf("canonicalVar(%q, %q) = %q, want %q", test.name, test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalRedirects(t *testing.T) {
+	handler := newTestServer(t)
+	tests := []struct {
+		target string
+		// location is empty if the target is already canonical
+		location string
+	}{
+		{"/John/3", "/john/3"},
+		{"/JOHN/3", "/john/3"},
+		{"/john/03", "/john/3"},
+		{"/John/03/016", "/john/3/16"},
+		{"/john/3/016-018", "/john/3/16-18"},
+		{"/john/3/", "/john/3"},
+		{"/john/3/16/", "/john/3/16"},
+		{"/john/", "/john"},
+		{"/John/3?mode=poetry", "/john/3?mode=poetry"},
+		{"/john/03?mode=poetry&translation=web", "/john/3?mode=poetry&translation=web"},
+		{"/john/3/?mode=poetry", "/john/3?mode=poetry"},
+		{"/john/3", ""},
+		{"/john/3/16", ""},
+		{"/", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			w := get(t, handler, test.target)
+			if test.location == "" {
+				if w.Code != http.StatusOK {
+					t.Errorf("GET %s: status %d, want %d", test.target, w.Code, http.StatusOK)
+				}
+				return
+			}
+			if w.Code != http.StatusMovedPermanently {
+				t.Fatalf("GET %s: status %d, want %d", test.target, w.Code, http.StatusMovedPermanently)
+			}
+			if location := w.Header().Get("Location"); location != test.location {
+				t.Errorf("GET %s: redirected to %q, want %q", test.target, location, test.location)
+			}
+		})
+	}
+}
+
+func TestTrailingSlashRedirect(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/john/{chapter}", func(w http.ResponseWriter, r *http.Request) {}).Methods(http.MethodGet, http.MethodHead)
+	router.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {}).Methods(http.MethodPost)
+	tests := []struct {
+		method   string
+		target   string
+		location string
+	}{
+		{http.MethodGet, "/john/3/", "/john/3"},
+		{http.MethodHead, "/john/3/", "/john/3"},
+		{http.MethodGet, "/john/3//", "/john/3"},
+		{http.MethodGet, "/john/3/?q=a+b", "/john/3?q=a+b"},
+		{http.MethodGet, "/john/3", ""},
+		{http.MethodGet, "/", ""},
+		{http.MethodGet, "//", ""},
+		{http.MethodGet, "/mark/3/", ""},
+		{http.MethodPost, "/john/3/", ""},
+		// the route is there but not for GET
+		{http.MethodGet, "/search/", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			redirected := TrailingSlashRedirect(router, w, httptest.NewRequest(test.method, test.target, nil))
+			if redirected != (test.location != "") {
+				t.Fatalf("redirected %t, want %t", redirected, test.location != "")
+			}
+			if location := w.Header().Get("Location"); location != test.location {
+				t.Errorf("redirected to %q, want %q", location, test.location)
+			}
+		})
+	}
+}
+
+func TestCanonicalURL(t *testing.T) {
+	tests := []struct {
+		target    string
+		canonical string
+		want      string
+	}{
+		{"/john/3", "", "http://example.com/john/3"},
+		{"/john/3?mode=poetry&width=wide", "", "http://example.com/john/3"},
+		{"/john/3?translation=kjv", "", "http://example.com/kjv/john/3"},
+		{"/john/3?translation=web", "", "http://example.com/john/3"},
+		{"/search?q=love&mode=poetry", "", "http://example.com/search?q=love"},
+		{"/john/3", "https://bible.example", "https://bible.example/john/3"},
+	}
+	defer func() { canonical_url = "" }()
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			canonical_url = test.canonical
+			if got := CanonicalURL(httptest.NewRequest(http.MethodGet, test.target, nil)); got != test.want {
+				t.Errorf("CanonicalURL = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalLink(t *testing.T) {
+	handler := newTestServer(t)
+	tests := []struct {
+		target string
+		// want is the canonical link, or empty for none
+		want string
+	}{
+		{"/john/3?mode=paragraph", `<link rel="canonical" href="http://example.com/john/3">`},
+		{"/", `<link rel="canonical" href="http://example.com/">`},
+		{"/nowhere", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			body := get(t, handler, test.target).Body.String()
+			if test.want == "" {
+				if strings.Contains(body, `rel="canonical"`) {
+					t.Errorf("GET %s has a canonical link", test.target)
+				}
+				return
+			}
+			if !strings.Contains(body, test.want) {
+				t.Errorf("GET %s: body doesn't contain %s", test.target, test.want)
+			}
+		})
+	}
+}
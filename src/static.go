@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// static_files are the stylesheet and icons served at /static/.
+//
+//go:embed static
+var static_files embed.FS
+
+const (
+	// static_max_age is how long browsers keep an asset under its hashed
+	// name, which changes whenever the file does.
+	static_max_age = 365 * 24 * time.Hour
+	// unhashed_max_age is for assets asked for by their plain name, like
+	// /favicon.ico, which has to be fetched again to see a new version.
+	unhashed_max_age = 24 * time.Hour
+)
+
+// Asset is an embedded file with a name that includes a hash of its
+// contents, like "style.3f2a9c1b7d0e4a5f.css".
+type Asset struct {
+	Name        string
+	Hashed      string
+	ContentType string
+	ETag        string
+	Data        []byte
+}
+
+// assets holds the embedded files by both their plain and hashed names.
+var assets = map[string]*Asset{}
+
+func init() {
+	err := fs.WalkDir(static_files, "static", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := static_files.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		asset := NewAsset(strings.TrimPrefix(name, "static/"), data)
+		assets[asset.Name] = asset
+		assets[asset.Hashed] = asset
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// NewAsset hashes an asset's contents into its name.
+func NewAsset(name string, data []byte) *Asset {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:8])
+	ext := path.Ext(name)
+	content_type := mime.TypeByExtension(ext)
+	if content_type == "" {
+		content_type = http.DetectContentType(data)
+	}
+	return &Asset{
+		Name:        name,
+		Hashed:      strings.TrimSuffix(name, ext) + "." + hash + ext,
+		ContentType: content_type,
+		ETag:        `"` + hash + `"`,
+		Data:        data,
+	}
+}
+
+// AssetPath links to an asset by its hashed name. Templates use it as
+// {{asset "style.css"}}.
+func (s *Server) AssetPath(name string) string {
+	asset, ok := assets[name]
+	if !ok {
+		return s.Path("static", "name", name)
+	}
+	return s.Path("static", "name", asset.Hashed)
+}
+
+func serveAsset(w http.ResponseWriter, r *http.Request, asset *Asset, max_age time.Duration) {
+	w.Header().Set("Content-Type", asset.ContentType)
+	w.Header().Set("ETag", asset.ETag)
+	cache_control := fmt.Sprintf("public, max-age=%d", int(max_age.Seconds()))
+	if max_age == static_max_age {
+		cache_control += ", immutable"
+	}
+	w.Header().Set("Cache-Control", cache_control)
+	http.ServeContent(w, r, asset.Name, time.Time{}, bytes.NewReader(asset.Data))
+}
+
+// getStatic serves /static/{name}, cached for good under a hashed name.
+func (s *Server) getStatic(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	asset, ok := assets[name]
+	if !ok {
+		s.renderError(w, r, http.StatusNotFound, "There's nothing at this address.")
+		return
+	}
+	max_age := unhashed_max_age
+	if name == asset.Hashed {
+		max_age = static_max_age
+	}
+	serveAsset(w, r, asset, max_age)
+}
+
+// getFavicon answers /favicon.ico, which browsers ask for on their own.
+func getFavicon(w http.ResponseWriter, r *http.Request) {
+	serveAsset(w, r, assets["favicon.ico"], unhashed_max_age)
+}
@@ -0,0 +1,9 @@
+// Starts Swagger UI on /api/v1/docs. It lives in a file of its own because the
+// Content-Security-Policy doesn't allow inline scripts.
+window.addEventListener("load", function () {
+	window.ui = SwaggerUIBundle({
+		url: document.getElementById("swagger-ui").dataset.spec,
+		dom_id: "#swagger-ui",
+		deepLinking: true,
+	});
+});
@@ -0,0 +1,28 @@
+// Runs the playground's query on /graphql and shows the result under the
+// form. Without it the form still works, showing the raw JSON response.
+document.getElementById("graphql").addEventListener("submit", function (event) {
+	event.preventDefault();
+	var form = event.target;
+	var result = document.getElementById("graphql-result");
+	var body = {query: form.elements.query.value};
+	if (form.elements.variables.value.trim() !== "") {
+		try {
+			body.variables = JSON.parse(form.elements.variables.value);
+		} catch (err) {
+			result.textContent = "The variables aren't valid JSON: " + err.message;
+			return;
+		}
+	}
+	result.textContent = "Running…";
+	fetch(form.action, {
+		method: "POST",
+		headers: {"Content-Type": "application/json", "Accept": "application/json"},
+		body: JSON.stringify(body),
+	}).then(function (response) {
+		return response.json();
+	}).then(function (json) {
+		result.textContent = JSON.stringify(json, null, 2);
+	}).catch(function (err) {
+		result.textContent = "The query couldn't be sent: " + err.message;
+	});
+});
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	stats_top_words     = 10
+	stats_max_top_words = 50
+)
+
+// stopwords are left out of a page's top words, by language_code. They are
+// folded like Words output, so without accents.
+var stopwords = map[string]string{
+	"eng": "a an and are as at be but by for from had has have he her him his i if in into is it its me my no not of on or our she so that the their them then there they this thou thee thy to unto up upon us was we were what when which who will with ye you your shall all said",
+	"spa": "a al con de del el en es la las lo los mas me mi no o para por que se su sus te tu un una y yo le les ni",
+	"por": "a ao as com da das de do dos e em eu lhe mas me na nao nas no nos o os para por que se seu sua te um uma",
+	"fra": "a au aux avec ce de des du elle en est et il ils je la le les leur mais ne nous par pas pour que qui sa se ses son sur tu un une vous",
+	"deu": "auch auf aus bei das dem den der des die du ein eine er es ich ihm ihr in ist mit nicht sie sein und von was wie zu",
+	"lat": "a ab ad cum de et ex in est et eius enim non quae qui quia quod sed sunt ut",
+}
+
+var stopword_sets = sync.OnceValue(func() map[string]map[string]bool {
+	sets := map[string]map[string]bool{}
+	for language, words := range stopwords {
+		sets[language] = map[string]bool{}
+		for _, word := range strings.Fields(words) {
+			sets[language][word] = true
+		}
+	}
+	return sets
+})
+
+type StatsVerse struct {
+	Reference string `json:"reference"`
+	URL       string `json:"url"`
+	Words     int    `json:"words"`
+}
+
+type WordCount struct {
+	Word  string `json:"word"`
+	Count int    `json:"count"`
+}
+
+// Stats describes the text of a book or chapter.
+type Stats struct {
+	Reference    string      `json:"reference"`
+	Verses       int         `json:"verses"`
+	Words        int         `json:"words"`
+	AverageWords float64     `json:"average_words"`
+	Longest      StatsVerse  `json:"longest"`
+	Shortest     StatsVerse  `json:"shortest"`
+	TopWords     []WordCount `json:"top_words"`
+}
+
+// ComputeStats counts the words of verses from book. TopWords holds up to
+// stats_max_top_words, skipping numbers and the stopwords of language.
+func (s *Server) ComputeStats(translation string, reference string, book Book, verses []Verse, language string) Stats {
+	stats := Stats{Reference: reference, Verses: len(verses), TopWords: []WordCount{}}
+	counts := map[string]int{}
+	skip := stopword_sets()[language]
+	for i, verse := range verses {
+		words := Words(verse.Text)
+		stats.Words += len(words)
+		for _, word := range words {
+			if !skip[word] && !unicode.IsDigit([]rune(word)[0]) {
+				counts[word]++
+			}
+		}
+		summary := StatsVerse{
+			Reference: fmt.Sprintf("%s %d:%d", book.Name, verse.Chapter, verse.Verse),
+			URL:       s.VerseLink(translation, book, verse.Chapter, verse.Verse).URL,
+			Words:     len(words),
+		}
+		if i == 0 || summary.Words > stats.Longest.Words {
+			stats.Longest = summary
+		}
+		if i == 0 || summary.Words < stats.Shortest.Words {
+			stats.Shortest = summary
+		}
+	}
+	if stats.Verses > 0 {
+		stats.AverageWords = float64(stats.Words) / float64(stats.Verses)
+	}
+
+	for word, count := range counts {
+		stats.TopWords = append(stats.TopWords, WordCount{Word: word, Count: count})
+	}
+	sort.Slice(stats.TopWords, func(i, j int) bool {
+		a, b := stats.TopWords[i], stats.TopWords[j]
+		return a.Count > b.Count || (a.Count == b.Count && a.Word < b.Word)
+	})
+	stats.TopWords = stats.TopWords[:min(len(stats.TopWords), stats_max_top_words)]
+	return stats
+}
+
+// StatsCache keeps computed stats. The text they are counted from doesn't
+// change, so entries never expire.
+type StatsCache struct {
+	mu      sync.RWMutex
+	entries map[string]statsCacheEntry
+	group   FetchGroup
+}
+
+type statsCacheEntry struct {
+	stats Stats
+	added time.Time
+}
+
+func (c *StatsCache) Get(ctx context.Context, key string, stats *Stats, compute func(context.Context, *Stats) error) error {
+	c.mu.RLock()
+	cached, ok := c.entries[key]
+	c.mu.RUnlock()
+	if ok {
+		recordLookup(ctx, "stats", "hit")
+		*stats = cached.stats
+		return nil
+	}
+	recordLookup(ctx, "stats", "miss")
+	err := sharedFetch(ctx, &c.group, key, stats, compute)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.entries[key] = statsCacheEntry{stats: *stats, added: time.Now()}
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *StatsCache) Entries() []CacheEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entries := make([]CacheEntry, 0, len(c.entries))
+	for key, entry := range c.entries {
+		entries = append(entries, CacheEntry{Key: key, Size: estimateSize(entry.stats), Added: entry.added})
+	}
+	return entries
+}
+
+func (c *StatsCache) Flush(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return flushMap(c.entries, key)
+}
+
+// loadStats computes or looks up the stats for a book, or one chapter of it
+// when chapter isn't empty. Verses come through LoadVerses, so from -data,
+// -db or the cache before bible-api.com.
+func (s *Server) loadStats(ctx context.Context, translation string, slug string, chapter string, stats *Stats) error {
+	var book Book
+	var chapter_info ChapterInfo
+	err := s.LoadChapters(ctx, translation, slug, &book, &chapter_info)
+	if err != nil {
+		return err
+	}
+
+	if chapter != "" {
+		number, err := ParseNumber("chapter", chapter)
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprintf("%s/%s/%d", translation, book.ID, number)
+		return s.Stats.Get(ctx, key, stats, func(ctx context.Context, stats *Stats) error {
+			var verse_info VerseInfo
+			err := s.LoadVerses(ctx, translation, slug, chapter, &book, &verse_info)
+			if err != nil {
+				return err
+			}
+			*stats = s.ComputeStats(translation, fmt.Sprintf("%s %d", book.Name, number), book, verse_info.Verses, verse_info.Translation.LanguageCode)
+			return nil
+		})
+	}
+
+	key := fmt.Sprintf("%s/%s", translation, book.ID)
+	return s.Stats.Get(ctx, key, stats, func(ctx context.Context, stats *Stats) error {
+		chapters := make([]VerseInfo, len(chapter_info.Chapters))
+		g, ctx := errgroup.WithContext(ctx)
+		g.SetLimit(markdown_workers)
+		for i, chapter := range chapter_info.Chapters {
+			g.Go(func() error {
+				var chapter_book Book
+				return s.LoadVerses(ctx, translation, slug, strconv.Itoa(chapter.Chapter), &chapter_book, &chapters[i])
+			})
+		}
+		err := g.Wait()
+		if err != nil {
+			return err
+		}
+		var verses []Verse
+		for _, verse_info := range chapters {
+			verses = append(verses, verse_info.Verses...)
+		}
+		*stats = s.ComputeStats(translation, book.Name, book, verses, chapter_info.Translation.LanguageCode)
+		return nil
+	})
+}
+
+// topWords is how many of the top words ?top= asks for.
+func topWords(r *http.Request) int {
+	n, err := strconv.Atoi(r.URL.Query().Get("top"))
+	if err != nil || n < 1 {
+		return stats_top_words
+	}
+	return min(n, stats_max_top_words)
+}
+
+func (s *Server) apiStats(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var stats Stats
+	err := s.loadStats(r.Context(), RequestTranslation(r), vars["book"], vars["chapter"], &stats)
+	if err != nil {
+		apiError(w, r, err)
+		return
+	}
+	stats.TopWords = stats.TopWords[:min(len(stats.TopWords), topWords(r))]
+	WriteJSON(w, http.StatusOK, stats)
+}
+
+func (s *Server) getStats(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	translation := RequestTranslation(r)
+	var stats Stats
+	err := s.loadStats(r.Context(), translation, vars["book"], vars["chapter"], &stats)
+	if err != nil {
+		s.fetchError(w, r, translation, vars["book"], err)
+		return
+	}
+	stats.TopWords = stats.TopWords[:min(len(stats.TopWords), topWords(r))]
+	s.RenderPage(w, r, http.StatusOK, "stats.html", "Statistics: "+stats.Reference, stats)
+}
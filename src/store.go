@@ -0,0 +1,613 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Store is an optional SQLite copy of everything fetched from bible-api.com,
+// so chapters survive restarts and the app can run offline once prefetched.
+// Every read and write failure is reported to the caller, which falls back
+// to the live API rather than failing the request.
+type Store struct {
+	db *sql.DB
+}
+
+var errStoreMiss = errors.New("not in store")
+
+const store_schema = `
+CREATE TABLE IF NOT EXISTS translations (
+	identifier    TEXT PRIMARY KEY,
+	name          TEXT NOT NULL,
+	language      TEXT NOT NULL,
+	language_code TEXT NOT NULL,
+	license       TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS books (
+	translation TEXT NOT NULL,
+	id          TEXT NOT NULL,
+	name        TEXT NOT NULL,
+	position    INTEGER NOT NULL,
+	chapters    INTEGER,
+	PRIMARY KEY (translation, id)
+);
+CREATE TABLE IF NOT EXISTS plan_progress (
+	user TEXT NOT NULL,
+	plan TEXT NOT NULL,
+	day  INTEGER NOT NULL,
+	PRIMARY KEY (user, plan, day)
+);
+CREATE TABLE IF NOT EXISTS verses (
+	translation TEXT NOT NULL,
+	book_id     TEXT NOT NULL,
+	chapter     INTEGER NOT NULL,
+	verse       INTEGER NOT NULL,
+	text        TEXT NOT NULL,
+	PRIMARY KEY (translation, book_id, chapter, verse)
+);
+CREATE TABLE IF NOT EXISTS bookmarks (
+	user    TEXT NOT NULL,
+	book    TEXT NOT NULL,
+	chapter INTEGER NOT NULL,
+	verse   INTEGER NOT NULL,
+	added   INTEGER NOT NULL,
+	PRIMARY KEY (user, book, chapter, verse)
+);
+CREATE TABLE IF NOT EXISTS notes (
+	user    TEXT NOT NULL,
+	book    TEXT NOT NULL,
+	chapter INTEGER NOT NULL,
+	verse   INTEGER NOT NULL,
+	text    TEXT NOT NULL,
+	updated INTEGER NOT NULL,
+	PRIMARY KEY (user, book, chapter, verse)
+);
+CREATE TABLE IF NOT EXISTS highlights (
+	user    TEXT NOT NULL,
+	book    TEXT NOT NULL,
+	chapter INTEGER NOT NULL,
+	verse   INTEGER NOT NULL,
+	color   TEXT NOT NULL,
+	PRIMARY KEY (user, book, chapter, verse)
+);
+CREATE TABLE IF NOT EXISTS webhooks (
+	id          TEXT PRIMARY KEY,
+	url         TEXT NOT NULL,
+	secret      TEXT NOT NULL,
+	translation TEXT NOT NULL,
+	created     INTEGER NOT NULL,
+	failures    INTEGER NOT NULL DEFAULT 0,
+	disabled    INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS subscribers (
+	email       TEXT PRIMARY KEY,
+	translation TEXT NOT NULL,
+	added       INTEGER NOT NULL,
+	last_sent   TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS pending_subscribers (
+	email       TEXT PRIMARY KEY,
+	translation TEXT NOT NULL,
+	requested   INTEGER NOT NULL
+);
+`
+
+func OpenStore(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(store_schema)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) loadTranslation(ctx context.Context, identifier string, translation *Translation) error {
+	row := s.db.QueryRowContext(ctx, `SELECT identifier, name, language, language_code, license FROM translations WHERE identifier = ?`, identifier)
+	err := row.Scan(&translation.Identifier, &translation.Name, &translation.Language, &translation.LanguageCode, &translation.License)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errStoreMiss
+	}
+	return err
+}
+
+// LoadBookInfo reads a stored book list, with its links pointing at
+// base_url.
+func (s *Store) LoadBookInfo(ctx context.Context, base_url string, translation string, book_info *BookInfo) error {
+	err := s.loadTranslation(ctx, translation, &book_info.Translation)
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT id, name FROM books WHERE translation = ? ORDER BY position`, translation)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	book_info.Books = nil
+	for rows.Next() {
+		var book Book
+		err = rows.Scan(&book.ID, &book.Name)
+		if err != nil {
+			return err
+		}
+		book.URL = fmt.Sprintf("%s/data/%s/%s", base_url, translation, book.ID)
+		book_info.Books = append(book_info.Books, book)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if len(book_info.Books) == 0 {
+		return errStoreMiss
+	}
+	return nil
+}
+
+func (s *Store) SaveBookInfo(ctx context.Context, book_info BookInfo) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	t := book_info.Translation
+	_, err = tx.ExecContext(ctx, `INSERT OR REPLACE INTO translations (identifier, name, language, language_code, license) VALUES (?, ?, ?, ?, ?)`,
+		t.Identifier, t.Name, t.Language, t.LanguageCode, t.License)
+	if err != nil {
+		return err
+	}
+	for i, book := range book_info.Books {
+		_, err = tx.ExecContext(ctx, `INSERT INTO books (translation, id, name, position) VALUES (?, ?, ?, ?)
+			ON CONFLICT (translation, id) DO UPDATE SET name = excluded.name, position = excluded.position`,
+			t.Identifier, book.ID, book.Name, i)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Store) LoadChapterInfo(ctx context.Context, base_url string, translation string, book string, chapter_info *ChapterInfo) error {
+	err := s.loadTranslation(ctx, translation, &chapter_info.Translation)
+	if err != nil {
+		return err
+	}
+
+	var name string
+	var chapters sql.NullInt64
+	row := s.db.QueryRowContext(ctx, `SELECT name, chapters FROM books WHERE translation = ? AND id = ?`, translation, book)
+	err = row.Scan(&name, &chapters)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !chapters.Valid) {
+		return errStoreMiss
+	}
+	if err != nil {
+		return err
+	}
+
+	chapter_info.Chapters = make([]Chapter, chapters.Int64)
+	for i := range chapter_info.Chapters {
+		chapter_info.Chapters[i] = Chapter{
+			BookID:  book,
+			Book:    name,
+			Chapter: i + 1,
+			URL:     fmt.Sprintf("%s/data/%s/%s/%d", base_url, translation, book, i+1),
+		}
+	}
+	return nil
+}
+
+func (s *Store) SaveChapterInfo(ctx context.Context, translation string, book string, chapter_info ChapterInfo) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE books SET chapters = ? WHERE translation = ? AND id = ?`, len(chapter_info.Chapters), translation, book)
+	return err
+}
+
+func (s *Store) LoadVerseInfo(ctx context.Context, translation string, book string, chapter string, verse_info *VerseInfo) error {
+	chapter_number, err := strconv.Atoi(chapter)
+	if err != nil {
+		return errStoreMiss
+	}
+	err = s.loadTranslation(ctx, translation, &verse_info.Translation)
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT v.verse, v.text, b.name FROM verses v
+		JOIN books b ON b.translation = v.translation AND b.id = v.book_id
+		WHERE v.translation = ? AND v.book_id = ? AND v.chapter = ? ORDER BY v.verse`, translation, book, chapter_number)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	verse_info.Verses = nil
+	for rows.Next() {
+		verse := Verse{BookID: book, Chapter: chapter_number}
+		err = rows.Scan(&verse.Verse, &verse.Text, &verse.BookName)
+		if err != nil {
+			return err
+		}
+		verse_info.Verses = append(verse_info.Verses, verse)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if len(verse_info.Verses) == 0 {
+		return errStoreMiss
+	}
+	return nil
+}
+
+func (s *Store) SaveVerseInfo(ctx context.Context, translation string, book string, verse_info VerseInfo) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, verse := range verse_info.Verses {
+		_, err = tx.ExecContext(ctx, `INSERT OR REPLACE INTO verses (translation, book_id, chapter, verse, text) VALUES (?, ?, ?, ?, ?)`,
+			translation, book, verse.Chapter, verse.Verse, verse.Text)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// storeError logs a store failure that isn't just a cache miss. The caller
+// carries on with the live API either way.
+func storeError(err error) {
+	if err != nil && !errors.Is(err, errStoreMiss) && !errors.Is(err, context.Canceled) {
+		slog.Error("store", "err", err)
+	}
+}
+
+// Prefetch walks every book and chapter of a translation so the store can
+// serve it without bible-api.com. Chapters already stored are skipped, so an
+// interrupted prefetch can simply be run again.
+func (s *Server) Prefetch(ctx context.Context, translation string, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var book_info BookInfo
+	err := s.Bible.GetBookInfo(ctx, translation, &book_info)
+	if err != nil {
+		return err
+	}
+	for _, book := range book_info.Books {
+		var chapter_info ChapterInfo
+		err = s.Bible.GetChapterInfo(ctx, translation, book.ID, &chapter_info)
+		if err != nil {
+			return err
+		}
+		for _, chapter := range chapter_info.Chapters {
+			var verse_info VerseInfo
+			if s.Store.LoadVerseInfo(ctx, translation, book.ID, strconv.Itoa(chapter.Chapter), &verse_info) == nil {
+				continue
+			}
+			<-ticker.C
+			err = s.Bible.GetVerseInfo(ctx, translation, book.ID, strconv.Itoa(chapter.Chapter), &verse_info)
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Printf("prefetched %s (%d chapters)\n", book.Name, len(chapter_info.Chapters))
+	}
+	return nil
+}
+
+// LoadPlanProgress returns the days of a reading plan user has read.
+func (s *Store) LoadPlanProgress(ctx context.Context, user string, plan string) (PlanProgress, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT day FROM plan_progress WHERE user = ? AND plan = ?`, user, plan)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	progress := PlanProgress{}
+	for rows.Next() {
+		var day int
+		err = rows.Scan(&day)
+		if err != nil {
+			return nil, err
+		}
+		progress[day] = true
+	}
+	return progress, rows.Err()
+}
+
+// SavePlanDay marks one day of a reading plan as read by user, or not.
+func (s *Store) SavePlanDay(ctx context.Context, user string, plan string, day int, done bool) error {
+	var err error
+	if done {
+		_, err = s.db.ExecContext(ctx, `INSERT OR IGNORE INTO plan_progress (user, plan, day) VALUES (?, ?, ?)`, user, plan, day)
+	} else {
+		_, err = s.db.ExecContext(ctx, `DELETE FROM plan_progress WHERE user = ? AND plan = ? AND day = ?`, user, plan, day)
+	}
+	return err
+}
+
+// LoadBookmarks returns user's bookmarks, oldest first.
+func (s *Store) LoadBookmarks(ctx context.Context, user string) ([]Bookmark, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT book, chapter, verse FROM bookmarks WHERE user = ? ORDER BY added, rowid`, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bookmarks []Bookmark
+	for rows.Next() {
+		var bookmark Bookmark
+		err = rows.Scan(&bookmark.Book, &bookmark.Chapter, &bookmark.Verse)
+		if err != nil {
+			return nil, err
+		}
+		bookmarks = append(bookmarks, bookmark)
+	}
+	return bookmarks, rows.Err()
+}
+
+// AddBookmark saves a bookmark for user, unless they already have it.
+func (s *Store) AddBookmark(ctx context.Context, user string, bookmark Bookmark) error {
+	_, err := s.db.ExecContext(ctx, `INSERT OR IGNORE INTO bookmarks (user, book, chapter, verse, added) VALUES (?, ?, ?, ?, ?)`,
+		user, bookmark.Book, bookmark.Chapter, bookmark.Verse, time.Now().Unix())
+	return err
+}
+
+func (s *Store) RemoveBookmark(ctx context.Context, user string, bookmark Bookmark) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM bookmarks WHERE user = ? AND book = ? AND chapter = ? AND verse = ?`,
+		user, bookmark.Book, bookmark.Chapter, bookmark.Verse)
+	return err
+}
+
+// LoadNote reads user's note on a verse, returning errStoreMiss if there
+// isn't one.
+func (s *Store) LoadNote(ctx context.Context, user string, book string, chapter int, verse int, note *Note) error {
+	var updated int64
+	err := s.db.QueryRowContext(ctx, `SELECT text, updated FROM notes WHERE user = ? AND book = ? AND chapter = ? AND verse = ?`,
+		user, book, chapter, verse).Scan(&note.Text, &updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errStoreMiss
+	}
+	if err != nil {
+		return err
+	}
+	note.Book, note.Chapter, note.Verse = book, chapter, verse
+	note.Updated = time.Unix(updated, 0).UTC()
+	return nil
+}
+
+// LoadNotes returns user's notes, most recently changed first. A query
+// leaves only the notes containing it.
+func (s *Store) LoadNotes(ctx context.Context, user string, query string) ([]Note, error) {
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query) + "%"
+	rows, err := s.db.QueryContext(ctx, `SELECT book, chapter, verse, text, updated FROM notes
+		WHERE user = ? AND text LIKE ? ESCAPE '\' ORDER BY updated DESC, rowid DESC`, user, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []Note
+	for rows.Next() {
+		var note Note
+		var updated int64
+		err = rows.Scan(&note.Book, &note.Chapter, &note.Verse, &note.Text, &updated)
+		if err != nil {
+			return nil, err
+		}
+		note.Updated = time.Unix(updated, 0).UTC()
+		notes = append(notes, note)
+	}
+	return notes, rows.Err()
+}
+
+func (s *Store) SaveNote(ctx context.Context, user string, note Note) error {
+	_, err := s.db.ExecContext(ctx, `INSERT OR REPLACE INTO notes (user, book, chapter, verse, text, updated) VALUES (?, ?, ?, ?, ?, ?)`,
+		user, note.Book, note.Chapter, note.Verse, note.Text, note.Updated.Unix())
+	return err
+}
+
+func (s *Store) DeleteNote(ctx context.Context, user string, book string, chapter int, verse int) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM notes WHERE user = ? AND book = ? AND chapter = ? AND verse = ?`,
+		user, book, chapter, verse)
+	return err
+}
+
+func (s *Store) queryHighlights(ctx context.Context, query string, args ...any) ([]VerseHighlight, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var highlights []VerseHighlight
+	for rows.Next() {
+		var highlight VerseHighlight
+		err = rows.Scan(&highlight.Book, &highlight.Chapter, &highlight.Verse, &highlight.Color)
+		if err != nil {
+			return nil, err
+		}
+		highlights = append(highlights, highlight)
+	}
+	return highlights, rows.Err()
+}
+
+// LoadHighlights returns every verse user has highlighted.
+func (s *Store) LoadHighlights(ctx context.Context, user string) ([]VerseHighlight, error) {
+	return s.queryHighlights(ctx, `SELECT book, chapter, verse, color FROM highlights WHERE user = ? ORDER BY rowid`, user)
+}
+
+// LoadChapterHighlights returns the verses of one chapter user has
+// highlighted.
+func (s *Store) LoadChapterHighlights(ctx context.Context, user string, book string, chapter int) ([]VerseHighlight, error) {
+	return s.queryHighlights(ctx, `SELECT book, chapter, verse, color FROM highlights WHERE user = ? AND book = ? AND chapter = ?`, user, book, chapter)
+}
+
+func (s *Store) SaveHighlight(ctx context.Context, user string, highlight VerseHighlight) error {
+	_, err := s.db.ExecContext(ctx, `INSERT OR REPLACE INTO highlights (user, book, chapter, verse, color) VALUES (?, ?, ?, ?, ?)`,
+		user, highlight.Book, highlight.Chapter, highlight.Verse, highlight.Color)
+	return err
+}
+
+func (s *Store) DeleteHighlight(ctx context.Context, user string, highlight VerseHighlight) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM highlights WHERE user = ? AND book = ? AND chapter = ? AND verse = ?`,
+		user, highlight.Book, highlight.Chapter, highlight.Verse)
+	return err
+}
+
+// AddPendingSubscriber keeps a sign up for the daily verse until the
+// address confirms it, replacing any earlier one for email. Sign ups
+// requested before expired are dropped, since their links no longer work.
+func (s *Store) AddPendingSubscriber(ctx context.Context, email string, translation string, expired time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM pending_subscribers WHERE requested < ?`, expired.Unix())
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT OR REPLACE INTO pending_subscribers (email, translation, requested) VALUES (?, ?, ?)`,
+		email, translation, time.Now().Unix())
+	return err
+}
+
+// ConfirmSubscriber signs email up for the daily verse with the translation
+// of its pending sign up, or changes the translation of an address already
+// signed up. It reports false if email has no pending sign up, such as when
+// it was already confirmed.
+func (s *Store) ConfirmSubscriber(ctx context.Context, email string) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var translation string
+	err = tx.QueryRowContext(ctx, `SELECT translation FROM pending_subscribers WHERE email = ?`, email).Scan(&translation)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO subscribers (email, translation, added) VALUES (?, ?, ?)
+		ON CONFLICT (email) DO UPDATE SET translation = excluded.translation`,
+		email, translation, time.Now().Unix())
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM pending_subscribers WHERE email = ?`, email)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (s *Store) RemoveSubscriber(ctx context.Context, email string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM subscribers WHERE email = ?`, email)
+	return err
+}
+
+// LoadSubscribersDue returns the subscribers who haven't been sent the
+// verse for date yet, oldest first.
+func (s *Store) LoadSubscribersDue(ctx context.Context, date string) ([]Subscriber, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT email, translation FROM subscribers WHERE last_sent != ? ORDER BY added, rowid`, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscribers []Subscriber
+	for rows.Next() {
+		var subscriber Subscriber
+		err = rows.Scan(&subscriber.Email, &subscriber.Translation)
+		if err != nil {
+			return nil, err
+		}
+		subscribers = append(subscribers, subscriber)
+	}
+	return subscribers, rows.Err()
+}
+
+// MarkSent records that email has been sent the verse for date.
+func (s *Store) MarkSent(ctx context.Context, email string, date string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE subscribers SET last_sent = ? WHERE email = ?`, date, email)
+	return err
+}
+
+// AddWebhook registers a webhook for the daily verse.
+func (s *Store) AddWebhook(ctx context.Context, webhook Webhook, secret string) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO webhooks (id, url, secret, translation, created) VALUES (?, ?, ?, ?, ?)`,
+		webhook.ID, webhook.URL, secret, webhook.Translation, webhook.Created.Unix())
+	return err
+}
+
+// RemoveWebhook deletes a webhook, returning errStoreMiss if there isn't
+// one with that ID.
+func (s *Store) RemoveWebhook(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return errStoreMiss
+	}
+	return nil
+}
+
+func (s *Store) CountWebhooks(ctx context.Context) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, `SELECT count(*) FROM webhooks WHERE disabled = 0`).Scan(&count)
+	return count, err
+}
+
+// LoadWebhooks returns the webhooks that haven't been disabled, with
+// their secrets.
+func (s *Store) LoadWebhooks(ctx context.Context) ([]webhookTarget, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, url, secret, translation, created FROM webhooks WHERE disabled = 0 ORDER BY created, rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var targets []webhookTarget
+	for rows.Next() {
+		var target webhookTarget
+		var created int64
+		err = rows.Scan(&target.ID, &target.URL, &target.Secret, &target.Translation, &created)
+		if err != nil {
+			return nil, err
+		}
+		target.Created = time.Unix(created, 0).UTC()
+		targets = append(targets, target)
+	}
+	return targets, rows.Err()
+}
+
+// RecordWebhookDelivery resets a webhook's failure count after a delivery
+// that worked, or adds to it, disabling the webhook once it reaches
+// max_failures. It reports whether the webhook was disabled.
+func (s *Store) RecordWebhookDelivery(ctx context.Context, id string, ok bool, max_failures int) (bool, error) {
+	if ok {
+		_, err := s.db.ExecContext(ctx, `UPDATE webhooks SET failures = 0 WHERE id = ?`, id)
+		return false, err
+	}
+	var disabled bool
+	err := s.db.QueryRowContext(ctx, `UPDATE webhooks SET failures = failures + 1, disabled = failures + 1 >= ? WHERE id = ? RETURNING disabled`,
+		max_failures, id).Scan(&disabled)
+	return disabled, err
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	telegram_api       = "https://api.telegram.org"
+	telegram_body_size = 64 << 10
+	// telegram_text_limit leaves room under Telegram's 4096 characters for
+	// the reference and link around a passage.
+	telegram_text_limit = 3800
+	telegram_usage      = "Send a reference like <b>John 3:16</b> or <b>Ps 23</b> to read it, or /random for a random verse."
+)
+
+// telegram_token is the bot's token from BotFather, from
+// -telegram-bot-token. /integrations/telegram is only served with one.
+var telegram_token = ""
+
+// TelegramSecrets are the secret path component of the webhook and the
+// secret Telegram is asked to send back in a header. They're derived from
+// the token, so they stay the same across restarts without more
+// configuration, and from it separately, so the path, which can end up in
+// a proxy's logs, isn't enough to forge an update.
+func TelegramSecrets(token string) (path string, header string) {
+	path_sum := sha256.Sum256([]byte("telegram webhook path:" + token))
+	header_sum := sha256.Sum256([]byte("telegram webhook:" + token))
+	return hex.EncodeToString(path_sum[:16]), hex.EncodeToString(header_sum[:16])
+}
+
+type TelegramUpdate struct {
+	UpdateID int64            `json:"update_id"`
+	Message  *TelegramMessage `json:"message"`
+}
+
+type TelegramMessage struct {
+	MessageID int64        `json:"message_id"`
+	Chat      TelegramChat `json:"chat"`
+	Text      string       `json:"text"`
+}
+
+type TelegramChat struct {
+	ID int64 `json:"id"`
+}
+
+type TelegramSendMessage struct {
+	ChatID             int64                       `json:"chat_id"`
+	Text               string                      `json:"text"`
+	ParseMode          string                      `json:"parse_mode"`
+	LinkPreviewOptions *TelegramLinkPreviewOptions `json:"link_preview_options,omitempty"`
+}
+
+type TelegramLinkPreviewOptions struct {
+	IsDisabled bool `json:"is_disabled"`
+}
+
+// telegramMethod is the URL of a Bot API method.
+func telegramMethod(token string, method string) string {
+	return telegram_api + "/bot" + token + "/" + method
+}
+
+// TelegramPassageText formats a passage as a Telegram HTML message: the
+// reference in bold, the text, and a link back to the site. A passage too
+// long for one message is cut short, without its verse numbers in bold so
+// no tag is cut in half.
+func TelegramPassageText(passage Passage, link string) string {
+	plain := PassageText(passage, func(label string) string { return label })
+	text := html.EscapeString(Truncate(plain, telegram_text_limit-1))
+	if utf8.RuneCountInString(plain) <= telegram_text_limit {
+		escaped := passage
+		escaped.Verses = make([]Verse, len(passage.Verses))
+		for i, verse := range passage.Verses {
+			verse.Text = html.EscapeString(verse.Text)
+			escaped.Verses[i] = verse
+		}
+		text = PassageText(escaped, func(label string) string { return "<b>" + label + "</b>" })
+	}
+	return fmt.Sprintf("<b>%s</b>\n%s\n\n<a href=\"%s\">%s</a>",
+		html.EscapeString(passage.Reference.String()), text, html.EscapeString(link), html.EscapeString(passage.Translation.Name))
+}
+
+// telegramCommand is the command a message starts with, like "random" for
+// "/random" or "/random@SomeBot", or "" if it isn't one.
+func telegramCommand(text string) string {
+	first, _, _ := strings.Cut(strings.TrimSpace(text), " ")
+	command, ok := strings.CutPrefix(first, "/")
+	if !ok {
+		return ""
+	}
+	command, _, _ = strings.Cut(command, "@")
+	return strings.ToLower(command)
+}
+
+// telegramReply works out the answer to a message.
+func (s *Server) telegramReply(ctx context.Context, r *http.Request, text string) string {
+	translation := default_translation
+	switch telegramCommand(text) {
+	case "":
+	case "random":
+		var passage Passage
+		var verse_info VerseInfo
+		var verse Verse
+		err := s.RandomVerse(ctx, translation, "", "", &passage.Book, &verse_info, &verse)
+		if err != nil {
+			return html.EscapeString(integrationErrorText(text, err))
+		}
+		verse.Text = verseText(verse.Text)
+		passage.Reference = Reference{Book: passage.Book.Name, ChapterStart: verse.Chapter, VerseStart: verse.Verse, ChapterEnd: verse.Chapter, VerseEnd: verse.Verse}
+		passage.Translation = verse_info.Translation
+		passage.Verses = []Verse{verse}
+		return TelegramPassageText(passage, s.PassageURL(r, translation, passage.Reference))
+	default:
+		return telegram_usage
+	}
+
+	_, err := ParseReference(text)
+	if err != nil {
+		return telegram_usage
+	}
+	passage, err := s.LoadPassage(ctx, translation, text)
+	if err != nil {
+		return html.EscapeString(integrationErrorText(text, err))
+	}
+	return TelegramPassageText(passage, s.PassageURL(r, translation, passage.Reference))
+}
+
+// postTelegram serves POST /integrations/telegram/{secret}, the bot's
+// webhook. Every update gets a 200, even one that couldn't be answered,
+// since Telegram would otherwise send it again and again.
+func (s *Server) postTelegram(w http.ResponseWriter, r *http.Request) {
+	path_secret, header_secret := TelegramSecrets(telegram_token)
+	if subtle.ConstantTimeCompare([]byte(mux.Vars(r)["secret"]), []byte(path_secret)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Telegram-Bot-Api-Secret-Token")), []byte(header_secret)) != 1 {
+		Logger(r.Context()).Warn("rejected telegram request")
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, telegram_body_size))
+	if err != nil {
+		http.Error(w, "Request body too large.", http.StatusRequestEntityTooLarge)
+		return
+	}
+	var update TelegramUpdate
+	err = json.Unmarshal(body, &update)
+	if err != nil {
+		http.Error(w, "Bad update.", http.StatusBadRequest)
+		return
+	}
+	// edits, joins, stickers and the like go unanswered
+	if update.Message == nil || strings.TrimSpace(update.Message.Text) == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	message := TelegramSendMessage{
+		ChatID:             update.Message.Chat.ID,
+		Text:               s.telegramReply(r.Context(), r, strings.TrimSpace(update.Message.Text)),
+		ParseMode:          "HTML",
+		LinkPreviewOptions: &TelegramLinkPreviewOptions{IsDisabled: true},
+	}
+	err = s.sendIntegration(r.Context(), http.MethodPost, telegramMethod(telegram_token, "sendMessage"), nil, message)
+	if err != nil {
+		Logger(r.Context()).Error("answering telegram message", "update", update.UpdateID, "err", err)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// SetTelegramWebhook points the bot at the webhook under origin, a scheme
+// and host like https://bible.example.com.
+func (s *Server) SetTelegramWebhook(ctx context.Context, token string, origin string) error {
+	path_secret, header_secret := TelegramSecrets(token)
+	webhook := origin + s.Path("telegram", "secret", path_secret)
+	payload := map[string]any{
+		"url":             webhook,
+		"secret_token":    header_secret,
+		"allowed_updates": []string{"message"},
+	}
+	return s.sendIntegration(ctx, http.MethodPost, telegramMethod(token, "setWebhook"), nil, payload)
+}
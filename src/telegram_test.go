@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTelegramSecrets(t *testing.T) {
+	path, header := TelegramSecrets("123:abc")
+	if path == header {
+		t.Errorf("the path and header secrets are both %q", path)
+	}
+	if again_path, again_header := TelegramSecrets("123:abc"); again_path != path || again_header != header {
+		t.Errorf("secrets changed between calls")
+	}
+	if other_path, _ := TelegramSecrets("123:abd"); other_path == path {
+		t.Errorf("two tokens have the same path secret")
+	}
+}
+
+// The webhook's path secret stays out of the logs, whether the update is
+// accepted or rejected.
+func TestTelegramSecretNotLogged(t *testing.T) {
+	telegram_token = "123:abc"
+	t.Cleanup(func() { telegram_token = "" })
+	var logs bytes.Buffer
+	saved := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(saved) })
+	handler := Logging(newTestServer(t))
+	path_secret, header_secret := TelegramSecrets(telegram_token)
+
+	tests := []struct {
+		name   string
+		header string
+		status int
+	}{
+		{"accepted", header_secret, http.StatusOK},
+		{"wrong header", "nope", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logs.Reset()
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/integrations/telegram/"+path_secret, strings.NewReader(`{"update_id": 1}`))
+			r.Header.Set("X-Telegram-Bot-Api-Secret-Token", test.header)
+			handler.ServeHTTP(w, r)
+			if w.Code != test.status {
+				t.Errorf("status %d, want %d", w.Code, test.status)
+			}
+			if strings.Contains(logs.String(), path_secret) {
+				t.Errorf("the path secret was logged:\n%s", logs.String())
+			}
+			if !strings.Contains(logs.String(), "path=/integrations/telegram/REDACTED") {
+				t.Errorf("no redacted path logged:\n%s", logs.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+//go:embed templates/*.html
+var template_files embed.FS
+
+// template_funcs are available in every page.
+var template_funcs = template.FuncMap{
+	"verse":  verseText,
+	"poetry": poetryHTML,
+	"lines":  PoetryLines,
+}
+
+// parseTemplates parses one template per page, each together with the
+// shared layout. server_funcs are added to template_funcs: they need a
+// server, like linkify, which looks books up in its cache, path, which
+// links to a route as {{path "chapter" "book" "john" "chapter" "3"}}, and
+// asset, which links to a file in static/ by its hashed name.
+func parseTemplates(server_funcs template.FuncMap) map[string]*template.Template {
+	funcs := template.FuncMap{}
+	for name, f := range template_funcs {
+		funcs[name] = f
+	}
+	for name, f := range server_funcs {
+		funcs[name] = f
+	}
+	pages, err := fs.Glob(template_files, "templates/*.html")
+	if err != nil {
+		panic(err)
+	}
+	templates := map[string]*template.Template{}
+	for _, page := range pages {
+		name := path.Base(page)
+		if name == "layout.html" {
+			continue
+		}
+		templates[name] = template.Must(template.New(name).Funcs(funcs).ParseFS(template_files, "templates/layout.html", page))
+	}
+	return templates
+}
+
+type Link struct {
+	Text string
+	URL  string
+}
+
+// site_name is what link previews call the site.
+const site_name = "Bible App"
+
+// description_length is roughly how long link preview descriptions are
+// cut to.
+const description_length = 200
+
+// SocialMeta fills the OpenGraph and Twitter card tags that link previews
+// in chat apps and social sites are built from.
+type SocialMeta struct {
+	Title       string
+	Description string
+	SiteName    string
+	// Image is the absolute URL of a share image, if the page has one
+	Image string
+}
+
+func NewSocialMeta(title string, verses []Verse) SocialMeta {
+	texts := make([]string, len(verses))
+	for i, verse := range verses {
+		texts[i] = verseText(verse.Text)
+	}
+	return SocialMeta{Title: title, Description: Truncate(strings.Join(texts, " "), description_length), SiteName: site_name}
+}
+
+// Page is what the layout template is executed with.
+type Page struct {
+	Title  string
+	Body   any
+	Header *HeaderNav
+	Prefs  Prefs
+	Theme  string
+	Toggle ThemeToggle
+	// Canonical is left empty on error pages
+	Canonical string
+}
+
+// NewPage wraps a page's body with the header and the visitor's display
+// settings. Pages look different with settings that aren't the defaults, so
+// those are kept out of shared caches.
+func (s *Server) NewPage(w http.ResponseWriter, r *http.Request, title string, body any) Page {
+	theme := RequestTheme(w, r)
+	prefs := RequestPrefs(r)
+	if prefs != default_prefs {
+		Private(w)
+	}
+	page := Page{Title: title, Body: body, Header: s.PageHeader(r), Prefs: prefs, Theme: theme, Toggle: s.NewThemeToggle(theme)}
+	if r != nil {
+		page.Canonical = CanonicalURL(r)
+	}
+	return page
+}
+
+// TimedLink is a link to a book or chapter with its estimated reading
+// time, empty while its text hasn't been loaded.
+type TimedLink struct {
+	Link
+	ReadingTime string
+}
+
+type BookSection struct {
+	Title string
+	Books []TimedLink
+}
+
+type BooksPage struct {
+	Sections    []BookSection
+	Translation string
+	Ref         string
+	Error       string
+	Continue    *Link
+}
+
+type ChaptersPage struct {
+	Breadcrumbs []Link
+	Chapters    []TimedLink
+	Full        Link
+}
+
+type FullBookPage struct {
+	Breadcrumbs []Link
+	Title       string
+	Contents    []Link
+}
+
+type FullBookChapter struct {
+	Anchor string
+	Number int
+	Verses []Verse
+	Error  string
+}
+
+type VersesPage struct {
+	Breadcrumbs []Link
+	Verses      []ChapterVerse
+	Colors      []HighlightColor
+	Highlights  string
+	Paragraphs  [][]ChapterVerse
+	ReadingTime string
+	Mode        string
+	Modes       []ModeLink
+	Print       string
+	Bookmark    BookmarkForm
+	Previous    *Link
+	Next        *Link
+}
+
+type PassagePage struct {
+	Breadcrumbs []Link
+	Reference   string
+	Verses      []Verse
+	Poetry      bool
+	Total       int
+	Print       string
+	Social      SocialMeta
+}
+
+type ReferenceChapter struct {
+	Chapter Link
+	Verses  []Verse
+}
+
+type ReferencePage struct {
+	Reference   string
+	Translation string
+	Chapters    []ReferenceChapter
+}
+
+type VersePage struct {
+	Breadcrumbs []Link
+	Reference   string
+	Verse       Verse
+	Chapter     Link
+	Cite        Link
+	CrossRefs   []Link
+	Bookmark    BookmarkForm
+	Note        *NoteForm
+	Social      SocialMeta
+	OEmbed      string
+	Previous    *Link
+	Next        *Link
+}
+
+type HighlightsPage struct {
+	Groups []HighlightGroup
+}
+
+type PrefsPage struct {
+	Prefs        Prefs
+	Action       string
+	Back         string
+	FontSizes    []PrefOption
+	FontFamilies []PrefOption
+	LineHeights  []PrefOption
+}
+
+type GraphQLPage struct {
+	Endpoint string
+	Example  string
+	Schema   string
+}
+
+type NotesPage struct {
+	Query       string
+	Translation string
+	Notes       []NoteItem
+}
+
+type HistoryPage struct {
+	Clear string
+	Items []HistoryItem
+}
+
+type BookmarksPage struct {
+	Action string
+	Export string
+	Import string
+	Items  []BookmarkItem
+}
+
+type PlansPage struct {
+	Plans []PlanListItem
+}
+
+type PlanPage struct {
+	Name        string
+	Description string
+	Total       int
+	Read        int
+	Percent     int
+	Continue    *Link
+	Calendar    string
+	Days        []PlanDayItem
+}
+
+type PlanDayPage struct {
+	Plan     Link
+	Day      int
+	Total    int
+	Readings []PlanReading
+	Read     bool
+	Action   string
+	Previous *Link
+	Next     *Link
+}
+
+type SearchOption struct {
+	Value string
+	Text  string
+}
+
+type SearchPage struct {
+	Query      string
+	Context    bool
+	Book       string
+	Testament  string
+	Books      []SearchOption
+	Testaments []SearchOption
+	Results    []SearchResult
+	Matches    int
+	Page       int
+	Pages      int
+	Previous   *Link
+	Next       *Link
+	Indexed    int
+	Chapters   int
+	Complete   bool
+}
+
+type ConcordanceCount struct {
+	Book  string
+	Count int
+}
+
+type ConcordanceSection struct {
+	Book   string
+	Count  int
+	Verses []Link
+}
+
+type ConcordancePage struct {
+	Word     string
+	Total    int
+	Counts   []ConcordanceCount
+	Sections []ConcordanceSection
+	Page     int
+	Pages    int
+	Previous *Link
+	Next     *Link
+	Indexed  int
+	Chapters int
+	Complete bool
+}
+
+type VerseOfTheDayPage struct {
+	Date        string
+	Reference   Link
+	Text        string
+	Translation string
+	Chapter     Link
+}
+
+type TranslationRow struct {
+	Translation Translation
+	Books       Link
+	Sample      Link
+}
+
+type TranslationsPage struct {
+	Translations []TranslationRow
+}
+
+type ComparePage struct {
+	Breadcrumbs []Link
+	Reference   string
+	Book        string
+	Chapter     string
+	Columns     []CompareColumn
+	Rows        []CompareRow
+	Choices     []TranslationChoice
+}
+
+type BookNotFoundPage struct {
+	Slug        string
+	Suggestions []Link
+	IndexURL    string
+}
+
+type AmbiguousBookPage struct {
+	Slug       string
+	Candidates []Link
+}
+
+type ErrorPage struct {
+	Status  int
+	Message string
+}
+
+type UnknownTranslationPage struct {
+	Requested    string
+	Translations []Link
+}
+
+// RenderPage executes a page into a buffer first so a template error turns
+// into a 500 rather than a half-written response.
+func (s *Server) RenderPage(w http.ResponseWriter, r *http.Request, status int, name string, title string, body any) {
+	var buf bytes.Buffer
+	page := s.NewPage(w, r, title, body)
+	if status != http.StatusOK {
+		page.Canonical = ""
+	}
+	err := s.templates[name].ExecuteTemplate(&buf, "layout", page)
+	if err != nil {
+		slog.Error("rendering page", "template", name, "err", err)
+		if name != "error.html" {
+			s.renderError(w, r, http.StatusInternalServerError, "Something went wrong while building this page.")
+		} else {
+			http.Error(w, "500 internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// renderError is the single way handlers report failures, so every error
+// gets the site layout and a way back to the book index.
+func (s *Server) renderError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	s.RenderPage(w, r, status, "error.html", http.StatusText(status), ErrorPage{Status: status, Message: message})
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEscapesRequestText(t *testing.T) {
+	handler := newTestServer(t)
+	tests := []struct {
+		name   string
+		target string
+	}{
+		{"chapter", "/john/%3Cscript%3Ealert(1)"},
+		{"verse", "/john/3/%3Cscript%3Ealert(1)"},
+		{"reference", "/passage?ref=%3Cscript%3Ealert(1)"},
+		{"search", "/search?q=%3Cscript%3Ealert(1)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := get(t, handler, test.target).Body.String()
+			if strings.Contains(body, "<script>alert(1)") {
+				t.Errorf("GET %s: body has the script unescaped", test.target)
+			}
+			if !strings.Contains(body, "&lt;script&gt;alert(1)") {
+				t.Errorf("GET %s: body doesn't have the escaped script", test.target)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+const (
+	OldTestament = "ot"
+	NewTestament = "nt"
+	Apocrypha    = "ap"
+	// OtherBooks holds any book ID missing from book_testaments.
+	OtherBooks = "other"
+)
+
+// book_testaments classifies bible-api.com's book IDs.
+var book_testaments = map[string]string{
+	"GEN": OldTestament, "EXO": OldTestament, "LEV": OldTestament, "NUM": OldTestament,
+	"DEU": OldTestament, "JOS": OldTestament, "JDG": OldTestament, "RUT": OldTestament,
+	"1SA": OldTestament, "2SA": OldTestament, "1KI": OldTestament, "2KI": OldTestament,
+	"1CH": OldTestament, "2CH": OldTestament, "EZR": OldTestament, "NEH": OldTestament,
+	"EST": OldTestament, "JOB": OldTestament, "PSA": OldTestament, "PRO": OldTestament,
+	"ECC": OldTestament, "SNG": OldTestament, "ISA": OldTestament, "JER": OldTestament,
+	"LAM": OldTestament, "EZK": OldTestament, "DAN": OldTestament, "HOS": OldTestament,
+	"JOL": OldTestament, "AMO": OldTestament, "OBA": OldTestament, "JON": OldTestament,
+	"MIC": OldTestament, "NAM": OldTestament, "HAB": OldTestament, "ZEP": OldTestament,
+	"HAG": OldTestament, "ZEC": OldTestament, "MAL": OldTestament,
+
+	"MAT": NewTestament, "MRK": NewTestament, "LUK": NewTestament, "JHN": NewTestament,
+	"ACT": NewTestament, "ROM": NewTestament, "1CO": NewTestament, "2CO": NewTestament,
+	"GAL": NewTestament, "EPH": NewTestament, "PHP": NewTestament, "COL": NewTestament,
+	"1TH": NewTestament, "2TH": NewTestament, "1TI": NewTestament, "2TI": NewTestament,
+	"TIT": NewTestament, "PHM": NewTestament, "HEB": NewTestament, "JAS": NewTestament,
+	"1PE": NewTestament, "2PE": NewTestament, "1JN": NewTestament, "2JN": NewTestament,
+	"3JN": NewTestament, "JUD": NewTestament, "REV": NewTestament,
+
+	"TOB": Apocrypha, "JDT": Apocrypha, "ESG": Apocrypha, "WIS": Apocrypha,
+	"SIR": Apocrypha, "BAR": Apocrypha, "LJE": Apocrypha, "S3Y": Apocrypha,
+	"SUS": Apocrypha, "BEL": Apocrypha, "1MA": Apocrypha, "2MA": Apocrypha,
+	"3MA": Apocrypha, "4MA": Apocrypha, "1ES": Apocrypha, "2ES": Apocrypha,
+	"MAN": Apocrypha, "PS2": Apocrypha, "DAG": Apocrypha,
+}
+
+// testament_order is the order of the sections on the index page.
+var testament_order = []string{OldTestament, Apocrypha, NewTestament, OtherBooks}
+
+var testament_names = map[string]string{
+	OldTestament: "Old Testament",
+	Apocrypha:    "Apocrypha",
+	NewTestament: "New Testament",
+	OtherBooks:   "Other Books",
+}
+
+// Testament classifies a book ID as Old Testament, New Testament,
+// Apocrypha, or OtherBooks when it isn't in the table.
+func Testament(book_id string) string {
+	testament, ok := book_testaments[book_id]
+	if !ok {
+		return OtherBooks
+	}
+	return testament
+}
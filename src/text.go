@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// WrapVerse wraps text to width columns after a "3:16" style prefix.
+// Continuation lines are indented to line up with the start of the text. A
+// width of 0 or less leaves the verse on one line, and a word longer than
+// the width gets a line to itself.
+func WrapVerse(prefix string, text string, width int) []string {
+	words := strings.Fields(text)
+	if width <= 0 {
+		return []string{strings.Join(append([]string{prefix}, words...), " ")}
+	}
+
+	indent := strings.Repeat(" ", utf8.RuneCountInString(prefix)+1)
+	var lines []string
+	line := prefix
+	length := utf8.RuneCountInString(prefix)
+	empty := true
+	for _, word := range words {
+		word_length := utf8.RuneCountInString(word)
+		if !empty && length+1+word_length > width {
+			lines = append(lines, line)
+			line = indent + word
+			length = len(indent) + word_length
+			continue
+		}
+		line += " " + word
+		length += 1 + word_length
+		empty = false
+	}
+	return append(lines, line)
+}
+
+// Attribution is the footer line for plain text output.
+func Attribution(translation Translation) string {
+	if translation.License == "" {
+		return translation.Name
+	}
+	return fmt.Sprintf("%s (%s)", translation.Name, translation.License)
+}
+
+func WriteText(w http.ResponseWriter, translation Translation, verses []Verse, width int) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	var b strings.Builder
+	for _, verse := range verses {
+		prefix := fmt.Sprintf("%d:%d", verse.Chapter, verse.Verse)
+		for _, line := range WrapVerse(prefix, verseText(verse.Text), width) {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	b.WriteString("\n")
+	b.WriteString(Attribution(translation))
+	b.WriteByte('\n')
+	fmt.Fprint(w, b.String())
+}
+
+func textError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	Logger(r.Context()).Error("request failed", "err", err)
+	status, message := ErrorStatus(err)
+	http.Error(w, message, status)
+}
+
+// textWidth reads ?width=, where 0 or a missing value means no wrapping.
+func textWidth(r *http.Request) int {
+	width, err := strconv.Atoi(r.URL.Query().Get("width"))
+	if err != nil || width < 0 {
+		return 0
+	}
+	return width
+}
+
+func (s *Server) textVerses(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var book Book
+	var verse_info VerseInfo
+	err := s.LoadVerses(r.Context(), RequestTranslation(r), vars["book"], vars["chapter"], &book, &verse_info)
+	if err != nil {
+		textError(w, r, err)
+		return
+	}
+	WriteText(w, verse_info.Translation, verse_info.Verses, textWidth(r))
+}
+
+func (s *Server) textPassage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	ranges, err := ParseVerseRanges(vars["verses"])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("\"%s\" isn't a verse or range of verses.", vars["verses"]), http.StatusBadRequest)
+		return
+	}
+
+	var book Book
+	var verse_info VerseInfo
+	err = s.LoadVerses(r.Context(), RequestTranslation(r), vars["book"], vars["chapter"], &book, &verse_info)
+	if err != nil {
+		textError(w, r, err)
+		return
+	}
+	verses := PassageVerses(verse_info.Verses, ranges)
+	if len(verses) == 0 {
+		textError(w, r, &VerseNotFoundError{Reference: fmt.Sprintf("%s %s", book.Name, vars["chapter"]), Verse: ranges[0].Start, Last: LastVerse(verse_info.Verses)})
+		return
+	}
+	WriteText(w, verse_info.Translation, verses, textWidth(r))
+}
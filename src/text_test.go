@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestWrapVerse(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		text   string
+		width  int
+		want   []string
+	}{
+		{
+			"no wrapping", "3:16", "For God so loved the world", 0,
+			[]string{"3:16 For God so loved the world"},
+		},
+		{
+			"fits", "3:16", "For God so loved the world", 31,
+			[]string{"3:16 For God so loved the world"},
+		},
+		{
+			"continuation lines up with the text", "3:16", "For God so loved the world", 20,
+			[]string{
+				"3:16 For God so",
+				"     loved the world",
+			},
+		},
+		{
+			"longer prefix", "119:176", "I have gone astray like a lost sheep", 24,
+			[]string{
+				"119:176 I have gone",
+				"        astray like a",
+				"        lost sheep",
+			},
+		},
+		{
+			"word longer than the width", "1:1", "In Jerusalem, Maher-Shalal-Hash-Baz", 12,
+			[]string{
+				"1:1 In",
+				"    Jerusalem,",
+				"    Maher-Shalal-Hash-Baz",
+			},
+		},
+		{
+			"first word doesn't fit after the prefix", "1:1", "Maher-Shalal-Hash-Baz came", 10,
+			[]string{
+				"1:1 Maher-Shalal-Hash-Baz",
+				"    came",
+			},
+		},
+		{
+			"extra whitespace", "1:1", "  In the\nbeginning  ", 40,
+			[]string{"1:1 In the beginning"},
+		},
+		{
+			"counts letters, not bytes", "1:1", "God’s Spirit was hovering", 20,
+			[]string{
+				"1:1 God’s Spirit was",
+				"    hovering",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := WrapVerse(test.prefix, test.text, test.width)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("WrapVerse(%q, %q, %d) =\n%q\nwant\n%q", test.prefix, test.text, test.width, got, test.want)
+			}
+		})
+	}
+}
+
+func TestAttribution(t *testing.T) {
+	tests := []struct {
+		translation Translation
+		want        string
+	}{
+		{Translation{Name: "World English Bible", License: "Public Domain"}, "World English Bible (Public Domain)"},
+		{Translation{Name: "World English Bible"}, "World English Bible"},
+	}
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			if got := Attribution(test.translation); got != test.want {
+				t.Errorf("Attribution = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTextChapter(t *testing.T) {
+	handler := newTestServer(t)
+	tests := []struct {
+		target string
+		width  int
+		first  string
+	}{
+		{"/john/3.txt", 0, "3:1 Now there was a man of the Pharisees named Nicodemus, a ruler of the Jews."},
+		{"/john/3.txt?width=40", 40, "3:1 Now there was a man of the Pharisees"},
+		{"/psalms/119.txt?width=30", 30, "119:1 Blessed are those whose"},
+		{"/john/3/16-17.txt?width=72", 72, "3:16 For God so loved the world, that he gave his one and only Son, that"},
+	}
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			w := get(t, handler, test.target)
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET %s: status %d, want %d", test.target, w.Code, http.StatusOK)
+			}
+			if content_type := w.Header().Get("Content-Type"); content_type != "text/plain; charset=utf-8" {
+				t.Errorf("GET %s: Content-Type %q", test.target, content_type)
+			}
+			lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+			if lines[0] != test.first {
+				t.Errorf("GET %s: first line %q, want %q", test.target, lines[0], test.first)
+			}
+			if footer := lines[len(lines)-1]; footer != "World English Bible (Public Domain)" {
+				t.Errorf("GET %s: footer %q", test.target, footer)
+			}
+			// the footer stays on one line
+			for _, line := range lines[:len(lines)-1] {
+				if test.width > 0 && utf8.RuneCountInString(line) > test.width {
+					t.Errorf("GET %s: line %q is wider than %d", test.target, line, test.width)
+				}
+				if strings.ContainsAny(line, "<>") {
+					t.Errorf("GET %s: line %q has markup", test.target, line)
+				}
+			}
+		})
+	}
+}
+
+func TestTextPassageOutOfRange(t *testing.T) {
+	w := get(t, newTestServer(t), "/john/3/37-40.txt")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if want := "John 3 has no verse 37, it has verses 1-36.\n"; w.Body.String() != want {
+		t.Errorf("body %q, want %q", w.Body.String(), want)
+	}
+}
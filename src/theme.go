@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Pages follow the browser's prefers-color-scheme unless the visitor picked
+// a theme with the toggle, which is kept in the theme cookie.
+const (
+	ThemeLight = "light"
+	ThemeDark  = "dark"
+	ThemeAuto  = "auto"
+)
+
+// ThemeToggle is the light and dark switch at the top of every page.
+type ThemeToggle struct {
+	Action  string
+	Choices []PrefOption
+}
+
+// RequestTheme is the theme the visitor picked, or "" to follow the
+// browser. Pages with a picked theme are kept out of shared caches.
+func RequestTheme(w http.ResponseWriter, r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	theme, ok := SignedCookie(r, "theme")
+	if !ok || (theme != ThemeLight && theme != ThemeDark) {
+		return ""
+	}
+	if w != nil {
+		Private(w)
+	}
+	return theme
+}
+
+// NewThemeToggle offers the themes other than the current one.
+func (s *Server) NewThemeToggle(theme string) ThemeToggle {
+	toggle := ThemeToggle{Action: s.Path("theme")}
+	if theme != ThemeDark {
+		toggle.Choices = append(toggle.Choices, PrefOption{Value: ThemeDark, Label: "☾ Dark"})
+	}
+	if theme != ThemeLight {
+		toggle.Choices = append(toggle.Choices, PrefOption{Value: ThemeLight, Label: "☀ Light"})
+	}
+	if theme != "" {
+		toggle.Choices = append(toggle.Choices, PrefOption{Value: ThemeAuto, Label: "Auto"})
+	}
+	return toggle
+}
+
+// postTheme saves the theme picked with the toggle, or forgets it for
+// "auto", and goes back to the page the toggle was on.
+func (s *Server) postTheme(w http.ResponseWriter, r *http.Request) {
+	switch theme := r.PostFormValue("theme"); theme {
+	case ThemeLight, ThemeDark:
+		SetSignedCookie(w, r, "theme", theme)
+	case ThemeAuto:
+		ClearCookie(w, "theme")
+	default:
+		s.renderError(w, r, http.StatusBadRequest, fmt.Sprintf("%q isn't a theme, pick light, dark or auto.", theme))
+		return
+	}
+	redirectBack(w, r, s.Path("books"))
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const trace_service = "bible-app"
+
+// tracer is set by StartTracing when -otel-endpoint is. Until then it's
+// nil, the Tracing middleware isn't installed and upstream calls skip
+// their spans, so tracing costs nothing when it's off.
+var tracer trace.Tracer
+
+// trace_propagator reads and writes W3C traceparent headers, so a request
+// from a traced caller joins its trace and bible-api.com is told about
+// ours.
+var trace_propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// StartTracing exports spans over OTLP/HTTP to endpoint, a URL like
+// http://localhost:4318, keeping ratio of the traces that start here.
+// Traces started by a caller are kept if the caller kept them. The
+// returned function flushes what's left to send.
+func StartTracing(ctx context.Context, endpoint string, ratio float64) (func(context.Context) error, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%q should be a URL like http://localhost:4318", endpoint)
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		u.Path = "/v1/traces"
+	}
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(u.String()))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", trace_service))),
+	)
+	tracer = provider.Tracer("bible_api")
+	return provider.Shutdown, nil
+}
+
+// Tracing starts a span for every request, named after the route it
+// matched once mux has matched one, so /john/3 and /genesis/1 are both
+// "GET /{book}/{chapter}". Handlers pass the request's context on, so
+// upstream calls show up inside it.
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := trace_propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+			attribute.String("client.address", remoteIP(r)),
+		))
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+
+		if entry, ok := r.Context().Value(requestLogKey{}).(*requestLog); ok {
+			// recordRoute may have redacted a secret from the path
+			span.SetAttributes(attribute.String("url.path", entry.path))
+			if entry.route != "" {
+				span.SetName(r.Method + " " + entry.route)
+				span.SetAttributes(attribute.String("http.route", entry.route))
+			}
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", sw.status))
+		if sw.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+	})
+}
+
+// startUpstreamSpan starts the span of one request to bible-api.com and
+// sends its traceparent along.
+func startUpstreamSpan(ctx context.Context, req *http.Request) trace.Span {
+	ctx, span := tracer.Start(ctx, "GET "+upstreamEndpoint(req.URL.Path), trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("http.request.method", req.Method),
+		attribute.String("url.full", req.URL.String()),
+		attribute.String("server.address", req.URL.Hostname()),
+	))
+	trace_propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return span
+}
+
+// endUpstreamSpan records how a request to bible-api.com went. status is 0
+// if there was no response.
+func endUpstreamSpan(span trace.Span, status int, err error) {
+	if status != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, upstreamOutcome(err))
+	}
+	span.End()
+}
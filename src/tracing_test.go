@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceTestServer is the site wrapped the way main wraps it with tracing
+// on, recording spans in memory. It returns the traceparent header of each
+// upstream request too.
+func traceTestServer(t *testing.T) (http.Handler, *tracetest.InMemoryExporter, func() []string) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter), sdktrace.WithSampler(sdktrace.AlwaysSample()))
+	tracer = provider.Tracer("bible_api")
+	t.Cleanup(func() { tracer = nil })
+
+	var mu sync.Mutex
+	var traceparents []string
+	bible := NewBibleClient(fakeUpstream(t).URL)
+	bible.Retries = 0
+	bible.HTTP = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		mu.Lock()
+		traceparents = append(traceparents, r.Header.Get("traceparent"))
+		mu.Unlock()
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+	handler := Logging(Tracing(NewServer(bible, nil).Routes(false, false)))
+	return handler, exporter, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(traceparents)
+	}
+}
+
+func spanAttribute(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracingSpans(t *testing.T) {
+	tests := []struct {
+		target string
+		name   string
+		route  string
+		status int
+		// upstream is the name of a span that should be under the request's
+		upstream string
+		failed   bool
+	}{
+		{"/john/3", "GET /{book}/{chapter}", "/{book}/{chapter}", http.StatusOK, "GET verses", false},
+		{"/john/3/16", "GET /{book}/{chapter}/{verse:[0-9]+}", "/{book}/{chapter}/{verse:[0-9]+}", http.StatusOK, "GET verses", false},
+		{"/", "GET /", "/", http.StatusOK, "GET books", false},
+		{"/john/4", "GET /{book}/{chapter}", "/{book}/{chapter}", http.StatusNotFound, "GET verses", true},
+	}
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			handler, exporter, traceparents := traceTestServer(t)
+			if w := get(t, handler, test.target); w.Code != test.status {
+				t.Fatalf("status %d, want %d", w.Code, test.status)
+			}
+			spans := exporter.GetSpans()
+			i := slices.IndexFunc(spans, func(span tracetest.SpanStub) bool { return span.SpanKind == trace.SpanKindServer })
+			if i < 0 {
+				t.Fatalf("no server span in %d spans", len(spans))
+			}
+			server := spans[i]
+			if server.Name != test.name {
+				t.Errorf("server span %q, want %q", server.Name, test.name)
+			}
+			if route := spanAttribute(server, "http.route").AsString(); route != test.route {
+				t.Errorf("http.route %q, want %q", route, test.route)
+			}
+			if status := spanAttribute(server, "http.response.status_code").AsInt64(); status != int64(test.status) {
+				t.Errorf("http.response.status_code %d, want %d", status, test.status)
+			}
+			if server.Parent.IsValid() {
+				t.Errorf("server span has a parent")
+			}
+
+			var upstream []string
+			for _, span := range spans {
+				if span.SpanKind != trace.SpanKindClient {
+					continue
+				}
+				upstream = append(upstream, span.Name)
+				if span.Parent.SpanID() != server.SpanContext.SpanID() || span.SpanContext.TraceID() != server.SpanContext.TraceID() {
+					t.Errorf("%s isn't a child of the request's span", span.Name)
+				}
+				if spanAttribute(span, "url.full").AsString() == "" || spanAttribute(span, "http.response.status_code").AsInt64() == 0 {
+					t.Errorf("%s: attributes %v", span.Name, span.Attributes)
+				}
+				if span.Name == test.upstream && (span.Status.Code == codes.Error) != test.failed {
+					t.Errorf("%s: status %v", span.Name, span.Status)
+				}
+			}
+			if !slices.Contains(upstream, test.upstream) {
+				t.Errorf("upstream spans %v, want %s among them", upstream, test.upstream)
+			}
+			// each upstream request carries its own span's context
+			for _, traceparent := range traceparents() {
+				if len(traceparent) != 55 || traceparent[3:35] != server.SpanContext.TraceID().String() {
+					t.Errorf("upstream traceparent %q isn't in trace %s", traceparent, server.SpanContext.TraceID())
+				}
+			}
+		})
+	}
+}
+
+// A request that comes with a traceparent joins the caller's trace.
+func TestTracingPropagation(t *testing.T) {
+	handler, exporter, _ := traceTestServer(t)
+	r := httptest.NewRequest(http.MethodGet, "/john/3", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	for _, span := range exporter.GetSpans() {
+		if trace_id := span.SpanContext.TraceID().String(); trace_id != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("%s is in trace %s", span.Name, trace_id)
+		}
+		if span.SpanKind == trace.SpanKindServer && span.Parent.SpanID().String() != "00f067aa0ba902b7" {
+			t.Errorf("server span's parent is %s", span.Parent.SpanID())
+		}
+	}
+}
+
+// Tracing off leaves upstream requests alone.
+func TestTracingOff(t *testing.T) {
+	var traceparent string
+	bible := NewBibleClient(fakeUpstream(t).URL)
+	bible.HTTP = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		traceparent += r.Header.Get("traceparent")
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+	get(t, NewServer(bible, nil).Routes(false, false), "/john/3")
+	if traceparent != "" {
+		t.Errorf("upstream got traceparent %q", traceparent)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"html/template"
+	"strings"
+	"unicode"
+)
+
+// NormalizeVerse cleans up verse text from bible-api.com, which ends most
+// verses with "\n" and breaks poetry across lines. Each line is trimmed,
+// blank lines are dropped, and the rest are joined with line_break: " " for
+// running text, "<br>" for poetry. Every output format goes through here.
+func NormalizeVerse(text string, line_break string) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, line_break)
+}
+
+// poetryHTML keeps the upstream line breaks of a verse as <br> tags.
+func poetryHTML(text string) template.HTML {
+	return template.HTML(NormalizeVerse(template.HTMLEscapeString(text), "<br>"))
+}
+
+func verseText(text string) string {
+	return NormalizeVerse(text, " ")
+}
+
+// normalizeVerses rewrites verse text in place for formats without a
+// poetry mode.
+func normalizeVerses(verses []Verse) {
+	for i := range verses {
+		verses[i].Text = verseText(verses[i].Text)
+	}
+}
+
+// CountWords counts the words of verse text for reading time, leaving out
+// anything without a letter in it, like verse numbers and stray punctuation
+// such as "¶" or "—".
+func CountWords(text string) int {
+	count := 0
+	for _, field := range strings.Fields(text) {
+		if strings.IndexFunc(field, unicode.IsLetter) >= 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// Truncate shortens text to at most limit characters, cutting at the last
+// space that fits and adding "…". It counts runes, so a multi-byte
+// character is never split. A first word longer than limit is cut mid-word.
+func Truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	cut := runes[:limit]
+	if space := strings.LastIndexFunc(string(cut), unicode.IsSpace); space > 0 {
+		return strings.TrimRightFunc(string(cut)[:space], unicode.IsSpace) + "…"
+	}
+	return string(cut) + "…"
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestNormalizeVerse(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		line_break string
+		want       string
+	}{
+		{"trailing newline", "For God so loved the world.\n", " ", "For God so loved the world."},
+		{"trailing spaces", "For God so loved the world.  \n  ", " ", "For God so loved the world."},
+		{"poetry as prose", "Blessed are those whose ways are blameless,\nwho walk according to Yahweh’s law.\n", " ", "Blessed are those whose ways are blameless, who walk according to Yahweh’s law."},
+		{"poetry", "Blessed are those whose ways are blameless,\nwho walk according to Yahweh’s law.\n", "<br>", "Blessed are those whose ways are blameless,<br>who walk according to Yahweh’s law."},
+		{"blank lines", "\n\nI am a rose of Sharon,\n\n\na lily of the valleys.\n\n", "<br>", "I am a rose of Sharon,<br>a lily of the valleys."},
+		{"indented lines", "  I am a rose of Sharon,\n    a lily of the valleys.", "\n", "I am a rose of Sharon,\na lily of the valleys."},
+		{"runs of spaces", "In  the\tbeginning", " ", "In the beginning"},
+		{"windows line endings", "In the beginning\r\nGod created\r\n", " ", "In the beginning God created"},
+		{"empty", "", " ", ""},
+		{"only whitespace", " \n \n", "<br>", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := NormalizeVerse(test.text, test.line_break); got != test.want {
+				t.Errorf("NormalizeVerse(%q, %q) = %q, want %q", test.text, test.line_break, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPoetryHTML(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"I am a rose of Sharon,\na lily of the valleys.\n", "I am a rose of Sharon,<br>a lily of the valleys."},
+		{"<b>bold</b> & brave\n", "&lt;b&gt;bold&lt;/b&gt; &amp; brave"},
+		{"Yahweh’s law\n", "Yahweh’s law"},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			if got := poetryHTML(test.text); string(got) != test.want {
+				t.Errorf("poetryHTML(%q) = %q, want %q", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPoetryLines(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"I am a rose of Sharon,\na lily of the valleys.\n", []string{"I am a rose of Sharon,", "a lily of the valleys."}},
+		{"For God so loved the world.\n", []string{"For God so loved the world."}},
+		{"\n \n", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			if got := PoetryLines(test.text); !slices.Equal(got, test.want) {
+				t.Errorf("PoetryLines(%q) = %q, want %q", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestContentType(t *testing.T) {
+	handler := newTestServer(t)
+	tests := []struct {
+		target       string
+		content_type string
+	}{
+		{"/", "text/html; charset=utf-8"},
+		{"/john/3", "text/html; charset=utf-8"},
+		{"/john/3/16-17", "text/html; charset=utf-8"},
+		{"/john/3?format=json", "application/json; charset=utf-8"},
+		{"/api/v1/john/3", "application/json; charset=utf-8"},
+		{"/john/3.txt", "text/plain; charset=utf-8"},
+		{"/john/3/16-17.txt", "text/plain; charset=utf-8"},
+		{"/john/3?format=md", "text/markdown; charset=utf-8"},
+		{"/nope/3", "text/html; charset=utf-8"},
+	}
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			w := get(t, handler, test.target)
+			if content_type := w.Header().Get("Content-Type"); content_type != test.content_type {
+				t.Errorf("GET %s: Content-Type %q, want %q", test.target, content_type, test.content_type)
+			}
+		})
+	}
+}
+
+func TestVerseTextNormalized(t *testing.T) {
+	handler := newTestServer(t)
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/api/v1/psalms/119", `"text":"Blessed are those whose ways are blameless, who walk according to Yahweh’s law."`},
+		{"/psalms/119.txt", "119:1 Blessed are those whose ways are blameless, who walk according to Yahweh’s law.\n"},
+		{"/song-of-solomon/2?mode=poetry", "<sup class=\"verse-number\">1</sup>\n\t<span style=\"display: block; padding-left: 2em; text-indent: -2em\">I am a rose of Sharon,</span>\n\t<span style=\"display: block; padding-left: 2em; text-indent: -2em\">a lily of the valleys.</span>\n</div>"},
+	}
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			w := get(t, handler, test.target)
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET %s: status %d", test.target, w.Code)
+			}
+			body := w.Body.String()
+			if !strings.Contains(body, test.want) {
+				t.Errorf("GET %s: body doesn't contain %q", test.target, test.want)
+			}
+			if strings.Contains(body, `\n"`) {
+				t.Errorf("GET %s: verse text keeps its trailing newline", test.target)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		text  string
+		limit int
+		want  string
+	}{
+		{"For God so loved the world", 100, "For God so loved the world"},
+		{"For God so loved the world", 26, "For God so loved the world"},
+		{"For God so loved the world", 25, "For God so loved the…"},
+		{"For God so loved the world", 20, "For God so loved…"},
+		{"For God so loved the world", 19, "For God so loved…"},
+		{"For God so loved,  the world", 18, "For God so loved,…"},
+		{"Maher-Shalal-Hash-Baz came", 10, "Maher-Shal…"},
+		// multi-byte characters are counted, and never split
+		{"God didn’t send his Son", 10, "God…"},
+		{"God didn’t send his Son", 14, "God didn’t…"},
+		{"God didn’t send his Son", 8, "God…"},
+		{"didn’tsendhisSon", 6, "didn’t…"},
+		{"Señor Señor Señor", 8, "Señor…"},
+		{"ñññññ", 3, "ñññ…"},
+		{"👋👋👋👋", 2, "👋👋…"},
+		{"", 10, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			got := Truncate(test.text, test.limit)
+			if got != test.want {
+				t.Errorf("Truncate(%q, %d) = %q, want %q", test.text, test.limit, got, test.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("Truncate(%q, %d) split a character: %q", test.text, test.limit, got)
+			}
+		})
+	}
+}
+
+func TestSocialMeta(t *testing.T) {
+	handler := newTestServer(t)
+	tests := []struct {
+		target      string
+		title       string
+		description string
+	}{
+		{"/john/3/16", "John 3:16", `content="For God so loved the world, that he gave his one and only Son, that whoever believes in him should not perish, but have eternal life."`},
+		{"/john/3/16-17", "John 3:16-17", `content="For God so loved the world, that he gave his one and only Son, that whoever believes in him should not perish, but have eternal life. For God didn’t send his Son into the world to judge the world,…"`},
+		{"/song-of-solomon/2/1", "Song of Solomon 2:1", `content="I am a rose of Sharon, a lily of the valleys."`},
+	}
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			w := get(t, handler, test.target)
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET %s: status %d", test.target, w.Code)
+			}
+			body := w.Body.String()
+			for _, want := range []string{
+				`<meta property="og:title" content="` + test.title,
+				`<meta property="og:description" ` + test.description,
+				`<meta property="og:site_name" content="` + site_name + `">`,
+				`<meta name="twitter:card" content="summary`,
+			} {
+				if !strings.Contains(body, want) {
+					t.Errorf("GET %s: body doesn't contain %s", test.target, want)
+				}
+			}
+		})
+	}
+}
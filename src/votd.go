@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type VerseRef struct {
+	Book    string
+	Chapter int
+	Verse   int
+}
+
+// curated_verses is the pool the verse of the day is drawn from. Book IDs
+// are bible-api.com's.
+var curated_verses = []VerseRef{
+	{"GEN", 1, 1}, {"GEN", 28, 15}, {"EXO", 14, 14}, {"EXO", 33, 14},
+	{"NUM", 6, 24}, {"DEU", 31, 6}, {"DEU", 31, 8}, {"JOS", 1, 9},
+	{"RUT", 1, 16}, {"1SA", 16, 7}, {"2SA", 22, 31}, {"1CH", 16, 34},
+	{"2CH", 7, 14}, {"NEH", 8, 10}, {"JOB", 19, 25}, {"PSA", 1, 1},
+	{"PSA", 16, 11}, {"PSA", 18, 2}, {"PSA", 19, 14}, {"PSA", 23, 1},
+	{"PSA", 27, 1}, {"PSA", 34, 8}, {"PSA", 37, 4}, {"PSA", 46, 1},
+	{"PSA", 46, 10}, {"PSA", 51, 10}, {"PSA", 55, 22}, {"PSA", 62, 1},
+	{"PSA", 73, 26}, {"PSA", 90, 12}, {"PSA", 91, 1}, {"PSA", 103, 12},
+	{"PSA", 118, 24}, {"PSA", 119, 105}, {"PSA", 121, 1}, {"PSA", 139, 14},
+	{"PSA", 145, 18}, {"PRO", 3, 5}, {"PRO", 3, 6}, {"PRO", 16, 3},
+	{"PRO", 18, 10}, {"PRO", 22, 6}, {"ECC", 3, 1}, {"ISA", 9, 6},
+	{"ISA", 26, 3}, {"ISA", 40, 31}, {"ISA", 41, 10}, {"ISA", 43, 2},
+	{"ISA", 53, 5}, {"ISA", 55, 8}, {"JER", 29, 11}, {"JER", 33, 3},
+	{"LAM", 3, 22}, {"LAM", 3, 23}, {"MIC", 6, 8}, {"NAM", 1, 7},
+	{"HAB", 3, 19}, {"ZEP", 3, 17}, {"MAT", 5, 9}, {"MAT", 5, 14},
+	{"MAT", 6, 33}, {"MAT", 7, 7}, {"MAT", 11, 28}, {"MAT", 28, 20},
+	{"MRK", 10, 27}, {"MRK", 12, 30}, {"LUK", 1, 37}, {"LUK", 6, 31},
+	{"JHN", 1, 1}, {"JHN", 3, 16}, {"JHN", 8, 12}, {"JHN", 10, 10},
+	{"JHN", 11, 25}, {"JHN", 13, 34}, {"JHN", 14, 6}, {"JHN", 14, 27},
+	{"JHN", 15, 13}, {"JHN", 16, 33}, {"ACT", 1, 8}, {"ROM", 5, 8},
+	{"ROM", 8, 28}, {"ROM", 8, 38}, {"ROM", 12, 2}, {"ROM", 12, 12},
+	{"ROM", 15, 13}, {"1CO", 10, 13}, {"1CO", 13, 4}, {"1CO", 13, 13},
+	{"1CO", 16, 14}, {"2CO", 5, 17}, {"2CO", 12, 9}, {"GAL", 2, 20},
+	{"GAL", 5, 22}, {"GAL", 6, 9}, {"EPH", 2, 8}, {"EPH", 3, 20},
+	{"EPH", 4, 32}, {"PHP", 4, 6}, {"PHP", 4, 7}, {"PHP", 4, 13},
+	{"PHP", 4, 19}, {"COL", 3, 23}, {"1TH", 5, 16}, {"1TH", 5, 18},
+	{"2TI", 1, 7}, {"2TI", 3, 16}, {"HEB", 4, 16}, {"HEB", 11, 1},
+	{"HEB", 12, 1}, {"HEB", 13, 8}, {"JAS", 1, 5}, {"JAS", 1, 17},
+	{"1PE", 5, 7}, {"2PE", 3, 9}, {"1JN", 1, 9}, {"1JN", 4, 8},
+	{"1JN", 4, 19}, {"REV", 3, 20}, {"REV", 21, 4}, {"REV", 22, 13},
+}
+
+// VerseOfTheDayRef picks the verse for a UTC calendar date. Everyone gets the
+// same verse on the same day.
+func VerseOfTheDayRef(date time.Time) VerseRef {
+	h := fnv.New32a()
+	h.Write([]byte(date.UTC().Format(time.DateOnly)))
+	return curated_verses[h.Sum32()%uint32(len(curated_verses))]
+}
+
+func (s *Server) VerseOfTheDay(ctx context.Context, translation string, date time.Time, book *Book, verse_info *VerseInfo, verse *Verse) error {
+	ref := VerseOfTheDayRef(date)
+	err := s.Books.BookByID(ctx, translation, ref.Book, book)
+	if err != nil {
+		return err
+	}
+	return s.LoadVerse(ctx, translation, BookSlug(book.Name), strconv.Itoa(ref.Chapter), ref.Verse, book, verse_info, verse)
+}
+
+// votdDate reads the ?date= override, defaulting to today in UTC. The bool
+// is false for a malformed date.
+func votdDate(r *http.Request) (time.Time, bool, bool) {
+	value := r.URL.Query().Get("date")
+	if value == "" {
+		return time.Now().UTC(), false, true
+	}
+	date, err := time.Parse(time.DateOnly, value)
+	return date, true, err == nil
+}
+
+// votdCacheControl lets today's verse be cached until midnight UTC, when it
+// changes. A verse for an explicit date never changes.
+func votdCacheControl(w http.ResponseWriter, date time.Time, explicit bool) {
+	max_age := text_max_age
+	if !explicit {
+		midnight := date.Truncate(24 * time.Hour).Add(24 * time.Hour)
+		max_age = time.Until(midnight)
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(max_age.Seconds())))
+}
+
+func (s *Server) getVerseOfTheDay(w http.ResponseWriter, r *http.Request) {
+	translation := RequestTranslation(r)
+	date, explicit, ok := votdDate(r)
+	if !ok {
+		s.renderError(w, r, http.StatusBadRequest, "date must look like 2024-01-01.")
+		return
+	}
+
+	var book Book
+	var verse_info VerseInfo
+	var verse Verse
+	err := s.VerseOfTheDay(r.Context(), translation, date, &book, &verse_info, &verse)
+	if err != nil {
+		s.fetchError(w, r, translation, "", err)
+		return
+	}
+
+	page := VerseOfTheDayPage{
+		Date:        date.Format("Monday, 2 January 2006"),
+		Reference:   s.VerseLink(translation, book, verse.Chapter, verse.Verse),
+		Text:        verse.Text,
+		Translation: verse_info.Translation.Name,
+		Chapter:     s.ChapterLink(translation, book, verse.Chapter),
+	}
+	votdCacheControl(w, date, explicit)
+	s.RenderPage(w, r, http.StatusOK, "votd.html", "Verse of the day", page)
+}
+
+type VerseOfTheDayInfo struct {
+	Date        string      `json:"date"`
+	Reference   string      `json:"reference"`
+	Translation Translation `json:"translation"`
+	Verse       Verse       `json:"verse"`
+}
+
+func (s *Server) NewVerseOfTheDayInfo(ctx context.Context, translation string, date time.Time) (VerseOfTheDayInfo, error) {
+	var book Book
+	var verse_info VerseInfo
+	var verse Verse
+	err := s.VerseOfTheDay(ctx, translation, date, &book, &verse_info, &verse)
+	if err != nil {
+		return VerseOfTheDayInfo{}, err
+	}
+	return VerseOfTheDayInfo{
+		Date:        date.Format(time.DateOnly),
+		Reference:   fmt.Sprintf("%s %d:%d", book.Name, verse.Chapter, verse.Verse),
+		Translation: verse_info.Translation,
+		Verse:       verse,
+	}, nil
+}
+
+func (s *Server) apiVerseOfTheDay(w http.ResponseWriter, r *http.Request) {
+	date, explicit, ok := votdDate(r)
+	if !ok {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Status: http.StatusBadRequest, Error: "date must look like 2024-01-01"})
+		return
+	}
+
+	info, err := s.NewVerseOfTheDayInfo(r.Context(), RequestTranslation(r), date)
+	if err != nil {
+		apiError(w, r, err)
+		return
+	}
+	votdCacheControl(w, date, explicit)
+	WriteJSON(w, http.StatusOK, info)
+}
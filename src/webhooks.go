@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// max_webhooks caps how many webhooks can be registered at once.
+	max_webhooks = 1000
+	// max_webhook_failures is how many days in a row a webhook can fail
+	// before it's disabled.
+	max_webhook_failures = 5
+	// webhook_retries is how many times one delivery is retried.
+	webhook_retries     = 3
+	webhook_body_size   = 4 << 10
+	max_webhook_secret  = 256
+	max_webhook_url     = 2048
+	webhook_workers     = 4
+	webhook_signature   = "X-Webhook-Signature"
+	webhook_event       = "X-Webhook-Event"
+	webhook_event_votd  = "votd"
+	webhook_event_check = "challenge"
+)
+
+var ErrPrivateAddress = errors.New("webhooks can't be sent to private addresses")
+
+// dialPublic stops webhooks from reaching loopback, private or link-local
+// addresses. It runs after DNS resolution, so a public name that resolves
+// to an internal address is caught too.
+func dialPublic(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, ip)
+	}
+	return nil
+}
+
+// webhook_client only connects to public addresses, and doesn't follow
+// redirects, which could lead anywhere.
+var webhook_client = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext:           (&net.Dialer{Timeout: 5 * time.Second, Control: dialPublic}).DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+		MaxIdleConnsPerHost:   1,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// WebhookRequest is the body of POST /api/v1/webhooks. With a Secret,
+// every delivery is signed with it.
+type WebhookRequest struct {
+	URL         string `json:"url"`
+	Secret      string `json:"secret,omitempty"`
+	Translation string `json:"translation,omitempty"`
+}
+
+// Webhook is a registered webhook. Its ID is the only way to delete it, so
+// it's only shown once, when it's registered.
+type Webhook struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Translation string    `json:"translation"`
+	Created     time.Time `json:"created"`
+}
+
+// webhookTarget is a webhook as the dispatcher needs it.
+type webhookTarget struct {
+	Webhook
+	Secret string
+}
+
+// WebhookEvent is what a webhook is sent. A challenge asks for Challenge
+// to be echoed back as {"challenge": "..."}, proving the URL expects
+// webhooks.
+type WebhookEvent struct {
+	Event     string             `json:"event"`
+	Challenge string             `json:"challenge,omitempty"`
+	Data      *VerseOfTheDayInfo `json:"data,omitempty"`
+}
+
+// WebhookSignature is the X-Webhook-Signature of body: "sha256=" and the
+// hex HMAC-SHA256 of it keyed with the webhook's secret.
+func WebhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// postWebhookOnce makes a single delivery, returning the response body and
+// how long a 429 or 503 asked to be left alone for.
+func postWebhookOnce(ctx context.Context, target string, secret string, event string, body []byte) ([]byte, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhook_event, event)
+	if secret != "" {
+		req.Header.Set(webhook_signature, WebhookSignature(secret, body))
+	}
+	res, err := webhook_client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+	answer, _ := io.ReadAll(io.LimitReader(res.Body, webhook_body_size))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, retryAfter(res.Header), fmt.Errorf("%s answered %s", req.URL.Host, res.Status)
+	}
+	return answer, 0, nil
+}
+
+// deliverWebhook sends event to a webhook, retrying with backoff.
+func deliverWebhook(ctx context.Context, target webhookTarget, body []byte) error {
+	for attempt := 1; ; attempt++ {
+		_, wait, err := postWebhookOnce(ctx, target.URL, target.Secret, webhook_event_votd, body)
+		if err == nil || attempt > webhook_retries || errors.Is(err, ErrPrivateAddress) {
+			return err
+		}
+		if wait == 0 {
+			wait = backoff(attempt)
+		}
+		timer := time.NewTimer(min(wait, time.Minute))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// verifyWebhook sends a challenge to a URL being registered and checks it
+// comes back.
+func verifyWebhook(ctx context.Context, request WebhookRequest) error {
+	challenge := RandomToken(16)
+	body, _ := json.Marshal(WebhookEvent{Event: webhook_event_check, Challenge: challenge})
+	answer, _, err := postWebhookOnce(ctx, request.URL, request.Secret, webhook_event_check, body)
+	if err != nil {
+		return err
+	}
+	var echo struct {
+		Challenge string `json:"challenge"`
+	}
+	if json.Unmarshal(answer, &echo) != nil || echo.Challenge != challenge {
+		return errors.New(`the URL didn't answer the challenge with {"challenge": "..."}`)
+	}
+	return nil
+}
+
+// parseWebhookURL accepts absolute http and https URLs with a host name
+// or address.
+func parseWebhookURL(value string) (string, error) {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || len(value) > max_webhook_url {
+		return "", errors.New("url must be an absolute http or https URL")
+	}
+	u.Fragment = ""
+	return u.String(), nil
+}
+
+// apiAddWebhook serves POST /api/v1/webhooks, registering a URL to be sent
+// the verse of the day once it has answered a challenge.
+func (s *Server) apiAddWebhook(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, webhook_body_size)
+	var request WebhookRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Status: http.StatusBadRequest, Error: `The body should be JSON like {"url": "https://example.com/hook", "secret": "..."}.`})
+		return
+	}
+	request.URL, err = parseWebhookURL(request.URL)
+	if err == nil && len(request.Secret) > max_webhook_secret {
+		err = fmt.Errorf("secret can be up to %d bytes", max_webhook_secret)
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Status: http.StatusBadRequest, Error: err.Error()})
+		return
+	}
+	request.Translation = strings.ToLower(request.Translation)
+	if request.Translation == "" {
+		request.Translation = RequestTranslation(r)
+	}
+	if !s.Translations.Has(r.Context(), request.Translation) {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Status: http.StatusBadRequest, Error: fmt.Sprintf("%q isn't a translation", request.Translation)})
+		return
+	}
+
+	count, err := s.Store.CountWebhooks(r.Context())
+	if err == nil && count >= max_webhooks {
+		WriteJSON(w, http.StatusServiceUnavailable, ErrorResponse{Status: http.StatusServiceUnavailable, Error: "No more webhooks can be registered right now."})
+		return
+	}
+	err = verifyWebhook(r.Context(), request)
+	if err != nil {
+		message := "The URL didn't answer the challenge: " + err.Error()
+		if errors.Is(err, ErrPrivateAddress) {
+			message = "The URL has to be reachable on the public internet."
+		}
+		WriteJSON(w, http.StatusUnprocessableEntity, ErrorResponse{Status: http.StatusUnprocessableEntity, Error: message})
+		return
+	}
+
+	webhook := Webhook{ID: RandomToken(16), URL: request.URL, Translation: request.Translation, Created: time.Now().UTC().Truncate(time.Second)}
+	err = s.Store.AddWebhook(r.Context(), webhook, request.Secret)
+	if err != nil {
+		Logger(r.Context()).Error("adding webhook", "err", err)
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Status: http.StatusInternalServerError, Error: "The webhook couldn't be saved. Please try again."})
+		return
+	}
+	w.Header().Set("Location", SitePath("api", current_api_version, "webhooks", webhook.ID))
+	WriteJSON(w, http.StatusCreated, webhook)
+}
+
+// apiDeleteWebhook serves DELETE /api/v1/webhooks/{id}.
+func (s *Server) apiDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	err := s.Store.RemoveWebhook(r.Context(), mux.Vars(r)["id"])
+	if errors.Is(err, errStoreMiss) {
+		WriteJSON(w, http.StatusNotFound, ErrorResponse{Status: http.StatusNotFound, Error: "There's no webhook with that ID."})
+		return
+	}
+	if err != nil {
+		Logger(r.Context()).Error("removing webhook", "err", err)
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Status: http.StatusInternalServerError, Error: "The webhook couldn't be deleted. Please try again."})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DispatchWebhooks sends the verse of the day to every webhook each time
+// the date changes, until ctx is done.
+func (s *Server) DispatchWebhooks(ctx context.Context, hub *VotdHub) {
+	events := hub.Subscribe()
+	if events == nil {
+		return
+	}
+	defer hub.Unsubscribe(events)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case date, ok := <-events:
+			if !ok {
+				return
+			}
+			s.SendWebhooks(ctx, date)
+		}
+	}
+}
+
+// SendWebhooks delivers the verse for date to every enabled webhook, a few
+// at a time. A webhook that still fails after its retries counts a
+// failure, and is disabled after max_webhook_failures in a row.
+func (s *Server) SendWebhooks(ctx context.Context, date time.Time) {
+	targets, err := s.Store.LoadWebhooks(ctx)
+	if err != nil {
+		Logger(ctx).Error("loading webhooks", "err", err)
+		return
+	}
+	bodies := map[string][]byte{}
+	for _, target := range targets {
+		if _, ok := bodies[target.Translation]; ok {
+			continue
+		}
+		info, err := s.NewVerseOfTheDayInfo(ctx, target.Translation, date)
+		if err != nil {
+			Logger(ctx).Error("loading verse of the day for webhooks", "translation", target.Translation, "err", err)
+			continue
+		}
+		bodies[target.Translation], _ = json.Marshal(WebhookEvent{Event: webhook_event_votd, Data: &info})
+	}
+
+	var g errgroup.Group
+	g.SetLimit(webhook_workers)
+	for _, target := range targets {
+		body, ok := bodies[target.Translation]
+		if !ok {
+			continue
+		}
+		g.Go(func() error {
+			err := deliverWebhook(ctx, target, body)
+			if err != nil {
+				Logger(ctx).Warn("webhook delivery failed", "webhook", target.ID, "err", err)
+			}
+			disabled, store_err := s.Store.RecordWebhookDelivery(ctx, target.ID, err == nil, max_webhook_failures)
+			if store_err != nil {
+				Logger(ctx).Error("recording webhook delivery", "webhook", target.ID, "err", store_err)
+			}
+			if disabled {
+				Logger(ctx).Warn("disabled webhook", "webhook", target.ID, "failures", max_webhook_failures)
+			}
+			return nil
+		})
+	}
+	g.Wait()
+	Logger(ctx).Info("sent verse of the day to webhooks", "date", date.Format(time.DateOnly), "webhooks", len(targets))
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDialPublic(t *testing.T) {
+	tests := []struct {
+		address string
+		ok      bool
+	}{
+		{"93.184.215.14:443", true},
+		{"8.8.8.8:53", true},
+		{"[2606:2800:21f:cb07:6820:80da:af6b:8b2c]:443", true},
+		{"127.0.0.1:80", false},
+		{"127.8.9.10:80", false},
+		{"10.0.0.1:80", false},
+		{"172.16.5.4:80", false},
+		{"172.31.255.255:80", false},
+		{"192.168.1.1:80", false},
+		{"169.254.169.254:80", false},
+		{"0.0.0.0:80", false},
+		{"224.0.0.1:80", false},
+		{"255.255.255.255:80", false},
+		{"[::1]:80", false},
+		{"[::]:80", false},
+		{"[fe80::1]:80", false},
+		{"[fd00::1]:80", false},
+		{"[ff02::1]:80", false},
+		{"[::ffff:127.0.0.1]:80", false},
+		{"[::ffff:10.1.2.3]:80", false},
+		{"[::ffff:8.8.8.8]:53", true},
+		{"localhost:80", false},
+		{"8.8.8.8", false},
+	}
+	for _, test := range tests {
+		t.Run(test.address, func(t *testing.T) {
+			err := dialPublic("tcp", test.address, nil)
+			if test.ok && err != nil {
+				t.Errorf("dialPublic(%s): %v", test.address, err)
+			}
+			if !test.ok && err == nil {
+				t.Errorf("dialPublic(%s) allowed it", test.address)
+			}
+		})
+	}
+}
+
+// The webhook client won't reach a server on this machine, whether it's
+// named by address or by a host name that resolves to it.
+func TestWebhookClientPrivate(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	t.Cleanup(server.Close)
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	for _, target := range []string{server.URL, "http://localhost:" + port + "/hook"} {
+		_, _, err := postWebhookOnce(context.Background(), target, "", webhook_event_votd, []byte("{}"))
+		if !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("posting to %s: %v, want ErrPrivateAddress", target, err)
+		}
+	}
+	// nor is a private address retried
+	err := deliverWebhook(context.Background(), webhookTarget{Webhook: Webhook{URL: server.URL}}, []byte("{}"))
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("deliverWebhook: %v, want ErrPrivateAddress", err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("the server got %d requests", n)
+	}
+}
+
+// The transport itself refuses private addresses, and redirects aren't
+// followed, since they could point anywhere.
+func TestWebhookClientTransport(t *testing.T) {
+	response, err := webhook_client.Transport.(*http.Transport).Clone().RoundTrip(httptest.NewRequest(http.MethodGet, "http://127.0.0.1:1/", nil))
+	if err == nil {
+		response.Body.Close()
+		t.Fatal("the transport reached 127.0.0.1")
+	}
+	if webhook_client.CheckRedirect(nil, nil) != http.ErrUseLastResponse {
+		t.Errorf("CheckRedirect follows redirects")
+	}
+}
+
+func TestParseWebhookURL(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"https://example.com/hook", "https://example.com/hook"},
+		{"http://example.com:8080/hook?a=b", "http://example.com:8080/hook?a=b"},
+		{"https://example.com/hook#top", "https://example.com/hook"},
+		{"https://93.184.215.14/hook", "https://93.184.215.14/hook"},
+		{"ftp://example.com/hook", ""},
+		{"example.com/hook", ""},
+		{"https:///hook", ""},
+		{"https://example.com/" + strings.Repeat("a", max_webhook_url), ""},
+		{"", ""},
+		{"http://[::1", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := parseWebhookURL(test.value)
+			if test.want == "" && err == nil {
+				t.Errorf("parseWebhookURL(%q) = %q, want an error", test.value, got)
+			}
+			if test.want != "" && (err != nil || got != test.want) {
+				t.Errorf("parseWebhookURL(%q) = %q, %v, want %q", test.value, got, err, test.want)
+			}
+		})
+	}
+}
+
+// allowLoopbackWebhooks lets webhooks reach test servers until the test
+// ends.
+func allowLoopbackWebhooks(t *testing.T) {
+	t.Helper()
+	saved := webhook_client
+	webhook_client = &http.Client{
+		Timeout:       saved.Timeout,
+		CheckRedirect: saved.CheckRedirect,
+	}
+	t.Cleanup(func() { webhook_client = saved })
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	allowLoopbackWebhooks(t)
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int
+		ok       bool
+	}{
+		{"delivered", []int{200}, 1, true},
+		{"no content", []int{204}, 1, true},
+		{"retried", []int{503, 500, 200}, 3, true},
+		{"gives up", []int{503, 503, 503, 503, 200}, 4, false},
+		{"redirect isn't followed", []int{302, 302, 302, 302}, 4, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests atomic.Int32
+			body := []byte(`{"event":"votd"}`)
+			hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := requests.Add(1)
+				got, _ := io.ReadAll(r.Body)
+				if r.Header.Get(webhook_signature) != WebhookSignature("secret", got) || r.Header.Get(webhook_event) != webhook_event_votd {
+					t.Errorf("headers %v for %s", r.Header, got)
+				}
+				w.Header().Set("Retry-After", "0")
+				w.Header().Set("Location", "/elsewhere")
+				w.WriteHeader(test.statuses[n-1])
+			}))
+			t.Cleanup(hook.Close)
+			err := deliverWebhook(context.Background(), webhookTarget{Webhook: Webhook{URL: hook.URL}, Secret: "secret"}, body)
+			if (err == nil) != test.ok {
+				t.Errorf("deliverWebhook: %v", err)
+			}
+			if n := int(requests.Load()); n != test.requests {
+				t.Errorf("%d requests, want %d", n, test.requests)
+			}
+		})
+	}
+}
+
+// webhookTestServer is the site with a store, so the webhook API is
+// routed.
+func webhookTestServer(t *testing.T) *Server {
+	t.Helper()
+	store, err := OpenStore(filepath.Join(t.TempDir(), "bible.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	bible := NewBibleClient(fakeUpstream(t).URL)
+	bible.Retries = 0
+	return NewServer(bible, store)
+}
+
+func postJSON(handler http.Handler, target string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestAPIAddWebhook(t *testing.T) {
+	handler := webhookTestServer(t).Routes(false, false)
+	private := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("a private address was reached")
+	}))
+	t.Cleanup(private.Close)
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		error  string
+	}{
+		{"not JSON", `https://example.com/hook`, http.StatusBadRequest, `The body should be JSON like {"url": "https://example.com/hook", "secret": "..."}.`},
+		{"bad URL", `{"url": "example.com/hook"}`, http.StatusBadRequest, "url must be an absolute http or https URL"},
+		{"long secret", `{"url": "https://example.com/hook", "secret": "` + strings.Repeat("s", max_webhook_secret+1) + `"}`, http.StatusBadRequest, "secret can be up to 256 bytes"},
+		{"unknown translation", `{"url": "https://example.com/hook", "translation": "xyz"}`, http.StatusBadRequest, `"xyz" isn't a translation`},
+		{"private address", `{"url": "` + private.URL + `/hook"}`, http.StatusUnprocessableEntity, "The URL has to be reachable on the public internet."},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := postJSON(handler, "/api/v1/webhooks", test.body)
+			var response ErrorResponse
+			json.Unmarshal(w.Body.Bytes(), &response)
+			if w.Code != test.status || response.Error != test.error {
+				t.Errorf("%d %q, want %d %q", w.Code, response.Error, test.status, test.error)
+			}
+		})
+	}
+}
+
+// A webhook that answers its challenge is registered, sent the verse of
+// the day signed with its secret, and can be deleted.
+func TestWebhookLifecycle(t *testing.T) {
+	allowLoopbackWebhooks(t)
+	s := webhookTestServer(t)
+	handler := s.Routes(false, false)
+
+	var mu sync.Mutex
+	var events []WebhookEvent
+	var echo atomic.Bool
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(webhook_signature) != WebhookSignature("secret", body) {
+			t.Errorf("signature %q for %s", r.Header.Get(webhook_signature), body)
+		}
+		var event WebhookEvent
+		json.Unmarshal(body, &event)
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+		if event.Event == webhook_event_check && echo.Load() {
+			json.NewEncoder(w).Encode(map[string]string{"challenge": event.Challenge})
+		}
+	}))
+	t.Cleanup(hook.Close)
+
+	if w := postJSON(handler, "/api/v1/webhooks", `{"url": "`+hook.URL+`", "secret": "secret"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("unanswered challenge: status %d: %s", w.Code, w.Body)
+	}
+	echo.Store(true)
+	w := postJSON(handler, "/api/v1/webhooks", `{"url": "`+hook.URL+`", "secret": "secret", "translation": "WEB"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var webhook Webhook
+	json.Unmarshal(w.Body.Bytes(), &webhook)
+	if webhook.ID == "" || webhook.URL != hook.URL || webhook.Translation != "web" || w.Header().Get("Location") != "/api/v1/webhooks/"+webhook.ID {
+		t.Errorf("registered %+v at %q", webhook, w.Header().Get("Location"))
+	}
+
+	// the verse of the day is John 3:16, which the upstream has
+	date := time.Date(2026, 3, 12, 0, 0, 0, 0, time.UTC)
+	s.SendWebhooks(context.Background(), date)
+	mu.Lock()
+	last := events[len(events)-1]
+	mu.Unlock()
+	if last.Event != webhook_event_votd || last.Data == nil || last.Data.Date != "2026-03-12" || !strings.HasPrefix(last.Data.Verse.Text, "For God so loved") {
+		t.Errorf("sent %+v", last)
+	}
+
+	for _, status := range []int{http.StatusNoContent, http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/webhooks/"+webhook.ID, nil))
+		if w.Code != status {
+			t.Errorf("DELETE: status %d, want %d", w.Code, status)
+		}
+	}
+	mu.Lock()
+	sent := len(events)
+	mu.Unlock()
+	s.SendWebhooks(context.Background(), date.AddDate(0, 0, 1))
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != sent {
+		t.Errorf("a deleted webhook was sent an event")
+	}
+}
+
+// A webhook that keeps failing is disabled after max_webhook_failures
+// days in a row, and one that works starts counting again.
+func TestRecordWebhookDelivery(t *testing.T) {
+	s := webhookTestServer(t)
+	ctx := context.Background()
+	err := s.Store.AddWebhook(ctx, Webhook{ID: "a", URL: "https://example.com/hook", Translation: "web", Created: time.Now()}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ok       bool
+		disabled bool
+	}{
+		{false, false},
+		{false, false},
+		{true, false},
+		{false, false},
+		{false, false},
+		{false, false},
+		{false, false},
+		{false, true},
+	}
+	for i, test := range tests {
+		disabled, err := s.Store.RecordWebhookDelivery(ctx, "a", test.ok, max_webhook_failures)
+		if err != nil || disabled != test.disabled {
+			t.Fatalf("delivery %d: disabled %t, %v, want %t", i+1, disabled, err, test.disabled)
+		}
+	}
+	targets, err := s.Store.LoadWebhooks(ctx)
+	if err != nil || len(targets) != 0 {
+		t.Errorf("webhooks %+v, %v, want the disabled one left out", targets, err)
+	}
+}